@@ -788,6 +788,15 @@ func FromAPIGatewayProxyRequest2HttpRequest(from *events.APIGatewayProxyRequest)
 	return
 }
 
+// isTextMimeType reports whether a body of mimeType is returned as is rather than base64-encoded:
+// text/*, JSON and XML, including structured syntax suffixes like application/problem+json or image/svg+xml.
+func isTextMimeType(mimeType string) bool {
+	mediaType := strings.ToLower(strings.TrimSpace(strings.Split(mimeType, ";")[0]))
+
+	return strings.HasPrefix(mediaType, "text/") || mediaType == "application/json" ||
+		strings.HasSuffix(mediaType, "+json") || strings.HasSuffix(mediaType, "+xml")
+}
+
 func FromHttpResponse2APIGatewayProxyResponse(res *http.Response) (to *events.APIGatewayProxyResponse, err error) {
 	to = &events.APIGatewayProxyResponse{
 		StatusCode: res.StatusCode,
@@ -814,7 +823,7 @@ func FromHttpResponse2APIGatewayProxyResponse(res *http.Response) (to *events.AP
 
 	if res.Body != nil {
 		if responseBody, readErr := io.ReadAll(res.Body); readErr == nil {
-			if strings.HasPrefix(mimeType, "text/") || strings.HasPrefix(mimeType, "application/json") || strings.HasPrefix(mimeType, "image/svg+xml") {
+			if isTextMimeType(mimeType) {
 				to.IsBase64Encoded = false
 				to.Body = string(responseBody)
 			} else {
@@ -909,7 +918,7 @@ func FromHttpResponse2APIGatewayV2HTTPResponse(res *http.Response) (to *events.A
 
 	if res.Body != nil {
 		if responseBody, readErr := io.ReadAll(res.Body); readErr == nil {
-			if strings.HasPrefix(mimeType, "text/") || strings.HasPrefix(mimeType, "application/json") || strings.HasPrefix(mimeType, "image/svg+xml") {
+			if isTextMimeType(mimeType) {
 				to.IsBase64Encoded = false
 				to.Body = string(responseBody)
 			} else {
@@ -997,7 +1006,7 @@ func FromHttpResponse2LambdaFunctionURLResponse(res *http.Response) (to *events.
 
 	if res.Body != nil {
 		if responseBody, readErr := io.ReadAll(res.Body); readErr == nil {
-			if strings.HasPrefix(mimeType, "text/") || strings.HasPrefix(mimeType, "application/json") || strings.HasPrefix(mimeType, "image/svg+xml") {
+			if isTextMimeType(mimeType) {
 				to.IsBase64Encoded = false
 				to.Body = string(responseBody)
 			} else {
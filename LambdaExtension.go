@@ -0,0 +1,338 @@
+package awssdkhelper
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"os/signal"
+	"strings"
+	"sync"
+	"syscall"
+	"time"
+
+	ThcompUtility "github.com/thcomp/GoLang_Utility"
+)
+
+type LambdaExtensionType int
+
+const (
+	LambdaExtensionExternal LambdaExtensionType = iota
+	LambdaExtensionInternal
+)
+
+type LambdaExtensionEventType string
+
+const (
+	LambdaExtensionInvoke   LambdaExtensionEventType = "INVOKE"
+	LambdaExtensionShutdown LambdaExtensionEventType = "SHUTDOWN"
+)
+
+const lambdaExtensionAPIVersion = "2020-01-01"
+const lambdaExtensionNameHeader = "Lambda-Extension-Name"
+const lambdaExtensionIdentifierHeader = "Lambda-Extension-Identifier"
+const lambdaExtensionErrorTypeHeader = "Lambda-Extension-Function-Error-Type"
+
+type LambdaExtensionTracing struct {
+	Type  string `json:"type"`
+	Value string `json:"value"`
+}
+
+type LambdaExtensionEvent struct {
+	EventType          LambdaExtensionEventType `json:"eventType"`
+	DeadlineMs         int64                    `json:"deadlineMs"`
+	RequestID          string                   `json:"requestId,omitempty"`
+	InvokedFunctionArn string                   `json:"invokedFunctionArn,omitempty"`
+	ShutdownReason     string                   `json:"shutdownReason,omitempty"`
+	Tracing            *LambdaExtensionTracing  `json:"tracing,omitempty"`
+}
+
+func (event *LambdaExtensionEvent) Deadline() time.Time {
+	return time.UnixMilli(event.DeadlineMs)
+}
+
+type LambdaExtensionRegistration struct {
+	FunctionName    string `json:"functionName"`
+	FunctionVersion string `json:"functionVersion"`
+	Handler         string `json:"handler"`
+	AccountID       string `json:"accountId,omitempty"`
+}
+
+type LambdaExtensionEventHandler func(ctx context.Context, event *LambdaExtensionEvent) error
+
+// LambdaExtensionHelper registers an extension with the Lambda Extensions API and
+// delivers INVOKE / SHUTDOWN events to the registered callbacks.
+type LambdaExtensionHelper struct {
+	name          string
+	extensionType LambdaExtensionType
+	runtimeAPI    string
+	httpClient    *http.Client
+
+	extensionID  string
+	registration *LambdaExtensionRegistration
+
+	onInvoke   LambdaExtensionEventHandler
+	onShutdown LambdaExtensionEventHandler
+
+	shutdownOnce sync.Once
+	shutdownErr  error
+}
+
+// NewLambdaExtensionHelper creates a helper for the extension "name". The Extensions API address
+// is taken from AWS_LAMBDA_RUNTIME_API; use SetRuntimeAPI to point it at a local stand-in.
+func NewLambdaExtensionHelper(name string, extensionType LambdaExtensionType) (ret *LambdaExtensionHelper) {
+	ret = &LambdaExtensionHelper{
+		name:          name,
+		extensionType: extensionType,
+		runtimeAPI:    os.Getenv("AWS_LAMBDA_RUNTIME_API"),
+		// next event is a long poll, so the client must not time out
+		httpClient: &http.Client{},
+	}
+
+	return ret
+}
+
+func (helper *LambdaExtensionHelper) SetRuntimeAPI(runtimeAPI string) {
+	helper.runtimeAPI = runtimeAPI
+}
+
+func (helper *LambdaExtensionHelper) SetHttpClient(client *http.Client) {
+	helper.httpClient = client
+}
+
+func (helper *LambdaExtensionHelper) OnInvoke(handler LambdaExtensionEventHandler) {
+	helper.onInvoke = handler
+}
+
+func (helper *LambdaExtensionHelper) OnShutdown(handler LambdaExtensionEventHandler) {
+	helper.onShutdown = handler
+}
+
+func (helper *LambdaExtensionHelper) ExtensionID() string {
+	return helper.extensionID
+}
+
+func (helper *LambdaExtensionHelper) Registration() *LambdaExtensionRegistration {
+	return helper.registration
+}
+
+func (helper *LambdaExtensionHelper) endpoint(path string) (ret string, err error) {
+	if helper.runtimeAPI == "" {
+		err = fmt.Errorf("AWS_LAMBDA_RUNTIME_API is not set")
+	} else {
+		baseURL := helper.runtimeAPI
+		if !strings.HasPrefix(baseURL, "http://") && !strings.HasPrefix(baseURL, "https://") {
+			baseURL = "http://" + baseURL
+		}
+		ret = strings.TrimSuffix(baseURL, "/") + "/" + lambdaExtensionAPIVersion + "/extension/" + path
+	}
+
+	return
+}
+
+// Register registers the extension. Internal extensions cannot subscribe to SHUTDOWN,
+// so only INVOKE is requested for them and shutdown is detected from SIGTERM instead.
+func (helper *LambdaExtensionHelper) Register(ctx context.Context) (err error) {
+	eventTypes := []LambdaExtensionEventType{LambdaExtensionInvoke}
+	if helper.extensionType == LambdaExtensionExternal {
+		eventTypes = append(eventTypes, LambdaExtensionShutdown)
+	}
+
+	if registerURL, urlErr := helper.endpoint("register"); urlErr == nil {
+		body, _ := json.Marshal(map[string]interface{}{"events": eventTypes})
+		if req, reqErr := http.NewRequestWithContext(ctx, http.MethodPost, registerURL, bytes.NewReader(body)); reqErr == nil {
+			req.Header.Set(lambdaExtensionNameHeader, helper.name)
+			req.Header.Set("Content-Type", "application/json")
+
+			if res, doErr := helper.httpClient.Do(req); doErr == nil {
+				defer res.Body.Close()
+
+				if res.StatusCode == http.StatusOK {
+					helper.extensionID = res.Header.Get(lambdaExtensionIdentifierHeader)
+					registration := &LambdaExtensionRegistration{}
+					if decodeErr := json.NewDecoder(res.Body).Decode(registration); decodeErr == nil || decodeErr == io.EOF {
+						helper.registration = registration
+					} else {
+						err = decodeErr
+					}
+
+					if err == nil && helper.extensionID == "" {
+						err = fmt.Errorf("%s header is missing in register response", lambdaExtensionIdentifierHeader)
+					}
+				} else {
+					err = lambdaExtensionStatusError("register", res)
+				}
+			} else {
+				err = doErr
+			}
+		} else {
+			err = reqErr
+		}
+	} else {
+		err = urlErr
+	}
+
+	return
+}
+
+// NextEvent blocks until the Extensions API delivers the next event.
+func (helper *LambdaExtensionHelper) NextEvent(ctx context.Context) (event *LambdaExtensionEvent, err error) {
+	if helper.extensionID == "" {
+		return nil, fmt.Errorf("extension %s is not registered", helper.name)
+	}
+
+	if nextURL, urlErr := helper.endpoint("event/next"); urlErr == nil {
+		if req, reqErr := http.NewRequestWithContext(ctx, http.MethodGet, nextURL, nil); reqErr == nil {
+			req.Header.Set(lambdaExtensionIdentifierHeader, helper.extensionID)
+
+			if res, doErr := helper.httpClient.Do(req); doErr == nil {
+				defer res.Body.Close()
+
+				if res.StatusCode == http.StatusOK {
+					event = &LambdaExtensionEvent{}
+					if decodeErr := json.NewDecoder(res.Body).Decode(event); decodeErr != nil {
+						event = nil
+						err = decodeErr
+					}
+				} else {
+					err = lambdaExtensionStatusError("event/next", res)
+				}
+			} else {
+				err = doErr
+			}
+		} else {
+			err = reqErr
+		}
+	} else {
+		err = urlErr
+	}
+
+	return
+}
+
+func (helper *LambdaExtensionHelper) InitError(ctx context.Context, errorType string, cause error) error {
+	return helper.reportError(ctx, "init/error", errorType, cause)
+}
+
+func (helper *LambdaExtensionHelper) ExitError(ctx context.Context, errorType string, cause error) error {
+	return helper.reportError(ctx, "exit/error", errorType, cause)
+}
+
+func (helper *LambdaExtensionHelper) reportError(ctx context.Context, path, errorType string, cause error) (err error) {
+	if reportURL, urlErr := helper.endpoint(path); urlErr == nil {
+		body, _ := json.Marshal(map[string]interface{}{
+			"errorMessage": fmt.Sprint(cause),
+			"errorType":    errorType,
+		})
+		if req, reqErr := http.NewRequestWithContext(ctx, http.MethodPost, reportURL, bytes.NewReader(body)); reqErr == nil {
+			req.Header.Set(lambdaExtensionIdentifierHeader, helper.extensionID)
+			req.Header.Set(lambdaExtensionErrorTypeHeader, errorType)
+			req.Header.Set("Content-Type", "application/json")
+
+			if res, doErr := helper.httpClient.Do(req); doErr == nil {
+				defer res.Body.Close()
+
+				if res.StatusCode != http.StatusAccepted && res.StatusCode != http.StatusOK {
+					err = lambdaExtensionStatusError(path, res)
+				}
+			} else {
+				err = doErr
+			}
+		} else {
+			err = reqErr
+		}
+	} else {
+		err = urlErr
+	}
+
+	return
+}
+
+// Run registers the extension when needed and dispatches events until SHUTDOWN is received
+// or ctx is cancelled. The error returned by the shutdown callback is returned from Run.
+func (helper *LambdaExtensionHelper) Run(ctx context.Context) (err error) {
+	if helper.extensionID == "" {
+		if err = helper.Register(ctx); err != nil {
+			return
+		}
+	}
+
+	for {
+		event, nextErr := helper.NextEvent(ctx)
+		if nextErr != nil {
+			if ctx.Err() != nil {
+				return ctx.Err()
+			}
+			return nextErr
+		}
+
+		switch event.EventType {
+		case LambdaExtensionInvoke:
+			if helper.onInvoke != nil {
+				if invokeErr := helper.onInvoke(ctx, event); invokeErr != nil {
+					ThcompUtility.LogfE("extension %s: invoke %s: %v", helper.name, event.RequestID, invokeErr)
+				}
+			}
+		case LambdaExtensionShutdown:
+			return helper.shutdown(ctx, event)
+		default:
+			ThcompUtility.LogfW("extension %s: unknown event type: %s", helper.name, event.EventType)
+		}
+	}
+}
+
+// Start registers the extension synchronously and dispatches events in the background.
+// Internal extensions must call Start before the runtime starts polling for invocations.
+func (helper *LambdaExtensionHelper) Start(ctx context.Context) (err error) {
+	if err = helper.Register(ctx); err == nil {
+		if helper.extensionType == LambdaExtensionInternal {
+			signalCh := make(chan os.Signal, 1)
+			signal.Notify(signalCh, syscall.SIGTERM)
+			go func() {
+				select {
+				case <-signalCh:
+					signal.Stop(signalCh)
+					helper.shutdown(ctx, &LambdaExtensionEvent{
+						EventType:      LambdaExtensionShutdown,
+						ShutdownReason: "SIGTERM",
+					})
+				case <-ctx.Done():
+					// stopped without a SIGTERM, the handler is no longer needed
+					signal.Stop(signalCh)
+				}
+			}()
+		}
+
+		go func() {
+			if runErr := helper.Run(ctx); runErr != nil && ctx.Err() == nil {
+				ThcompUtility.LogfE("extension %s: %v", helper.name, runErr)
+			}
+		}()
+	}
+
+	return
+}
+
+func (helper *LambdaExtensionHelper) shutdown(ctx context.Context, event *LambdaExtensionEvent) error {
+	helper.shutdownOnce.Do(func() {
+		if helper.onShutdown != nil {
+			shutdownCtx := ctx
+			if event.DeadlineMs > 0 {
+				var cancel context.CancelFunc
+				shutdownCtx, cancel = context.WithDeadline(ctx, event.Deadline())
+				defer cancel()
+			}
+			helper.shutdownErr = helper.onShutdown(shutdownCtx, event)
+		}
+	})
+
+	return helper.shutdownErr
+}
+
+func lambdaExtensionStatusError(path string, res *http.Response) error {
+	body, _ := io.ReadAll(io.LimitReader(res.Body, 4096))
+	return fmt.Errorf("extension %s failed: %d: %s", path, res.StatusCode, strings.TrimSpace(string(body)))
+}
@@ -0,0 +1,116 @@
+package awssdkhelper
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	TestUtility "github.com/thcomp/GoLang_TestUtility"
+)
+
+type fakeExtensionsAPI struct {
+	mutex          sync.Mutex
+	registeredName string
+	registeredFor  []string
+	events         []LambdaExtensionEvent
+	reportedErrors []string
+}
+
+func (api *fakeExtensionsAPI) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	api.mutex.Lock()
+	defer api.mutex.Unlock()
+
+	switch {
+	case r.Method == http.MethodPost && r.URL.Path == "/2020-01-01/extension/register":
+		body := map[string][]string{}
+		json.NewDecoder(r.Body).Decode(&body)
+		api.registeredName = r.Header.Get("Lambda-Extension-Name")
+		api.registeredFor = body["events"]
+		w.Header().Set("Lambda-Extension-Identifier", "test-extension-id")
+		json.NewEncoder(w).Encode(LambdaExtensionRegistration{FunctionName: "test-function", FunctionVersion: "$LATEST", Handler: "bootstrap"})
+	case r.Method == http.MethodGet && r.URL.Path == "/2020-01-01/extension/event/next":
+		if r.Header.Get("Lambda-Extension-Identifier") != "test-extension-id" || len(api.events) == 0 {
+			w.WriteHeader(http.StatusForbidden)
+			return
+		}
+		event := api.events[0]
+		api.events = api.events[1:]
+		json.NewEncoder(w).Encode(event)
+	case r.Method == http.MethodPost && strings.HasSuffix(r.URL.Path, "/error"):
+		api.reportedErrors = append(api.reportedErrors, r.Header.Get("Lambda-Extension-Function-Error-Type"))
+		w.WriteHeader(http.StatusAccepted)
+	default:
+		w.WriteHeader(http.StatusNotFound)
+	}
+}
+
+func TestLambdaExtensionHelper_Run(t *testing.T) {
+	tester := TestUtility.NewTestHelper(t)
+	deadline := time.Now().Add(time.Second).UnixMilli()
+	api := &fakeExtensionsAPI{
+		events: []LambdaExtensionEvent{
+			{EventType: LambdaExtensionInvoke, RequestID: "request-1", DeadlineMs: deadline},
+			{EventType: LambdaExtensionInvoke, RequestID: "request-2", DeadlineMs: deadline},
+			{EventType: LambdaExtensionShutdown, ShutdownReason: "spindown", DeadlineMs: deadline},
+		},
+	}
+	server := httptest.NewServer(api)
+	defer server.Close()
+
+	helper := NewLambdaExtensionHelper("metrics-flusher", LambdaExtensionExternal)
+	helper.SetRuntimeAPI(strings.TrimPrefix(server.URL, "http://"))
+
+	invoked := []string{}
+	shutdownReason := ""
+	helper.OnInvoke(func(ctx context.Context, event *LambdaExtensionEvent) error {
+		invoked = append(invoked, event.RequestID)
+		return nil
+	})
+	helper.OnShutdown(func(ctx context.Context, event *LambdaExtensionEvent) error {
+		shutdownReason = event.ShutdownReason
+		_, hasDeadline := ctx.Deadline()
+		tester.Errorf(hasDeadline, "shutdown context has no deadline")
+		return nil
+	})
+
+	err := helper.Run(context.Background())
+	tester.Fatalf(err == nil, "Run error: %v", err)
+	tester.Errorf(api.registeredName == "metrics-flusher", "registered name: %s", api.registeredName)
+	tester.Errorf(len(api.registeredFor) == 2, "registered events: %v", api.registeredFor)
+	tester.Errorf(helper.ExtensionID() == "test-extension-id", "extension id: %s", helper.ExtensionID())
+	tester.Errorf(helper.Registration() != nil && helper.Registration().FunctionName == "test-function", "registration: %v", helper.Registration())
+	tester.Errorf(len(invoked) == 2 && invoked[0] == "request-1" && invoked[1] == "request-2", "invoked: %v", invoked)
+	tester.Errorf(shutdownReason == "spindown", "shutdown reason: %s", shutdownReason)
+}
+
+func TestLambdaExtensionHelper_Internal(t *testing.T) {
+	tester := TestUtility.NewTestHelper(t)
+	api := &fakeExtensionsAPI{}
+	server := httptest.NewServer(api)
+	defer server.Close()
+
+	helper := NewLambdaExtensionHelper("internal-ext", LambdaExtensionInternal)
+	helper.SetRuntimeAPI(server.URL)
+
+	err := helper.Register(context.Background())
+	tester.Fatalf(err == nil, "Register error: %v", err)
+	tester.Errorf(len(api.registeredFor) == 1 && api.registeredFor[0] == "INVOKE", "registered events: %v", api.registeredFor)
+
+	err = helper.InitError(context.Background(), "Extension.ConfigInvalid", nil)
+	tester.Errorf(err == nil, "InitError error: %v", err)
+	tester.Errorf(len(api.reportedErrors) == 1 && api.reportedErrors[0] == "Extension.ConfigInvalid", "reported errors: %v", api.reportedErrors)
+}
+
+func TestLambdaExtensionHelper_NoRuntimeAPI(t *testing.T) {
+	tester := TestUtility.NewTestHelper(t)
+	helper := NewLambdaExtensionHelper("ext", LambdaExtensionExternal)
+	helper.SetRuntimeAPI("")
+
+	err := helper.Run(context.Background())
+	tester.Errorf(err != nil, "Run must fail without AWS_LAMBDA_RUNTIME_API")
+}
@@ -0,0 +1,403 @@
+package awssdkhelper
+
+import (
+	"bytes"
+	"context"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"path"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/aws/aws-lambda-go/lambdacontext"
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/s3"
+	"github.com/rs/xid"
+
+	ThcompUtility "github.com/thcomp/GoLang_Utility"
+)
+
+const RedactedValue = "[REDACTED]"
+
+type LambdaEventHandler1 func(ctx context.Context, event interface{}) error
+type LambdaEventHandler2 func(ctx context.Context, event interface{}) (interface{}, error)
+
+type RecordedLambdaEvent struct {
+	RecordedAt   time.Time              `json:"recordedAt"`
+	RequestID    string                 `json:"requestId,omitempty"`
+	FunctionName string                 `json:"functionName,omitempty"`
+	EventType    LambdaEventType        `json:"eventType"`
+	Event        map[string]interface{} `json:"event"`
+}
+
+type LambdaEventRecordSink interface {
+	WriteEvent(ctx context.Context, name string, data []byte) error
+}
+
+// LambdaEventRecorder is an opt-in middleware that stores every raw event after redaction.
+type LambdaEventRecorder struct {
+	sink          LambdaEventRecordSink
+	enabled       bool
+	redactHeaders map[string]bool
+	redactFields  [][]string
+}
+
+func NewLambdaEventRecorder(sink LambdaEventRecordSink) *LambdaEventRecorder {
+	return &LambdaEventRecorder{
+		sink:    sink,
+		enabled: true,
+		redactHeaders: map[string]bool{
+			"authorization":        true,
+			"cookie":               true,
+			"x-amz-security-token": true,
+		},
+	}
+}
+
+func (recorder *LambdaEventRecorder) SetEnabled(enabled bool) {
+	recorder.enabled = enabled
+}
+
+// RedactHeaders adds header names (case-insensitive) whose values are replaced in headers and multiValueHeaders.
+func (recorder *LambdaEventRecorder) RedactHeaders(names ...string) {
+	for _, name := range names {
+		recorder.redactHeaders[strings.ToLower(name)] = true
+	}
+}
+
+// RedactFields adds dotted paths in the raw event to redact, e.g. "requestContext.identity.sourceIp".
+// "*" matches every element of an array or map, and string values holding JSON (such as "body")
+// are descended into, e.g. "body.password" or "Records.*.body.card.number". Bodies of HTTP events with
+// isBase64Encoded set are decoded for that.
+func (recorder *LambdaEventRecorder) RedactFields(paths ...string) {
+	for _, fieldPath := range paths {
+		recorder.redactFields = append(recorder.redactFields, strings.Split(fieldPath, "."))
+	}
+}
+
+func (recorder *LambdaEventRecorder) Record(ctx context.Context, event interface{}) (err error) {
+	if !recorder.enabled {
+		return
+	}
+
+	recorded := &RecordedLambdaEvent{
+		RecordedAt:   time.Now().UTC(),
+		FunctionName: lambdacontext.FunctionName,
+	}
+	if lambdaCtx, ok := lambdacontext.FromContext(ctx); ok {
+		recorded.RequestID = lambdaCtx.AwsRequestID
+	}
+
+	if helper, helperErr := NewLambdaEventHelper(event); helperErr == nil {
+		recorded.EventType = helper.EventType()
+	}
+
+	if recorded.Event, err = recorder.redact(event); err == nil {
+		if data, marshalErr := json.MarshalIndent(recorded, "", "  "); marshalErr == nil {
+			id := recorded.RequestID
+			if id == "" {
+				id = xid.New().String()
+			}
+			name := path.Join(
+				recorded.RecordedAt.Format("2006/01/02"),
+				recorded.RecordedAt.Format("150405.000000000")+"-"+id+".json",
+			)
+			err = recorder.sink.WriteEvent(ctx, name, data)
+		} else {
+			err = marshalErr
+		}
+	}
+
+	return
+}
+
+func (recorder *LambdaEventRecorder) redact(event interface{}) (ret map[string]interface{}, err error) {
+	// work on a copy so that the handler still receives the original event
+	if data, marshalErr := json.Marshal(event); marshalErr == nil {
+		ret = map[string]interface{}{}
+		if err = decodeLambdaEventJSON(data, &ret); err != nil {
+			return nil, err
+		}
+	} else {
+		return nil, marshalErr
+	}
+
+	for _, headersKey := range []string{"headers", "multiValueHeaders"} {
+		if headers, ok := ret[headersKey].(map[string]interface{}); ok {
+			for name, value := range headers {
+				if recorder.redactHeaders[strings.ToLower(name)] {
+					if values, isArray := value.([]interface{}); isArray {
+						for index := range values {
+							values[index] = RedactedValue
+						}
+					} else {
+						headers[name] = RedactedValue
+					}
+				}
+			}
+		}
+	}
+	// API Gateway v2 and function URL events carry the Cookie header as a separate array
+	if cookies, isArray := ret["cookies"].([]interface{}); isArray && recorder.redactHeaders["cookie"] {
+		for index := range cookies {
+			cookies[index] = RedactedValue
+		}
+	}
+
+	for _, fieldPath := range recorder.redactFields {
+		redactLambdaEventField(ret, fieldPath)
+	}
+
+	return
+}
+
+// decodeLambdaEventJSON decodes data keeping numbers as json.Number, so that integers above 2^53 (IDs, amounts)
+// are recorded unchanged. Content after the first JSON value fails like with json.Unmarshal.
+func decodeLambdaEventJSON(data []byte, value interface{}) (err error) {
+	decoder := json.NewDecoder(bytes.NewReader(data))
+	decoder.UseNumber()
+	if err = decoder.Decode(value); err == nil {
+		if _, tokenErr := decoder.Token(); tokenErr != io.EOF {
+			err = fmt.Errorf("invalid content after the JSON value")
+		}
+	}
+
+	return
+}
+
+// redactLambdaEventField returns value with fieldPath redacted, and whether the path matched anything.
+func redactLambdaEventField(value interface{}, fieldPath []string) (ret interface{}, matched bool) {
+	if len(fieldPath) == 0 {
+		return RedactedValue, true
+	}
+
+	ret = value
+	switch v := value.(type) {
+	case map[string]interface{}:
+		if fieldPath[0] == "*" {
+			for key := range v {
+				matched = redactLambdaEventMember(v, key, fieldPath[1:]) || matched
+			}
+		} else if _, exist := v[fieldPath[0]]; exist {
+			matched = redactLambdaEventMember(v, fieldPath[0], fieldPath[1:])
+		}
+	case []interface{}:
+		if fieldPath[0] == "*" {
+			for index, child := range v {
+				childMatched := false
+				v[index], childMatched = redactLambdaEventField(child, fieldPath[1:])
+				matched = childMatched || matched
+			}
+		} else if index, err := strconv.Atoi(fieldPath[0]); err == nil && index >= 0 && index < len(v) {
+			v[index], matched = redactLambdaEventField(v[index], fieldPath[1:])
+		}
+	case string:
+		// JSON encoded in a string, e.g. body of HTTP events or SQS messages. It is only encoded again when
+		// something was redacted, so untouched bodies are recorded byte for byte.
+		var decoded interface{}
+		if err := decodeLambdaEventJSON([]byte(v), &decoded); err == nil {
+			switch decoded.(type) {
+			case map[string]interface{}, []interface{}:
+				if redacted, redactedMatched := redactLambdaEventField(decoded, fieldPath); redactedMatched {
+					if data, err := json.Marshal(redacted); err == nil {
+						ret, matched = string(data), true
+					}
+				}
+			}
+		}
+	}
+
+	return
+}
+
+// redactLambdaEventMember redacts fieldPath in the member key of event, and returns whether it matched.
+// The body of HTTP events with isBase64Encoded set is decoded before, and encoded again after.
+func redactLambdaEventMember(event map[string]interface{}, key string, fieldPath []string) (matched bool) {
+	if encoded, isString := event[key].(string); isString && len(fieldPath) > 0 && event["isBase64Encoded"] == true {
+		if decoded, err := base64.StdEncoding.DecodeString(encoded); err == nil {
+			if redacted, redactedMatched := redactLambdaEventField(string(decoded), fieldPath); redactedMatched {
+				if redactedString, isString := redacted.(string); isString {
+					event[key], matched = base64.StdEncoding.EncodeToString([]byte(redactedString)), true
+				}
+			}
+		}
+		return
+	}
+
+	event[key], matched = redactLambdaEventField(event[key], fieldPath)
+
+	return
+}
+
+// Wrap1 records the event before calling handler. Recording failures are logged and never fail the invocation.
+func (recorder *LambdaEventRecorder) Wrap1(handler LambdaEventHandler1) LambdaEventHandler1 {
+	return func(ctx context.Context, event interface{}) error {
+		if err := recorder.Record(ctx, event); err != nil {
+			ThcompUtility.LogfW("record event: %v", err)
+		}
+		return handler(ctx, event)
+	}
+}
+
+func (recorder *LambdaEventRecorder) Wrap2(handler LambdaEventHandler2) LambdaEventHandler2 {
+	return func(ctx context.Context, event interface{}) (interface{}, error) {
+		if err := recorder.Record(ctx, event); err != nil {
+			ThcompUtility.LogfW("record event: %v", err)
+		}
+		return handler(ctx, event)
+	}
+}
+
+type S3LambdaEventRecordSink struct {
+	helper *S3Helper
+	prefix string
+}
+
+func NewS3LambdaEventRecordSink(helper *S3Helper, prefix string) *S3LambdaEventRecordSink {
+	return &S3LambdaEventRecordSink{
+		helper: helper,
+		prefix: prefix,
+	}
+}
+
+func (sink *S3LambdaEventRecordSink) WriteEvent(ctx context.Context, name string, data []byte) error {
+	return sink.helper.PutDataWithContext(ctx, path.Join(sink.prefix, name), data)
+}
+
+type LocalLambdaEventRecordSink struct {
+	dir string
+}
+
+func NewLocalLambdaEventRecordSink(dir string) *LocalLambdaEventRecordSink {
+	return &LocalLambdaEventRecordSink{
+		dir: dir,
+	}
+}
+
+func (sink *LocalLambdaEventRecordSink) WriteEvent(ctx context.Context, name string, data []byte) (err error) {
+	filePath := filepath.Join(sink.dir, filepath.FromSlash(name))
+	if err = os.MkdirAll(filepath.Dir(filePath), 0o755); err == nil {
+		err = os.WriteFile(filePath, data, 0o600)
+	}
+
+	return
+}
+
+func LoadRecordedLambdaEvent(reader io.Reader) (ret *RecordedLambdaEvent, err error) {
+	ret = &RecordedLambdaEvent{}
+	if err = json.NewDecoder(reader).Decode(ret); err != nil {
+		ret = nil
+	} else if ret.Event == nil {
+		ret, err = nil, fmt.Errorf("recorded event has no event")
+	}
+
+	return
+}
+
+// LoadRecordedLambdaEventsFromDir loads every *.json record under dir in recording order.
+func LoadRecordedLambdaEventsFromDir(dir string) (ret []*RecordedLambdaEvent, err error) {
+	filePaths := []string{}
+	err = filepath.WalkDir(dir, func(filePath string, entry os.DirEntry, walkErr error) error {
+		if walkErr == nil && !entry.IsDir() && strings.HasSuffix(filePath, ".json") {
+			filePaths = append(filePaths, filePath)
+		}
+		return walkErr
+	})
+	sort.Strings(filePaths)
+
+	for _, filePath := range filePaths {
+		if err != nil {
+			break
+		}
+
+		if data, readErr := os.ReadFile(filePath); readErr == nil {
+			if recorded, loadErr := LoadRecordedLambdaEvent(bytes.NewReader(data)); loadErr == nil {
+				ret = append(ret, recorded)
+			} else {
+				err = fmt.Errorf("%s: %w", filePath, loadErr)
+			}
+		} else {
+			err = readErr
+		}
+	}
+
+	return
+}
+
+// LoadRecordedLambdaEventsFromS3 loads every *.json record under prefix in recording order.
+func LoadRecordedLambdaEventsFromS3(ctx context.Context, helper *S3Helper, prefix string) (ret []*RecordedLambdaEvent, err error) {
+	if !strings.HasSuffix(prefix, "/") && prefix != "" {
+		prefix += "/"
+	}
+
+	items := [](*S3Item){}
+	paginator := s3.NewListObjectsV2Paginator(helper.client, &s3.ListObjectsV2Input{
+		Bucket: aws.String(helper.bucket),
+		Prefix: aws.String(prefix),
+	})
+	for paginator.HasMorePages() {
+		output, listErr := paginator.NextPage(ctx)
+		if listErr != nil {
+			return nil, listErr
+		}
+		for _, content := range output.Contents {
+			items = append(items, &S3Item{
+				Path:         aws.ToString(content.Key),
+				size:         content.Size,
+				lastModified: content.LastModified,
+				helper:       helper,
+				ctx:          ctx,
+			})
+		}
+	}
+	sort.Slice(items, func(i, j int) bool { return items[i].Path < items[j].Path })
+
+	for _, item := range items {
+		if !strings.HasSuffix(item.Path, ".json") {
+			continue
+		}
+
+		recorded, loadErr := LoadRecordedLambdaEvent(item)
+		item.Close()
+		if loadErr != nil {
+			return nil, fmt.Errorf("%s: %w", item.Path, loadErr)
+		}
+		ret = append(ret, recorded)
+	}
+
+	return
+}
+
+// ReplayLambdaEvent feeds a recorded event back through handler with a Lambda context
+// carrying the recorded request ID.
+func ReplayLambdaEvent(ctx context.Context, recorded *RecordedLambdaEvent, handler LambdaEventHandler2) (interface{}, error) {
+	requestID := recorded.RequestID
+	if requestID == "" {
+		requestID = "replay-" + xid.New().String()
+	}
+	ctx = lambdacontext.NewContext(ctx, &lambdacontext.LambdaContext{AwsRequestID: requestID})
+
+	return handler(ctx, recorded.Event)
+}
+
+type ReplayResult struct {
+	Recorded *RecordedLambdaEvent
+	Output   interface{}
+	Err      error
+}
+
+// ReplayLambdaEvents replays every recorded event in order and collects the outputs.
+func ReplayLambdaEvents(ctx context.Context, recordedEvents []*RecordedLambdaEvent, handler LambdaEventHandler2) (results []*ReplayResult) {
+	for _, recorded := range recordedEvents {
+		output, err := ReplayLambdaEvent(ctx, recorded, handler)
+		results = append(results, &ReplayResult{Recorded: recorded, Output: output, Err: err})
+	}
+
+	return
+}
@@ -0,0 +1,136 @@
+package awssdkhelper
+
+import (
+	"context"
+	"encoding/base64"
+	"encoding/json"
+	"strings"
+	"testing"
+
+	"github.com/aws/aws-lambda-go/events"
+	"github.com/aws/aws-lambda-go/lambdacontext"
+	TestUtility "github.com/thcomp/GoLang_TestUtility"
+)
+
+const testRecorderEvent = `{
+	"httpMethod": "POST",
+	"path": "/login",
+	"headers": {"Authorization": "Bearer secret", "X-Api-Key": "key", "Accept": "application/json"},
+	"multiValueHeaders": {"X-Api-Key": ["key"]},
+	"body": "{\"user\":\"alice\",\"password\":\"p@ss\",\"amount\":9007199254740993}",
+	"requestContext": {"httpMethod": "POST", "identity": {"sourceIp": "192.0.2.1"}}
+}`
+
+func TestLambdaEventRecorder_LocalRecordAndReplay(t *testing.T) {
+	tester := TestUtility.NewTestHelper(t)
+	dir := t.TempDir()
+
+	recorder := NewLambdaEventRecorder(NewLocalLambdaEventRecordSink(dir))
+	recorder.RedactHeaders("X-Api-Key")
+	recorder.RedactFields("body.password", "requestContext.identity.sourceIp")
+
+	event := map[string]interface{}{}
+	json.Unmarshal([]byte(testRecorderEvent), &event)
+
+	handled := 0
+	handler := recorder.Wrap2(func(ctx context.Context, event interface{}) (interface{}, error) {
+		handled++
+		headers := event.(map[string]interface{})["headers"].(map[string]interface{})
+		return headers["Authorization"], nil
+	})
+
+	ctx := lambdacontext.NewContext(context.Background(), &lambdacontext.LambdaContext{AwsRequestID: "request-1"})
+	output, err := handler(ctx, event)
+	tester.Fatalf(err == nil, "handler error: %v", err)
+	tester.Errorf(output == "Bearer secret", "handler received a redacted event: %v", output)
+
+	// v2 events carry cookies in their own array. A body without redacted fields is recorded as is,
+	// large integers included.
+	v2Body := `{"id": 12345678901234567891, "note": "kept"}`
+	v2Event := &events.APIGatewayV2HTTPRequest{
+		Version:        "2.0",
+		RawPath:        "/orders",
+		Cookies:        []string{"session=secret", "theme=dark"},
+		Headers:        map[string]string{"content-type": "application/json"},
+		Body:           v2Body,
+		RequestContext: events.APIGatewayV2HTTPRequestContext{HTTP: events.APIGatewayV2HTTPRequestContextHTTPDescription{Method: "POST"}},
+	}
+	ctx2 := lambdacontext.NewContext(context.Background(), &lambdacontext.LambdaContext{AwsRequestID: "request-2"})
+	err = recorder.Record(ctx2, v2Event)
+	tester.Fatalf(err == nil, "Record error: %v", err)
+	tester.Errorf(v2Event.Cookies[0] == "session=secret", "the event itself was redacted: %v", v2Event.Cookies)
+
+	recordedEvents, err := LoadRecordedLambdaEventsFromDir(dir)
+	tester.Fatalf(err == nil && len(recordedEvents) == 2, "LoadRecordedLambdaEventsFromDir: %v, %v", recordedEvents, err)
+
+	recordedV2 := recordedEvents[1]
+	cookies, _ := recordedV2.Event["cookies"].([]interface{})
+	tester.Errorf(len(cookies) == 2 && cookies[0] == RedactedValue && cookies[1] == RedactedValue, "cookies: %v", cookies)
+	tester.Errorf(recordedV2.Event["body"] == v2Body, "untouched body is re-encoded: %v", recordedV2.Event["body"])
+
+	recorded := recordedEvents[0]
+	tester.Errorf(recorded.RequestID == "request-1" && recorded.EventType == APIGateway, "recorded: %v", recorded)
+	headers := recorded.Event["headers"].(map[string]interface{})
+	tester.Errorf(headers["Authorization"] == RedactedValue && headers["X-Api-Key"] == RedactedValue && headers["Accept"] == "application/json", "headers: %v", headers)
+	multiValueHeaders := recorded.Event["multiValueHeaders"].(map[string]interface{})
+	tester.Errorf(multiValueHeaders["X-Api-Key"].([]interface{})[0] == RedactedValue, "multiValueHeaders: %v", multiValueHeaders)
+	body := recorded.Event["body"].(string)
+	tester.Errorf(strings.Contains(body, `"user":"alice"`) && strings.Contains(body, `"password":"[REDACTED]"`) && strings.Contains(body, `"amount":9007199254740993`), "body: %s", body)
+	identity := recorded.Event["requestContext"].(map[string]interface{})["identity"].(map[string]interface{})
+	tester.Errorf(identity["sourceIp"] == RedactedValue, "sourceIp: %v", identity["sourceIp"])
+
+	results := ReplayLambdaEvents(context.Background(), recordedEvents, func(ctx context.Context, event interface{}) (interface{}, error) {
+		lambdaCtx, _ := lambdacontext.FromContext(ctx)
+		return lambdaCtx.AwsRequestID, nil
+	})
+	tester.Errorf(len(results) == 2 && results[0].Err == nil && results[0].Output == "request-1" && results[1].Output == "request-2", "replay: %v", results)
+}
+
+func TestLambdaEventRecorder_RedactBase64Body(t *testing.T) {
+	tester := TestUtility.NewTestHelper(t)
+	dir := t.TempDir()
+
+	recorder := NewLambdaEventRecorder(NewLocalLambdaEventRecordSink(dir))
+	recorder.RedactFields("body.password")
+
+	encodedBody := base64.StdEncoding.EncodeToString([]byte(`{"user":"alice","password":"p@ss"}`))
+	event := map[string]interface{}{
+		"httpMethod":      "POST",
+		"body":            encodedBody,
+		"isBase64Encoded": true,
+	}
+	err := recorder.Record(context.Background(), event)
+	tester.Fatalf(err == nil, "Record: %v", err)
+
+	recordedEvents, err := LoadRecordedLambdaEventsFromDir(dir)
+	tester.Fatalf(err == nil && len(recordedEvents) == 1, "LoadRecordedLambdaEventsFromDir: %v, %v", recordedEvents, err)
+	recorded := recordedEvents[0].Event
+	body, err := base64.StdEncoding.DecodeString(recorded["body"].(string))
+	tester.Errorf(err == nil && recorded["isBase64Encoded"] == true, "recorded body is not base64-encoded: %v, %v", recorded, err)
+	tester.Errorf(strings.Contains(string(body), `"user":"alice"`) && strings.Contains(string(body), `"password":"[REDACTED]"`), "body: %s", body)
+	tester.Errorf(event["body"] == encodedBody, "the event itself was redacted: %v", event)
+}
+
+func TestLambdaEventRecorder_S3(t *testing.T) {
+	tester := TestUtility.NewTestHelper(t)
+	fake := newFakeS3Server(t, "records-bucket")
+	helper := fake.helper()
+
+	recorder := NewLambdaEventRecorder(NewS3LambdaEventRecordSink(helper, "recorded"))
+	recorder.RedactFields("Records.*.body.token")
+
+	event := map[string]interface{}{}
+	json.Unmarshal([]byte(`{"Records":[{"messageId":"1","body":"{\"token\":\"t\"}"},{"messageId":"2","body":"plain"}]}`), &event)
+	err := recorder.Record(context.Background(), event)
+	tester.Fatalf(err == nil, "Record error: %v", err)
+
+	recorder.SetEnabled(false)
+	recorder.Record(context.Background(), event)
+
+	recordedEvents, err := LoadRecordedLambdaEventsFromS3(context.Background(), helper, "recorded")
+	tester.Fatalf(err == nil && len(recordedEvents) == 1, "LoadRecordedLambdaEventsFromS3: %v, %v", recordedEvents, err)
+	records := recordedEvents[0].Event["Records"].([]interface{})
+	tester.Errorf(records[0].(map[string]interface{})["body"] == `{"token":"[REDACTED]"}`, "records[0]: %v", records[0])
+	tester.Errorf(records[1].(map[string]interface{})["body"] == "plain", "records[1]: %v", records[1])
+	tester.Errorf(recordedEvents[0].EventType == SQSEvent, "event type: %v", recordedEvents[0].EventType)
+}
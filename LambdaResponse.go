@@ -0,0 +1,167 @@
+package awssdkhelper
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"mime"
+	"net/http"
+	"path"
+	"strconv"
+
+	ThcompUtility "github.com/thcomp/GoLang_Utility"
+)
+
+// MapOfResponse converts response into the response shape of the event type
+// (API Gateway REST / websocket, API Gateway HTTP API or Lambda function URL).
+func (helper *LambdaEventHelper) MapOfResponse(response *http.Response) (ret map[string]interface{}, retErr error) {
+	switch helper.eventType {
+	case APIGateway, APIGatewayWebsocket:
+		ret, retErr = helper.MapOfAPIGatewayProxyResponse(response)
+	case APIGatewayV2:
+		ret, retErr = helper.MapOfAPIGatewayV2HTTPResponse(response)
+	case LambdaFunctionURL:
+		ret, retErr = helper.MapOfLambdaFunctionURLResponse(response)
+	default:
+		retErr = fmt.Errorf("event type %d has no HTTP response format", helper.eventType)
+	}
+
+	return
+}
+
+func newHttpResponse(statusCode int, contentType string, body []byte) *http.Response {
+	response := &http.Response{
+		StatusCode:    statusCode,
+		Status:        strconv.Itoa(statusCode) + " " + http.StatusText(statusCode),
+		Header:        http.Header{},
+		Body:          io.NopCloser(bytes.NewReader(body)),
+		ContentLength: int64(len(body)),
+	}
+	if contentType != "" {
+		response.Header.Set("Content-Type", contentType)
+	}
+
+	return response
+}
+
+func NewJSONResponse(statusCode int, value interface{}) (ret *http.Response, err error) {
+	if data, marshalErr := json.Marshal(value); marshalErr == nil {
+		ret = newHttpResponse(statusCode, "application/json; charset=utf-8", data)
+	} else {
+		err = marshalErr
+	}
+
+	return
+}
+
+func NewTextResponse(statusCode int, text string) *http.Response {
+	return newHttpResponse(statusCode, "text/plain; charset=utf-8", []byte(text))
+}
+
+func NewHTMLResponse(statusCode int, html string) *http.Response {
+	return newHttpResponse(statusCode, "text/html; charset=utf-8", []byte(html))
+}
+
+// NewRedirectResponse creates a redirect to location. statusCode defaults to 302 when it is not a 3xx code.
+func NewRedirectResponse(statusCode int, location string) *http.Response {
+	if statusCode < 300 || statusCode > 399 {
+		statusCode = http.StatusFound
+	}
+
+	response := newHttpResponse(statusCode, "", nil)
+	response.Header.Set("Location", location)
+	return response
+}
+
+func NewNoContentResponse() *http.Response {
+	return newHttpResponse(http.StatusNoContent, "", nil)
+}
+
+func NewBinaryResponse(statusCode int, contentType string, data []byte) *http.Response {
+	if contentType == "" {
+		contentType = "application/octet-stream"
+	}
+
+	return newHttpResponse(statusCode, contentType, data)
+}
+
+// NewFileResponse creates a download response for body. A negative size means the length is unknown.
+// When attachment is true, Content-Disposition asks browsers to save the file as filename.
+func NewFileResponse(filename, contentType string, body io.Reader, size int64, attachment bool) *http.Response {
+	if contentType == "" {
+		contentType = ThcompUtility.GetMIMETypeFromExtension(filename)
+	}
+
+	readCloser, ok := body.(io.ReadCloser)
+	if !ok {
+		readCloser = io.NopCloser(body)
+	}
+
+	response := &http.Response{
+		StatusCode:    http.StatusOK,
+		Status:        "200 OK",
+		Header:        http.Header{},
+		Body:          readCloser,
+		ContentLength: size,
+	}
+	response.Header.Set("Content-Type", contentType)
+	if size >= 0 {
+		response.Header.Set("Content-Length", strconv.FormatInt(size, 10))
+	}
+	if filename != "" {
+		disposition := "inline"
+		if attachment {
+			disposition = "attachment"
+		}
+		response.Header.Set("Content-Disposition", mime.FormatMediaType(disposition, map[string]string{"filename": path.Base(filename)}))
+	}
+
+	return response
+}
+
+// NewS3ItemResponse streams the object body of item as the response body.
+func NewS3ItemResponse(item *S3Item, attachment bool) (ret *http.Response, err error) {
+	if _, readerErr := item.Reader(); readerErr == nil {
+		size, sizeErr := item.Size()
+		if sizeErr != nil {
+			size = -1
+		}
+
+		ret = NewFileResponse(item.Path, "", item, size, attachment)
+		if lastModified, lastModifiedErr := item.LastModified(); lastModifiedErr == nil {
+			ret.Header.Set("Last-Modified", lastModified.UTC().Format(http.TimeFormat))
+		}
+	} else {
+		err = readerErr
+	}
+
+	return
+}
+
+// NewProblemResponse creates an RFC 9457 application/problem+json response.
+// extensions are added as extra members of the problem document.
+func NewProblemResponse(statusCode int, title, detail string, extensions map[string]interface{}) *http.Response {
+	problem := map[string]interface{}{}
+	for key, value := range extensions {
+		problem[key] = value
+	}
+	if _, exist := problem["type"]; !exist {
+		problem["type"] = "about:blank"
+	}
+	if title == "" {
+		title = http.StatusText(statusCode)
+	}
+	problem["title"] = title
+	problem["status"] = statusCode
+	if detail != "" {
+		problem["detail"] = detail
+	}
+
+	data, err := json.Marshal(problem)
+	if err != nil {
+		data, _ = json.Marshal(map[string]interface{}{"type": "about:blank", "title": title, "status": statusCode})
+	}
+
+	return newHttpResponse(statusCode, "application/problem+json", data)
+}
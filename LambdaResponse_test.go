@@ -0,0 +1,81 @@
+package awssdkhelper
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"net/http"
+	"strings"
+	"testing"
+
+	TestUtility "github.com/thcomp/GoLang_TestUtility"
+)
+
+func newTestLambdaEventHelper(t *testing.T, eventJson string) *LambdaEventHelper {
+	eventMap := map[string]interface{}{}
+	if err := json.Unmarshal([]byte(eventJson), &eventMap); err != nil {
+		t.Fatalf("Unmarshal error: %v", err)
+	}
+
+	helper, err := NewLambdaEventHelper(eventMap)
+	if err != nil {
+		t.Fatalf("NewLambdaEventHelper error: %v", err)
+	}
+
+	return helper
+}
+
+func TestLambdaEventHelper_MapOfResponse(t *testing.T) {
+	tester := TestUtility.NewTestHelper(t)
+	eventJsons := map[string]string{
+		"APIGateway":        `{"httpMethod":"GET","path":"/","requestContext":{"httpMethod":"GET"}}`,
+		"APIGatewayV2":      `{"rawPath":"/","requestContext":{"routeKey":"GET /","http":{"method":"GET","path":"/"}}}`,
+		"LambdaFunctionURL": `{"rawPath":"/","requestContext":{"http":{"method":"GET","path":"/"}}}`,
+	}
+
+	for name, eventJson := range eventJsons {
+		helper := newTestLambdaEventHelper(t, eventJson)
+
+		response, _ := NewJSONResponse(http.StatusCreated, map[string]string{"id": "1"})
+		ret, err := helper.MapOfResponse(response)
+		tester.Fatalf(err == nil, "%s: MapOfResponse error: %v", name, err)
+		tester.Errorf(ret["statusCode"] == http.StatusCreated, "%s: status code: %v", name, ret["statusCode"])
+		tester.Errorf(ret["body"] == `{"id":"1"}` && ret["isBase64Encoded"] == false, "%s: body: %v", name, ret["body"])
+
+		ret, err = helper.MapOfResponse(NewNoContentResponse())
+		tester.Errorf(err == nil && ret["statusCode"] == http.StatusNoContent && ret["body"] == "", "%s: no content: %v, %v", name, ret, err)
+
+		ret, err = helper.MapOfResponse(NewBinaryResponse(http.StatusOK, "image/png", []byte{0x89, 0x50}))
+		tester.Errorf(err == nil && ret["isBase64Encoded"] == true && ret["body"] == base64.StdEncoding.EncodeToString([]byte{0x89, 0x50}), "%s: binary: %v, %v", name, ret, err)
+	}
+
+	snsHelper := newTestLambdaEventHelper(t, `{"Records":[{"Sns":{"Message":"x"}}]}`)
+	_, err := snsHelper.MapOfResponse(NewNoContentResponse())
+	tester.Errorf(err != nil, "SNS event must not produce an HTTP response")
+}
+
+func TestHttpResponseHelpers(t *testing.T) {
+	tester := TestUtility.NewTestHelper(t)
+
+	redirect, err := FromHttpResponse2APIGatewayV2HTTPResponse(NewRedirectResponse(0, "https://example.com/next"))
+	tester.Fatalf(err == nil, "redirect error: %v", err)
+	tester.Errorf(redirect.StatusCode == http.StatusFound && redirect.Headers["Location"] == "https://example.com/next", "redirect: %v", redirect)
+
+	text, err := FromHttpResponse2LambdaFunctionURLResponse(NewTextResponse(http.StatusOK, "hello"))
+	tester.Errorf(err == nil && text.Body == "hello" && !text.IsBase64Encoded, "text: %v, %v", text, err)
+
+	problem, err := FromHttpResponse2APIGatewayProxyResponse(NewProblemResponse(http.StatusNotFound, "", "user 1 not found", map[string]interface{}{"instance": "/users/1"}))
+	tester.Fatalf(err == nil, "problem error: %v", err)
+	tester.Errorf(problem.Headers["Content-Type"] == "application/problem+json", "problem content type: %v", problem.Headers)
+	tester.Errorf(!problem.IsBase64Encoded, "problem body is base64-encoded: %s", problem.Body)
+	document := map[string]interface{}{}
+	json.Unmarshal([]byte(problem.Body), &document)
+	tester.Errorf(document["title"] == "Not Found" && document["status"] == float64(404) && document["instance"] == "/users/1", "problem: %v", document)
+	for mimeType, text := range map[string]bool{"application/vnd.api+json; charset=utf-8": true, "application/atom+xml": true, "image/svg+xml": true, "Text/Plain": true, "application/octet-stream": false, "image/png": false} {
+		tester.Errorf(isTextMimeType(mimeType) == text, "isTextMimeType(%s) != %v", mimeType, text)
+	}
+
+	file := NewFileResponse("reports/2024 report.csv", "", strings.NewReader("a,b\n1,2\n"), 8, true)
+	fileResponse, err := FromHttpResponse2APIGatewayProxyResponse(file)
+	tester.Errorf(err == nil && fileResponse.Headers["Content-Disposition"] == `attachment; filename="2024 report.csv"`, "file: %v, %v", fileResponse.Headers, err)
+	tester.Errorf(fileResponse.Headers["Content-Length"] == "8", "content length: %v", fileResponse.Headers)
+}
@@ -0,0 +1,421 @@
+package awssdkhelper
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"path"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/aws/aws-lambda-go/events"
+	"github.com/rs/xid"
+
+	ThcompUtility "github.com/thcomp/GoLang_Utility"
+)
+
+type ScheduledJobFunc func(ctx context.Context, event *events.EventBridgeEvent) error
+
+type ScheduledJobOptions struct {
+	// Timeout cancels the job context after the duration. Zero means no timeout besides the Lambda deadline.
+	Timeout time.Duration
+	// AllowOverlap skips the lock store, so runs of the same job may overlap.
+	AllowOverlap bool
+	// LockTTL is how long a lock is held before another run may take it over. Defaults to Timeout + 1 minute, or 15 minutes.
+	LockTTL time.Duration
+}
+
+type JobRunStatus string
+
+const (
+	JobRunSucceeded JobRunStatus = "succeeded"
+	JobRunFailed    JobRunStatus = "failed"
+	JobRunTimedOut  JobRunStatus = "timeout"
+	JobRunSkipped   JobRunStatus = "skipped"
+)
+
+type JobRunRecord struct {
+	JobName    string       `json:"jobName"`
+	Resource   string       `json:"resource"`
+	EventID    string       `json:"eventId"`
+	Status     JobRunStatus `json:"status"`
+	StartedAt  time.Time    `json:"startedAt"`
+	FinishedAt time.Time    `json:"finishedAt"`
+	Error      string       `json:"error,omitempty"`
+}
+
+type JobLockStore interface {
+	// Acquire returns false without error when another owner holds an unexpired lock.
+	Acquire(ctx context.Context, jobName, owner string, ttl time.Duration) (bool, error)
+	Release(ctx context.Context, jobName, owner string) error
+}
+
+type JobHistoryWriter interface {
+	WriteRun(ctx context.Context, record *JobRunRecord) error
+}
+
+type scheduledJob struct {
+	name    string
+	job     ScheduledJobFunc
+	options ScheduledJobOptions
+}
+
+// ScheduledJobRegistry maps EventBridge schedule names, rule names or their ARNs to jobs.
+type ScheduledJobRegistry struct {
+	jobs          map[string]*scheduledJob
+	lockStore     JobLockStore
+	historyWriter JobHistoryWriter
+}
+
+func NewScheduledJobRegistry() *ScheduledJobRegistry {
+	return &ScheduledJobRegistry{
+		jobs:      map[string]*scheduledJob{},
+		lockStore: NewMemoryJobLockStore(),
+	}
+}
+
+// Register adds job under nameOrArn, which is a rule or schedule name, "group/schedule" for
+// EventBridge Scheduler, or the full ARN found in the event's resources.
+func (registry *ScheduledJobRegistry) Register(nameOrArn string, job ScheduledJobFunc, options *ScheduledJobOptions) {
+	registered := &scheduledJob{
+		name: nameOrArn,
+		job:  job,
+	}
+	if options != nil {
+		registered.options = *options
+	}
+
+	registry.jobs[nameOrArn] = registered
+}
+
+func (registry *ScheduledJobRegistry) SetLockStore(lockStore JobLockStore) {
+	registry.lockStore = lockStore
+}
+
+func (registry *ScheduledJobRegistry) SetHistoryWriter(historyWriter JobHistoryWriter) {
+	registry.historyWriter = historyWriter
+}
+
+func (registry *ScheduledJobRegistry) findJob(resource string) (ret *scheduledJob) {
+	if job, exist := registry.jobs[resource]; exist {
+		return job
+	}
+
+	// arn:aws:events:region:account:rule/[bus/]rule-name
+	// arn:aws:scheduler:region:account:schedule/group-name/schedule-name
+	parts := strings.SplitN(resource, ":", 6)
+	if len(parts) == 6 {
+		resourcePath := parts[5]
+		if index := strings.Index(resourcePath, "/"); index >= 0 {
+			resourcePath = resourcePath[index+1:]
+		}
+
+		if job, exist := registry.jobs[resourcePath]; exist {
+			ret = job
+		} else if job, exist := registry.jobs[path.Base(resourcePath)]; exist {
+			ret = job
+		}
+	}
+
+	return
+}
+
+// Handle runs the jobs for a raw Lambda event. It can be passed to StartLambda1.
+func (registry *ScheduledJobRegistry) Handle(ctx context.Context, event interface{}) (err error) {
+	if helper, helperErr := NewLambdaEventHelper(event); helperErr == nil {
+		if eventBridgeEvent, eventErr := helper.EventBridgeEvent(); eventErr == nil && eventBridgeEvent != nil {
+			_, err = registry.HandleEventBridgeEvent(ctx, eventBridgeEvent)
+		} else if eventErr != nil {
+			err = eventErr
+		} else {
+			err = fmt.Errorf("event is not an EventBridge event: %d", helper.EventType())
+		}
+	} else {
+		err = helperErr
+	}
+
+	return
+}
+
+// HandleEventBridgeEvent runs every job matching the event's resources and returns their run records.
+// Skipped runs (another run holds the lock) are not treated as errors.
+func (registry *ScheduledJobRegistry) HandleEventBridgeEvent(ctx context.Context, event *events.EventBridgeEvent) (records []*JobRunRecord, err error) {
+	errs := []error{}
+	started := map[*scheduledJob]bool{}
+
+	for _, resource := range event.Resources {
+		if job := registry.findJob(resource); job != nil && !started[job] {
+			started[job] = true
+
+			record := registry.run(ctx, job, resource, event)
+			records = append(records, record)
+			if record.Status == JobRunFailed || record.Status == JobRunTimedOut {
+				errs = append(errs, fmt.Errorf("job %s: %s", job.name, record.Error))
+			}
+		}
+	}
+
+	if len(started) == 0 {
+		errs = append(errs, fmt.Errorf("no job registered for resources: %v", event.Resources))
+	}
+
+	err = errors.Join(errs...)
+	return
+}
+
+func (registry *ScheduledJobRegistry) run(ctx context.Context, job *scheduledJob, resource string, event *events.EventBridgeEvent) (record *JobRunRecord) {
+	record = &JobRunRecord{
+		JobName:   job.name,
+		Resource:  resource,
+		EventID:   event.ID,
+		StartedAt: time.Now(),
+	}
+
+	owner := xid.New().String()
+	release := func() {}
+	if !job.options.AllowOverlap && registry.lockStore != nil {
+		lockTTL := job.options.LockTTL
+		if lockTTL <= 0 {
+			lockTTL = 15 * time.Minute
+			if job.options.Timeout > 0 {
+				lockTTL = job.options.Timeout + time.Minute
+			}
+		}
+
+		if acquired, lockErr := registry.lockStore.Acquire(ctx, job.name, owner, lockTTL); lockErr != nil {
+			record.Status = JobRunFailed
+			record.Error = fmt.Sprintf("acquire lock: %v", lockErr)
+		} else if !acquired {
+			record.Status = JobRunSkipped
+			record.Error = "previous run is still in progress"
+		} else {
+			release = func() {
+				if releaseErr := registry.lockStore.Release(context.WithoutCancel(ctx), job.name, owner); releaseErr != nil {
+					ThcompUtility.LogfW("job %s: release lock: %v", job.name, releaseErr)
+				}
+			}
+		}
+	}
+
+	if record.Status == "" {
+		jobCtx, cancel := ctx, context.CancelFunc(func() {})
+		if job.options.Timeout > 0 {
+			jobCtx, cancel = context.WithTimeout(ctx, job.options.Timeout)
+		}
+
+		done := make(chan error, 1)
+		go func() {
+			defer func() {
+				if recovered := recover(); recovered != nil {
+					done <- fmt.Errorf("panic: %v", recovered)
+				}
+			}()
+			done <- job.job(jobCtx, event)
+		}()
+
+		select {
+		case jobErr := <-done:
+			release()
+			if jobErr == nil {
+				record.Status = JobRunSucceeded
+			} else if errors.Is(jobErr, context.DeadlineExceeded) && jobCtx.Err() != nil {
+				record.Status = JobRunTimedOut
+				record.Error = jobErr.Error()
+			} else {
+				record.Status = JobRunFailed
+				record.Error = jobErr.Error()
+			}
+		case <-jobCtx.Done():
+			record.Status = JobRunTimedOut
+			record.Error = jobCtx.Err().Error()
+			// a job ignoring its context still runs: the lock is kept until it returns, or until its TTL
+			// expires when the execution environment is frozen meanwhile
+			go func() {
+				<-done
+				release()
+			}()
+		}
+		cancel()
+	}
+	record.FinishedAt = time.Now()
+
+	if registry.historyWriter != nil {
+		if writeErr := registry.historyWriter.WriteRun(context.WithoutCancel(ctx), record); writeErr != nil {
+			ThcompUtility.LogfW("job %s: write run history: %v", job.name, writeErr)
+		}
+	}
+
+	return
+}
+
+type memoryJobLock struct {
+	owner     string
+	expiresAt time.Time
+}
+
+// MemoryJobLockStore protects against overlapping runs inside one execution environment.
+type MemoryJobLockStore struct {
+	mutex sync.Mutex
+	locks map[string]memoryJobLock
+}
+
+func NewMemoryJobLockStore() *MemoryJobLockStore {
+	return &MemoryJobLockStore{
+		locks: map[string]memoryJobLock{},
+	}
+}
+
+func (store *MemoryJobLockStore) Acquire(ctx context.Context, jobName, owner string, ttl time.Duration) (bool, error) {
+	store.mutex.Lock()
+	defer store.mutex.Unlock()
+
+	if lock, exist := store.locks[jobName]; exist && lock.owner != owner && time.Now().Before(lock.expiresAt) {
+		return false, nil
+	}
+
+	store.locks[jobName] = memoryJobLock{owner: owner, expiresAt: time.Now().Add(ttl)}
+	return true, nil
+}
+
+func (store *MemoryJobLockStore) Release(ctx context.Context, jobName, owner string) error {
+	store.mutex.Lock()
+	defer store.mutex.Unlock()
+
+	if lock, exist := store.locks[jobName]; exist && lock.owner == owner {
+		delete(store.locks, jobName)
+	}
+
+	return nil
+}
+
+type s3JobLock struct {
+	Owner     string    `json:"owner"`
+	ExpiresAt time.Time `json:"expiresAt"`
+}
+
+// S3JobLockStore keeps locks as objects under prefix and uses conditional writes,
+// so overlapping runs are detected across execution environments.
+type S3JobLockStore struct {
+	helper *S3Helper
+	prefix string
+}
+
+func NewS3JobLockStore(helper *S3Helper, prefix string) *S3JobLockStore {
+	return &S3JobLockStore{
+		helper: helper,
+		prefix: prefix,
+	}
+}
+
+func (store *S3JobLockStore) lockKey(jobName string) string {
+	return path.Join(store.prefix, jobName+".lock")
+}
+
+// s3JobLockAttempts bounds the retries of Acquire when the lock is released between its requests.
+const s3JobLockAttempts = 3
+
+func (store *S3JobLockStore) Acquire(ctx context.Context, jobName, owner string, ttl time.Duration) (acquired bool, err error) {
+	key := store.lockKey(jobName)
+	data, _ := json.Marshal(&s3JobLock{Owner: owner, ExpiresAt: time.Now().Add(ttl)})
+	// stored as is, so the lock reads back whatever SetCompression and SetDecompression of the helper are
+	putOptions := S3PutOptions{ContentType: "application/json", Compression: S3CompressionNone}
+
+	for attempt := 0; attempt < s3JobLockAttempts; attempt++ {
+		createOptions := putOptions
+		createOptions.IfNoneMatch = "*"
+		putErr := store.helper.PutDataWithOptions(ctx, key, data, &createOptions)
+		if putErr == nil {
+			return true, nil
+		} else if !errors.Is(putErr, ErrS3PreconditionFailed) {
+			return false, putErr
+		}
+
+		// the lock exists: take it over only when it has expired and nobody replaced it meanwhile
+		item, getErr := store.helper.GetItemWithContext(ctx, key)
+		if errors.Is(getErr, ErrObjectNotFound) {
+			// released meanwhile: create it again
+			continue
+		} else if getErr != nil {
+			return false, getErr
+		}
+
+		current := &s3JobLock{}
+		decodeErr := json.NewDecoder(item).Decode(current)
+		item.Close()
+		if decodeErr != nil {
+			// a lock which cannot be read may still be held
+			return false, fmt.Errorf("lock %s: %w", key, decodeErr)
+		} else if time.Now().Before(current.ExpiresAt) {
+			return false, nil
+		}
+
+		etag, _ := item.ETag()
+		takeOverOptions := putOptions
+		takeOverOptions.IfMatch = etag
+		if putErr = store.helper.PutDataWithOptions(ctx, key, data, &takeOverOptions); putErr == nil {
+			return true, nil
+		} else if errors.Is(putErr, ErrS3PreconditionFailed) {
+			return false, nil
+		} else if !errors.Is(putErr, ErrObjectNotFound) {
+			return false, putErr
+		}
+	}
+
+	return false, nil
+}
+
+func (store *S3JobLockStore) Release(ctx context.Context, jobName, owner string) (err error) {
+	key := store.lockKey(jobName)
+
+	if item, getErr := store.helper.GetItemWithContext(ctx, key); getErr == nil {
+		current := &s3JobLock{}
+		decodeErr := json.NewDecoder(item).Decode(current)
+		item.Close()
+
+		if decodeErr != nil {
+			err = fmt.Errorf("lock %s: %w", key, decodeErr)
+		} else if current.Owner == owner {
+			// only deletes the lock read: another owner may have taken it over once expired
+			etag, _ := item.ETag()
+			if err = store.helper.deleteItemIfMatch(ctx, key, etag); errors.Is(err, ErrS3PreconditionFailed) || errors.Is(err, ErrObjectNotFound) {
+				err = nil
+			}
+		}
+	} else {
+		err = getErr
+	}
+
+	return
+}
+
+// S3JobHistoryWriter writes every run record as a JSON object under prefix/jobName/yyyy/mm/dd/.
+type S3JobHistoryWriter struct {
+	helper *S3Helper
+	prefix string
+}
+
+func NewS3JobHistoryWriter(helper *S3Helper, prefix string) *S3JobHistoryWriter {
+	return &S3JobHistoryWriter{
+		helper: helper,
+		prefix: prefix,
+	}
+}
+
+func (writer *S3JobHistoryWriter) WriteRun(ctx context.Context, record *JobRunRecord) (err error) {
+	if data, marshalErr := json.Marshal(record); marshalErr == nil {
+		startedAt := record.StartedAt.UTC()
+		key := path.Join(
+			writer.prefix,
+			strings.ReplaceAll(record.JobName, ":", "_"),
+			startedAt.Format("2006/01/02"),
+			startedAt.Format("20060102T150405.000000000Z")+"-"+record.EventID+".json",
+		)
+		err = writer.helper.PutDataWithContext(ctx, key, data)
+	} else {
+		err = marshalErr
+	}
+
+	return
+}
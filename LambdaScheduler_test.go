@@ -0,0 +1,177 @@
+package awssdkhelper
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/aws/aws-lambda-go/events"
+	TestUtility "github.com/thcomp/GoLang_TestUtility"
+)
+
+type testJobHistoryWriter struct {
+	records []*JobRunRecord
+}
+
+func (writer *testJobHistoryWriter) WriteRun(ctx context.Context, record *JobRunRecord) error {
+	writer.records = append(writer.records, record)
+	return nil
+}
+
+func TestScheduledJobRegistry_Handle(t *testing.T) {
+	tester := TestUtility.NewTestHelper(t)
+	registry := NewScheduledJobRegistry()
+	history := &testJobHistoryWriter{}
+	registry.SetHistoryWriter(history)
+
+	ran := []string{}
+	registry.Register("nightly-report", func(ctx context.Context, event *events.EventBridgeEvent) error {
+		ran = append(ran, "nightly-report")
+		return nil
+	}, nil)
+	registry.Register("arn:aws:events:us-east-1:123456789012:rule/cleanup", func(ctx context.Context, event *events.EventBridgeEvent) error {
+		ran = append(ran, "cleanup")
+		return errors.New("cleanup failed")
+	}, nil)
+
+	schedulerEvent := map[string]interface{}{}
+	json.Unmarshal([]byte(`{
+		"version": "0",
+		"id": "event-1",
+		"detail-type": "Scheduled Event",
+		"source": "aws.scheduler",
+		"resources": ["arn:aws:scheduler:us-east-1:123456789012:schedule/default/nightly-report"],
+		"detail": "{}"
+	}`), &schedulerEvent)
+	err := registry.Handle(context.Background(), schedulerEvent)
+	tester.Errorf(err == nil, "Handle error: %v", err)
+	tester.Errorf(len(ran) == 1 && ran[0] == "nightly-report", "ran: %v", ran)
+	tester.Errorf(len(history.records) == 1 && history.records[0].Status == JobRunSucceeded && history.records[0].EventID == "event-1", "history: %v", history.records)
+
+	records, err := registry.HandleEventBridgeEvent(context.Background(), &events.EventBridgeEvent{
+		ID:        "event-2",
+		Source:    "aws.events",
+		Resources: []string{"arn:aws:events:us-east-1:123456789012:rule/cleanup"},
+	})
+	tester.Errorf(err != nil && strings.Contains(err.Error(), "cleanup failed"), "job error is not returned: %v", err)
+	tester.Errorf(len(records) == 1 && records[0].Status == JobRunFailed, "records: %v", records)
+
+	_, err = registry.HandleEventBridgeEvent(context.Background(), &events.EventBridgeEvent{Resources: []string{"arn:aws:events:us-east-1:123456789012:rule/unknown"}})
+	tester.Errorf(err != nil, "unknown resource must fail")
+}
+
+func TestScheduledJobRegistry_TimeoutAndOverlap(t *testing.T) {
+	tester := TestUtility.NewTestHelper(t)
+	registry := NewScheduledJobRegistry()
+	lockStore := NewMemoryJobLockStore()
+	registry.SetLockStore(lockStore)
+
+	registry.Register("slow", func(ctx context.Context, event *events.EventBridgeEvent) error {
+		<-ctx.Done()
+		return ctx.Err()
+	}, &ScheduledJobOptions{Timeout: 20 * time.Millisecond})
+	registry.Register("locked", func(ctx context.Context, event *events.EventBridgeEvent) error {
+		return nil
+	}, nil)
+
+	records, err := registry.HandleEventBridgeEvent(context.Background(), &events.EventBridgeEvent{Resources: []string{"arn:aws:events:us-east-1:123456789012:rule/slow"}})
+	tester.Errorf(err != nil && len(records) == 1 && records[0].Status == JobRunTimedOut, "timeout: %v, %v", records, err)
+
+	acquired, _ := lockStore.Acquire(context.Background(), "locked", "other-run", time.Minute)
+	tester.Fatalf(acquired, "lock is not acquired")
+	records, err = registry.HandleEventBridgeEvent(context.Background(), &events.EventBridgeEvent{Resources: []string{"arn:aws:events:us-east-1:123456789012:rule/locked"}})
+	tester.Errorf(err == nil && len(records) == 1 && records[0].Status == JobRunSkipped, "overlap: %v, %v", records, err)
+}
+
+func TestScheduledJobRegistry_TimeoutKeepsLock(t *testing.T) {
+	tester := TestUtility.NewTestHelper(t)
+	registry := NewScheduledJobRegistry()
+	lockStore := NewMemoryJobLockStore()
+	registry.SetLockStore(lockStore)
+
+	release := make(chan struct{})
+	finished := make(chan struct{})
+	runs := 0
+	registry.Register("stubborn", func(ctx context.Context, event *events.EventBridgeEvent) error {
+		runs++
+		if runs == 1 {
+			// ignores its context
+			<-release
+			defer close(finished)
+		}
+		return nil
+	}, &ScheduledJobOptions{Timeout: 20 * time.Millisecond})
+	event := &events.EventBridgeEvent{Resources: []string{"arn:aws:events:us-east-1:123456789012:rule/stubborn"}}
+
+	records, _ := registry.HandleEventBridgeEvent(context.Background(), event)
+	tester.Fatalf(len(records) == 1 && records[0].Status == JobRunTimedOut, "timeout: %v", records)
+	records, _ = registry.HandleEventBridgeEvent(context.Background(), event)
+	tester.Errorf(len(records) == 1 && records[0].Status == JobRunSkipped, "run overlapping a timed out job: %v", records)
+
+	close(release)
+	<-finished
+	// the lock is released once the timed out job returned
+	for start := time.Now(); time.Since(start) < time.Second; time.Sleep(5 * time.Millisecond) {
+		if records, _ = registry.HandleEventBridgeEvent(context.Background(), event); records[0].Status != JobRunSkipped {
+			break
+		}
+	}
+	tester.Errorf(len(records) == 1 && records[0].Status == JobRunSucceeded, "run after the timed out job returned: %v", records)
+}
+
+func TestS3JobLockStoreAndHistory(t *testing.T) {
+	tester := TestUtility.NewTestHelper(t)
+	fake := newFakeS3Server(t, "jobs-bucket")
+	helper := fake.helper()
+	ctx := context.Background()
+
+	lockStore := NewS3JobLockStore(helper, "locks")
+	acquired, err := lockStore.Acquire(ctx, "job", "owner-1", time.Minute)
+	tester.Fatalf(err == nil && acquired, "first Acquire: %t, %v", acquired, err)
+	acquired, err = lockStore.Acquire(ctx, "job", "owner-2", time.Minute)
+	tester.Errorf(err == nil && !acquired, "second Acquire: %t, %v", acquired, err)
+
+	err = lockStore.Release(ctx, "job", "owner-2")
+	tester.Errorf(err == nil && fake.object("locks/job.lock") != nil, "foreign owner released the lock: %v", err)
+	err = lockStore.Release(ctx, "job", "owner-1")
+	tester.Errorf(err == nil && fake.object("locks/job.lock") == nil, "Release: %v", err)
+
+	// a lock replaced after it was read is not deleted
+	acquired, _ = lockStore.Acquire(ctx, "job", "owner-1", time.Minute)
+	tester.Fatalf(acquired, "lock is not acquired again")
+	staleETag := fake.object("locks/job.lock").etag
+	fake.putObject("locks/job.lock", []byte(`{"owner":"owner-2"}`))
+	err = helper.deleteItemIfMatch(ctx, "locks/job.lock", staleETag)
+	tester.Errorf(errors.Is(err, ErrS3PreconditionFailed) && fake.object("locks/job.lock") != nil, "lock of another owner deleted: %v", err)
+
+	acquired, _ = lockStore.Acquire(ctx, "expired", "owner-1", -time.Second)
+	tester.Fatalf(acquired, "expired lock is not written")
+	acquired, err = lockStore.Acquire(ctx, "expired", "owner-2", time.Minute)
+	tester.Errorf(err == nil && acquired, "expired lock is not taken over: %t, %v", acquired, err)
+
+	// locks are stored uncompressed, whatever the compression of the helper
+	helper.SetCompression(S3CompressionGzip)
+	acquired, err = lockStore.Acquire(ctx, "compressed", "owner-1", time.Minute)
+	tester.Fatalf(err == nil && acquired, "Acquire with compression: %t, %v", acquired, err)
+	acquired, err = lockStore.Acquire(ctx, "compressed", "owner-2", time.Minute)
+	tester.Errorf(err == nil && !acquired, "live lock is taken over with compression: %t, %v", acquired, err)
+	err = lockStore.Release(ctx, "compressed", "owner-1")
+	tester.Errorf(err == nil && fake.object("locks/compressed.lock") == nil, "Release with compression: %v", err)
+	helper.SetCompression(S3CompressionNone)
+
+	// a lock which cannot be decoded is never taken over
+	fake.putObject("locks/garbled.lock", []byte{0x1f, 0x8b, 0x08})
+	acquired, err = lockStore.Acquire(ctx, "garbled", "owner-1", time.Minute)
+	tester.Errorf(err != nil && !acquired && bytes.Equal(fake.object("locks/garbled.lock").data, []byte{0x1f, 0x8b, 0x08}), "garbled lock: %t, %v", acquired, err)
+
+	writer := NewS3JobHistoryWriter(helper, "history")
+	startedAt := time.Date(2024, 5, 6, 7, 8, 9, 0, time.UTC)
+	err = writer.WriteRun(ctx, &JobRunRecord{JobName: "job", EventID: "event-1", Status: JobRunSucceeded, StartedAt: startedAt})
+	tester.Errorf(err == nil, "WriteRun error: %v", err)
+	items, _, err := helper.ListItems("history/job/2024/05/06/", nil)
+	tester.Errorf(err == nil && len(items) == 1 && strings.HasSuffix(items[0].Path, "-event-1.json"), "history items: %v, %v", items, err)
+}
@@ -0,0 +1,487 @@
+package awssdkhelper
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"math"
+	"net/http"
+	"net/mail"
+	"net/url"
+	"reflect"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+	"unicode/utf8"
+
+	"github.com/aws/aws-lambda-go/events"
+)
+
+type RequestValidator interface {
+	Validate(data []byte) error
+}
+
+type ValidationFieldError struct {
+	Field   string `json:"field"`
+	Message string `json:"message"`
+}
+
+type ValidationError struct {
+	Errors []ValidationFieldError `json:"errors"`
+}
+
+func (validationErr *ValidationError) Error() string {
+	messages := make([]string, 0, len(validationErr.Errors))
+	for _, fieldErr := range validationErr.Errors {
+		if fieldErr.Field == "" {
+			messages = append(messages, fieldErr.Message)
+		} else {
+			messages = append(messages, fieldErr.Field+": "+fieldErr.Message)
+		}
+	}
+
+	return "validation failed: " + strings.Join(messages, "; ")
+}
+
+// JSONSchema validates JSON documents against a subset of JSON Schema:
+// type, properties, required, additionalProperties, items, enum, const,
+// minimum/maximum (and exclusive variants), minLength/maxLength, pattern,
+// format (email, date-time, date, uuid, uri), minItems/maxItems, allOf, anyOf and oneOf.
+type JSONSchema struct {
+	Type                 interface{}            `json:"type,omitempty"`
+	Properties           map[string]*JSONSchema `json:"properties,omitempty"`
+	Required             []string               `json:"required,omitempty"`
+	AdditionalProperties *bool                  `json:"additionalProperties,omitempty"`
+	Items                *JSONSchema            `json:"items,omitempty"`
+	Enum                 []interface{}          `json:"enum,omitempty"`
+	Const                interface{}            `json:"const,omitempty"`
+	Minimum              *float64               `json:"minimum,omitempty"`
+	Maximum              *float64               `json:"maximum,omitempty"`
+	ExclusiveMinimum     *float64               `json:"exclusiveMinimum,omitempty"`
+	ExclusiveMaximum     *float64               `json:"exclusiveMaximum,omitempty"`
+	MinLength            *int                   `json:"minLength,omitempty"`
+	MaxLength            *int                   `json:"maxLength,omitempty"`
+	Pattern              string                 `json:"pattern,omitempty"`
+	Format               string                 `json:"format,omitempty"`
+	MinItems             *int                   `json:"minItems,omitempty"`
+	MaxItems             *int                   `json:"maxItems,omitempty"`
+	AllOf                []*JSONSchema          `json:"allOf,omitempty"`
+	AnyOf                []*JSONSchema          `json:"anyOf,omitempty"`
+	OneOf                []*JSONSchema          `json:"oneOf,omitempty"`
+
+	pattern *regexp.Regexp
+}
+
+var jsonSchemaUUIDPattern = regexp.MustCompile(`^[0-9a-fA-F]{8}-[0-9a-fA-F]{4}-[0-9a-fA-F]{4}-[0-9a-fA-F]{4}-[0-9a-fA-F]{12}$`)
+
+func NewJSONSchema(schemaJSON []byte) (schema *JSONSchema, err error) {
+	schema = &JSONSchema{}
+	if err = json.Unmarshal(schemaJSON, schema); err == nil {
+		err = schema.compile()
+	}
+	if err != nil {
+		schema = nil
+	}
+
+	return
+}
+
+func (schema *JSONSchema) compile() (err error) {
+	if schema.Pattern != "" {
+		if schema.pattern, err = regexp.Compile(schema.Pattern); err != nil {
+			return fmt.Errorf("invalid pattern %q: %w", schema.Pattern, err)
+		}
+	}
+
+	children := []*JSONSchema{schema.Items}
+	for _, property := range schema.Properties {
+		children = append(children, property)
+	}
+	children = append(children, schema.AllOf...)
+	children = append(children, schema.AnyOf...)
+	children = append(children, schema.OneOf...)
+	for _, child := range children {
+		if child != nil {
+			if err = child.compile(); err != nil {
+				return
+			}
+		}
+	}
+
+	return
+}
+
+func (schema *JSONSchema) Validate(data []byte) error {
+	decoder := json.NewDecoder(bytes.NewReader(data))
+	decoder.UseNumber()
+
+	var value interface{}
+	if decodeErr := decoder.Decode(&value); decodeErr != nil {
+		return &ValidationError{Errors: []ValidationFieldError{{Message: "invalid JSON: " + decodeErr.Error()}}}
+	}
+
+	return schema.ValidateValue(value)
+}
+
+// ValidateValue validates a value that has already been decoded from JSON.
+func (schema *JSONSchema) ValidateValue(value interface{}) error {
+	if fieldErrs := schema.validate("", value); len(fieldErrs) > 0 {
+		return &ValidationError{Errors: fieldErrs}
+	}
+
+	return nil
+}
+
+func (schema *JSONSchema) validate(field string, value interface{}) (fieldErrs []ValidationFieldError) {
+	addErr := func(format string, args ...interface{}) {
+		fieldErrs = append(fieldErrs, ValidationFieldError{Field: field, Message: fmt.Sprintf(format, args...)})
+	}
+
+	if schema.Type != nil {
+		types := []string{}
+		switch v := schema.Type.(type) {
+		case string:
+			types = append(types, v)
+		case []interface{}:
+			for _, t := range v {
+				if s, ok := t.(string); ok {
+					types = append(types, s)
+				}
+			}
+		}
+
+		matched := false
+		for _, t := range types {
+			if jsonSchemaTypeMatches(t, value) {
+				matched = true
+				break
+			}
+		}
+		if !matched {
+			addErr("must be of type %s", strings.Join(types, " or "))
+			return
+		}
+	}
+
+	if schema.Enum != nil {
+		found := false
+		for _, candidate := range schema.Enum {
+			if jsonSchemaEqual(candidate, value) {
+				found = true
+				break
+			}
+		}
+		if !found {
+			addErr("must be one of %v", schema.Enum)
+		}
+	}
+	if schema.Const != nil && !jsonSchemaEqual(schema.Const, value) {
+		addErr("must be %v", schema.Const)
+	}
+
+	switch v := value.(type) {
+	case map[string]interface{}:
+		for _, name := range schema.Required {
+			if _, exist := v[name]; !exist {
+				fieldErrs = append(fieldErrs, ValidationFieldError{Field: jsonSchemaJoinField(field, name), Message: "is required"})
+			}
+		}
+
+		names := make([]string, 0, len(v))
+		for name := range v {
+			names = append(names, name)
+		}
+		sort.Strings(names)
+		for _, name := range names {
+			if property, exist := schema.Properties[name]; exist {
+				fieldErrs = append(fieldErrs, property.validate(jsonSchemaJoinField(field, name), v[name])...)
+			} else if schema.AdditionalProperties != nil && !(*schema.AdditionalProperties) {
+				fieldErrs = append(fieldErrs, ValidationFieldError{Field: jsonSchemaJoinField(field, name), Message: "is not allowed"})
+			}
+		}
+	case []interface{}:
+		if schema.MinItems != nil && len(v) < *schema.MinItems {
+			addErr("must have at least %d items", *schema.MinItems)
+		}
+		if schema.MaxItems != nil && len(v) > *schema.MaxItems {
+			addErr("must have at most %d items", *schema.MaxItems)
+		}
+		if schema.Items != nil {
+			for index, item := range v {
+				fieldErrs = append(fieldErrs, schema.Items.validate(fmt.Sprintf("%s[%d]", field, index), item)...)
+			}
+		}
+	case string:
+		length := utf8.RuneCountInString(v)
+		if schema.MinLength != nil && length < *schema.MinLength {
+			addErr("must be at least %d characters", *schema.MinLength)
+		}
+		if schema.MaxLength != nil && length > *schema.MaxLength {
+			addErr("must be at most %d characters", *schema.MaxLength)
+		}
+		if schema.pattern != nil && !schema.pattern.MatchString(v) {
+			addErr("must match pattern %s", schema.Pattern)
+		}
+		if schema.Format != "" && !jsonSchemaFormatMatches(schema.Format, v) {
+			addErr("must be a valid %s", schema.Format)
+		}
+	case json.Number, float64:
+		number, _ := jsonSchemaNumber(v)
+		if schema.Minimum != nil && number < *schema.Minimum {
+			addErr("must be >= %v", *schema.Minimum)
+		}
+		if schema.Maximum != nil && number > *schema.Maximum {
+			addErr("must be <= %v", *schema.Maximum)
+		}
+		if schema.ExclusiveMinimum != nil && number <= *schema.ExclusiveMinimum {
+			addErr("must be > %v", *schema.ExclusiveMinimum)
+		}
+		if schema.ExclusiveMaximum != nil && number >= *schema.ExclusiveMaximum {
+			addErr("must be < %v", *schema.ExclusiveMaximum)
+		}
+	}
+
+	for _, sub := range schema.AllOf {
+		fieldErrs = append(fieldErrs, sub.validate(field, value)...)
+	}
+	if len(schema.AnyOf) > 0 {
+		matched := false
+		for _, sub := range schema.AnyOf {
+			if len(sub.validate(field, value)) == 0 {
+				matched = true
+				break
+			}
+		}
+		if !matched {
+			addErr("must match at least one schema in anyOf")
+		}
+	}
+	if len(schema.OneOf) > 0 {
+		matchCount := 0
+		for _, sub := range schema.OneOf {
+			if len(sub.validate(field, value)) == 0 {
+				matchCount++
+			}
+		}
+		if matchCount != 1 {
+			addErr("must match exactly one schema in oneOf")
+		}
+	}
+
+	return
+}
+
+func jsonSchemaJoinField(parent, name string) string {
+	if parent == "" {
+		return name
+	}
+	return parent + "." + name
+}
+
+func jsonSchemaNumber(value interface{}) (ret float64, ok bool) {
+	switch v := value.(type) {
+	case json.Number:
+		if f, err := v.Float64(); err == nil {
+			ret, ok = f, true
+		}
+	case float64:
+		ret, ok = v, true
+	case int:
+		ret, ok = float64(v), true
+	case int64:
+		ret, ok = float64(v), true
+	}
+
+	return
+}
+
+func jsonSchemaTypeMatches(schemaType string, value interface{}) (ret bool) {
+	switch schemaType {
+	case "object":
+		_, ret = value.(map[string]interface{})
+	case "array":
+		_, ret = value.([]interface{})
+	case "string":
+		_, ret = value.(string)
+	case "boolean":
+		_, ret = value.(bool)
+	case "null":
+		ret = value == nil
+	case "number":
+		_, ret = jsonSchemaNumber(value)
+	case "integer":
+		if number, ok := value.(json.Number); ok {
+			if _, err := strconv.ParseInt(number.String(), 10, 64); err == nil {
+				ret = true
+			} else if f, err := number.Float64(); err == nil {
+				ret = f == math.Trunc(f)
+			}
+		} else if f, ok := jsonSchemaNumber(value); ok {
+			ret = f == math.Trunc(f)
+		}
+	}
+
+	return
+}
+
+func jsonSchemaFormatMatches(format, value string) (ret bool) {
+	switch format {
+	case "email":
+		_, err := mail.ParseAddress(value)
+		ret = err == nil && !strings.Contains(value, "<")
+	case "date-time":
+		_, err := time.Parse(time.RFC3339, value)
+		ret = err == nil
+	case "date":
+		_, err := time.Parse("2006-01-02", value)
+		ret = err == nil
+	case "uuid":
+		ret = jsonSchemaUUIDPattern.MatchString(value)
+	case "uri":
+		u, err := url.Parse(value)
+		ret = err == nil && u.Scheme != ""
+	default:
+		// unknown formats are annotations only
+		ret = true
+	}
+
+	return
+}
+
+func jsonSchemaEqual(expected, actual interface{}) bool {
+	expectedNumber, expectedIsNumber := jsonSchemaNumber(expected)
+	actualNumber, actualIsNumber := jsonSchemaNumber(actual)
+	if expectedIsNumber || actualIsNumber {
+		return expectedIsNumber && actualIsNumber && expectedNumber == actualNumber
+	}
+
+	return reflect.DeepEqual(expected, actual)
+}
+
+// ValidateBody validates the body of an HTTP event. A *ValidationError is returned when the body is invalid.
+func (helper *LambdaEventHelper) ValidateBody(validator RequestValidator) (err error) {
+	if body, bodyErr := helper.Body(); bodyErr == nil {
+		defer body.Close()
+
+		if data, readErr := io.ReadAll(body); readErr == nil {
+			err = validator.Validate(data)
+		} else {
+			err = readErr
+		}
+	} else {
+		err = &ValidationError{Errors: []ValidationFieldError{{Message: "body is required"}}}
+	}
+
+	return
+}
+
+// ValidationErrorResponse builds a 400 response with field level details in the response format of the event.
+func (helper *LambdaEventHelper) ValidationErrorResponse(err error) (ret map[string]interface{}, retErr error) {
+	return helper.MapOfResponse(NewValidationErrorHttpResponse(err))
+}
+
+func NewValidationErrorHttpResponse(err error) *http.Response {
+	body := map[string]interface{}{
+		"message": "request validation failed",
+	}
+
+	validationErr := (*ValidationError)(nil)
+	if errors.As(err, &validationErr) {
+		body["errors"] = validationErr.Errors
+	} else if err != nil {
+		body["errors"] = []ValidationFieldError{{Message: err.Error()}}
+	}
+
+	data, _ := json.Marshal(body)
+	header := http.Header{}
+	header.Set("Content-Type", "application/json")
+
+	return &http.Response{
+		StatusCode:    http.StatusBadRequest,
+		Header:        header,
+		Body:          io.NopCloser(bytes.NewReader(data)),
+		ContentLength: int64(len(data)),
+	}
+}
+
+// ValidateHttpRequestHandler wraps a route handler so that invalid bodies are answered with 400 before the handler runs.
+func ValidateHttpRequestHandler(validator RequestValidator, handler HttpRequestHandler) HttpRequestHandler {
+	return func(r *http.Request, w http.ResponseWriter) {
+		data := []byte(nil)
+		if r.Body != nil {
+			var readErr error
+			if data, readErr = io.ReadAll(r.Body); readErr != nil {
+				writeValidationError(w, readErr)
+				return
+			}
+			r.Body.Close()
+		}
+
+		if err := validator.Validate(data); err != nil {
+			writeValidationError(w, err)
+			return
+		}
+
+		r.Body = io.NopCloser(bytes.NewReader(data))
+		handler(r, w)
+	}
+}
+
+func writeValidationError(w http.ResponseWriter, err error) {
+	response := NewValidationErrorHttpResponse(err)
+	for key, values := range response.Header {
+		for _, value := range values {
+			w.Header().Add(key, value)
+		}
+	}
+	w.WriteHeader(response.StatusCode)
+	io.Copy(w, response.Body)
+}
+
+type SQSMessageHandler func(ctx context.Context, message *events.SQSMessage) error
+type SNSRecordHandler func(ctx context.Context, record *events.SNSEventRecord) error
+
+// ValidateSQSMessages validates every message body before handing it to handler. Messages that fail
+// validation or handling are reported as batch item failures, which requires ReportBatchItemFailures
+// to be enabled on the event source mapping.
+func ValidateSQSMessages(validator RequestValidator, handler SQSMessageHandler) func(ctx context.Context, event *events.SQSEvent) (events.SQSEventResponse, error) {
+	return func(ctx context.Context, event *events.SQSEvent) (response events.SQSEventResponse, err error) {
+		for index := range event.Records {
+			message := &event.Records[index]
+			if validateErr := validator.Validate([]byte(message.Body)); validateErr == nil {
+				if handleErr := handler(ctx, message); handleErr != nil {
+					response.BatchItemFailures = append(response.BatchItemFailures, events.SQSBatchItemFailure{ItemIdentifier: message.MessageId})
+				}
+			} else {
+				response.BatchItemFailures = append(response.BatchItemFailures, events.SQSBatchItemFailure{ItemIdentifier: message.MessageId})
+			}
+		}
+
+		return
+	}
+}
+
+// ValidateSNSRecords validates every SNS message before handing it to handler. SNS has no partial batch
+// response, so the invocation fails when any record is invalid.
+func ValidateSNSRecords(validator RequestValidator, handler SNSRecordHandler) func(ctx context.Context, event *events.SNSEvent) error {
+	return func(ctx context.Context, event *events.SNSEvent) error {
+		errs := []error{}
+		for index := range event.Records {
+			record := &event.Records[index]
+			if validateErr := validator.Validate([]byte(record.SNS.Message)); validateErr == nil {
+				if handleErr := handler(ctx, record); handleErr != nil {
+					errs = append(errs, fmt.Errorf("message %s: %w", record.SNS.MessageID, handleErr))
+				}
+			} else {
+				errs = append(errs, fmt.Errorf("message %s: %w", record.SNS.MessageID, validateErr))
+			}
+		}
+
+		return errors.Join(errs...)
+	}
+}
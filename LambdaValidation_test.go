@@ -0,0 +1,135 @@
+package awssdkhelper
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/aws/aws-lambda-go/events"
+	TestUtility "github.com/thcomp/GoLang_TestUtility"
+)
+
+const testUserSchema = `{
+	"type": "object",
+	"required": ["name", "age"],
+	"additionalProperties": false,
+	"properties": {
+		"name": {"type": "string", "minLength": 1, "maxLength": 10},
+		"age": {"type": "integer", "minimum": 0},
+		"email": {"type": "string", "format": "email"},
+		"tags": {"type": "array", "maxItems": 2, "items": {"type": "string", "enum": ["a", "b", "c"]}}
+	}
+}`
+
+func TestJSONSchema_Validate(t *testing.T) {
+	tester := TestUtility.NewTestHelper(t)
+	schema, err := NewJSONSchema([]byte(testUserSchema))
+	tester.Fatalf(err == nil, "NewJSONSchema error: %v", err)
+
+	err = schema.Validate([]byte(`{"name":"alice","age":20,"email":"alice@example.com","tags":["a","b"]}`))
+	tester.Errorf(err == nil, "valid document rejected: %v", err)
+
+	err = schema.Validate([]byte(`{"name":"","age":1.5,"tags":["a","x","b"],"extra":true}`))
+	validationErr := (*ValidationError)(nil)
+	tester.Fatalf(errors.As(err, &validationErr), "expected ValidationError: %v", err)
+
+	fields := map[string]bool{}
+	for _, fieldErr := range validationErr.Errors {
+		fields[fieldErr.Field] = true
+	}
+	for _, field := range []string{"name", "age", "tags", "tags[1]", "extra"} {
+		tester.Errorf(fields[field], "missing error for %s: %v", field, validationErr.Errors)
+	}
+
+	err = schema.Validate([]byte(`{"age":1}`))
+	tester.Errorf(errors.As(err, &validationErr) && len(validationErr.Errors) == 1 && validationErr.Errors[0].Field == "name", "required error: %v", err)
+
+	err = schema.Validate([]byte(`{"name":`))
+	tester.Errorf(err != nil, "broken JSON accepted")
+
+	_, err = NewJSONSchema([]byte(`{"type":"string","pattern":"("}`))
+	tester.Errorf(err != nil, "invalid pattern accepted")
+}
+
+func TestLambdaEventHelper_ValidateBody(t *testing.T) {
+	tester := TestUtility.NewTestHelper(t)
+	schema, _ := NewJSONSchema([]byte(testUserSchema))
+
+	eventMap := map[string]interface{}{}
+	json.Unmarshal([]byte(`{
+		"rawPath": "/users",
+		"body": "{\"name\":\"alice\"}",
+		"isBase64Encoded": false,
+		"requestContext": {"routeKey": "POST /users", "http": {"method": "POST", "path": "/users"}}
+	}`), &eventMap)
+	helper, err := NewLambdaEventHelper(eventMap)
+	tester.Fatalf(err == nil, "NewLambdaEventHelper error: %v", err)
+
+	err = helper.ValidateBody(schema)
+	tester.Fatalf(err != nil, "invalid body accepted")
+
+	response, err := helper.ValidationErrorResponse(err)
+	tester.Fatalf(err == nil, "ValidationErrorResponse error: %v", err)
+	tester.Errorf(response["statusCode"] == http.StatusBadRequest, "status code: %v", response["statusCode"])
+
+	body := map[string]interface{}{}
+	json.Unmarshal([]byte(response["body"].(string)), &body)
+	fieldErrs, _ := body["errors"].([]interface{})
+	tester.Errorf(len(fieldErrs) == 1, "errors: %v", body)
+}
+
+func TestValidateHttpRequestHandler(t *testing.T) {
+	tester := TestUtility.NewTestHelper(t)
+	schema, _ := NewJSONSchema([]byte(testUserSchema))
+
+	called := false
+	handler := ValidateHttpRequestHandler(schema, func(r *http.Request, w http.ResponseWriter) {
+		called = true
+		data, _ := io.ReadAll(r.Body)
+		tester.Errorf(len(data) > 0, "body is not restored")
+		w.WriteHeader(http.StatusNoContent)
+	})
+
+	recorder := httptest.NewRecorder()
+	handler(httptest.NewRequest(http.MethodPost, "/users", bytes.NewReader([]byte(`{"name":"bob"}`))), recorder)
+	tester.Errorf(!called && recorder.Code == http.StatusBadRequest, "invalid request: called=%t, code=%d", called, recorder.Code)
+
+	recorder = httptest.NewRecorder()
+	handler(httptest.NewRequest(http.MethodPost, "/users", bytes.NewReader([]byte(`{"name":"bob","age":3}`))), recorder)
+	tester.Errorf(called && recorder.Code == http.StatusNoContent, "valid request: called=%t, code=%d", called, recorder.Code)
+}
+
+func TestValidateSQSMessages(t *testing.T) {
+	tester := TestUtility.NewTestHelper(t)
+	schema, _ := NewJSONSchema([]byte(testUserSchema))
+
+	handled := []string{}
+	handler := ValidateSQSMessages(schema, func(ctx context.Context, message *events.SQSMessage) error {
+		handled = append(handled, message.MessageId)
+		if message.MessageId == "3" {
+			return errors.New("handler failure")
+		}
+		return nil
+	})
+
+	response, err := handler(context.Background(), &events.SQSEvent{Records: []events.SQSMessage{
+		{MessageId: "1", Body: `{"name":"a","age":1}`},
+		{MessageId: "2", Body: `{"name":"b"}`},
+		{MessageId: "3", Body: `{"name":"c","age":3}`},
+	}})
+	tester.Fatalf(err == nil, "handler error: %v", err)
+	tester.Errorf(len(handled) == 2, "handled: %v", handled)
+	tester.Errorf(
+		len(response.BatchItemFailures) == 2 && response.BatchItemFailures[0].ItemIdentifier == "2" && response.BatchItemFailures[1].ItemIdentifier == "3",
+		"batch item failures: %v", response.BatchItemFailures,
+	)
+
+	snsHandler := ValidateSNSRecords(schema, func(ctx context.Context, record *events.SNSEventRecord) error { return nil })
+	err = snsHandler(context.Background(), &events.SNSEvent{Records: []events.SNSEventRecord{{SNS: events.SNSEntity{MessageID: "x", Message: `{}`}}}})
+	tester.Errorf(err != nil, "invalid SNS message accepted")
+}
@@ -0,0 +1,32 @@
+package awssdkhelper
+
+import (
+	"context"
+	"errors"
+	"io"
+	"time"
+)
+
+var ErrObjectNotFound = errors.New("object not found")
+
+type ObjectInfo struct {
+	Key          string
+	Size         int64
+	LastModified time.Time
+	ETag         string
+	ContentType  string
+}
+
+// ObjectStore is the storage surface used by application code, implemented by S3Helper,
+// MemoryObjectStore and LocalFileObjectStore. Keys use "/" as separator in every backend.
+type ObjectStore interface {
+	// ListObjects returns every object whose key starts with prefix, sorted by key.
+	ListObjects(ctx context.Context, prefix string) ([]*ObjectInfo, error)
+	// GetObject opens the object. ErrObjectNotFound is returned (wrapped) for missing keys.
+	GetObject(ctx context.Context, key string) (io.ReadCloser, *ObjectInfo, error)
+	PutObject(ctx context.Context, key string, body io.Reader) error
+	// DeleteObject succeeds when the key does not exist.
+	DeleteObject(ctx context.Context, key string) error
+	// StatObject returns object information without opening the body.
+	StatObject(ctx context.Context, key string) (*ObjectInfo, error)
+}
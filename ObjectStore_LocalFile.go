@@ -0,0 +1,172 @@
+package awssdkhelper
+
+import (
+	"context"
+	"crypto/md5"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"os"
+	"path"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	ThcompUtility "github.com/thcomp/GoLang_Utility"
+)
+
+// LocalFileObjectStore stores objects as files under a root directory. Key "a/b.txt" is stored at root/a/b.txt.
+type LocalFileObjectStore struct {
+	root string
+}
+
+func NewLocalFileObjectStore(root string) *LocalFileObjectStore {
+	return &LocalFileObjectStore{
+		root: root,
+	}
+}
+
+func (store *LocalFileObjectStore) filePath(key string) (ret string, err error) {
+	cleaned := path.Clean("/" + key)
+	if key == "" || strings.HasSuffix(key, "/") || cleaned != "/"+key {
+		err = fmt.Errorf("invalid key for local file store: %q", key)
+	} else {
+		ret = filepath.Join(store.root, filepath.FromSlash(cleaned[1:]))
+	}
+
+	return
+}
+
+func (store *LocalFileObjectStore) objectInfo(key, filePath string, fileInfo fs.FileInfo) (info *ObjectInfo, err error) {
+	info = &ObjectInfo{
+		Key:          key,
+		Size:         fileInfo.Size(),
+		LastModified: fileInfo.ModTime(),
+		ContentType:  ThcompUtility.GetMIMETypeFromExtension(key),
+	}
+
+	if file, openErr := os.Open(filePath); openErr == nil {
+		defer file.Close()
+
+		hash := md5.New()
+		if _, err = io.Copy(hash, file); err == nil {
+			info.ETag = `"` + hex.EncodeToString(hash.Sum(nil)) + `"`
+		}
+	} else {
+		err = openErr
+	}
+
+	return
+}
+
+func (store *LocalFileObjectStore) ListObjects(ctx context.Context, prefix string) (ret []*ObjectInfo, err error) {
+	err = filepath.WalkDir(store.root, func(filePath string, entry fs.DirEntry, walkErr error) error {
+		if walkErr != nil {
+			if errors.Is(walkErr, fs.ErrNotExist) && filePath == store.root {
+				return filepath.SkipAll
+			}
+			return walkErr
+		}
+		if ctxErr := ctx.Err(); ctxErr != nil {
+			return ctxErr
+		}
+
+		relPath, relErr := filepath.Rel(store.root, filePath)
+		if relErr != nil {
+			return relErr
+		}
+		key := filepath.ToSlash(relPath)
+
+		if entry.IsDir() {
+			// skip directories which can not contain keys with prefix
+			if filePath != store.root && !strings.HasPrefix(key+"/", prefix) && !strings.HasPrefix(prefix, key+"/") {
+				return filepath.SkipDir
+			}
+		} else if strings.HasPrefix(key, prefix) {
+			if fileInfo, infoErr := entry.Info(); infoErr == nil {
+				if info, statErr := store.objectInfo(key, filePath, fileInfo); statErr == nil {
+					ret = append(ret, info)
+				} else {
+					return statErr
+				}
+			} else {
+				return infoErr
+			}
+		}
+
+		return nil
+	})
+	sort.Slice(ret, func(i, j int) bool { return ret[i].Key < ret[j].Key })
+
+	return
+}
+
+func (store *LocalFileObjectStore) GetObject(ctx context.Context, key string) (reader io.ReadCloser, info *ObjectInfo, err error) {
+	if info, err = store.StatObject(ctx, key); err == nil {
+		filePath, _ := store.filePath(key)
+		if file, openErr := os.Open(filePath); openErr == nil {
+			reader = file
+		} else {
+			info, err = nil, openErr
+		}
+	}
+
+	return
+}
+
+func (store *LocalFileObjectStore) PutObject(ctx context.Context, key string, body io.Reader) (err error) {
+	if filePath, pathErr := store.filePath(key); pathErr == nil {
+		if err = os.MkdirAll(filepath.Dir(filePath), 0o755); err == nil {
+			// write to a temporary file first so that readers never see a partial object
+			if tempFile, tempErr := os.CreateTemp(filepath.Dir(filePath), ".tmp-*"); tempErr == nil {
+				_, err = io.Copy(tempFile, body)
+				if closeErr := tempFile.Close(); err == nil {
+					err = closeErr
+				}
+
+				if err == nil {
+					err = os.Rename(tempFile.Name(), filePath)
+				}
+				if err != nil {
+					os.Remove(tempFile.Name())
+				}
+			} else {
+				err = tempErr
+			}
+		}
+	} else {
+		err = pathErr
+	}
+
+	return
+}
+
+func (store *LocalFileObjectStore) DeleteObject(ctx context.Context, key string) (err error) {
+	if filePath, pathErr := store.filePath(key); pathErr == nil {
+		if err = os.Remove(filePath); errors.Is(err, fs.ErrNotExist) {
+			err = nil
+		}
+	} else {
+		err = pathErr
+	}
+
+	return
+}
+
+func (store *LocalFileObjectStore) StatObject(ctx context.Context, key string) (info *ObjectInfo, err error) {
+	if filePath, pathErr := store.filePath(key); pathErr == nil {
+		if fileInfo, statErr := os.Stat(filePath); statErr == nil && !fileInfo.IsDir() {
+			info, err = store.objectInfo(key, filePath, fileInfo)
+		} else if statErr == nil || errors.Is(statErr, fs.ErrNotExist) {
+			err = fmt.Errorf("%s: %w", key, ErrObjectNotFound)
+		} else {
+			err = statErr
+		}
+	} else {
+		err = pathErr
+	}
+
+	return
+}
@@ -0,0 +1,108 @@
+package awssdkhelper
+
+import (
+	"bytes"
+	"context"
+	"crypto/md5"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	ThcompUtility "github.com/thcomp/GoLang_Utility"
+)
+
+type memoryObject struct {
+	data []byte
+	info ObjectInfo
+}
+
+type MemoryObjectStore struct {
+	mutex   sync.RWMutex
+	objects map[string]*memoryObject
+}
+
+func NewMemoryObjectStore() *MemoryObjectStore {
+	return &MemoryObjectStore{
+		objects: map[string]*memoryObject{},
+	}
+}
+
+func (store *MemoryObjectStore) ListObjects(ctx context.Context, prefix string) (ret []*ObjectInfo, err error) {
+	store.mutex.RLock()
+	defer store.mutex.RUnlock()
+
+	for key, object := range store.objects {
+		if strings.HasPrefix(key, prefix) {
+			info := object.info
+			ret = append(ret, &info)
+		}
+	}
+	sort.Slice(ret, func(i, j int) bool { return ret[i].Key < ret[j].Key })
+
+	return
+}
+
+func (store *MemoryObjectStore) GetObject(ctx context.Context, key string) (reader io.ReadCloser, info *ObjectInfo, err error) {
+	store.mutex.RLock()
+	defer store.mutex.RUnlock()
+
+	if object, exist := store.objects[key]; exist {
+		copied := object.info
+		info = &copied
+		reader = io.NopCloser(bytes.NewReader(object.data))
+	} else {
+		err = fmt.Errorf("%s: %w", key, ErrObjectNotFound)
+	}
+
+	return
+}
+
+func (store *MemoryObjectStore) PutObject(ctx context.Context, key string, body io.Reader) (err error) {
+	if data, readErr := io.ReadAll(body); readErr == nil {
+		sum := md5.Sum(data)
+
+		store.mutex.Lock()
+		defer store.mutex.Unlock()
+
+		store.objects[key] = &memoryObject{
+			data: data,
+			info: ObjectInfo{
+				Key:          key,
+				Size:         int64(len(data)),
+				LastModified: time.Now(),
+				ETag:         `"` + hex.EncodeToString(sum[:]) + `"`,
+				ContentType:  ThcompUtility.GetMIMETypeFromExtension(key),
+			},
+		}
+	} else {
+		err = readErr
+	}
+
+	return
+}
+
+func (store *MemoryObjectStore) DeleteObject(ctx context.Context, key string) error {
+	store.mutex.Lock()
+	defer store.mutex.Unlock()
+
+	delete(store.objects, key)
+	return nil
+}
+
+func (store *MemoryObjectStore) StatObject(ctx context.Context, key string) (info *ObjectInfo, err error) {
+	store.mutex.RLock()
+	defer store.mutex.RUnlock()
+
+	if object, exist := store.objects[key]; exist {
+		copied := object.info
+		info = &copied
+	} else {
+		err = fmt.Errorf("%s: %w", key, ErrObjectNotFound)
+	}
+
+	return
+}
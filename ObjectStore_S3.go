@@ -0,0 +1,128 @@
+package awssdkhelper
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/s3"
+	"github.com/aws/aws-sdk-go-v2/service/s3/types"
+	"github.com/aws/smithy-go"
+)
+
+var _ ObjectStore = (*S3Helper)(nil)
+var _ ObjectStore = (*MemoryObjectStore)(nil)
+var _ ObjectStore = (*LocalFileObjectStore)(nil)
+
+func wrapS3NotFound(key string, err error) error {
+	noSuchKey := (*types.NoSuchKey)(nil)
+	notFound := (*types.NotFound)(nil)
+	// operations such as GetObjectTagging do not model NoSuchKey, so it only shows as the error code
+	apiErr := smithy.APIError(nil)
+	if errors.As(err, &noSuchKey) || errors.As(err, &notFound) || (errors.As(err, &apiErr) && apiErr.ErrorCode() == "NoSuchKey") {
+		return fmt.Errorf("%s: %w: %w", key, ErrObjectNotFound, err)
+	}
+
+	return err
+}
+
+func (s3Helper *S3Helper) ListObjects(ctx context.Context, prefix string) (ret []*ObjectInfo, err error) {
+	paginator := s3.NewListObjectsV2Paginator(s3Helper.client, &s3.ListObjectsV2Input{
+		Bucket: aws.String(s3Helper.bucket),
+		Prefix: aws.String(prefix),
+	})
+
+	for paginator.HasMorePages() {
+		callCtx, cancel := s3Helper.callContext(ctx)
+		output, listErr := paginator.NextPage(callCtx)
+		cancel()
+		if listErr != nil {
+			return nil, listErr
+		}
+
+		for _, content := range output.Contents {
+			if s3Helper.decompression {
+				// sizes are the ones GetObject reads, which takes a HEAD of each object
+				item := s3Helper.newS3ItemFromObject(ctx, content)
+				if resolveErr := item.resolveCompression(ctx); resolveErr != nil {
+					return nil, wrapS3NotFound(item.Path, resolveErr)
+				}
+				ret = append(ret, newObjectInfoOfS3Item(item))
+				continue
+			}
+
+			ret = append(ret, &ObjectInfo{
+				Key:          aws.ToString(content.Key),
+				Size:         aws.ToInt64(content.Size),
+				LastModified: aws.ToTime(content.LastModified),
+				ETag:         aws.ToString(content.ETag),
+			})
+		}
+	}
+
+	return
+}
+
+// GetObject opens the object like GetItemWithContext, so it is decompressed when SetDecompression is enabled.
+// The size is then the one before compression, -1 when the writer did not store it.
+func (s3Helper *S3Helper) GetObject(ctx context.Context, key string) (reader io.ReadCloser, info *ObjectInfo, err error) {
+	if item, getErr := s3Helper.GetItemWithContext(ctx, key); getErr == nil {
+		reader, info = item, newObjectInfoOfS3Item(item)
+	} else {
+		err = wrapS3NotFound(key, getErr)
+	}
+
+	return
+}
+
+// PutObject uploads body like UploadWithContext, so it is compressed when SetCompression is set.
+// Bodies which are not io.ReadSeeker are streamed in parts, as their size is unknown.
+func (s3Helper *S3Helper) PutObject(ctx context.Context, key string, body io.Reader) (err error) {
+	options := &S3UploadOptions{Size: -1}
+	if readSeeker, ok := body.(io.ReadSeeker); ok {
+		if current, seekErr := readSeeker.Seek(0, io.SeekCurrent); seekErr == nil {
+			if end, seekErr := readSeeker.Seek(0, io.SeekEnd); seekErr == nil {
+				options.Size = end - current
+			}
+			if _, err = readSeeker.Seek(current, io.SeekStart); err != nil {
+				return
+			}
+		}
+	}
+
+	return s3Helper.UploadWithContext(ctx, key, body, options)
+}
+
+func (s3Helper *S3Helper) DeleteObject(ctx context.Context, key string) error {
+	return s3Helper.DeleteItemWithContext(ctx, key)
+}
+
+// StatObject loads the object like HeadItemWithContext, so its size is the one GetObject reads.
+func (s3Helper *S3Helper) StatObject(ctx context.Context, key string) (info *ObjectInfo, err error) {
+	if item, headErr := s3Helper.HeadItemWithContext(ctx, key); headErr == nil {
+		info = newObjectInfoOfS3Item(item)
+	} else {
+		err = headErr
+	}
+
+	return
+}
+
+func newObjectInfoOfS3Item(item *S3Item) (info *ObjectInfo) {
+	info = &ObjectInfo{
+		Key:          item.Path,
+		Size:         -1,
+		LastModified: aws.ToTime(item.lastModified),
+		ETag:         aws.ToString(item.etag),
+	}
+	if item.size != nil {
+		info.Size = *item.size
+	}
+	if item.attributes != nil {
+		info.ContentType = item.attributes.ContentType
+	}
+
+	return
+}
@@ -0,0 +1,118 @@
+package awssdkhelper
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"io"
+	"strings"
+	"testing"
+
+	TestUtility "github.com/thcomp/GoLang_TestUtility"
+)
+
+// testObjectStoreConformance is the behaviour shared by every ObjectStore backend.
+func testObjectStoreConformance(t *testing.T, store ObjectStore) {
+	tester := TestUtility.NewTestHelper(t)
+	ctx := context.Background()
+
+	for key, content := range map[string]string{
+		"docs/a.txt":        "alpha",
+		"docs/sub/b.json":   `{"b":true}`,
+		"docs2/c.txt":       "gamma",
+		"top.txt":           "top",
+		"docs/sub/deep/d.t": "delta",
+	} {
+		err := store.PutObject(ctx, key, strings.NewReader(content))
+		tester.Fatalf(err == nil, "PutObject(%s) error: %v", key, err)
+	}
+
+	infos, err := store.ListObjects(ctx, "docs/")
+	tester.Fatalf(err == nil, "ListObjects error: %v", err)
+	keys := []string{}
+	for _, info := range infos {
+		keys = append(keys, info.Key)
+	}
+	tester.Errorf(strings.Join(keys, ",") == "docs/a.txt,docs/sub/b.json,docs/sub/deep/d.t", "ListObjects keys: %v", keys)
+
+	infos, err = store.ListObjects(ctx, "docs")
+	tester.Errorf(err == nil && len(infos) == 4, "ListObjects without separator: %d, %v", len(infos), err)
+	infos, err = store.ListObjects(ctx, "none/")
+	tester.Errorf(err == nil && len(infos) == 0, "ListObjects of empty prefix: %v, %v", infos, err)
+
+	reader, info, err := store.GetObject(ctx, "docs/a.txt")
+	tester.Fatalf(err == nil, "GetObject error: %v", err)
+	data, _ := io.ReadAll(reader)
+	reader.Close()
+	tester.Errorf(string(data) == "alpha", "GetObject data: %s", string(data))
+	tester.Errorf(info.Key == "docs/a.txt" && info.Size == 5 && !info.LastModified.IsZero(), "GetObject info: %+v", info)
+
+	stat, err := store.StatObject(ctx, "docs/sub/b.json")
+	tester.Errorf(err == nil && stat.Size == 10 && stat.ETag != "", "StatObject: %+v, %v", stat, err)
+
+	err = store.PutObject(ctx, "docs/a.txt", strings.NewReader("overwritten"))
+	tester.Errorf(err == nil, "overwrite error: %v", err)
+	stat, _ = store.StatObject(ctx, "docs/a.txt")
+	tester.Errorf(stat != nil && stat.Size == 11, "overwritten size: %+v", stat)
+
+	_, err = store.StatObject(ctx, "missing.txt")
+	tester.Errorf(errors.Is(err, ErrObjectNotFound), "StatObject of missing key: %v", err)
+	_, _, err = store.GetObject(ctx, "missing.txt")
+	tester.Errorf(errors.Is(err, ErrObjectNotFound), "GetObject of missing key: %v", err)
+
+	err = store.DeleteObject(ctx, "docs/a.txt")
+	tester.Errorf(err == nil, "DeleteObject error: %v", err)
+	_, err = store.StatObject(ctx, "docs/a.txt")
+	tester.Errorf(errors.Is(err, ErrObjectNotFound), "deleted object still exists: %v", err)
+	err = store.DeleteObject(ctx, "docs/a.txt")
+	tester.Errorf(err == nil, "DeleteObject of missing key: %v", err)
+}
+
+func TestObjectStore_Memory(t *testing.T) {
+	testObjectStoreConformance(t, NewMemoryObjectStore())
+}
+
+func TestObjectStore_LocalFile(t *testing.T) {
+	testObjectStoreConformance(t, NewLocalFileObjectStore(t.TempDir()))
+
+	store := NewLocalFileObjectStore(t.TempDir())
+	err := store.PutObject(context.Background(), "../escape.txt", strings.NewReader("x"))
+	if err == nil {
+		t.Errorf("key escaping the root is accepted")
+	}
+}
+
+func TestObjectStore_S3(t *testing.T) {
+	tester := TestUtility.NewTestHelper(t)
+	fake := newFakeS3Server(t, "store-bucket")
+	helper := fake.helper()
+	testObjectStoreConformance(t, helper)
+
+	// a body which is not seekable is streamed in parts
+	data := testMultipartData(int(s3DefaultPartSize) + 1)
+	err := helper.PutObject(context.Background(), "streamed.bin", io.LimitReader(bytes.NewReader(data), int64(len(data))))
+	tester.Fatalf(err == nil, "PutObject: %v", err)
+	stored := fake.object("streamed.bin")
+	tester.Errorf(stored != nil && bytes.Equal(stored.data, data) && len(stored.partSizes) == 2, "streamed object differs or is not uploaded in parts")
+}
+
+func TestObjectStore_S3Compressed(t *testing.T) {
+	tester := TestUtility.NewTestHelper(t)
+	fake := newFakeS3Server(t, "store-bucket")
+	helper := fake.helper()
+	helper.SetCompression(S3CompressionGzip)
+	helper.SetDecompression(true)
+
+	// sizes and contents are the ones before compression
+	testObjectStoreConformance(t, helper)
+
+	err := helper.PutObject(context.Background(), "compressed.txt", io.LimitReader(strings.NewReader("compressed content"), 100))
+	tester.Fatalf(err == nil, "PutObject: %v", err)
+	stored := fake.object("compressed.txt")
+	tester.Errorf(stored != nil && stored.headers.Get("Content-Encoding") == "gzip", "stored object is not compressed: %+v", stored)
+	reader, info, err := helper.GetObject(context.Background(), "compressed.txt")
+	tester.Fatalf(err == nil, "GetObject: %v", err)
+	data, err := io.ReadAll(reader)
+	reader.Close()
+	tester.Errorf(err == nil && string(data) == "compressed content" && info.Size == int64(len(data)), "GetObject: %q, %+v, %v", data, info, err)
+}
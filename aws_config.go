@@ -0,0 +1,231 @@
+package awssdkhelper
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/aws/retry"
+	"github.com/aws/aws-sdk-go-v2/config"
+	"github.com/aws/aws-sdk-go-v2/credentials"
+	"github.com/aws/aws-sdk-go-v2/credentials/stscreds"
+	"github.com/aws/aws-sdk-go-v2/service/sts"
+	"github.com/aws/smithy-go/logging"
+
+	ThcompUtility "github.com/thcomp/GoLang_Utility"
+)
+
+// AWSConfigOption configures the AWS configuration shared by the helper constructors, such as
+// NewS3HelperWithConfig and NewSQSHelperWithConfig. Without credential option, the default chain
+// (environment, shared files, web identity of EKS, container and instance roles) is used.
+type AWSConfigOption func(*awsConfigBuilder)
+
+type AWSAssumeRoleOptions struct {
+	// ExternalID is required by roles trusting a third party. It is ignored by WithAWSWebIdentity.
+	ExternalID string
+	// SessionName defaults to one generated by the SDK.
+	SessionName string
+	// Duration of the role credentials. 0 uses the STS default of the provider.
+	Duration time.Duration
+}
+
+type awsConfigBuilder struct {
+	region      string
+	profile     string
+	credentials *aws.Credentials
+	preloaded   *aws.Config
+
+	assumeRoleARN    string
+	assumeRole       AWSAssumeRoleOptions
+	webIdentityARN   string
+	webIdentityToken string
+	webIdentity      AWSAssumeRoleOptions
+	retryMaxAttempts int
+	retryMaxBackoff  time.Duration
+	logger           *ThcompUtility.Logger
+	s3Options        []S3HelperOption
+}
+
+func WithAWSRegion(region string) AWSConfigOption {
+	return func(builder *awsConfigBuilder) {
+		builder.region = region
+	}
+}
+
+// WithAWSProfile loads the named profile of the shared config and credentials files.
+func WithAWSProfile(profile string) AWSConfigOption {
+	return func(builder *awsConfigBuilder) {
+		builder.profile = profile
+	}
+}
+
+// WithAWSStaticCredentials uses fixed keys. sessionToken is empty for long-term keys.
+func WithAWSStaticCredentials(accessKeyId, secretAccessKey, sessionToken string) AWSConfigOption {
+	return func(builder *awsConfigBuilder) {
+		builder.credentials = &aws.Credentials{
+			AccessKeyID:     accessKeyId,
+			SecretAccessKey: secretAccessKey,
+			SessionToken:    sessionToken,
+			Source:          credentials.StaticCredentialsName,
+		}
+	}
+}
+
+// WithAWSAssumeRole assumes roleARN with STS, using the other credentials (or the default chain) to call STS.
+// The role credentials are refreshed before they expire.
+func WithAWSAssumeRole(roleARN string, options *AWSAssumeRoleOptions) AWSConfigOption {
+	return func(builder *awsConfigBuilder) {
+		builder.assumeRoleARN = roleARN
+		builder.assumeRole = AWSAssumeRoleOptions{}
+		if options != nil {
+			builder.assumeRole = *options
+		}
+	}
+}
+
+// WithAWSWebIdentity assumes roleARN with the OIDC token read from tokenFile, e.g. by GitHub Actions or EKS.
+// Combined with WithAWSAssumeRole, the web identity role assumes the other role.
+func WithAWSWebIdentity(roleARN, tokenFile string, options *AWSAssumeRoleOptions) AWSConfigOption {
+	return func(builder *awsConfigBuilder) {
+		builder.webIdentityARN = roleARN
+		builder.webIdentityToken = tokenFile
+		builder.webIdentity = AWSAssumeRoleOptions{}
+		if options != nil {
+			builder.webIdentity = *options
+		}
+	}
+}
+
+// WithAWSConfig starts from a configuration loaded by the caller instead of the default one.
+// The other options are applied over it, except WithAWSProfile, which needs loading.
+func WithAWSConfig(config aws.Config) AWSConfigOption {
+	return func(builder *awsConfigBuilder) {
+		builder.preloaded = &config
+	}
+}
+
+// WithAWSRetry sets the attempts of every call (1 disables retries) and the longest backoff between them.
+// Zero keeps the SDK default.
+func WithAWSRetry(maxAttempts int, maxBackoff time.Duration) AWSConfigOption {
+	return func(builder *awsConfigBuilder) {
+		builder.retryMaxAttempts = maxAttempts
+		builder.retryMaxBackoff = maxBackoff
+	}
+}
+
+// WithAWSLogger sets the logger of the helper, which also receives the warnings and retries of the SDK.
+func WithAWSLogger(logger *ThcompUtility.Logger) AWSConfigOption {
+	return func(builder *awsConfigBuilder) {
+		builder.logger = logger
+	}
+}
+
+// WithS3Options applies S3 client options, such as WithS3Endpoint, to the helpers of S3.
+func WithS3Options(options ...S3HelperOption) AWSConfigOption {
+	return func(builder *awsConfigBuilder) {
+		builder.s3Options = append(builder.s3Options, options...)
+	}
+}
+
+func newAWSConfigBuilder(options []AWSConfigOption) *awsConfigBuilder {
+	builder := &awsConfigBuilder{}
+	for _, option := range options {
+		if option != nil {
+			option(builder)
+		}
+	}
+
+	return builder
+}
+
+// NewAWSConfig loads the configuration of options, for clients of services without helper.
+func NewAWSConfig(ctx context.Context, options ...AWSConfigOption) (aws.Config, error) {
+	return newAWSConfigBuilder(options).load(ctx)
+}
+
+func (builder *awsConfigBuilder) load(ctx context.Context) (awsConfig aws.Config, err error) {
+	if builder.preloaded != nil {
+		if builder.profile != "" {
+			return aws.Config{}, errors.New("a profile cannot be combined with a preloaded configuration")
+		}
+		awsConfig = builder.preloaded.Copy()
+		if builder.region != "" {
+			awsConfig.Region = builder.region
+		}
+		if builder.credentials != nil {
+			awsConfig.Credentials = aws.NewCredentialsCache(credentials.StaticCredentialsProvider{Value: *builder.credentials})
+		}
+	} else {
+		loadOptions := []func(*config.LoadOptions) error{}
+		if builder.region != "" {
+			loadOptions = append(loadOptions, config.WithRegion(builder.region))
+		}
+		if builder.profile != "" {
+			loadOptions = append(loadOptions, config.WithSharedConfigProfile(builder.profile))
+		}
+		if builder.credentials != nil {
+			loadOptions = append(loadOptions, config.WithCredentialsProvider(credentials.StaticCredentialsProvider{Value: *builder.credentials}))
+		}
+		if awsConfig, err = config.LoadDefaultConfig(ctx, loadOptions...); err != nil {
+			return aws.Config{}, fmt.Errorf("loading the AWS configuration: %w", err)
+		}
+	}
+
+	if builder.retryMaxAttempts > 0 || builder.retryMaxBackoff > 0 {
+		awsConfig.Retryer = func() aws.Retryer {
+			return retry.NewStandard(func(options *retry.StandardOptions) {
+				if builder.retryMaxAttempts > 0 {
+					options.MaxAttempts = builder.retryMaxAttempts
+				}
+				if builder.retryMaxBackoff > 0 {
+					options.MaxBackoff = builder.retryMaxBackoff
+				}
+			})
+		}
+	}
+	if builder.logger != nil {
+		awsConfig.Logger = awsLogger{logger: builder.logger}
+		awsConfig.ClientLogMode |= aws.LogRetries
+	}
+
+	if builder.webIdentityARN != "" {
+		provider := stscreds.NewWebIdentityRoleProvider(sts.NewFromConfig(awsConfig), builder.webIdentityARN, stscreds.IdentityTokenFile(builder.webIdentityToken), func(options *stscreds.WebIdentityRoleOptions) {
+			options.RoleSessionName = builder.webIdentity.SessionName
+			if builder.webIdentity.Duration > 0 {
+				options.Duration = builder.webIdentity.Duration
+			}
+		})
+		awsConfig.Credentials = aws.NewCredentialsCache(provider)
+	}
+	if builder.assumeRoleARN != "" {
+		provider := stscreds.NewAssumeRoleProvider(sts.NewFromConfig(awsConfig), builder.assumeRoleARN, func(options *stscreds.AssumeRoleOptions) {
+			if builder.assumeRole.ExternalID != "" {
+				options.ExternalID = aws.String(builder.assumeRole.ExternalID)
+			}
+			if builder.assumeRole.SessionName != "" {
+				options.RoleSessionName = builder.assumeRole.SessionName
+			}
+			if builder.assumeRole.Duration > 0 {
+				options.Duration = builder.assumeRole.Duration
+			}
+		})
+		awsConfig.Credentials = aws.NewCredentialsCache(provider)
+	}
+
+	return
+}
+
+// awsLogger forwards the logs of the SDK to the logger of the helper.
+type awsLogger struct {
+	logger *ThcompUtility.Logger
+}
+
+func (adapter awsLogger) Logf(classification logging.Classification, format string, args ...interface{}) {
+	if classification == logging.Warn {
+		adapter.logger.LogfW(format, args...)
+	} else {
+		adapter.logger.LogfD(format, args...)
+	}
+}
@@ -0,0 +1,178 @@
+package awssdkhelper
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/credentials"
+	TestUtility "github.com/thcomp/GoLang_TestUtility"
+	ThcompUtility "github.com/thcomp/GoLang_Utility"
+)
+
+// fakeSTSServer answers AssumeRole and AssumeRoleWithWebIdentity, recording the form of every call.
+type fakeSTSServer struct {
+	mutex  sync.Mutex
+	calls  []map[string]string
+	server *httptest.Server
+}
+
+func newFakeSTSServer(t *testing.T) *fakeSTSServer {
+	fake := &fakeSTSServer{}
+	fake.server = httptest.NewServer(fake)
+	t.Cleanup(fake.server.Close)
+
+	return fake
+}
+
+func (fake *fakeSTSServer) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	fake.mutex.Lock()
+	defer fake.mutex.Unlock()
+
+	r.ParseForm()
+	call := map[string]string{}
+	for name := range r.PostForm {
+		call[name] = r.PostForm.Get(name)
+	}
+	fake.calls = append(fake.calls, call)
+
+	action := call["Action"]
+	if action != "AssumeRole" && action != "AssumeRoleWithWebIdentity" {
+		w.WriteHeader(http.StatusBadRequest)
+		return
+	}
+	w.Header().Set("Content-Type", "text/xml")
+	fmt.Fprintf(w, `<%sResponse xmlns="https://sts.amazonaws.com/doc/2011-06-15/"><%sResult><Credentials>`+
+		`<AccessKeyId>ASIA%d</AccessKeyId><SecretAccessKey>secret-%s</SecretAccessKey><SessionToken>token-%s</SessionToken>`+
+		`<Expiration>%s</Expiration></Credentials><AssumedRoleUser><Arn>%s</Arn><AssumedRoleId>ID:session</AssumedRoleId></AssumedRoleUser>`+
+		`</%sResult><ResponseMetadata><RequestId>request</RequestId></ResponseMetadata></%sResponse>`,
+		action, action, len(fake.calls), action, action, time.Now().Add(time.Hour).UTC().Format(time.RFC3339), call["RoleArn"], action, action)
+}
+
+// baseConfig calls the fake STS server with static keys.
+func (fake *fakeSTSServer) baseConfig() aws.Config {
+	return aws.Config{
+		Region:       "us-east-1",
+		Credentials:  credentials.NewStaticCredentialsProvider("AKIDBASE", "SECRET", ""),
+		BaseEndpoint: aws.String(fake.server.URL),
+		HTTPClient:   fake.server.Client(),
+	}
+}
+
+func Test_NewAWSConfig_Credentials(t *testing.T) {
+	tester := TestUtility.NewTestHelper(t)
+	ctx := context.Background()
+
+	awsConfig, err := NewAWSConfig(ctx, WithAWSRegion("ap-northeast-1"), WithAWSStaticCredentials("AKIDSTATIC", "SECRET", "SESSION"))
+	tester.Fatalf(err == nil, "NewAWSConfig: %v", err)
+	value, err := awsConfig.Credentials.Retrieve(ctx)
+	tester.Errorf(err == nil && awsConfig.Region == "ap-northeast-1" && value.AccessKeyID == "AKIDSTATIC" && value.SessionToken == "SESSION", "static credentials: %s, %+v, %v", awsConfig.Region, value, err)
+
+	directory := t.TempDir()
+	configFile := filepath.Join(directory, "config")
+	credentialsFile := filepath.Join(directory, "credentials")
+	os.WriteFile(configFile, []byte("[profile ci]\nregion = eu-west-1\n"), 0o600)
+	os.WriteFile(credentialsFile, []byte("[ci]\naws_access_key_id = AKIDPROFILE\naws_secret_access_key = SECRET\n"), 0o600)
+	t.Setenv("AWS_CONFIG_FILE", configFile)
+	t.Setenv("AWS_SHARED_CREDENTIALS_FILE", credentialsFile)
+	for _, name := range []string{"AWS_PROFILE", "AWS_REGION", "AWS_DEFAULT_REGION", "AWS_ACCESS_KEY_ID", "AWS_SECRET_ACCESS_KEY", "AWS_SESSION_TOKEN"} {
+		t.Setenv(name, "")
+	}
+	awsConfig, err = NewAWSConfig(ctx, WithAWSProfile("ci"))
+	tester.Fatalf(err == nil, "NewAWSConfig of a profile: %v", err)
+	value, err = awsConfig.Credentials.Retrieve(ctx)
+	tester.Errorf(err == nil && awsConfig.Region == "eu-west-1" && value.AccessKeyID == "AKIDPROFILE", "profile: %s, %+v, %v", awsConfig.Region, value, err)
+
+	_, err = NewAWSConfig(ctx, WithAWSProfile("missing"))
+	tester.Errorf(err != nil, "missing profile is loaded")
+	_, err = NewAWSConfig(ctx, WithAWSConfig(aws.Config{}), WithAWSProfile("ci"))
+	tester.Errorf(err != nil, "profile combined with a preloaded configuration")
+}
+
+func Test_NewAWSConfig_AssumeRole(t *testing.T) {
+	tester := TestUtility.NewTestHelper(t)
+	fake := newFakeSTSServer(t)
+	ctx := context.Background()
+
+	awsConfig, err := NewAWSConfig(ctx,
+		WithAWSConfig(fake.baseConfig()),
+		WithAWSAssumeRole("arn:aws:iam::123456789012:role/partner", &AWSAssumeRoleOptions{ExternalID: "external-id", SessionName: "batch"}),
+	)
+	tester.Fatalf(err == nil, "NewAWSConfig: %v", err)
+	value, err := awsConfig.Credentials.Retrieve(ctx)
+	tester.Fatalf(err == nil, "Retrieve: %v", err)
+	tester.Errorf(value.AccessKeyID == "ASIA1" && value.SessionToken == "token-AssumeRole" && value.CanExpire, "role credentials: %+v", value)
+	call := fake.calls[0]
+	tester.Errorf(call["RoleArn"] == "arn:aws:iam::123456789012:role/partner" && call["ExternalId"] == "external-id" && call["RoleSessionName"] == "batch", "AssumeRole call: %v", call)
+
+	// cached until they expire
+	_, err = awsConfig.Credentials.Retrieve(ctx)
+	tester.Errorf(err == nil && len(fake.calls) == 1, "credentials are not cached: %d calls", len(fake.calls))
+}
+
+func Test_NewAWSConfig_WebIdentity(t *testing.T) {
+	tester := TestUtility.NewTestHelper(t)
+	fake := newFakeSTSServer(t)
+	ctx := context.Background()
+	tokenFile := filepath.Join(t.TempDir(), "token")
+	os.WriteFile(tokenFile, []byte("oidc-token"), 0o600)
+
+	// the web identity role then assumes the target role
+	awsConfig, err := NewAWSConfig(ctx,
+		WithAWSConfig(fake.baseConfig()),
+		WithAWSWebIdentity("arn:aws:iam::123456789012:role/ci", tokenFile, &AWSAssumeRoleOptions{SessionName: "ci"}),
+		WithAWSAssumeRole("arn:aws:iam::210987654321:role/deploy", nil),
+	)
+	tester.Fatalf(err == nil, "NewAWSConfig: %v", err)
+	value, err := awsConfig.Credentials.Retrieve(ctx)
+	tester.Fatalf(err == nil, "Retrieve: %v", err)
+	tester.Errorf(value.SessionToken == "token-AssumeRole" && len(fake.calls) == 2, "role credentials: %+v, %d calls", value, len(fake.calls))
+	tester.Errorf(fake.calls[0]["Action"] == "AssumeRoleWithWebIdentity" && fake.calls[0]["WebIdentityToken"] == "oidc-token" && fake.calls[0]["RoleArn"] == "arn:aws:iam::123456789012:role/ci", "web identity call: %v", fake.calls[0])
+	tester.Errorf(fake.calls[1]["Action"] == "AssumeRole" && fake.calls[1]["RoleArn"] == "arn:aws:iam::210987654321:role/deploy", "assume role call: %v", fake.calls[1])
+}
+
+func Test_NewAWSConfig_RetryAndLogger(t *testing.T) {
+	tester := TestUtility.NewTestHelper(t)
+	logger := ThcompUtility.NewLocalLogger()
+
+	awsConfig, err := NewAWSConfig(context.Background(), WithAWSConfig(aws.Config{Region: "us-east-1"}), WithAWSRetry(7, 3*time.Second), WithAWSLogger(logger))
+	tester.Fatalf(err == nil, "NewAWSConfig: %v", err)
+	tester.Errorf(awsConfig.Retryer != nil && awsConfig.Retryer().MaxAttempts() == 7, "retryer is not set")
+	tester.Errorf(awsConfig.Logger != nil && awsConfig.ClientLogMode&aws.LogRetries != 0, "logger is not set")
+}
+
+func Test_NewHelpersWithConfig(t *testing.T) {
+	tester := TestUtility.NewTestHelper(t)
+	fake := newFakeS3Server(t, "config-bucket")
+	ctx := context.Background()
+	logger := ThcompUtility.NewLocalLogger()
+
+	helper, err := NewS3HelperWithConfig(ctx, fake.bucket,
+		WithAWSRegion("us-east-1"),
+		WithAWSStaticCredentials("AKIDEXAMPLE", "SECRET", "SESSION"),
+		WithAWSRetry(2, 0),
+		WithAWSLogger(logger),
+		WithS3Options(WithS3Endpoint(fake.server.URL), WithS3PathStyle(), WithS3DisableChecksums(), WithS3HTTPClient(fake.server.Client())),
+	)
+	tester.Fatalf(err == nil && helper.logger == logger, "NewS3HelperWithConfig: %v", err)
+	err = helper.PutData("config.txt", []byte("config"))
+	tester.Fatalf(err == nil, "PutData: %v", err)
+	item, err := helper.GetItem("config.txt")
+	tester.Fatalf(err == nil, "GetItem: %v", err)
+	data, err := io.ReadAll(item)
+	item.Close()
+	tester.Errorf(err == nil && string(data) == "config", "GetItem content: %q, %v", data, err)
+
+	sqsHelper, err := NewSQSHelperWithConfig(ctx, "https://sqs.us-east-1.amazonaws.com/123456789012/jobs.fifo", WithAWSRegion("us-east-1"), WithAWSStaticCredentials("AKIDEXAMPLE", "SECRET", ""))
+	tester.Errorf(err == nil && sqsHelper.fifo, "NewSQSHelperWithConfig: %v", err)
+	_, err = NewSQSHelperWithConfig(ctx, "https://sqs.us-east-1.amazonaws.com/123456789012/jobs", WithAWSConfig(aws.Config{}), WithAWSProfile("ci"))
+	tester.Errorf(err != nil, "invalid configuration is loaded")
+}
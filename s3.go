@@ -5,13 +5,10 @@ import (
 	"context"
 	"fmt"
 	"io"
-	"os"
 	"strings"
 	"time"
 
 	"github.com/aws/aws-sdk-go-v2/aws"
-	"github.com/aws/aws-sdk-go-v2/config"
-	"github.com/aws/aws-sdk-go-v2/credentials"
 	"github.com/aws/aws-sdk-go-v2/service/s3"
 
 	ThcompUtility "github.com/thcomp/GoLang_Utility"
@@ -22,47 +19,85 @@ type S3Helper struct {
 	client *s3.Client
 	logger *ThcompUtility.Logger
 
+	timeout            time.Duration
+	multipartThreshold int64
+	encryption         *S3Encryption
+	compression        S3Compression
+	decompression      bool
+
 	createdByFunc bool
 }
 
-func NewS3Helper(accessKeyId, secretAccessKey, region, bucket string, logger *ThcompUtility.Logger) (ret *S3Helper) {
-	if config, err := config.LoadDefaultConfig(
+// NewS3Helper returns a helper of bucket with static keys, or nil when the configuration cannot be loaded.
+// options target S3-compatible stores, see WithS3Endpoint. NewS3HelperWithConfig accepts other credentials.
+func NewS3Helper(accessKeyId, secretAccessKey, region, bucket string, logger *ThcompUtility.Logger, options ...S3HelperOption) (ret *S3Helper) {
+	ret, _ = NewS3HelperWithConfig(
 		context.TODO(),
-		config.WithRegion(region),
-		config.WithCredentialsProvider(
-			credentials.NewStaticCredentialsProvider(
-				accessKeyId,
-				secretAccessKey,
-				``,
-			),
-		),
-	); err == nil {
+		bucket,
+		WithAWSRegion(region),
+		WithAWSStaticCredentials(accessKeyId, secretAccessKey, ``),
+		WithAWSLogger(logger),
+		WithS3Options(options...),
+	)
+
+	return ret
+}
+
+// NewS3HelperWithConfig returns a helper of bucket with the configuration of options,
+// e.g. WithAWSProfile or WithAWSAssumeRole, and the default credential chain otherwise.
+func NewS3HelperWithConfig(ctx context.Context, bucket string, options ...AWSConfigOption) (ret *S3Helper, err error) {
+	builder := newAWSConfigBuilder(options)
+	if awsConfig, loadErr := builder.load(ctx); loadErr == nil {
 		ret = &S3Helper{
 			bucket:        bucket,
-			logger:        logger,
+			logger:        builder.logger,
 			createdByFunc: true,
 		}
 
-		ret.client = s3.NewFromConfig(config)
+		ret.client = s3.NewFromConfig(awsConfig, newS3HelperConfig(builder.s3Options).apply)
+	} else {
+		err = loadErr
 	}
 
-	return ret
+	return
+}
+
+// SetTimeout sets a timeout applied to every S3 call. Zero disables it.
+// A deadline already set on the context passed to a *WithContext method is kept when it is earlier.
+func (s3Helper *S3Helper) SetTimeout(timeout time.Duration) {
+	s3Helper.timeout = timeout
+}
+
+func (s3Helper *S3Helper) callContext(ctx context.Context) (context.Context, context.CancelFunc) {
+	if ctx == nil {
+		ctx = context.Background()
+	}
+	if s3Helper.timeout > 0 {
+		return context.WithTimeout(ctx, s3Helper.timeout)
+	}
+
+	return context.WithCancel(ctx)
 }
 
 func (s3Helper *S3Helper) ListItems(prefix string, continuationToken *string) (items [](*S3Item), nextContinuationToken *string, err error) {
+	return s3Helper.ListItemsWithContext(context.Background(), prefix, continuationToken)
+}
+
+func (s3Helper *S3Helper) ListItemsWithContext(ctx context.Context, prefix string, continuationToken *string) (items [](*S3Item), nextContinuationToken *string, err error) {
 	needSubPrefix := false
 	if strings.HasSuffix(prefix, "*") {
 		prefix = strings.TrimRight(prefix, "*")
 		needSubPrefix = true
 	}
 
-	ctx := context.Background()
-	output, listErr := s3Helper.client.ListObjectsV2(ctx, &s3.ListObjectsV2Input{
+	callCtx, cancel := s3Helper.callContext(ctx)
+	output, listErr := s3Helper.client.ListObjectsV2(callCtx, &s3.ListObjectsV2Input{
 		Bucket:            &s3Helper.bucket,
 		ContinuationToken: continuationToken,
 		Delimiter:         aws.String("/"),
 		Prefix:            &prefix,
 	})
+	cancel()
 
 	if listErr == nil {
 		nextContinuationToken = output.NextContinuationToken
@@ -71,16 +106,7 @@ func (s3Helper *S3Helper) ListItems(prefix string, continuationToken *string) (i
 			items = [](*S3Item){}
 			for _, content := range output.Contents {
 				if content.Key != nil && (*content.Key) != prefix {
-					items = append(
-						items,
-						&S3Item{
-							IsDir:        content.Size == nil,
-							Path:         (*content.Key),
-							size:         content.Size,
-							lastModified: content.LastModified,
-							helper:       s3Helper,
-						},
-					)
+					items = append(items, s3Helper.newS3ItemFromObject(ctx, content))
 				}
 			}
 		}
@@ -94,25 +120,18 @@ func (s3Helper *S3Helper) ListItems(prefix string, continuationToken *string) (i
 							IsDir:  true,
 							Path:   (*commonPrefix.Prefix),
 							helper: s3Helper,
+							ctx:    ctx,
 						},
 					)
 
-					if needSubPrefix {
-						contToken := (*string)(nil)
-						for {
-							if tempItems, tempToken, tempErr := s3Helper.ListItems(*commonPrefix.Prefix, contToken); tempErr == nil {
-								if tempItems != nil {
-									items = append(items, tempItems...)
-								}
-								contToken = tempToken
-							} else {
-								err = tempErr
-								contToken = nil
-							}
-
-							if contToken == nil {
+					if needSubPrefix && err == nil {
+						// every page and level below the sub-prefix
+						for subItem, walkErr := range s3Helper.Walk(ctx, *commonPrefix.Prefix, &S3WalkOptions{IncludeDirs: true}) {
+							if walkErr != nil {
+								err = walkErr
 								break
 							}
+							items = append(items, subItem)
 						}
 					}
 				}
@@ -126,19 +145,42 @@ func (s3Helper *S3Helper) ListItems(prefix string, continuationToken *string) (i
 }
 
 func (s3Helper *S3Helper) GetItem(s3Filepath string) (item *S3Item, retErr error) {
-	ctx := context.Background()
-	if output, err := s3Helper.client.GetObject(ctx, &s3.GetObjectInput{
+	return s3Helper.GetItemWithContext(context.Background(), s3Filepath)
+}
+
+// GetItemWithContext opens the object. The body stays bound to ctx (and the helper timeout)
+// until the item is closed, so cancellation also stops reading.
+func (s3Helper *S3Helper) GetItemWithContext(ctx context.Context, s3Filepath string) (item *S3Item, retErr error) {
+	return s3Helper.getItem(ctx, s3Filepath, nil)
+}
+
+func (s3Helper *S3Helper) getItem(ctx context.Context, s3Filepath string, options *S3GetOptions) (item *S3Item, retErr error) {
+	input := &s3.GetObjectInput{
 		Bucket: aws.String(s3Helper.bucket),
 		Key:    aws.String(s3Filepath),
-	}); err == nil {
+	}
+	options.applyToGetObject(input)
+	s3Helper.encryption.applyToGetObject(input)
+
+	callCtx, cancel := s3Helper.callContext(ctx)
+	if output, err := s3Helper.client.GetObject(callCtx, input); err == nil {
 		item = &S3Item{
 			IsDir:        false,
 			Path:         s3Filepath,
 			lastModified: output.LastModified,
 			size:         output.ContentLength,
+			etag:         output.ETag,
+			attributes:   newS3ObjectAttributesOfGet(output),
+			versionID:    input.VersionId,
 			helper:       s3Helper,
+			ctx:          ctx,
+			reader:       newContextReadCloser(callCtx, output.Body, cancel),
+		}
+		if item.applyCompression(); item.compression != "" {
+			item.reader = &s3DecompressingReader{body: item.reader, compression: item.compression}
 		}
 	} else {
+		cancel()
 		retErr = err
 	}
 
@@ -146,56 +188,51 @@ func (s3Helper *S3Helper) GetItem(s3Filepath string) (item *S3Item, retErr error
 }
 
 func (s3Helper *S3Helper) PutItem(item *S3Item) (err error) {
-	ctx := context.Background()
+	return s3Helper.PutItemWithContext(context.Background(), item)
+}
+
+func (s3Helper *S3Helper) PutItemWithContext(ctx context.Context, item *S3Item) (err error) {
+	callCtx, cancel := s3Helper.callContext(ctx)
+	defer cancel()
 
 	mimeType := ThcompUtility.GetMIMETypeFromExtension(item.Path)
-	_, err = s3Helper.client.PutObject(ctx, &s3.PutObjectInput{
+	input := &s3.PutObjectInput{
 		Bucket:      &s3Helper.bucket,
 		Key:         &item.Path,
 		Body:        item, // You need to provide a valid io.Reader here
 		ContentType: aws.String(mimeType),
-	})
+	}
+	s3Helper.encryption.applyToPutObject(input)
+	_, err = s3Helper.client.PutObject(callCtx, input)
 
 	return
 }
 
 func (s3Helper *S3Helper) PutData(itemKey string, data []byte) (err error) {
-	ctx := context.Background()
-	mimeType := ThcompUtility.GetMIMETypeFromExtension(itemKey)
-
-	reader := bytes.NewReader(data)
-	_, err = s3Helper.client.PutObject(ctx, &s3.PutObjectInput{
-		Bucket:      &s3Helper.bucket,
-		Key:         &itemKey,
-		Body:        reader, // You need to provide a valid io.Reader here
-		ContentType: aws.String(mimeType),
-	})
+	return s3Helper.PutDataWithContext(context.Background(), itemKey, data)
+}
 
-	return
+func (s3Helper *S3Helper) PutDataWithContext(ctx context.Context, itemKey string, data []byte) (err error) {
+	return s3Helper.PutDataWithOptions(ctx, itemKey, data, nil)
 }
 
 func (s3Helper *S3Helper) PutFile(itemKey string, filepath string) (err error) {
-	ctx := context.Background()
-
-	if reader, readErr := os.Open(filepath); readErr == nil {
-		defer reader.Close()
-
-		mimeType := ThcompUtility.GetMIMETypeFromExtension(filepath)
-		_, err = s3Helper.client.PutObject(ctx, &s3.PutObjectInput{
-			Bucket:      &s3Helper.bucket,
-			Key:         &itemKey,
-			Body:        reader, // You need to provide a valid io.Reader here
-			ContentType: aws.String(mimeType),
-		})
-	}
+	return s3Helper.PutFileWithContext(context.Background(), itemKey, filepath)
+}
 
-	return
+func (s3Helper *S3Helper) PutFileWithContext(ctx context.Context, itemKey string, filepath string) (err error) {
+	return s3Helper.PutFileWithOptions(ctx, itemKey, filepath, nil)
 }
 
 func (s3Helper *S3Helper) DeleteItem(itemKey string) (err error) {
-	ctx := context.Background()
+	return s3Helper.DeleteItemWithContext(context.Background(), itemKey)
+}
+
+func (s3Helper *S3Helper) DeleteItemWithContext(ctx context.Context, itemKey string) (err error) {
+	callCtx, cancel := s3Helper.callContext(ctx)
+	defer cancel()
 
-	_, err = s3Helper.client.DeleteObject(ctx, &s3.DeleteObjectInput{
+	_, err = s3Helper.client.DeleteObject(callCtx, &s3.DeleteObjectInput{
 		Bucket: &s3Helper.bucket,
 		Key:    &itemKey,
 	})
@@ -208,23 +245,63 @@ type S3Item struct {
 	IsDir        bool
 	lastModified *time.Time
 	size         *int64
-	helper       *S3Helper
-	reader       io.ReadCloser
+	etag         *string
+	attributes   *S3ObjectAttributes
+	// clientSide is set on items read through S3EncryptedHelper. size is then the plaintext size.
+	clientSide *s3ClientSideDecryption
+	// compression is set on items decompressed on read (see SetDecompression). size is then the size before compression.
+	compression S3Compression
+	// versionID pins every read to one version, for items returned by GetItemVersion
+	versionID *string
+	helper    *S3Helper
+	ctx       context.Context
+	reader    io.ReadCloser
+	// offset is the position of the next Read, moved by Seek
+	offset int64
 }
 
 func (item *S3Item) Reader() (reader io.ReadCloser, retErr error) {
+	return item.ReaderWithContext(item.context())
+}
+
+// ReaderWithContext opens the object body bound to ctx. Reading fails with ctx.Err() once ctx is done.
+// An already opened body is returned as is. After Seek, the body starts at the sought offset.
+func (item *S3Item) ReaderWithContext(ctx context.Context) (reader io.ReadCloser, retErr error) {
 	if item.reader == nil {
-		ctx := context.Background()
-		if output, err := item.helper.client.GetObject(ctx, &s3.GetObjectInput{
-			Bucket: aws.String(item.helper.bucket),
-			Key:    aws.String(item.Path),
-		}); err == nil {
-			item.reader = output.Body
-			reader = item.reader
+		if retErr = item.resolveCompression(ctx); retErr != nil {
+			return
+		}
+	}
+
+	if item.reader == nil && item.clientSide != nil {
+		item.reader, retErr = item.clientSide.open(ctx, item, item.offset, item.clientSide.cipherSize)
+	} else if item.reader == nil && item.compression != "" {
+		item.reader, retErr = item.openDecompressed(ctx, item.offset)
+	} else if item.reader == nil {
+		input := &s3.GetObjectInput{
+			Bucket:    aws.String(item.helper.bucket),
+			Key:       aws.String(item.Path),
+			VersionId: item.versionID,
+		}
+		if item.offset > 0 {
+			input.Range = aws.String(fmt.Sprintf("bytes=%d-", item.offset))
+			input.IfMatch = item.etag
+		}
+		item.helper.encryption.applyToGetObject(input)
+
+		callCtx, cancel := item.helper.callContext(ctx)
+		if output, err := item.helper.client.GetObject(callCtx, input); err == nil {
+			item.reader = newContextReadCloser(callCtx, output.Body, cancel)
+		} else if isS3InvalidRange(err) {
+			// sought at or past the end
+			cancel()
+			item.reader = io.NopCloser(bytes.NewReader(nil))
 		} else {
+			cancel()
 			retErr = err
 		}
 	}
+	reader = item.reader
 
 	return
 }
@@ -232,6 +309,7 @@ func (item *S3Item) Reader() (reader io.ReadCloser, retErr error) {
 func (item *S3Item) Read(buffer []byte) (size int, retErr error) {
 	if reader, err := item.Reader(); err == nil {
 		size, retErr = reader.Read(buffer)
+		item.offset += int64(size)
 	} else {
 		retErr = err
 	}
@@ -246,11 +324,16 @@ func (item *S3Item) Close() (retErr error) {
 		}
 		item.reader = nil
 	}
+	item.offset = 0
 
 	return
 }
 
 func (item *S3Item) Size() (int64, error) {
+	if err := item.resolveCompression(item.context()); err != nil {
+		return -1, err
+	}
+
 	if item.size != nil {
 		return *item.size, nil
 	}
@@ -273,3 +356,35 @@ func (item *S3Item) LastModifiedNano() (int64, error) {
 
 	return 0, fmt.Errorf("lastModified is nil for item %s", item.Path)
 }
+
+type contextReadCloser struct {
+	ctx    context.Context
+	body   io.ReadCloser
+	cancel context.CancelFunc
+}
+
+func newContextReadCloser(ctx context.Context, body io.ReadCloser, cancel context.CancelFunc) *contextReadCloser {
+	return &contextReadCloser{
+		ctx:    ctx,
+		body:   body,
+		cancel: cancel,
+	}
+}
+
+func (reader *contextReadCloser) Read(buffer []byte) (size int, err error) {
+	if err = reader.ctx.Err(); err == nil {
+		size, err = reader.body.Read(buffer)
+		if err != nil && err != io.EOF && reader.ctx.Err() != nil {
+			err = reader.ctx.Err()
+		}
+	}
+
+	return
+}
+
+func (reader *contextReadCloser) Close() (err error) {
+	err = reader.body.Close()
+	reader.cancel()
+
+	return
+}
@@ -0,0 +1,598 @@
+package awssdkhelper
+
+import (
+	"bytes"
+	"context"
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/rand"
+	"encoding/base64"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"strconv"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/kms"
+	kmstypes "github.com/aws/aws-sdk-go-v2/service/kms/types"
+	"github.com/aws/aws-sdk-go-v2/service/s3"
+
+	ThcompUtility "github.com/thcomp/GoLang_Utility"
+)
+
+// S3ClientSideChunkSize is the plaintext size of each AES-GCM chunk of client-side encrypted objects.
+const S3ClientSideChunkSize = 64 * 1024
+
+// s3ClientSideAlgorithm names the content encryption, stored with every object.
+const s3ClientSideAlgorithm = "AES256-GCM-CHUNKED"
+
+// metadata names of client-side encrypted objects (x-amz-meta-*)
+const (
+	s3MetaClientSideKey       = "cse-key"
+	s3MetaClientSideIV        = "cse-iv"
+	s3MetaClientSideWrap      = "cse-wrap-alg"
+	s3MetaClientSideAlgorithm = "cse-cek-alg"
+	s3MetaClientSideChunkSize = "cse-chunk-size"
+)
+
+var ErrS3NotClientSideEncrypted = errors.New("s3 object is not client-side encrypted")
+var ErrS3ClientSideDecryption = errors.New("s3 client-side decryption failed")
+
+// S3KeyProvider generates and unwraps the data keys of client-side encryption. Every object is encrypted with
+// its own data key, stored wrapped in the object metadata.
+type S3KeyProvider interface {
+	// Algorithm names the key wrapping. It is stored with the object, and checked before unwrapping.
+	Algorithm() string
+	// GenerateDataKey returns a new 256-bit data key, in plaintext and wrapped.
+	GenerateDataKey(ctx context.Context) (dataKey, wrappedKey []byte, err error)
+	// UnwrapDataKey returns the plaintext of a data key wrapped by GenerateDataKey.
+	UnwrapDataKey(ctx context.Context, wrappedKey []byte) (dataKey []byte, err error)
+}
+
+// S3LocalKeyProvider wraps data keys with AES-GCM under a master key held by the process, e.g. for tests.
+type S3LocalKeyProvider struct {
+	aead cipher.AEAD
+}
+
+// NewS3LocalKeyProvider returns a provider wrapping with masterKey, which must be 16, 24 or 32 bytes.
+func NewS3LocalKeyProvider(masterKey []byte) (ret *S3LocalKeyProvider, err error) {
+	if block, blockErr := aes.NewCipher(masterKey); blockErr == nil {
+		if aead, aeadErr := cipher.NewGCM(block); aeadErr == nil {
+			ret = &S3LocalKeyProvider{aead: aead}
+		} else {
+			err = aeadErr
+		}
+	} else {
+		err = blockErr
+	}
+
+	return
+}
+
+func (provider *S3LocalKeyProvider) Algorithm() string {
+	return "local-aes-gcm"
+}
+
+// GenerateDataKey returns a random data key, wrapped as nonce followed by the sealed key.
+func (provider *S3LocalKeyProvider) GenerateDataKey(ctx context.Context) (dataKey, wrappedKey []byte, err error) {
+	dataKey = make([]byte, 32)
+	nonce := make([]byte, provider.aead.NonceSize())
+	if _, err = rand.Read(dataKey); err != nil {
+		return nil, nil, err
+	}
+	if _, err = rand.Read(nonce); err != nil {
+		return nil, nil, err
+	}
+
+	return dataKey, provider.aead.Seal(nonce, nonce, dataKey, nil), nil
+}
+
+func (provider *S3LocalKeyProvider) UnwrapDataKey(ctx context.Context, wrappedKey []byte) (dataKey []byte, err error) {
+	nonceSize := provider.aead.NonceSize()
+	if len(wrappedKey) < nonceSize {
+		return nil, fmt.Errorf("wrapped key of %d bytes is too short", len(wrappedKey))
+	}
+
+	return provider.aead.Open(nil, wrappedKey[:nonceSize], wrappedKey[nonceSize:], nil)
+}
+
+// S3KMSClient is the part of *kms.Client used by S3KMSKeyProvider.
+type S3KMSClient interface {
+	GenerateDataKey(ctx context.Context, params *kms.GenerateDataKeyInput, optFns ...func(*kms.Options)) (*kms.GenerateDataKeyOutput, error)
+	Decrypt(ctx context.Context, params *kms.DecryptInput, optFns ...func(*kms.Options)) (*kms.DecryptOutput, error)
+}
+
+// S3KMSKeyProvider generates data keys with KMS, so the master key never leaves KMS.
+type S3KMSKeyProvider struct {
+	client            S3KMSClient
+	keyID             string
+	encryptionContext map[string]string
+}
+
+// NewS3KMSKeyProvider returns a provider generating data keys under keyID (key ID, ARN or alias).
+// encryptionContext is bound to every data key: decrypting needs the same context.
+func NewS3KMSKeyProvider(client S3KMSClient, keyID string, encryptionContext map[string]string) *S3KMSKeyProvider {
+	return &S3KMSKeyProvider{
+		client:            client,
+		keyID:             keyID,
+		encryptionContext: encryptionContext,
+	}
+}
+
+func (provider *S3KMSKeyProvider) Algorithm() string {
+	return "kms"
+}
+
+func (provider *S3KMSKeyProvider) GenerateDataKey(ctx context.Context) (dataKey, wrappedKey []byte, err error) {
+	if output, generateErr := provider.client.GenerateDataKey(ctx, &kms.GenerateDataKeyInput{
+		KeyId:             aws.String(provider.keyID),
+		KeySpec:           kmstypes.DataKeySpecAes256,
+		EncryptionContext: provider.encryptionContext,
+	}); generateErr == nil {
+		dataKey, wrappedKey = output.Plaintext, output.CiphertextBlob
+	} else {
+		err = generateErr
+	}
+
+	return
+}
+
+func (provider *S3KMSKeyProvider) UnwrapDataKey(ctx context.Context, wrappedKey []byte) (dataKey []byte, err error) {
+	if output, decryptErr := provider.client.Decrypt(ctx, &kms.DecryptInput{
+		KeyId:             aws.String(provider.keyID),
+		CiphertextBlob:    wrappedKey,
+		EncryptionContext: provider.encryptionContext,
+	}); decryptErr == nil {
+		dataKey = output.Plaintext
+	} else {
+		err = decryptErr
+	}
+
+	return
+}
+
+// S3EncryptedHelper encrypts objects on the client with AES-GCM before uploading them, so S3 only stores
+// ciphertext. Each object has its own data key, wrapped by the key provider and stored with the IV in the
+// object metadata. The content is sealed in chunks of S3ClientSideChunkSize bytes, so uploads and downloads
+// stream, and ranged reads only fetch and decrypt the chunks they need.
+//
+// Items returned by GetItem decrypt transparently: Read, Seek, ReadAt, DownloadTo and Size all work on the plaintext.
+// Server-side encryption set on the helper still applies on top. The ObjectStore methods of the wrapped helper
+// read and write objects as stored, without client-side encryption.
+type S3EncryptedHelper struct {
+	helper   *S3Helper
+	provider S3KeyProvider
+}
+
+func NewS3EncryptedHelper(helper *S3Helper, provider S3KeyProvider) *S3EncryptedHelper {
+	return &S3EncryptedHelper{
+		helper:   helper,
+		provider: provider,
+	}
+}
+
+// Helper returns the wrapped helper, which reads and writes objects as stored, without client-side encryption.
+func (encrypted *S3EncryptedHelper) Helper() *S3Helper {
+	return encrypted.helper
+}
+
+func (encrypted *S3EncryptedHelper) PutData(itemKey string, data []byte) (err error) {
+	return encrypted.PutDataWithOptions(context.Background(), itemKey, data, nil)
+}
+
+func (encrypted *S3EncryptedHelper) PutDataWithContext(ctx context.Context, itemKey string, data []byte) (err error) {
+	return encrypted.PutDataWithOptions(ctx, itemKey, data, nil)
+}
+
+func (encrypted *S3EncryptedHelper) PutDataWithOptions(ctx context.Context, itemKey string, data []byte, options *S3PutOptions) (err error) {
+	return encrypted.UploadWithContext(ctx, itemKey, bytes.NewReader(data), &S3UploadOptions{
+		Size:       int64(len(data)),
+		PutOptions: options,
+	})
+}
+
+func (encrypted *S3EncryptedHelper) PutFile(itemKey string, filepath string) (err error) {
+	return encrypted.PutFileWithOptions(context.Background(), itemKey, filepath, nil)
+}
+
+func (encrypted *S3EncryptedHelper) PutFileWithContext(ctx context.Context, itemKey string, filepath string) (err error) {
+	return encrypted.PutFileWithOptions(ctx, itemKey, filepath, nil)
+}
+
+// PutFileWithOptions encrypts and uploads the file. The content type defaults to the one derived from the file extension.
+func (encrypted *S3EncryptedHelper) PutFileWithOptions(ctx context.Context, itemKey string, filepath string, options *S3PutOptions) (err error) {
+	if file, openErr := os.Open(filepath); openErr == nil {
+		defer file.Close()
+
+		uploadOptions := &S3UploadOptions{PutOptions: options}
+		if options == nil || options.ContentType == "" {
+			uploadOptions.ContentType = ThcompUtility.GetMIMETypeFromExtension(filepath)
+		}
+		if fileInfo, statErr := file.Stat(); statErr == nil {
+			uploadOptions.Size = fileInfo.Size()
+		}
+		err = encrypted.UploadWithContext(ctx, itemKey, file, uploadOptions)
+	} else {
+		err = openErr
+	}
+
+	return
+}
+
+// UploadWithContext encrypts body chunk by chunk while uploading it like S3Helper.UploadWithContext.
+// options.Size is the plaintext length. Uploads cannot be resumed with options.UploadID, since
+// every upload uses a new data key.
+func (encrypted *S3EncryptedHelper) UploadWithContext(ctx context.Context, key string, body io.Reader, options *S3UploadOptions) (err error) {
+	uploadOptions := S3UploadOptions{}
+	if options != nil {
+		uploadOptions = *options
+	}
+	if uploadOptions.UploadID != "" {
+		return fmt.Errorf("client-side encrypted upload of %s cannot be resumed", key)
+	}
+
+	dataKey, wrappedKey, err := encrypted.provider.GenerateDataKey(ctx)
+	if err != nil {
+		return fmt.Errorf("generating the data key of %s: %w", key, err)
+	}
+	baseNonce := make([]byte, 12)
+	if _, err = rand.Read(baseNonce); err != nil {
+		return err
+	}
+	aead, err := newS3ClientSideAEAD(dataKey)
+	if err != nil {
+		return err
+	}
+
+	putOptions := S3PutOptions{}
+	if uploadOptions.PutOptions != nil {
+		putOptions = *uploadOptions.PutOptions
+	}
+	metadata := map[string]string{}
+	for name, value := range putOptions.Metadata {
+		metadata[name] = value
+	}
+	metadata[s3MetaClientSideKey] = base64.StdEncoding.EncodeToString(wrappedKey)
+	metadata[s3MetaClientSideIV] = base64.StdEncoding.EncodeToString(baseNonce)
+	metadata[s3MetaClientSideWrap] = encrypted.provider.Algorithm()
+	metadata[s3MetaClientSideAlgorithm] = s3ClientSideAlgorithm
+	metadata[s3MetaClientSideChunkSize] = strconv.Itoa(S3ClientSideChunkSize)
+	putOptions.Metadata = metadata
+	// ciphertext does not compress
+	putOptions.Compression = S3CompressionNone
+	uploadOptions.PutOptions = &putOptions
+
+	if uploadOptions.ContentType == "" && putOptions.ContentType == "" {
+		// the content type is derived from the key, as for unencrypted uploads
+		uploadOptions.ContentType = ThcompUtility.GetMIMETypeFromExtension(key)
+	}
+	if uploadOptions.Size > 0 {
+		uploadOptions.Size = s3ClientSideCipherSize(uploadOptions.Size, S3ClientSideChunkSize)
+	}
+
+	return encrypted.helper.UploadWithContext(ctx, key, &s3EncryptingReader{
+		source:    body,
+		aead:      aead,
+		baseNonce: baseNonce,
+		chunkSize: S3ClientSideChunkSize,
+		ahead:     make([]byte, 0, S3ClientSideChunkSize+1),
+	}, &uploadOptions)
+}
+
+func (encrypted *S3EncryptedHelper) GetItem(key string) (item *S3Item, err error) {
+	return encrypted.GetItemWithContext(context.Background(), key)
+}
+
+// GetItemWithContext loads the attributes of the object and unwraps its data key. The body is fetched on the first
+// read and decrypted on the fly. Objects stored without client-side encryption fail with ErrS3NotClientSideEncrypted.
+func (encrypted *S3EncryptedHelper) GetItemWithContext(ctx context.Context, key string) (item *S3Item, err error) {
+	if item, err = encrypted.helper.HeadItemWithContext(ctx, key); err != nil {
+		return nil, err
+	}
+
+	if item.clientSide, err = encrypted.decryption(ctx, key, item.attributes.Metadata); err != nil {
+		return nil, err
+	}
+	item.clientSide.cipherSize = aws.ToInt64(item.size)
+	item.size = aws.Int64(item.clientSide.plaintextSize())
+
+	return
+}
+
+func (encrypted *S3EncryptedHelper) decryption(ctx context.Context, key string, metadata map[string]string) (ret *s3ClientSideDecryption, err error) {
+	if metadata[s3MetaClientSideKey] == "" {
+		return nil, fmt.Errorf("%s: %w", key, ErrS3NotClientSideEncrypted)
+	}
+	if algorithm := metadata[s3MetaClientSideAlgorithm]; algorithm != s3ClientSideAlgorithm {
+		return nil, fmt.Errorf("%s: unsupported content encryption %q: %w", key, algorithm, ErrS3ClientSideDecryption)
+	}
+	if wrap := metadata[s3MetaClientSideWrap]; wrap != encrypted.provider.Algorithm() {
+		return nil, fmt.Errorf("%s: data key wrapped with %q, not %q: %w", key, wrap, encrypted.provider.Algorithm(), ErrS3ClientSideDecryption)
+	}
+
+	wrappedKey, keyErr := base64.StdEncoding.DecodeString(metadata[s3MetaClientSideKey])
+	baseNonce, ivErr := base64.StdEncoding.DecodeString(metadata[s3MetaClientSideIV])
+	chunkSize, chunkErr := strconv.Atoi(metadata[s3MetaClientSideChunkSize])
+	if err = errors.Join(keyErr, ivErr, chunkErr); err != nil || len(baseNonce) != 12 || chunkSize <= 0 {
+		return nil, fmt.Errorf("%s: invalid client-side encryption metadata: %w", key, errors.Join(ErrS3ClientSideDecryption, err))
+	}
+
+	dataKey, err := encrypted.provider.UnwrapDataKey(ctx, wrappedKey)
+	if err != nil {
+		return nil, fmt.Errorf("%s: unwrapping the data key: %w", key, errors.Join(ErrS3ClientSideDecryption, err))
+	}
+
+	ret = &s3ClientSideDecryption{
+		baseNonce: baseNonce,
+		chunkSize: int64(chunkSize),
+	}
+	if ret.aead, err = newS3ClientSideAEAD(dataKey); err != nil {
+		return nil, err
+	}
+
+	return
+}
+
+func newS3ClientSideAEAD(dataKey []byte) (aead cipher.AEAD, err error) {
+	if len(dataKey) != 32 {
+		return nil, fmt.Errorf("data key must be 32 bytes, not %d", len(dataKey))
+	}
+	if block, blockErr := aes.NewCipher(dataKey); blockErr == nil {
+		aead, err = cipher.NewGCM(block)
+	} else {
+		err = blockErr
+	}
+
+	return
+}
+
+// s3ClientSideCipherSize returns the stored size of plaintextSize bytes: every chunk gets a GCM tag,
+// and empty content is one empty chunk.
+func s3ClientSideCipherSize(plaintextSize int64, chunkSize int64) int64 {
+	chunks := max((plaintextSize+chunkSize-1)/chunkSize, 1)
+
+	return plaintextSize + chunks*aes.BlockSize
+}
+
+// s3ClientSideNonce returns the nonce of a chunk, the base nonce with the chunk index xored into its last 8 bytes.
+// The additional data binds the index and whether the chunk is the last one, so chunks cannot be reordered,
+// dropped, or the content truncated at a chunk boundary.
+func s3ClientSideNonce(baseNonce []byte, index uint64, final bool) (nonce, additionalData []byte) {
+	nonce = append([]byte{}, baseNonce...)
+	counter := binary.BigEndian.Uint64(nonce[4:]) ^ index
+	binary.BigEndian.PutUint64(nonce[4:], counter)
+
+	additionalData = binary.BigEndian.AppendUint64(nil, index)
+	if final {
+		additionalData = append(additionalData, 1)
+	} else {
+		additionalData = append(additionalData, 0)
+	}
+
+	return
+}
+
+// s3EncryptingReader seals source chunk by chunk. It reads one byte ahead to know which chunk is the last one.
+type s3EncryptingReader struct {
+	source    io.Reader
+	aead      cipher.AEAD
+	baseNonce []byte
+	chunkSize int
+	index     uint64
+	ahead     []byte
+	sealed    []byte
+	out       []byte
+	done      bool
+}
+
+func (reader *s3EncryptingReader) Read(buffer []byte) (size int, err error) {
+	for len(reader.out) == 0 {
+		if reader.done {
+			return 0, io.EOF
+		}
+		if err = reader.sealNext(); err != nil {
+			return 0, err
+		}
+	}
+
+	size = copy(buffer, reader.out)
+	reader.out = reader.out[size:]
+
+	return
+}
+
+func (reader *s3EncryptingReader) sealNext() error {
+	filled := len(reader.ahead)
+	readSize, err := io.ReadFull(reader.source, reader.ahead[filled:reader.chunkSize+1])
+	reader.ahead = reader.ahead[:filled+readSize]
+
+	chunk := reader.ahead
+	if err == io.EOF || err == io.ErrUnexpectedEOF {
+		reader.done = true
+	} else if err != nil {
+		return err
+	} else {
+		chunk = reader.ahead[:reader.chunkSize]
+	}
+
+	nonce, additionalData := s3ClientSideNonce(reader.baseNonce, reader.index, reader.done)
+	reader.sealed = reader.aead.Seal(reader.sealed[:0], nonce, chunk, additionalData)
+	reader.out = reader.sealed
+	reader.index++
+
+	if !reader.done {
+		// keep the byte read ahead for the next chunk
+		reader.ahead = reader.ahead[:copy(reader.ahead, reader.ahead[reader.chunkSize:])]
+	}
+
+	return nil
+}
+
+// s3ClientSideDecryption holds the unwrapped data key of an item read through S3EncryptedHelper.
+type s3ClientSideDecryption struct {
+	aead       cipher.AEAD
+	baseNonce  []byte
+	chunkSize  int64
+	cipherSize int64
+}
+
+func (decryption *s3ClientSideDecryption) sealedChunkSize() int64 {
+	return decryption.chunkSize + aes.BlockSize
+}
+
+func (decryption *s3ClientSideDecryption) chunkCount() int64 {
+	return (decryption.cipherSize + decryption.sealedChunkSize() - 1) / decryption.sealedChunkSize()
+}
+
+func (decryption *s3ClientSideDecryption) plaintextSize() int64 {
+	return max(decryption.cipherSize-decryption.chunkCount()*aes.BlockSize, 0)
+}
+
+// open fetches the chunks holding the plaintext from offset on, up to the chunk holding lastOffset,
+// and returns their decrypted content from offset on. item.size must be loaded.
+func (decryption *s3ClientSideDecryption) open(ctx context.Context, item *S3Item, offset, lastOffset int64) (reader io.ReadCloser, err error) {
+	if offset >= decryption.plaintextSize() {
+		return io.NopCloser(bytes.NewReader(nil)), nil
+	}
+
+	firstChunk := offset / decryption.chunkSize
+	lastChunk := min(lastOffset/decryption.chunkSize, decryption.chunkCount()-1)
+	input := &s3.GetObjectInput{
+		Bucket:    aws.String(item.helper.bucket),
+		Key:       aws.String(item.Path),
+		VersionId: item.versionID,
+		Range:     aws.String(fmt.Sprintf("bytes=%d-%d", firstChunk*decryption.sealedChunkSize(), min((lastChunk+1)*decryption.sealedChunkSize(), decryption.cipherSize)-1)),
+		IfMatch:   item.etag,
+	}
+	item.helper.encryption.applyToGetObject(input)
+
+	callCtx, cancel := item.helper.callContext(ctx)
+	if output, getErr := item.helper.client.GetObject(callCtx, input); getErr == nil {
+		reader = &s3DecryptingReader{
+			body:       newContextReadCloser(callCtx, output.Body, cancel),
+			path:       item.Path,
+			decryption: decryption,
+			index:      firstChunk,
+			lastIndex:  lastChunk,
+			skip:       offset % decryption.chunkSize,
+		}
+	} else {
+		cancel()
+		if isS3PreconditionFailed(getErr) {
+			err = fmt.Errorf("%s: %w: %w", item.Path, ErrS3ObjectChanged, getErr)
+		} else {
+			err = getErr
+		}
+	}
+
+	return
+}
+
+func (item *S3Item) readClientSideAt(ctx context.Context, buffer []byte, offset int64) (size int, err error) {
+	if reader, openErr := item.clientSide.open(ctx, item, offset, offset+int64(len(buffer))-1); openErr == nil {
+		defer reader.Close()
+
+		if size, err = io.ReadFull(reader, buffer); err == io.ErrUnexpectedEOF {
+			// the range was cut by the end of the plaintext
+			err = io.EOF
+		}
+	} else {
+		err = openErr
+	}
+
+	return
+}
+
+// downloadClientSide streams the decrypted content into writer. Chunks are decrypted in order, so unlike
+// plain downloads the content is not fetched with parallel ranges; GCM authenticates every chunk instead of the ETag.
+func (item *S3Item) downloadClientSide(ctx context.Context, writer io.WriterAt, options *S3DownloadOptions) (err error) {
+	if _, err = item.head(ctx, 0); err != nil {
+		return
+	}
+
+	reader, err := item.clientSide.open(ctx, item, 0, item.clientSide.cipherSize)
+	if err != nil {
+		return
+	}
+	defer reader.Close()
+
+	total := item.clientSide.plaintextSize()
+	buffer := make([]byte, item.clientSide.chunkSize)
+	for downloaded := int64(0); ; {
+		readSize, readErr := reader.Read(buffer)
+		if readSize > 0 {
+			if _, err = writer.WriteAt(buffer[:readSize], downloaded); err != nil {
+				return
+			}
+			downloaded += int64(readSize)
+			if options != nil && options.Progress != nil {
+				options.Progress(downloaded, total)
+			}
+		}
+		if readErr == io.EOF {
+			return nil
+		} else if readErr != nil {
+			return readErr
+		}
+	}
+}
+
+// s3DecryptingReader opens the chunks of body from index to lastIndex, dropping skip plaintext bytes first.
+type s3DecryptingReader struct {
+	body       io.ReadCloser
+	path       string
+	decryption *s3ClientSideDecryption
+	index      int64
+	lastIndex  int64
+	skip       int64
+	sealed     []byte
+	out        []byte
+}
+
+func (reader *s3DecryptingReader) Read(buffer []byte) (size int, err error) {
+	for len(reader.out) == 0 {
+		if reader.index > reader.lastIndex {
+			return 0, io.EOF
+		}
+		if err = reader.openNext(); err != nil {
+			return 0, err
+		}
+	}
+
+	size = copy(buffer, reader.out)
+	reader.out = reader.out[size:]
+
+	return
+}
+
+func (reader *s3DecryptingReader) openNext() (err error) {
+	decryption := reader.decryption
+	sealedSize := min(decryption.sealedChunkSize(), decryption.cipherSize-reader.index*decryption.sealedChunkSize())
+	if int64(cap(reader.sealed)) < sealedSize {
+		reader.sealed = make([]byte, decryption.sealedChunkSize())
+	}
+	if _, err = io.ReadFull(reader.body, reader.sealed[:sealedSize]); err != nil {
+		if err == io.EOF {
+			err = io.ErrUnexpectedEOF
+		}
+		return fmt.Errorf("%s: reading chunk %d: %w", reader.path, reader.index, err)
+	}
+
+	nonce, additionalData := s3ClientSideNonce(decryption.baseNonce, uint64(reader.index), reader.index == decryption.chunkCount()-1)
+	if reader.out, err = decryption.aead.Open(reader.sealed[:0], nonce, reader.sealed[:sealedSize], additionalData); err != nil {
+		return fmt.Errorf("%s: chunk %d: %w", reader.path, reader.index, errors.Join(ErrS3ClientSideDecryption, err))
+	}
+	reader.index++
+
+	skip := min(reader.skip, int64(len(reader.out)))
+	reader.out = reader.out[skip:]
+	reader.skip -= skip
+
+	return nil
+}
+
+func (reader *s3DecryptingReader) Close() error {
+	return reader.body.Close()
+}
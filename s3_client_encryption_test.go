@@ -0,0 +1,179 @@
+package awssdkhelper
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"io"
+	"testing"
+
+	"github.com/aws/aws-sdk-go-v2/service/kms"
+
+	TestUtility "github.com/thcomp/GoLang_TestUtility"
+)
+
+// fakeKMSClient wraps data keys with a local key, and checks the key ID and encryption context like KMS.
+type fakeKMSClient struct {
+	provider          *S3LocalKeyProvider
+	keyID             string
+	encryptionContext map[string]string
+	decrypts          int
+}
+
+func (client *fakeKMSClient) GenerateDataKey(ctx context.Context, params *kms.GenerateDataKeyInput, optFns ...func(*kms.Options)) (*kms.GenerateDataKeyOutput, error) {
+	if *params.KeyId != client.keyID || params.EncryptionContext["tenant"] != client.encryptionContext["tenant"] {
+		return nil, errors.New("NotFoundException")
+	}
+
+	dataKey, wrappedKey, err := client.provider.GenerateDataKey(ctx)
+
+	return &kms.GenerateDataKeyOutput{Plaintext: dataKey, CiphertextBlob: wrappedKey, KeyId: params.KeyId}, err
+}
+
+func (client *fakeKMSClient) Decrypt(ctx context.Context, params *kms.DecryptInput, optFns ...func(*kms.Options)) (*kms.DecryptOutput, error) {
+	client.decrypts++
+	if params.EncryptionContext["tenant"] != client.encryptionContext["tenant"] {
+		return nil, errors.New("InvalidCiphertextException")
+	}
+
+	dataKey, err := client.provider.UnwrapDataKey(ctx, params.CiphertextBlob)
+
+	return &kms.DecryptOutput{Plaintext: dataKey, KeyId: params.KeyId}, err
+}
+
+func newTestS3LocalKeyProvider(t *testing.T, seed byte) *S3LocalKeyProvider {
+	provider, err := NewS3LocalKeyProvider(bytes.Repeat([]byte{seed}, 32))
+	if err != nil {
+		t.Fatalf("NewS3LocalKeyProvider: %v", err)
+	}
+
+	return provider
+}
+
+func Test_S3EncryptedHelper_PutAndRead(t *testing.T) {
+	tester := TestUtility.NewTestHelper(t)
+	fake := newFakeS3Server(t, "cse-bucket")
+	encrypted := NewS3EncryptedHelper(fake.helper(), newTestS3LocalKeyProvider(t, 1))
+
+	for _, size := range []int{0, 10, S3ClientSideChunkSize, 2*S3ClientSideChunkSize + 100} {
+		data := testMultipartData(size)
+		err := encrypted.PutDataWithOptions(context.Background(), "secret.txt", data, &S3PutOptions{Metadata: map[string]string{"owner": "alice"}})
+		tester.Fatalf(err == nil, "PutData of %d bytes: %v", size, err)
+
+		stored := fake.object("secret.txt")
+		tester.Fatalf(stored != nil && int64(len(stored.data)) == s3ClientSideCipherSize(int64(size), S3ClientSideChunkSize), "stored size for %d bytes", size)
+		tester.Errorf(size == 0 || !bytes.Contains(stored.data, data[:min(size, 64)]), "plaintext is stored for %d bytes", size)
+		tester.Errorf(stored.headers.Get("X-Amz-Meta-Cse-Key") != "" && stored.headers.Get("X-Amz-Meta-Cse-Iv") != "" && stored.headers.Get("X-Amz-Meta-Owner") == "alice", "metadata: %v", stored.headers)
+		tester.Errorf(stored.contentType == "text/plain; charset=utf-8" || stored.contentType == "text/plain", "content type: %s", stored.contentType)
+
+		item, err := encrypted.GetItem("secret.txt")
+		tester.Fatalf(err == nil, "GetItem: %v", err)
+		read, err := io.ReadAll(item)
+		tester.Errorf(err == nil && bytes.Equal(read, data), "read %d bytes of %d: %v", len(read), size, err)
+		itemSize, _ := item.Size()
+		tester.Errorf(itemSize == int64(size), "size: %d, expected %d", itemSize, size)
+		item.Close()
+	}
+
+	fake.putObject("plain.txt", []byte("plain"))
+	_, err := encrypted.GetItem("plain.txt")
+	tester.Errorf(errors.Is(err, ErrS3NotClientSideEncrypted), "plain object: %v", err)
+	_, err = encrypted.GetItem("missing.txt")
+	tester.Errorf(errors.Is(err, ErrObjectNotFound), "missing object: %v", err)
+}
+
+func Test_S3EncryptedHelper_Streaming(t *testing.T) {
+	tester := TestUtility.NewTestHelper(t)
+	fake := newFakeS3Server(t, "cse-bucket")
+	encrypted := NewS3EncryptedHelper(fake.helper(), newTestS3LocalKeyProvider(t, 2))
+
+	data := testMultipartData(int(2*S3MinPartSize + 1234))
+	// unknown size: the encrypted stream is cut into parts as it is produced
+	err := encrypted.UploadWithContext(context.Background(), "large.bin", io.MultiReader(bytes.NewReader(data)), &S3UploadOptions{PartSize: S3MinPartSize})
+	tester.Fatalf(err == nil, "UploadWithContext: %v", err)
+	stored := fake.object("large.bin")
+	tester.Fatalf(stored != nil && len(stored.partSizes) == 3, "stored object is not a multipart upload")
+
+	item, err := encrypted.GetItem("large.bin")
+	tester.Fatalf(err == nil, "GetItem: %v", err)
+	defer item.Close()
+
+	offset := int64(S3ClientSideChunkSize*3 + 17)
+	_, err = item.Seek(offset, io.SeekStart)
+	tester.Fatalf(err == nil, "Seek: %v", err)
+	buffer := make([]byte, 100)
+	_, err = io.ReadFull(item, buffer)
+	tester.Errorf(err == nil && bytes.Equal(buffer, data[offset:offset+100]), "read after Seek: %v", err)
+
+	end, err := item.Seek(-10, io.SeekEnd)
+	tester.Errorf(err == nil && end == int64(len(data))-10, "Seek from the end: %d, %v", end, err)
+	rest, err := io.ReadAll(item)
+	tester.Errorf(err == nil && bytes.Equal(rest, data[len(data)-10:]), "read to the end: %v", err)
+
+	buffer = make([]byte, S3ClientSideChunkSize+20)
+	size, err := item.ReadAt(buffer, S3ClientSideChunkSize-10)
+	tester.Errorf(err == nil && size == len(buffer) && bytes.Equal(buffer, data[S3ClientSideChunkSize-10:2*S3ClientSideChunkSize+10]), "ReadAt across chunks: %d, %v", size, err)
+	size, err = item.ReadAt(buffer, int64(len(data))-5)
+	tester.Errorf(err == io.EOF && size == 5 && bytes.Equal(buffer[:5], data[len(data)-5:]), "ReadAt at the end: %d, %v", size, err)
+	_, err = item.ReadAt(buffer, int64(len(data)))
+	tester.Errorf(err == io.EOF, "ReadAt past the end: %v", err)
+
+	writer := &bytesWriterAt{}
+	err = item.DownloadTo(writer, nil)
+	tester.Errorf(err == nil && bytes.Equal(writer.data, data), "DownloadTo: %v", err)
+}
+
+func Test_S3EncryptedHelper_Tampering(t *testing.T) {
+	tester := TestUtility.NewTestHelper(t)
+	fake := newFakeS3Server(t, "cse-bucket")
+	encrypted := NewS3EncryptedHelper(fake.helper(), newTestS3LocalKeyProvider(t, 3))
+
+	data := testMultipartData(3 * S3ClientSideChunkSize)
+	for _, key := range []string{"flipped.bin", "truncated.bin"} {
+		err := encrypted.PutData(key, data)
+		tester.Fatalf(err == nil, "PutData: %v", err)
+	}
+	fake.object("flipped.bin").data[S3ClientSideChunkSize+100] ^= 1
+	truncated := fake.object("truncated.bin")
+	truncated.data = truncated.data[:2*(S3ClientSideChunkSize+16)]
+
+	for _, key := range []string{"flipped.bin", "truncated.bin"} {
+		item, err := encrypted.GetItem(key)
+		tester.Fatalf(err == nil, "GetItem: %v", err)
+		_, err = io.ReadAll(item)
+		tester.Errorf(errors.Is(err, ErrS3ClientSideDecryption), "reading %s: %v", key, err)
+		item.Close()
+	}
+
+	other := NewS3EncryptedHelper(fake.helper(), newTestS3LocalKeyProvider(t, 4))
+	_, err := other.GetItem("flipped.bin")
+	tester.Errorf(errors.Is(err, ErrS3ClientSideDecryption), "unwrapping with another master key: %v", err)
+}
+
+func Test_S3EncryptedHelper_KMS(t *testing.T) {
+	tester := TestUtility.NewTestHelper(t)
+	fake := newFakeS3Server(t, "cse-bucket")
+	client := &fakeKMSClient{
+		provider:          newTestS3LocalKeyProvider(t, 5),
+		keyID:             "alias/cse",
+		encryptionContext: map[string]string{"tenant": "a"},
+	}
+	encrypted := NewS3EncryptedHelper(fake.helper(), NewS3KMSKeyProvider(client, "alias/cse", map[string]string{"tenant": "a"}))
+
+	err := encrypted.PutData("kms.txt", []byte("kms content"))
+	tester.Fatalf(err == nil, "PutData: %v", err)
+	tester.Errorf(fake.object("kms.txt").headers.Get("X-Amz-Meta-Cse-Wrap-Alg") == "kms", "wrap algorithm: %v", fake.object("kms.txt").headers)
+
+	item, err := encrypted.GetItem("kms.txt")
+	tester.Fatalf(err == nil, "GetItem: %v", err)
+	read, err := io.ReadAll(item)
+	tester.Errorf(err == nil && string(read) == "kms content" && client.decrypts == 1, "read: %q, %v", read, err)
+
+	otherTenant := NewS3EncryptedHelper(fake.helper(), NewS3KMSKeyProvider(client, "alias/cse", map[string]string{"tenant": "b"}))
+	_, err = otherTenant.GetItem("kms.txt")
+	tester.Errorf(errors.Is(err, ErrS3ClientSideDecryption), "another encryption context: %v", err)
+
+	local := NewS3EncryptedHelper(fake.helper(), client.provider)
+	_, err = local.GetItem("kms.txt")
+	tester.Errorf(errors.Is(err, ErrS3ClientSideDecryption), "another provider: %v", err)
+}
@@ -0,0 +1,376 @@
+package awssdkhelper
+
+import (
+	"bufio"
+	"bytes"
+	"compress/gzip"
+	"context"
+	"fmt"
+	"io"
+	"path"
+	"strconv"
+	"strings"
+	"sync/atomic"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/s3"
+	"github.com/klauspost/compress/zstd"
+)
+
+type S3Compression string
+
+const (
+	// S3CompressionNone disables the detection of compressed content.
+	S3CompressionNone S3Compression = "none"
+	S3CompressionGzip S3Compression = "gzip"
+	S3CompressionZstd S3Compression = "zstd"
+)
+
+var s3ZstdMagic = []byte{0x28, 0xb5, 0x2f, 0xfd}
+
+// s3CompressionOfEncoding returns the compression of a Content-Encoding, empty when it is not compressed.
+func s3CompressionOfEncoding(contentEncoding string) S3Compression {
+	switch strings.ToLower(strings.TrimSpace(contentEncoding)) {
+	case "gzip", "x-gzip":
+		return S3CompressionGzip
+	case "zstd":
+		return S3CompressionZstd
+	}
+
+	return ""
+}
+
+// s3CompressionOfKey returns the compression named by the extension of key, empty when there is none.
+func s3CompressionOfKey(key string) S3Compression {
+	switch strings.ToLower(path.Ext(key)) {
+	case ".gz", ".gzip":
+		return S3CompressionGzip
+	case ".zst", ".zstd":
+		return S3CompressionZstd
+	}
+
+	return ""
+}
+
+// detectS3Compression returns the compression of the content of item: the Content-Encoding when loaded,
+// then the extension of the key, then the magic number at the start of reader. Content already decompressed
+// by the item is not compressed.
+func detectS3Compression(item *S3Item, reader *bufio.Reader) S3Compression {
+	if item.compression != "" {
+		return S3CompressionNone
+	}
+	if item.attributes != nil {
+		if compression := s3CompressionOfEncoding(item.attributes.ContentEncoding); compression != "" {
+			return compression
+		}
+	}
+	if compression := s3CompressionOfKey(item.Path); compression != "" {
+		return compression
+	}
+
+	magic, _ := reader.Peek(len(s3ZstdMagic))
+
+	return s3CompressionOfMagic(magic)
+}
+
+// s3CompressionOfMagic returns the compression recognized by the magic number at the start of data.
+func s3CompressionOfMagic(data []byte) S3Compression {
+	if bytes.HasPrefix(data, []byte{0x1f, 0x8b}) {
+		return S3CompressionGzip
+	} else if bytes.HasPrefix(data, s3ZstdMagic) {
+		return S3CompressionZstd
+	}
+
+	return S3CompressionNone
+}
+
+// newS3Decompressor returns the decompressed content of reader.
+func newS3Decompressor(reader io.Reader, compression S3Compression) (io.ReadCloser, error) {
+	switch compression {
+	case S3CompressionGzip:
+		return gzip.NewReader(reader)
+	case S3CompressionZstd:
+		if decoder, err := zstd.NewReader(reader); err == nil {
+			return decoder.IOReadCloser(), nil
+		} else {
+			return nil, err
+		}
+	case S3CompressionNone, "":
+		return io.NopCloser(reader), nil
+	}
+
+	return nil, fmt.Errorf("unknown compression %q", compression)
+}
+
+// newS3Compressor returns a writer compressing into writer. Closing it flushes the compressed content,
+// but does not close writer.
+func newS3Compressor(writer io.Writer, compression S3Compression) (io.WriteCloser, error) {
+	switch compression {
+	case S3CompressionGzip:
+		return gzip.NewWriter(writer), nil
+	case S3CompressionZstd:
+		return zstd.NewWriter(writer)
+	case S3CompressionNone, "":
+		return nopWriteCloser{writer}, nil
+	}
+
+	return nil, fmt.Errorf("unknown compression %q", compression)
+}
+
+type nopWriteCloser struct {
+	io.Writer
+}
+
+func (nopWriteCloser) Close() error {
+	return nil
+}
+
+// s3MetaUncompressedSize is the metadata name (x-amz-meta-*) of the size before compression,
+// stored by compressing puts whose size is known.
+const s3MetaUncompressedSize = "uncompressed-size"
+
+// SetCompression sets the compression of every object PutData, PutFile and Upload write, with Content-Encoding
+// set accordingly. Keys named after a compression (.gz, .zst) and puts setting ContentEncoding are written as is.
+// S3CompressionNone or empty disables it.
+func (s3Helper *S3Helper) SetCompression(compression S3Compression) {
+	if compression == S3CompressionNone {
+		compression = ""
+	}
+	s3Helper.compression = compression
+}
+
+// SetDecompression enables the decompression of gzip and zstd content on read, detected by the Content-Encoding
+// or the key extension. Read, ReadAt and DownloadTo of such items then return the decompressed content, and Size
+// the size before compression, known when stored by a compressing put. Seeking and ReadAt decompress from the start.
+// Items which were not loaded (e.g. listed by Walk or ListItems) are loaded with a HEAD before the first read.
+func (s3Helper *S3Helper) SetDecompression(enabled bool) {
+	s3Helper.decompression = enabled
+}
+
+// putCompression returns the compression of a put of key, empty when the content is written as is.
+func (s3Helper *S3Helper) putCompression(key string, options *S3PutOptions) S3Compression {
+	if options != nil && options.Compression != "" {
+		if options.Compression == S3CompressionNone {
+			return ""
+		}
+		return options.Compression
+	} else if options != nil && options.ContentEncoding != "" {
+		return ""
+	} else if s3CompressionOfKey(key) != "" {
+		return ""
+	}
+
+	return s3Helper.compression
+}
+
+// compressedPutOptions returns options writing content compressed with compression, of size bytes when known.
+func compressedPutOptions(options *S3PutOptions, compression S3Compression, size int64) *S3PutOptions {
+	compressed := S3PutOptions{}
+	if options != nil {
+		compressed = *options
+	}
+	compressed.Compression = S3CompressionNone
+	compressed.ContentEncoding = string(compression)
+	if size >= 0 {
+		return withS3UncompressedSize(&compressed, size)
+	}
+
+	return &compressed
+}
+
+// withS3UncompressedSize returns a copy of options storing size as the size before compression.
+func withS3UncompressedSize(options *S3PutOptions, size int64) *S3PutOptions {
+	sized := *options
+	sized.Metadata = map[string]string{}
+	for name, value := range options.Metadata {
+		sized.Metadata[name] = value
+	}
+	sized.Metadata[s3MetaUncompressedSize] = strconv.FormatInt(size, 10)
+
+	return &sized
+}
+
+// s3CountingReader counts the bytes read from reader, while another goroutine may read them.
+type s3CountingReader struct {
+	reader io.Reader
+	count  atomic.Int64
+}
+
+func (counting *s3CountingReader) Read(buffer []byte) (size int, err error) {
+	size, err = counting.reader.Read(buffer)
+	counting.count.Add(int64(size))
+
+	return
+}
+
+// newS3CompressingReader returns the content of body compressed with compression. Closing it stops
+// the compression of the rest of body.
+func newS3CompressingReader(body io.Reader, compression S3Compression) io.ReadCloser {
+	pipeReader, pipeWriter := io.Pipe()
+	go func() {
+		compressor, err := newS3Compressor(pipeWriter, compression)
+		if err == nil {
+			if _, err = io.Copy(compressor, body); err == nil {
+				err = compressor.Close()
+			} else {
+				compressor.Close()
+			}
+		}
+		pipeWriter.CloseWithError(err)
+	}()
+
+	return pipeReader
+}
+
+// applyCompression sets the size before compression of an item whose size and attributes were just loaded,
+// and the decompression of its reads when enabled on the helper.
+func (item *S3Item) applyCompression() {
+	compression := S3Compression("")
+	if item.attributes != nil {
+		compression = s3CompressionOfEncoding(item.attributes.ContentEncoding)
+	}
+	if compression == "" {
+		compression = s3CompressionOfKey(item.Path)
+	}
+
+	uncompressedSize := item.size
+	if compression != "" {
+		uncompressedSize = nil
+		if item.attributes != nil {
+			if size, err := strconv.ParseInt(item.attributes.Metadata[s3MetaUncompressedSize], 10, 64); err == nil {
+				uncompressedSize = &size
+			}
+		}
+	}
+	if item.attributes != nil {
+		item.attributes.UncompressedSize = -1
+		if uncompressedSize != nil {
+			item.attributes.UncompressedSize = *uncompressedSize
+		}
+	}
+
+	if item.helper.decompression && item.clientSide == nil && compression != "" {
+		item.compression = compression
+		item.size = uncompressedSize
+	}
+}
+
+// resolveCompression loads the attributes of an item which was not loaded yet when decompression is enabled,
+// so that its Content-Encoding decides how it is read.
+func (item *S3Item) resolveCompression(ctx context.Context) (err error) {
+	if item.helper.decompression && item.clientSide == nil && item.attributes == nil && !item.IsDir {
+		_, err = item.head(ctx, 0)
+	}
+
+	return
+}
+
+// openDecompressed fetches the whole body and returns its decompressed content from offset on.
+func (item *S3Item) openDecompressed(ctx context.Context, offset int64) (reader io.ReadCloser, err error) {
+	input := &s3.GetObjectInput{
+		Bucket:    aws.String(item.helper.bucket),
+		Key:       aws.String(item.Path),
+		VersionId: item.versionID,
+		IfMatch:   item.etag,
+	}
+	item.helper.encryption.applyToGetObject(input)
+
+	callCtx, cancel := item.helper.callContext(ctx)
+	if output, getErr := item.helper.client.GetObject(callCtx, input); getErr == nil {
+		reader = &s3DecompressingReader{
+			body:        newContextReadCloser(callCtx, output.Body, cancel),
+			compression: item.compression,
+			skip:        offset,
+		}
+	} else {
+		cancel()
+		if isS3PreconditionFailed(getErr) {
+			err = fmt.Errorf("%s: %w: %w", item.Path, ErrS3ObjectChanged, getErr)
+		} else {
+			err = getErr
+		}
+	}
+
+	return
+}
+
+func (item *S3Item) readDecompressedAt(ctx context.Context, buffer []byte, offset int64) (size int, err error) {
+	if reader, openErr := item.openDecompressed(ctx, offset); openErr == nil {
+		defer reader.Close()
+
+		if size, err = io.ReadFull(reader, buffer); err == io.ErrUnexpectedEOF {
+			err = io.EOF
+		}
+	} else {
+		err = openErr
+	}
+
+	return
+}
+
+// downloadDecompressed streams the decompressed content into writer. The content is decompressed in order,
+// so it is not fetched with parallel ranges, and the ETag is not verified as it covers the compressed content.
+func (item *S3Item) downloadDecompressed(ctx context.Context, writer io.WriterAt, options *S3DownloadOptions) (err error) {
+	reader, err := item.openDecompressed(ctx, 0)
+	if err != nil {
+		return
+	}
+	defer reader.Close()
+
+	total := aws.ToInt64(item.size)
+	if item.size == nil {
+		total = -1
+	}
+	buffer := make([]byte, s3WriterBufferSize)
+	for downloaded := int64(0); ; {
+		readSize, readErr := reader.Read(buffer)
+		if readSize > 0 {
+			if _, err = writer.WriteAt(buffer[:readSize], downloaded); err != nil {
+				return
+			}
+			downloaded += int64(readSize)
+			if options != nil && options.Progress != nil {
+				options.Progress(downloaded, total)
+			}
+		}
+		if readErr == io.EOF {
+			return nil
+		} else if readErr != nil {
+			return readErr
+		}
+	}
+}
+
+// s3DecompressingReader decompresses body on the first Read, dropping skip decompressed bytes first.
+type s3DecompressingReader struct {
+	body         io.ReadCloser
+	compression  S3Compression
+	skip         int64
+	decompressor io.ReadCloser
+}
+
+func (reader *s3DecompressingReader) Read(buffer []byte) (size int, err error) {
+	if reader.decompressor == nil {
+		if reader.decompressor, err = newS3Decompressor(reader.body, reader.compression); err != nil {
+			return 0, err
+		}
+		if reader.skip > 0 {
+			if _, err = io.CopyN(io.Discard, reader.decompressor, reader.skip); err == io.EOF {
+				// sought at or past the end
+				return 0, io.EOF
+			} else if err != nil {
+				return 0, err
+			}
+		}
+	}
+
+	return reader.decompressor.Read(buffer)
+}
+
+func (reader *s3DecompressingReader) Close() error {
+	if reader.decompressor != nil {
+		reader.decompressor.Close()
+	}
+
+	return reader.body.Close()
+}
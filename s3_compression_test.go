@@ -0,0 +1,177 @@
+package awssdkhelper
+
+import (
+	"bytes"
+	"context"
+	"io"
+	"os"
+	"path/filepath"
+	"testing"
+
+	TestUtility "github.com/thcomp/GoLang_TestUtility"
+)
+
+func Test_S3Helper_CompressOnPut(t *testing.T) {
+	tester := TestUtility.NewTestHelper(t)
+	fake := newFakeS3Server(t, "compression-bucket")
+	helper := fake.helper()
+	ctx := context.Background()
+	data := bytes.Repeat([]byte("compressible content\n"), 1000)
+
+	helper.SetCompression(S3CompressionGzip)
+	err := helper.PutData("logs/app.log", data)
+	tester.Fatalf(err == nil, "PutData: %v", err)
+	stored := fake.object("logs/app.log")
+	tester.Errorf(bytes.HasPrefix(stored.data, []byte{0x1f, 0x8b}) && len(stored.data) < len(data), "stored content is not gzipped: %d bytes", len(stored.data))
+	tester.Errorf(stored.headers.Get("Content-Encoding") == "gzip" && stored.headers.Get("X-Amz-Meta-Uncompressed-Size") == "21000", "stored headers: %v", stored.headers)
+	tester.Errorf(stored.contentType != "application/gzip", "content type: %s", stored.contentType)
+
+	// without decompression the stored content is read as is, and attributes tell the size before compression
+	item, err := helper.GetItem("logs/app.log")
+	tester.Fatalf(err == nil, "GetItem: %v", err)
+	read, err := io.ReadAll(item)
+	item.Close()
+	attributes, _ := item.Attributes()
+	size, _ := item.Size()
+	tester.Errorf(err == nil && bytes.Equal(read, stored.data) && size == int64(len(stored.data)), "raw read: %d bytes, size %d, %v", len(read), size, err)
+	tester.Errorf(attributes != nil && attributes.UncompressedSize == int64(len(data)), "UncompressedSize: %+v", attributes)
+
+	// keys named after a compression and already encoded content are written as is
+	err = helper.PutData("archive.gz", stored.data)
+	tester.Errorf(err == nil && bytes.Equal(fake.object("archive.gz").data, stored.data), "archive written compressed again: %v", err)
+	err = helper.PutDataWithOptions(ctx, "encoded.log", stored.data, &S3PutOptions{ContentEncoding: "gzip"})
+	tester.Errorf(err == nil && bytes.Equal(fake.object("encoded.log").data, stored.data), "encoded content written compressed again: %v", err)
+	err = helper.PutDataWithOptions(ctx, "plain.log", data, &S3PutOptions{Compression: S3CompressionNone})
+	tester.Errorf(err == nil && bytes.Equal(fake.object("plain.log").data, data), "S3CompressionNone: %v", err)
+
+	// files are compressed while uploading, multipart included
+	helper.SetMultipartThreshold(S3MinPartSize)
+	large := testMultipartData(int(2*S3MinPartSize + 1))
+	path := filepath.Join(t.TempDir(), "large.bin")
+	tester.Fatalf(os.WriteFile(path, large, 0o600) == nil, "WriteFile")
+	err = helper.PutFileWithOptions(ctx, "large.bin", path, &S3PutOptions{Compression: S3CompressionZstd})
+	tester.Fatalf(err == nil, "PutFileWithOptions: %v", err)
+	stored = fake.object("large.bin")
+	tester.Errorf(bytes.HasPrefix(stored.data, s3ZstdMagic) && stored.headers.Get("Content-Encoding") == "zstd", "stored large content is not zstd")
+	tester.Errorf(stored.headers.Get("X-Amz-Meta-Uncompressed-Size") == "10485761" && len(fake.uploads) == 0, "stored headers: %v", stored.headers)
+}
+
+func Test_S3Helper_DecompressOnRead(t *testing.T) {
+	tester := TestUtility.NewTestHelper(t)
+	fake := newFakeS3Server(t, "compression-bucket")
+	helper := fake.helper()
+	ctx := context.Background()
+	data := testMultipartData(100000)
+
+	err := helper.PutDataWithOptions(ctx, "data.bin", data, &S3PutOptions{Compression: S3CompressionZstd})
+	tester.Fatalf(err == nil, "PutDataWithOptions: %v", err)
+	helper.SetDecompression(true)
+
+	item, err := helper.GetItem("data.bin")
+	tester.Fatalf(err == nil, "GetItem: %v", err)
+	read, err := io.ReadAll(item)
+	size, _ := item.Size()
+	tester.Errorf(err == nil && bytes.Equal(read, data) && size == int64(len(data)), "decompressed read: %d bytes, size %d, %v", len(read), size, err)
+
+	_, err = item.Seek(-100, io.SeekEnd)
+	tester.Fatalf(err == nil, "Seek: %v", err)
+	read, err = io.ReadAll(item)
+	tester.Errorf(err == nil && bytes.Equal(read, data[len(data)-100:]), "read after Seek: %d bytes, %v", len(read), err)
+	item.Close()
+
+	buffer := make([]byte, 1000)
+	readSize, err := item.ReadAt(buffer, 5000)
+	tester.Errorf(err == nil && readSize == 1000 && bytes.Equal(buffer, data[5000:6000]), "ReadAt: %d, %v", readSize, err)
+	readSize, err = item.ReadAt(buffer, int64(len(data))-10)
+	tester.Errorf(err == io.EOF && readSize == 10, "ReadAt at the end: %d, %v", readSize, err)
+
+	writer := &bytesWriterAt{}
+	err = item.DownloadTo(writer, nil)
+	tester.Errorf(err == nil && bytes.Equal(writer.data, data), "DownloadTo: %d bytes, %v", len(writer.data), err)
+
+	// HeadItem reports the size before compression
+	head, err := helper.HeadItem("data.bin")
+	tester.Fatalf(err == nil, "HeadItem: %v", err)
+	size, _ = head.Size()
+	tester.Errorf(size == int64(len(data)), "HeadItem size: %d", size)
+
+	// compressed by another writer: detected by the extension, the size is unknown
+	fake.putObject("external.txt.gz", gzipTestData(t, data))
+	item, err = helper.GetItem("external.txt.gz")
+	tester.Fatalf(err == nil, "GetItem: %v", err)
+	read, err = io.ReadAll(item)
+	item.Close()
+	_, sizeErr := item.Size()
+	tester.Errorf(err == nil && bytes.Equal(read, data) && sizeErr != nil, "extension read: %d bytes, %v, size %v", len(read), err, sizeErr)
+
+	// record readers do not decompress twice
+	err = helper.PutDataWithOptions(ctx, "records.csv", []byte("a,b\n1,2\n"), &S3PutOptions{Compression: S3CompressionGzip})
+	tester.Fatalf(err == nil, "PutDataWithOptions: %v", err)
+	item, err = helper.GetItem("records.csv")
+	tester.Fatalf(err == nil, "GetItem: %v", err)
+	records := [][]string{}
+	for record, readErr := range ReadCSVRecords(item, nil) {
+		tester.Fatalf(readErr == nil, "ReadCSVRecords: %v", readErr)
+		records = append(records, record)
+	}
+	item.Close()
+	tester.Errorf(len(records) == 2 && records[1][1] == "2", "records: %v", records)
+}
+
+func Test_S3Helper_DecompressUnloadedItems(t *testing.T) {
+	tester := TestUtility.NewTestHelper(t)
+	fake := newFakeS3Server(t, "compression-bucket")
+	helper := fake.helper()
+	ctx := context.Background()
+	data := testMultipartData(100000)
+
+	// neither key names the compression: only the Content-Encoding does
+	err := helper.PutDataWithOptions(ctx, "sync/data.bin", data, &S3PutOptions{Compression: S3CompressionZstd})
+	tester.Fatalf(err == nil, "PutDataWithOptions: %v", err)
+	err = helper.PutDataWithOptions(ctx, "sync/encoded.txt", gzipTestData(t, data), &S3PutOptions{ContentEncoding: "gzip"})
+	tester.Fatalf(err == nil, "PutDataWithOptions: %v", err)
+	helper.SetDecompression(true)
+
+	writer := &bytesWriterAt{}
+	err = (&S3Item{Path: "sync/data.bin", helper: helper, ctx: ctx}).DownloadTo(writer, nil)
+	tester.Errorf(err == nil && bytes.Equal(writer.data, data), "DownloadTo of an unloaded item: %d bytes, %v", len(writer.data), err)
+
+	// listed items are read like the ones of GetItem
+	for item, walkErr := range helper.Walk(ctx, "sync/", nil) {
+		tester.Fatalf(walkErr == nil, "Walk: %v", walkErr)
+		size, sizeErr := item.Size()
+		if item.Path == "sync/data.bin" {
+			tester.Errorf(sizeErr == nil && size == int64(len(data)), "listed size: %d, %v", size, sizeErr)
+		}
+		read, readErr := io.ReadAll(item)
+		item.Close()
+		tester.Errorf(readErr == nil && bytes.Equal(read, data), "listed read of %s: %d bytes, %v", item.Path, len(read), readErr)
+
+		buffer := make([]byte, 100)
+		readSize, readErr := item.ReadAt(buffer, 500)
+		tester.Errorf(readErr == nil && readSize == 100 && bytes.Equal(buffer, data[500:600]), "listed ReadAt of %s: %d, %v", item.Path, readSize, readErr)
+	}
+
+	localDir := t.TempDir()
+	result, err := helper.SyncFromS3(ctx, "sync", localDir, nil)
+	tester.Fatalf(err == nil && len(result.Failures) == 0, "SyncFromS3: %v, %+v", err, result)
+	for _, name := range []string{"data.bin", "encoded.txt"} {
+		read, readErr := os.ReadFile(filepath.Join(localDir, name))
+		tester.Errorf(readErr == nil && bytes.Equal(read, data), "synced %s: %d bytes, %v", name, len(read), readErr)
+	}
+}
+
+func gzipTestData(t *testing.T, data []byte) []byte {
+	buffer := &bytes.Buffer{}
+	writer, err := newS3Compressor(buffer, S3CompressionGzip)
+	if err == nil {
+		if _, err = writer.Write(data); err == nil {
+			err = writer.Close()
+		}
+	}
+	if err != nil {
+		t.Fatalf("gzip: %v", err)
+	}
+
+	return buffer.Bytes()
+}
@@ -0,0 +1,118 @@
+package awssdkhelper
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	awshttp "github.com/aws/aws-sdk-go-v2/aws/transport/http"
+	"github.com/aws/aws-sdk-go-v2/service/s3"
+	"github.com/aws/smithy-go"
+)
+
+// ErrS3PreconditionFailed is returned when the condition of a put or get does not hold, e.g. the ETag of
+// If-Match changed or If-None-Match "*" found an existing object. Compare-and-swap callers reread and retry.
+var ErrS3PreconditionFailed = errors.New("s3 precondition failed")
+
+// ErrS3NotModified is returned by a conditional get when the object still matches If-None-Match or
+// was not modified since If-Modified-Since, so the copy held by the caller is current.
+var ErrS3NotModified = errors.New("s3 object not modified")
+
+// S3GetOptions selects the version to read and the conditions of the read.
+type S3GetOptions struct {
+	// VersionId reads a version instead of the current object.
+	VersionId string
+	// IfMatch fails with ErrS3PreconditionFailed unless the ETag equals it.
+	IfMatch string
+	// IfNoneMatch fails with ErrS3NotModified when the ETag equals it.
+	IfNoneMatch string
+	// IfModifiedSince fails with ErrS3NotModified unless the object was modified after it.
+	IfModifiedSince time.Time
+	// IfUnmodifiedSince fails with ErrS3PreconditionFailed when the object was modified after it.
+	IfUnmodifiedSince time.Time
+}
+
+func (options *S3GetOptions) applyToGetObject(input *s3.GetObjectInput) {
+	if options == nil {
+		return
+	}
+
+	if options.VersionId != "" {
+		input.VersionId = aws.String(options.VersionId)
+	}
+	if options.IfMatch != "" {
+		input.IfMatch = aws.String(options.IfMatch)
+	}
+	if options.IfNoneMatch != "" {
+		input.IfNoneMatch = aws.String(options.IfNoneMatch)
+	}
+	if !options.IfModifiedSince.IsZero() {
+		input.IfModifiedSince = aws.Time(options.IfModifiedSince)
+	}
+	if !options.IfUnmodifiedSince.IsZero() {
+		input.IfUnmodifiedSince = aws.Time(options.IfUnmodifiedSince)
+	}
+}
+
+// GetItemWithOptions opens the object like GetItem once the conditions of options hold. A missing object
+// fails with ErrObjectNotFound, a failed condition with ErrS3PreconditionFailed or ErrS3NotModified.
+func (s3Helper *S3Helper) GetItemWithOptions(ctx context.Context, key string, options *S3GetOptions) (item *S3Item, err error) {
+	if item, err = s3Helper.getItem(ctx, key, options); err != nil {
+		err = wrapS3Condition(key, err)
+	}
+
+	return
+}
+
+// deleteItemIfMatch deletes key only while its ETag is etag, failing with ErrS3PreconditionFailed otherwise.
+func (s3Helper *S3Helper) deleteItemIfMatch(ctx context.Context, key, etag string) error {
+	callCtx, cancel := s3Helper.callContext(ctx)
+	defer cancel()
+
+	_, err := s3Helper.client.DeleteObject(callCtx, &s3.DeleteObjectInput{
+		Bucket:  aws.String(s3Helper.bucket),
+		Key:     aws.String(key),
+		IfMatch: aws.String(etag),
+	})
+
+	return wrapS3Condition(key, err)
+}
+
+// wrapS3Condition wraps the failed conditions of a put or get into ErrS3PreconditionFailed or ErrS3NotModified,
+// and a missing object into ErrObjectNotFound.
+func wrapS3Condition(key string, err error) error {
+	if err == nil {
+		return nil
+	} else if isS3PreconditionFailed(err) {
+		return fmt.Errorf("%s: %w: %w", key, ErrS3PreconditionFailed, err)
+	} else if isS3NotModified(err) {
+		return fmt.Errorf("%s: %w: %w", key, ErrS3NotModified, err)
+	}
+
+	return wrapS3NotFound(key, err)
+}
+
+// isS3PreconditionFailed also matches ConditionalRequestConflict, returned when a concurrent
+// conditional write to the same key is in progress: it is retried like a failed condition.
+func isS3PreconditionFailed(err error) bool {
+	apiErr := smithy.APIError(nil)
+	if errors.As(err, &apiErr) {
+		switch apiErr.ErrorCode() {
+		case "PreconditionFailed", "ConditionalRequestConflict":
+			return true
+		}
+	}
+
+	responseErr := (*awshttp.ResponseError)(nil)
+
+	return errors.As(err, &responseErr) && responseErr.HTTPStatusCode() == http.StatusPreconditionFailed
+}
+
+func isS3NotModified(err error) bool {
+	responseErr := (*awshttp.ResponseError)(nil)
+
+	return errors.As(err, &responseErr) && responseErr.HTTPStatusCode() == http.StatusNotModified
+}
@@ -0,0 +1,120 @@
+package awssdkhelper
+
+import (
+	"context"
+	"errors"
+	"io"
+	"strconv"
+	"sync"
+	"testing"
+	"time"
+
+	TestUtility "github.com/thcomp/GoLang_TestUtility"
+)
+
+func Test_S3Helper_ConditionalPut(t *testing.T) {
+	tester := TestUtility.NewTestHelper(t)
+	fake := newFakeS3Server(t, "conditional-bucket")
+	helper := fake.helper()
+	ctx := context.Background()
+
+	err := helper.PutDataWithOptions(ctx, "state.json", []byte(`{"v":1}`), &S3PutOptions{IfNoneMatch: "*"})
+	tester.Fatalf(err == nil, "create-only put: %v", err)
+	err = helper.PutDataWithOptions(ctx, "state.json", []byte(`{"v":2}`), &S3PutOptions{IfNoneMatch: "*"})
+	tester.Errorf(errors.Is(err, ErrS3PreconditionFailed) && string(fake.object("state.json").data) == `{"v":1}`, "create-only put of an existing key: %v", err)
+
+	item, err := helper.GetItem("state.json")
+	tester.Fatalf(err == nil, "GetItem: %v", err)
+	etag, _ := item.ETag()
+	item.Close()
+	err = helper.PutDataWithOptions(ctx, "state.json", []byte(`{"v":2}`), &S3PutOptions{IfMatch: etag})
+	tester.Errorf(err == nil && string(fake.object("state.json").data) == `{"v":2}`, "compare-and-swap: %v", err)
+	err = helper.PutDataWithOptions(ctx, "state.json", []byte(`{"v":3}`), &S3PutOptions{IfMatch: etag})
+	tester.Errorf(errors.Is(err, ErrS3PreconditionFailed) && string(fake.object("state.json").data) == `{"v":2}`, "compare-and-swap with a stale ETag: %v", err)
+
+	err = helper.PutDataWithOptions(ctx, "missing.json", []byte(`{}`), &S3PutOptions{IfMatch: etag})
+	tester.Errorf(errors.Is(err, ErrObjectNotFound), "compare-and-swap of a missing key: %v", err)
+
+	// multipart uploads check the condition on completion
+	helper.SetMultipartThreshold(S3MinPartSize)
+	err = helper.PutDataWithOptions(ctx, "state.json", testMultipartData(int(S3MinPartSize+1)), &S3PutOptions{IfNoneMatch: "*"})
+	tester.Errorf(errors.Is(err, ErrS3PreconditionFailed) && len(fake.uploads) == 0, "create-only multipart upload: %v", err)
+	tester.Errorf(string(fake.object("state.json").data) == `{"v":2}`, "object replaced by a failed multipart upload")
+}
+
+func Test_S3Helper_CompareAndSwapRetry(t *testing.T) {
+	tester := TestUtility.NewTestHelper(t)
+	fake := newFakeS3Server(t, "conditional-bucket")
+	helper := fake.helper()
+	ctx := context.Background()
+	fake.putObject("counter", []byte("0"))
+
+	increment := func() error {
+		for {
+			item, err := helper.GetItemWithContext(ctx, "counter")
+			if err != nil {
+				return err
+			}
+			data, err := io.ReadAll(item)
+			item.Close()
+			if err != nil {
+				return err
+			}
+			etag, _ := item.ETag()
+			count, _ := strconv.Atoi(string(data))
+
+			err = helper.PutDataWithOptions(ctx, "counter", []byte(strconv.Itoa(count+1)), &S3PutOptions{IfMatch: etag})
+			if !errors.Is(err, ErrS3PreconditionFailed) {
+				return err
+			}
+		}
+	}
+
+	waitGroup := sync.WaitGroup{}
+	errs := make([]error, 10)
+	for index := range errs {
+		waitGroup.Add(1)
+		go func() {
+			defer waitGroup.Done()
+			errs[index] = increment()
+		}()
+	}
+	waitGroup.Wait()
+
+	tester.Errorf(errors.Join(errs...) == nil, "increment: %v", errors.Join(errs...))
+	tester.Errorf(string(fake.object("counter").data) == "10", "counter: %s", fake.object("counter").data)
+}
+
+func Test_S3Helper_ConditionalGet(t *testing.T) {
+	tester := TestUtility.NewTestHelper(t)
+	fake := newFakeS3Server(t, "conditional-bucket")
+	helper := fake.helper()
+	ctx := context.Background()
+
+	fake.putObject("config.json", []byte(`{}`))
+	object := fake.object("config.json")
+	object.lastModified = time.Date(2024, 1, 2, 3, 4, 5, 0, time.UTC)
+
+	_, err := helper.GetItemWithOptions(ctx, "config.json", &S3GetOptions{IfNoneMatch: object.etag})
+	tester.Errorf(errors.Is(err, ErrS3NotModified), "If-None-Match of the current ETag: %v", err)
+	item, err := helper.GetItemWithOptions(ctx, "config.json", &S3GetOptions{IfNoneMatch: `"stale"`})
+	tester.Errorf(err == nil && item != nil, "If-None-Match of a stale ETag: %v", err)
+	if item != nil {
+		item.Close()
+	}
+
+	_, err = helper.GetItemWithOptions(ctx, "config.json", &S3GetOptions{IfModifiedSince: object.lastModified})
+	tester.Errorf(errors.Is(err, ErrS3NotModified), "If-Modified-Since of the last modification: %v", err)
+	item, err = helper.GetItemWithOptions(ctx, "config.json", &S3GetOptions{IfModifiedSince: object.lastModified.Add(-time.Hour)})
+	tester.Errorf(err == nil && item != nil, "If-Modified-Since before the last modification: %v", err)
+	if item != nil {
+		item.Close()
+	}
+
+	_, err = helper.GetItemWithOptions(ctx, "config.json", &S3GetOptions{IfMatch: `"stale"`})
+	tester.Errorf(errors.Is(err, ErrS3PreconditionFailed), "If-Match of a stale ETag: %v", err)
+	_, err = helper.GetItemWithOptions(ctx, "config.json", &S3GetOptions{IfUnmodifiedSince: object.lastModified.Add(-time.Hour)})
+	tester.Errorf(errors.Is(err, ErrS3PreconditionFailed), "If-Unmodified-Since before the last modification: %v", err)
+	_, err = helper.GetItemWithOptions(ctx, "missing.json", &S3GetOptions{IfNoneMatch: object.etag})
+	tester.Errorf(errors.Is(err, ErrObjectNotFound), "conditional get of a missing key: %v", err)
+}
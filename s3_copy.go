@@ -0,0 +1,536 @@
+package awssdkhelper
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/url"
+	"sort"
+	"strings"
+	"sync"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/s3"
+	"github.com/aws/aws-sdk-go-v2/service/s3/types"
+)
+
+// S3MaxCopyObjectSize is the largest object CopyObject accepts. Larger objects are copied with UploadPartCopy.
+const S3MaxCopyObjectSize int64 = 5 * 1024 * 1024 * 1024
+const s3DefaultCopyPartSize int64 = 64 * 1024 * 1024
+const s3DefaultCopyConcurrency = 4
+
+// ErrS3MoveSourceChanged fails a move whose copy succeeded, but whose source was overwritten before it was deleted.
+// The newer source is kept, and the destination holds the content copied.
+var ErrS3MoveSourceChanged = errors.New("s3 object copied, but the source changed before it was deleted")
+
+type S3CopyOptions struct {
+	// SourceBucket and DestinationBucket default to the bucket of the helper.
+	SourceBucket      string
+	DestinationBucket string
+	// SourceVersionId copies a version of the source instead of the current one. It is ignored by prefix operations.
+	SourceVersionId string
+	// Metadata replaces the user metadata (x-amz-meta-*) when not nil. ContentType replaces the content type.
+	// Without both, the metadata of the source is preserved as is.
+	Metadata    map[string]string
+	ContentType string
+	// Tags replaces the tags when not nil. An empty map removes them. Otherwise the source tags are preserved.
+	Tags map[string]string
+	// MultipartThreshold is the size from which parts are copied with UploadPartCopy. Defaults to 5 GiB, the CopyObject limit.
+	MultipartThreshold int64
+	// PartSize of a multipart copy defaults to 64 MiB, and is raised to 5 MiB (the S3 minimum) if smaller.
+	PartSize int64
+	// Concurrency is the number of parts, or of objects for prefix operations, copied in parallel. Defaults to 4.
+	Concurrency int
+	// Encryption of the copy defaults to the encryption set by SetEncryption, then to the SSE-S3 or SSE-KMS
+	// encryption of the source. SourceEncryption gives the SSE-C key of the source, and also defaults to SetEncryption.
+	Encryption       *S3Encryption
+	SourceEncryption *S3Encryption
+}
+
+// S3KeyError is the failure of an operation on a single key among many.
+type S3KeyError struct {
+	Key string
+	// VersionId is set when the operation targeted a specific version.
+	VersionId string
+	Err       error
+}
+
+func (keyErr *S3KeyError) Error() string {
+	if keyErr.VersionId != "" {
+		return keyErr.Key + " (version " + keyErr.VersionId + "): " + keyErr.Err.Error()
+	}
+
+	return keyErr.Key + ": " + keyErr.Err.Error()
+}
+
+func (keyErr *S3KeyError) Unwrap() error {
+	return keyErr.Err
+}
+
+type S3PrefixCopyResult struct {
+	// Copied holds the source keys copied (and deleted for a rename), sorted.
+	Copied   []string
+	Failures []*S3KeyError
+}
+
+func (s3Helper *S3Helper) normalizeCopyOptions(options *S3CopyOptions) S3CopyOptions {
+	normalized := S3CopyOptions{}
+	if options != nil {
+		normalized = *options
+	}
+	if normalized.SourceBucket == "" {
+		normalized.SourceBucket = s3Helper.bucket
+	}
+	if normalized.DestinationBucket == "" {
+		normalized.DestinationBucket = s3Helper.bucket
+	}
+	if normalized.MultipartThreshold <= 0 || normalized.MultipartThreshold > S3MaxCopyObjectSize {
+		normalized.MultipartThreshold = S3MaxCopyObjectSize
+	}
+	if normalized.PartSize <= 0 {
+		normalized.PartSize = s3DefaultCopyPartSize
+	}
+	if normalized.PartSize < S3MinPartSize {
+		normalized.PartSize = S3MinPartSize
+	}
+	if normalized.Concurrency <= 0 {
+		normalized.Concurrency = s3DefaultCopyConcurrency
+	}
+	normalized.Encryption = s3Helper.encryptionFor(normalized.Encryption)
+	normalized.SourceEncryption = s3Helper.encryptionFor(normalized.SourceEncryption)
+
+	return normalized
+}
+
+// copyEncryption returns the encryption of the copy. Without one, S3 would use the bucket default
+// instead of the source's, so the SSE-S3 or SSE-KMS encryption of the source is carried over.
+func copyEncryption(source *s3.HeadObjectOutput, options *S3CopyOptions) *S3Encryption {
+	if options.Encryption != nil {
+		return options.Encryption
+	}
+
+	switch source.ServerSideEncryption {
+	case types.ServerSideEncryptionAes256:
+		return &S3Encryption{Mode: S3EncryptionSSES3}
+	case types.ServerSideEncryptionAwsKms:
+		return &S3Encryption{
+			Mode:             S3EncryptionSSEKMS,
+			KMSKeyID:         aws.ToString(source.SSEKMSKeyId),
+			BucketKeyEnabled: aws.ToBool(source.BucketKeyEnabled),
+		}
+	}
+
+	return nil
+}
+
+// s3CopySource URL-encodes "bucket/key" for x-amz-copy-source, keeping the "/" separators.
+// A version is appended as "?versionId=".
+func s3CopySource(bucket, key, versionID string) string {
+	segments := strings.Split(key, "/")
+	for index, segment := range segments {
+		segments[index] = strings.ReplaceAll(url.QueryEscape(segment), "+", "%20")
+	}
+	source := url.QueryEscape(bucket) + "/" + strings.Join(segments, "/")
+	if versionID != "" {
+		source += "?versionId=" + url.QueryEscape(versionID)
+	}
+
+	return source
+}
+
+func encodeS3Tags(tags map[string]string) string {
+	values := url.Values{}
+	for name, value := range tags {
+		values.Set(name, value)
+	}
+
+	return values.Encode()
+}
+
+func (s3Helper *S3Helper) CopyItem(srcKey, dstKey string, options *S3CopyOptions) (err error) {
+	return s3Helper.CopyItemWithContext(context.Background(), srcKey, dstKey, options)
+}
+
+// CopyItemWithContext copies srcKey to dstKey on the S3 side, without downloading the object.
+// Objects from MultipartThreshold on are copied in parts with UploadPartCopy, which S3 requires over 5 GiB.
+func (s3Helper *S3Helper) CopyItemWithContext(ctx context.Context, srcKey, dstKey string, options *S3CopyOptions) (err error) {
+	normalized := s3Helper.normalizeCopyOptions(options)
+	_, err = s3Helper.copyItem(ctx, srcKey, dstKey, &normalized)
+
+	return
+}
+
+// copyItem copies srcKey with normalized options, and returns the attributes of the source copied.
+func (s3Helper *S3Helper) copyItem(ctx context.Context, srcKey, dstKey string, normalized *S3CopyOptions) (source *s3.HeadObjectOutput, err error) {
+	headInput := &s3.HeadObjectInput{
+		Bucket: aws.String(normalized.SourceBucket),
+		Key:    aws.String(srcKey),
+	}
+	if normalized.SourceVersionId != "" {
+		headInput.VersionId = aws.String(normalized.SourceVersionId)
+	}
+	normalized.SourceEncryption.applyToHeadObject(headInput)
+
+	callCtx, cancel := s3Helper.callContext(ctx)
+	source, headErr := s3Helper.client.HeadObject(callCtx, headInput)
+	cancel()
+	if headErr != nil {
+		return nil, wrapS3NotFound(srcKey, headErr)
+	}
+
+	if aws.ToInt64(source.ContentLength) >= normalized.MultipartThreshold {
+		err = s3Helper.copyMultipart(ctx, srcKey, dstKey, source, normalized)
+	} else {
+		err = s3Helper.copySingle(ctx, srcKey, dstKey, source, normalized)
+	}
+	if err != nil {
+		err = fmt.Errorf("copy %s to %s: %w", srcKey, dstKey, err)
+	}
+
+	return
+}
+
+func (s3Helper *S3Helper) copySingle(ctx context.Context, srcKey, dstKey string, source *s3.HeadObjectOutput, options *S3CopyOptions) (err error) {
+	input := &s3.CopyObjectInput{
+		Bucket:            aws.String(options.DestinationBucket),
+		Key:               aws.String(dstKey),
+		CopySource:        aws.String(s3CopySource(options.SourceBucket, srcKey, options.SourceVersionId)),
+		CopySourceIfMatch: source.ETag,
+	}
+	copyEncryption(source, options).applyToCopyObject(input)
+	input.CopySourceSSECustomerAlgorithm, input.CopySourceSSECustomerKey, input.CopySourceSSECustomerKeyMD5 = options.SourceEncryption.customerKey()
+	if source.StorageClass != "" {
+		input.StorageClass = types.StorageClass(source.StorageClass)
+	}
+	if options.Metadata != nil || options.ContentType != "" {
+		// REPLACE drops every stored header, so the ones not replaced are carried over from the source
+		input.MetadataDirective = types.MetadataDirectiveReplace
+		input.ContentType = source.ContentType
+		input.CacheControl = source.CacheControl
+		input.ContentDisposition = source.ContentDisposition
+		input.ContentEncoding = source.ContentEncoding
+		input.ContentLanguage = source.ContentLanguage
+		input.Metadata = source.Metadata
+		if options.ContentType != "" {
+			input.ContentType = aws.String(options.ContentType)
+		}
+		if options.Metadata != nil {
+			input.Metadata = options.Metadata
+		}
+	}
+	if options.Tags != nil {
+		input.TaggingDirective = types.TaggingDirectiveReplace
+		input.Tagging = aws.String(encodeS3Tags(options.Tags))
+	}
+
+	callCtx, cancel := s3Helper.callContext(ctx)
+	defer cancel()
+
+	_, err = s3Helper.client.CopyObject(callCtx, input)
+
+	return
+}
+
+// copyMultipart copies the source in ranges of PartSize. Unlike CopyObject, the destination does not inherit
+// metadata nor tags, so they are set on CreateMultipartUpload.
+func (s3Helper *S3Helper) copyMultipart(ctx context.Context, srcKey, dstKey string, source *s3.HeadObjectOutput, options *S3CopyOptions) (err error) {
+	size := aws.ToInt64(source.ContentLength)
+	partSize := options.PartSize
+	for (size+partSize-1)/partSize > S3MaxParts {
+		partSize *= 2
+	}
+
+	createInput := &s3.CreateMultipartUploadInput{
+		Bucket:             aws.String(options.DestinationBucket),
+		Key:                aws.String(dstKey),
+		ContentType:        source.ContentType,
+		CacheControl:       source.CacheControl,
+		ContentDisposition: source.ContentDisposition,
+		ContentEncoding:    source.ContentEncoding,
+		ContentLanguage:    source.ContentLanguage,
+		Metadata:           source.Metadata,
+	}
+	if source.StorageClass != "" {
+		createInput.StorageClass = types.StorageClass(source.StorageClass)
+	}
+	if options.ContentType != "" {
+		createInput.ContentType = aws.String(options.ContentType)
+	}
+	if options.Metadata != nil {
+		createInput.Metadata = options.Metadata
+	}
+	tags := options.Tags
+	if tags == nil {
+		if tags, err = s3Helper.getTags(ctx, options.SourceBucket, srcKey, options.SourceVersionId); err != nil {
+			return
+		}
+	}
+	if len(tags) > 0 {
+		createInput.Tagging = aws.String(encodeS3Tags(tags))
+	}
+	encryption := copyEncryption(source, options)
+	encryption.applyToCreateMultipartUpload(createInput)
+
+	callCtx, cancel := s3Helper.callContext(ctx)
+	created, createErr := s3Helper.client.CreateMultipartUpload(callCtx, createInput)
+	cancel()
+	if createErr != nil {
+		return createErr
+	}
+	uploadID := created.UploadId
+
+	partCount := int32((size + partSize - 1) / partSize)
+	completedParts := make([]types.CompletedPart, partCount)
+	err = runS3Concurrently(ctx, int(partCount), options.Concurrency, func(partCtx context.Context, index int) error {
+		start := int64(index) * partSize
+		end := min(start+partSize, size) - 1
+
+		callCtx, cancel := s3Helper.callContext(partCtx)
+		defer cancel()
+
+		input := &s3.UploadPartCopyInput{
+			Bucket:            aws.String(options.DestinationBucket),
+			Key:               aws.String(dstKey),
+			UploadId:          uploadID,
+			PartNumber:        aws.Int32(int32(index + 1)),
+			CopySource:        aws.String(s3CopySource(options.SourceBucket, srcKey, options.SourceVersionId)),
+			CopySourceRange:   aws.String(fmt.Sprintf("bytes=%d-%d", start, end)),
+			CopySourceIfMatch: source.ETag,
+		}
+		input.SSECustomerAlgorithm, input.SSECustomerKey, input.SSECustomerKeyMD5 = encryption.customerKey()
+		input.CopySourceSSECustomerAlgorithm, input.CopySourceSSECustomerKey, input.CopySourceSSECustomerKeyMD5 = options.SourceEncryption.customerKey()
+		if output, copyErr := s3Helper.client.UploadPartCopy(callCtx, input); copyErr == nil {
+			completedParts[index] = types.CompletedPart{
+				ETag:       output.CopyPartResult.ETag,
+				PartNumber: aws.Int32(int32(index + 1)),
+			}
+			return nil
+		} else {
+			return fmt.Errorf("copy part %d: %w", index+1, copyErr)
+		}
+	})
+
+	if err == nil {
+		input := &s3.CompleteMultipartUploadInput{
+			Bucket:          aws.String(options.DestinationBucket),
+			Key:             aws.String(dstKey),
+			UploadId:        uploadID,
+			MultipartUpload: &types.CompletedMultipartUpload{Parts: completedParts},
+		}
+		encryption.applyToCompleteMultipartUpload(input)
+
+		callCtx, cancel := s3Helper.callContext(ctx)
+		_, err = s3Helper.client.CompleteMultipartUpload(callCtx, input)
+		cancel()
+	}
+
+	if err != nil {
+		abortCtx, cancel := s3Helper.callContext(context.WithoutCancel(ctx))
+		if _, abortErr := s3Helper.client.AbortMultipartUpload(abortCtx, &s3.AbortMultipartUploadInput{
+			Bucket:   aws.String(options.DestinationBucket),
+			Key:      aws.String(dstKey),
+			UploadId: uploadID,
+		}); abortErr != nil {
+			err = errors.Join(err, fmt.Errorf("abort multipart upload %s: %w", aws.ToString(uploadID), abortErr))
+		}
+		cancel()
+	}
+
+	return
+}
+
+func (s3Helper *S3Helper) getTags(ctx context.Context, bucket, key, versionID string) (tags map[string]string, err error) {
+	callCtx, cancel := s3Helper.callContext(ctx)
+	defer cancel()
+
+	input := &s3.GetObjectTaggingInput{
+		Bucket: aws.String(bucket),
+		Key:    aws.String(key),
+	}
+	if versionID != "" {
+		input.VersionId = aws.String(versionID)
+	}
+	if output, taggingErr := s3Helper.client.GetObjectTagging(callCtx, input); taggingErr == nil {
+		tags = map[string]string{}
+		for _, tag := range output.TagSet {
+			tags[aws.ToString(tag.Key)] = aws.ToString(tag.Value)
+		}
+	} else {
+		err = wrapS3NotFound(key, taggingErr)
+	}
+
+	return
+}
+
+// runS3Concurrently calls task for 0 <= index < count, at most concurrency at a time.
+// The first error cancels the context passed to the remaining tasks and is returned.
+func runS3Concurrently(ctx context.Context, count int, concurrency int, task func(ctx context.Context, index int) error) (err error) {
+	taskCtx, cancel := context.WithCancel(ctx)
+	defer cancel()
+
+	semaphore := make(chan struct{}, concurrency)
+	waitGroup := sync.WaitGroup{}
+	errMutex := sync.Mutex{}
+	setErr := func(taskErr error) {
+		errMutex.Lock()
+		if err == nil {
+			err = taskErr
+			cancel()
+		}
+		errMutex.Unlock()
+	}
+
+	for index := 0; index < count; index++ {
+		semaphore <- struct{}{}
+		if taskCtx.Err() != nil {
+			<-semaphore
+			break
+		}
+
+		waitGroup.Add(1)
+		go func(index int) {
+			defer waitGroup.Done()
+			defer func() { <-semaphore }()
+
+			if taskErr := task(taskCtx, index); taskErr != nil {
+				setErr(taskErr)
+			}
+		}(index)
+	}
+	waitGroup.Wait()
+
+	if err == nil {
+		err = ctx.Err()
+	}
+
+	return
+}
+
+func (s3Helper *S3Helper) MoveItem(srcKey, dstKey string, options *S3CopyOptions) (err error) {
+	return s3Helper.MoveItemWithContext(context.Background(), srcKey, dstKey, options)
+}
+
+// MoveItemWithContext copies srcKey to dstKey, then deletes srcKey. The source is kept when the copy fails,
+// and when it was overwritten after the copy, which fails with ErrS3MoveSourceChanged. With SourceVersionId,
+// that version is copied, then deleted permanently.
+func (s3Helper *S3Helper) MoveItemWithContext(ctx context.Context, srcKey, dstKey string, options *S3CopyOptions) (err error) {
+	normalized := s3Helper.normalizeCopyOptions(options)
+	if normalized.SourceBucket == normalized.DestinationBucket && srcKey == dstKey && normalized.SourceVersionId == "" {
+		return nil
+	}
+
+	source, err := s3Helper.copyItem(ctx, srcKey, dstKey, &normalized)
+	if err != nil {
+		return
+	}
+
+	callCtx, cancel := s3Helper.callContext(ctx)
+	defer cancel()
+
+	input := &s3.DeleteObjectInput{
+		Bucket: aws.String(normalized.SourceBucket),
+		Key:    aws.String(srcKey),
+	}
+	if normalized.SourceVersionId != "" {
+		// versions never change: deleting the current one would only add a delete marker over it
+		input.VersionId = aws.String(normalized.SourceVersionId)
+	} else {
+		// only deletes the content copied
+		input.IfMatch = source.ETag
+	}
+	_, deleteErr := s3Helper.client.DeleteObject(callCtx, input)
+	if deleteErr = wrapS3Condition(srcKey, deleteErr); errors.Is(deleteErr, ErrS3PreconditionFailed) {
+		err = fmt.Errorf("move %s to %s: %w", srcKey, dstKey, ErrS3MoveSourceChanged)
+	} else if deleteErr != nil && !errors.Is(deleteErr, ErrObjectNotFound) {
+		// a source deleted meanwhile is moved all the same
+		err = fmt.Errorf("delete %s after copying it to %s: %w", srcKey, dstKey, deleteErr)
+	}
+
+	return
+}
+
+// CopyPrefixWithContext copies every object under srcPrefix to the same relative key under dstPrefix.
+// Objects are copied concurrently, and a failure does not stop the others: failures are listed in the
+// result and joined into the returned error.
+func (s3Helper *S3Helper) CopyPrefixWithContext(ctx context.Context, srcPrefix, dstPrefix string, options *S3CopyOptions) (*S3PrefixCopyResult, error) {
+	return s3Helper.copyPrefix(ctx, srcPrefix, dstPrefix, options, false)
+}
+
+// RenamePrefixWithContext moves every object under srcPrefix to dstPrefix, like renaming a directory.
+// S3 has no rename, so each object is copied then deleted; a failed object stays under srcPrefix.
+func (s3Helper *S3Helper) RenamePrefixWithContext(ctx context.Context, srcPrefix, dstPrefix string, options *S3CopyOptions) (*S3PrefixCopyResult, error) {
+	return s3Helper.copyPrefix(ctx, srcPrefix, dstPrefix, options, true)
+}
+
+func (s3Helper *S3Helper) copyPrefix(ctx context.Context, srcPrefix, dstPrefix string, options *S3CopyOptions, move bool) (result *S3PrefixCopyResult, err error) {
+	result = &S3PrefixCopyResult{}
+	normalized := s3Helper.normalizeCopyOptions(options)
+	if normalized.SourceBucket == normalized.DestinationBucket && srcPrefix == dstPrefix {
+		return result, nil
+	}
+	// list first, so copies made under dstPrefix never show up in the listing. Raw keys, unlike Walk, include
+	// the "folder" placeholders ("src/", "src/empty/"), so empty directories are copied and none is left behind.
+	keys := []string{}
+	paginator := s3.NewListObjectsV2Paginator(s3Helper.client, &s3.ListObjectsV2Input{
+		Bucket: aws.String(normalized.SourceBucket),
+		Prefix: aws.String(srcPrefix),
+	})
+	for paginator.HasMorePages() {
+		callCtx, cancel := s3Helper.callContext(ctx)
+		output, listErr := paginator.NextPage(callCtx)
+		cancel()
+		if listErr != nil {
+			return result, listErr
+		}
+		for _, content := range output.Contents {
+			keys = append(keys, aws.ToString(content.Key))
+		}
+	}
+	sort.Strings(keys)
+
+	// objects are copied one part at a time, so that Concurrency bounds the total number of requests
+	objectOptions := normalized
+	objectOptions.Concurrency = 1
+	objectOptions.SourceVersionId = ""
+
+	resultMutex := sync.Mutex{}
+	semaphore := make(chan struct{}, normalized.Concurrency)
+	waitGroup := sync.WaitGroup{}
+	for _, key := range keys {
+		semaphore <- struct{}{}
+		waitGroup.Add(1)
+		go func(key string) {
+			defer waitGroup.Done()
+			defer func() { <-semaphore }()
+
+			copyErr := ctx.Err()
+			if copyErr == nil {
+				dstKey := dstPrefix + strings.TrimPrefix(key, srcPrefix)
+				if move {
+					copyErr = s3Helper.MoveItemWithContext(ctx, key, dstKey, &objectOptions)
+				} else {
+					copyErr = s3Helper.CopyItemWithContext(ctx, key, dstKey, &objectOptions)
+				}
+			}
+
+			resultMutex.Lock()
+			defer resultMutex.Unlock()
+			if copyErr == nil {
+				result.Copied = append(result.Copied, key)
+			} else {
+				result.Failures = append(result.Failures, &S3KeyError{Key: key, Err: copyErr})
+			}
+		}(key)
+	}
+	waitGroup.Wait()
+
+	sort.Strings(result.Copied)
+	sort.Slice(result.Failures, func(i, j int) bool { return result.Failures[i].Key < result.Failures[j].Key })
+	errs := []error{}
+	for _, failure := range result.Failures {
+		errs = append(errs, failure)
+	}
+	err = errors.Join(errs...)
+
+	return
+}
@@ -0,0 +1,146 @@
+package awssdkhelper
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"net/http"
+	"net/url"
+	"testing"
+
+	TestUtility "github.com/thcomp/GoLang_TestUtility"
+)
+
+func putFakeS3ObjectWithMetadata(fake *fakeS3Server, key string, data []byte) {
+	fake.putObject(key, data)
+
+	object := fake.object(key)
+	object.contentType = "text/plain"
+	object.headers = http.Header{
+		"Cache-Control":    []string{"max-age=60"},
+		"X-Amz-Meta-Owner": []string{"alice"},
+	}
+	object.tags = url.Values{"project": []string{"copy"}}
+}
+
+func Test_S3Helper_CopyItem(t *testing.T) {
+	tester := TestUtility.NewTestHelper(t)
+	fake := newFakeS3Server(t, "copy-bucket")
+	fake.addBucket("other-bucket")
+	helper := fake.helper()
+	ctx := context.Background()
+
+	data := []byte("copied content")
+	putFakeS3ObjectWithMetadata(fake, "dir/source file+1.txt", data)
+
+	err := helper.CopyItemWithContext(ctx, "dir/source file+1.txt", "dir/copy.txt", nil)
+	tester.Fatalf(err == nil, "CopyItem: %v", err)
+	copied := fake.object("dir/copy.txt")
+	tester.Fatalf(copied != nil && bytes.Equal(copied.data, data), "copied object: %v", copied)
+	tester.Errorf(copied.contentType == "text/plain" && copied.headers.Get("X-Amz-Meta-Owner") == "alice" && copied.headers.Get("Cache-Control") == "max-age=60", "preserved metadata: %s, %v", copied.contentType, copied.headers)
+	tester.Errorf(copied.tags.Get("project") == "copy", "preserved tags: %v", copied.tags)
+
+	err = helper.CopyItemWithContext(ctx, "dir/source file+1.txt", "dir/replaced.txt", &S3CopyOptions{
+		Metadata: map[string]string{"owner": "bob"},
+		Tags:     map[string]string{"stage": "archived"},
+	})
+	tester.Fatalf(err == nil, "CopyItem replacing metadata: %v", err)
+	replaced := fake.object("dir/replaced.txt")
+	tester.Errorf(replaced.headers.Get("X-Amz-Meta-Owner") == "bob" && replaced.headers.Get("Cache-Control") == "max-age=60" && replaced.contentType == "text/plain", "replaced metadata: %s, %v", replaced.contentType, replaced.headers)
+	tester.Errorf(len(replaced.tags) == 1 && replaced.tags.Get("stage") == "archived", "replaced tags: %v", replaced.tags)
+
+	err = helper.CopyItemWithContext(ctx, "dir/source file+1.txt", "imported.txt", &S3CopyOptions{DestinationBucket: "other-bucket", ContentType: "application/octet-stream"})
+	tester.Fatalf(err == nil, "CopyItem to another bucket: %v", err)
+	imported := fake.objectIn("other-bucket", "imported.txt")
+	tester.Errorf(imported != nil && bytes.Equal(imported.data, data) && imported.contentType == "application/octet-stream" && imported.headers.Get("X-Amz-Meta-Owner") == "alice", "object in the other bucket: %v", imported)
+
+	err = helper.CopyItemWithContext(ctx, "missing.txt", "copy.txt", nil)
+	tester.Errorf(errors.Is(err, ErrObjectNotFound), "copy of a missing object: %v", err)
+}
+
+func Test_S3Helper_CopyItemMultipart(t *testing.T) {
+	tester := TestUtility.NewTestHelper(t)
+	fake := newFakeS3Server(t, "copy-bucket")
+	helper := fake.helper()
+
+	data := testMultipartData(int(2*S3MinPartSize + 1234))
+	putFakeS3ObjectWithMetadata(fake, "large.bin", data)
+
+	err := helper.CopyItemWithContext(context.Background(), "large.bin", "copies/large.bin", &S3CopyOptions{
+		MultipartThreshold: S3MinPartSize,
+		PartSize:           S3MinPartSize,
+	})
+	tester.Fatalf(err == nil, "multipart CopyItem: %v", err)
+	copied := fake.object("copies/large.bin")
+	tester.Fatalf(copied != nil && bytes.Equal(copied.data, data), "copied object differs")
+	tester.Errorf(len(copied.partSizes) == 3 && copied.partSizes[0] == S3MinPartSize, "part sizes: %v", copied.partSizes)
+	tester.Errorf(copied.contentType == "text/plain" && copied.headers.Get("X-Amz-Meta-Owner") == "alice" && copied.tags.Get("project") == "copy", "preserved metadata: %s, %v, %v", copied.contentType, copied.headers, copied.tags)
+	tester.Errorf(len(fake.uploads) == 0, "uploads left open: %v", fake.uploads)
+}
+
+func Test_S3Helper_MoveItem(t *testing.T) {
+	tester := TestUtility.NewTestHelper(t)
+	fake := newFakeS3Server(t, "copy-bucket")
+	helper := fake.helper()
+
+	fake.putObject("a.txt", []byte("moved"))
+	err := helper.MoveItem("a.txt", "b.txt", nil)
+	tester.Fatalf(err == nil, "MoveItem: %v", err)
+	tester.Errorf(fake.object("a.txt") == nil && fake.object("b.txt") != nil, "source kept or destination missing")
+
+	err = helper.MoveItem("a.txt", "c.txt", nil)
+	tester.Errorf(errors.Is(err, ErrObjectNotFound) && fake.object("c.txt") == nil, "move of a missing object: %v", err)
+
+	// a source overwritten between the copy and the delete is kept
+	fake.putObject("d.txt", []byte("copied"))
+	fake.beforeDelete = func(bucket, key string) {
+		fake.store(bucket, key, newFakeS3Object([]byte("newer"), ""))
+	}
+	err = helper.MoveItem("d.txt", "e.txt", nil)
+	fake.beforeDelete = nil
+	tester.Errorf(errors.Is(err, ErrS3MoveSourceChanged), "move of a changed source: %v", err)
+	tester.Errorf(string(fake.object("d.txt").data) == "newer" && string(fake.object("e.txt").data) == "copied", "newer source is deleted or copy is missing")
+
+	// moving a version deletes that version, not the current object
+	fake.versioned = true
+	fake.putObject("f.txt", []byte("first"))
+	firstVersion := fake.object("f.txt").versionID
+	fake.putObject("f.txt", []byte("second"))
+	err = helper.MoveItem("f.txt", "g.txt", &S3CopyOptions{SourceVersionId: firstVersion})
+	tester.Fatalf(err == nil, "MoveItem of a version: %v", err)
+	tester.Errorf(string(fake.object("g.txt").data) == "first" && string(fake.object("f.txt").data) == "second", "version move changed the current object")
+	tester.Errorf(fake.version(fake.bucket, "f.txt", firstVersion) == nil, "moved version is kept")
+}
+
+func Test_S3Helper_RenamePrefix(t *testing.T) {
+	tester := TestUtility.NewTestHelper(t)
+	fake := newFakeS3Server(t, "copy-bucket")
+	helper := fake.helper()
+
+	for _, key := range []string{"old/a.txt", "old/sub/b.txt", "old/sub/c.txt", "older/d.txt"} {
+		fake.putObject(key, []byte(key))
+	}
+	fake.failPuts["new/sub/c.txt"] = true
+
+	result, err := helper.RenamePrefixWithContext(context.Background(), "old/", "new/", &S3CopyOptions{Concurrency: 2})
+	tester.Errorf(err != nil, "a failed object is not reported")
+	tester.Errorf(len(result.Copied) == 2 && result.Copied[0] == "old/a.txt" && result.Copied[1] == "old/sub/b.txt", "copied: %v", result.Copied)
+	tester.Fatalf(len(result.Failures) == 1 && result.Failures[0].Key == "old/sub/c.txt", "failures: %v", result.Failures)
+
+	tester.Errorf(fake.object("new/a.txt") != nil && fake.object("new/sub/b.txt") != nil && fake.object("new/sub/c.txt") == nil, "renamed objects are missing")
+	tester.Errorf(fake.object("old/a.txt") == nil && fake.object("old/sub/b.txt") == nil, "renamed objects are kept")
+	tester.Errorf(fake.object("old/sub/c.txt") != nil && fake.object("older/d.txt") != nil, "a failed or unrelated object is deleted")
+
+	result, err = helper.CopyPrefixWithContext(context.Background(), "older/", "archive/older/", nil)
+	tester.Errorf(err == nil && len(result.Copied) == 1 && fake.object("archive/older/d.txt") != nil && fake.object("older/d.txt") != nil, "CopyPrefix: %v, %v", result, err)
+
+	// "folder" placeholders are moved too, empty directories included
+	for _, key := range []string{"src/", "src/empty/", "src/e.txt"} {
+		fake.putObject(key, nil)
+	}
+	result, err = helper.CopyPrefixWithContext(context.Background(), "src/", "copy/", nil)
+	tester.Errorf(err == nil && len(result.Copied) == 3 && fake.object("copy/") != nil && fake.object("copy/empty/") != nil, "CopyPrefix of placeholders: %v, %v", result, err)
+	result, err = helper.RenamePrefixWithContext(context.Background(), "src/", "dst/", nil)
+	tester.Errorf(err == nil && len(result.Copied) == 3 && fake.object("dst/") != nil && fake.object("dst/empty/") != nil && fake.object("dst/e.txt") != nil, "RenamePrefix of placeholders: %v, %v", result, err)
+	tester.Errorf(fake.object("src/") == nil && fake.object("src/empty/") == nil, "placeholders are left behind")
+}
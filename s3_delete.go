@@ -0,0 +1,233 @@
+package awssdkhelper
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sort"
+	"sync"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/s3"
+	"github.com/aws/aws-sdk-go-v2/service/s3/types"
+	"github.com/aws/smithy-go"
+)
+
+// S3MaxDeleteObjects is the number of keys a DeleteObjects request accepts.
+const S3MaxDeleteObjects = 1000
+const s3DefaultDeleteConcurrency = 4
+
+// ErrS3DeleteLimitExceeded is returned, before anything is deleted, when more objects match than S3DeleteOptions.MaxKeys.
+var ErrS3DeleteLimitExceeded = errors.New("delete limit exceeded")
+
+type S3DeleteOptions struct {
+	// DryRun only lists what would be deleted.
+	DryRun bool
+	// MaxKeys is a safety limit: when more objects (or versions with AllVersions) match, nothing is deleted
+	// and the error wraps ErrS3DeleteLimitExceeded. 0 means no limit.
+	MaxKeys int
+	// AllVersions makes DeletePrefix remove every version and delete marker under the prefix, which cannot be undone.
+	// Otherwise deleting in a versioned bucket only adds a delete marker, and older versions are kept.
+	AllVersions bool
+	// Concurrency is the number of DeleteObjects requests sent in parallel. Defaults to 4.
+	Concurrency int
+}
+
+type S3DeletedObject struct {
+	Key string
+	// VersionId is the deleted version, or the version of the delete marker created by deleting a key.
+	VersionId string
+	// DeleteMarker is set when a delete marker was created, or when the deleted version was a delete marker.
+	DeleteMarker bool
+}
+
+type S3DeleteResult struct {
+	// Deleted is sorted by key. With DryRun, it holds what would be deleted.
+	Deleted  []*S3DeletedObject
+	Failures []*S3KeyError
+}
+
+func (s3Helper *S3Helper) DeleteItems(keys []string) (*S3DeleteResult, error) {
+	return s3Helper.DeleteItemsWithContext(context.Background(), keys, nil)
+}
+
+// DeleteItemsWithContext deletes keys with DeleteObjects, S3MaxDeleteObjects keys per request.
+// Keys S3 failed to delete are listed in the result, and joined into the returned error.
+// Like DeleteItem, deleting a missing key succeeds.
+func (s3Helper *S3Helper) DeleteItemsWithContext(ctx context.Context, keys []string, options *S3DeleteOptions) (*S3DeleteResult, error) {
+	identifiers := make([]types.ObjectIdentifier, 0, len(keys))
+	for _, key := range keys {
+		identifiers = append(identifiers, types.ObjectIdentifier{Key: aws.String(key)})
+	}
+
+	return s3Helper.deleteObjects(ctx, identifiers, options)
+}
+
+func (s3Helper *S3Helper) DeletePrefix(prefix string) (*S3DeleteResult, error) {
+	return s3Helper.DeletePrefixWithContext(context.Background(), prefix, nil)
+}
+
+// DeletePrefixWithContext deletes every object under prefix, including a "folder" placeholder equal to prefix.
+// The whole listing is read before the first deletion, so that MaxKeys can refuse it. An empty prefix,
+// which would empty the bucket, is rejected.
+func (s3Helper *S3Helper) DeletePrefixWithContext(ctx context.Context, prefix string, options *S3DeleteOptions) (result *S3DeleteResult, err error) {
+	if prefix == "" {
+		return &S3DeleteResult{}, fmt.Errorf("refusing to delete the whole bucket %s with an empty prefix", s3Helper.bucket)
+	}
+
+	identifiers := []types.ObjectIdentifier{}
+	if options != nil && options.AllVersions {
+		identifiers, err = s3Helper.listVersionIdentifiers(ctx, prefix)
+	} else {
+		paginator := s3.NewListObjectsV2Paginator(s3Helper.client, &s3.ListObjectsV2Input{
+			Bucket: aws.String(s3Helper.bucket),
+			Prefix: aws.String(prefix),
+		})
+		for paginator.HasMorePages() && err == nil {
+			callCtx, cancel := s3Helper.callContext(ctx)
+			if output, listErr := paginator.NextPage(callCtx); listErr == nil {
+				for _, content := range output.Contents {
+					identifiers = append(identifiers, types.ObjectIdentifier{Key: content.Key})
+				}
+			} else {
+				err = listErr
+			}
+			cancel()
+		}
+	}
+	if err != nil {
+		return &S3DeleteResult{}, err
+	}
+
+	return s3Helper.deleteObjects(ctx, identifiers, options)
+}
+
+func (s3Helper *S3Helper) listVersionIdentifiers(ctx context.Context, prefix string) (identifiers []types.ObjectIdentifier, err error) {
+	paginator := s3.NewListObjectVersionsPaginator(s3Helper.client, &s3.ListObjectVersionsInput{
+		Bucket: aws.String(s3Helper.bucket),
+		Prefix: aws.String(prefix),
+	})
+	for paginator.HasMorePages() {
+		callCtx, cancel := s3Helper.callContext(ctx)
+		output, listErr := paginator.NextPage(callCtx)
+		cancel()
+		if listErr != nil {
+			return nil, listErr
+		}
+
+		for _, version := range output.Versions {
+			identifiers = append(identifiers, types.ObjectIdentifier{Key: version.Key, VersionId: version.VersionId})
+		}
+		for _, marker := range output.DeleteMarkers {
+			identifiers = append(identifiers, types.ObjectIdentifier{Key: marker.Key, VersionId: marker.VersionId})
+		}
+	}
+
+	return
+}
+
+func (s3Helper *S3Helper) deleteObjects(ctx context.Context, identifiers []types.ObjectIdentifier, options *S3DeleteOptions) (result *S3DeleteResult, err error) {
+	result = &S3DeleteResult{}
+	normalized := S3DeleteOptions{}
+	if options != nil {
+		normalized = *options
+	}
+	if normalized.Concurrency <= 0 {
+		normalized.Concurrency = s3DefaultDeleteConcurrency
+	}
+
+	if normalized.MaxKeys > 0 && len(identifiers) > normalized.MaxKeys {
+		return result, fmt.Errorf("%d objects match, at most %d may be deleted: %w", len(identifiers), normalized.MaxKeys, ErrS3DeleteLimitExceeded)
+	}
+
+	if normalized.DryRun {
+		for _, identifier := range identifiers {
+			result.Deleted = append(result.Deleted, &S3DeletedObject{
+				Key:       aws.ToString(identifier.Key),
+				VersionId: aws.ToString(identifier.VersionId),
+			})
+		}
+	} else {
+		resultMutex := sync.Mutex{}
+		semaphore := make(chan struct{}, normalized.Concurrency)
+		waitGroup := sync.WaitGroup{}
+		for start := 0; start < len(identifiers); start += S3MaxDeleteObjects {
+			semaphore <- struct{}{}
+			waitGroup.Add(1)
+			go func(chunk []types.ObjectIdentifier) {
+				defer waitGroup.Done()
+				defer func() { <-semaphore }()
+
+				deleted, failures := s3Helper.deleteChunk(ctx, chunk)
+
+				resultMutex.Lock()
+				defer resultMutex.Unlock()
+				result.Deleted = append(result.Deleted, deleted...)
+				result.Failures = append(result.Failures, failures...)
+			}(identifiers[start:min(start+S3MaxDeleteObjects, len(identifiers))])
+		}
+		waitGroup.Wait()
+	}
+
+	sort.Slice(result.Deleted, func(i, j int) bool {
+		if result.Deleted[i].Key != result.Deleted[j].Key {
+			return result.Deleted[i].Key < result.Deleted[j].Key
+		}
+		return result.Deleted[i].VersionId < result.Deleted[j].VersionId
+	})
+	sort.Slice(result.Failures, func(i, j int) bool { return result.Failures[i].Key < result.Failures[j].Key })
+	errs := []error{}
+	for _, failure := range result.Failures {
+		errs = append(errs, failure)
+	}
+	err = errors.Join(errs...)
+
+	return
+}
+
+// deleteChunk deletes at most S3MaxDeleteObjects objects. A failed request fails every object of the chunk.
+func (s3Helper *S3Helper) deleteChunk(ctx context.Context, chunk []types.ObjectIdentifier) (deleted []*S3DeletedObject, failures []*S3KeyError) {
+	requestErr := ctx.Err()
+	if requestErr == nil {
+		callCtx, cancel := s3Helper.callContext(ctx)
+		defer cancel()
+
+		if output, deleteErr := s3Helper.client.DeleteObjects(callCtx, &s3.DeleteObjectsInput{
+			Bucket: aws.String(s3Helper.bucket),
+			Delete: &types.Delete{Objects: chunk},
+		}); deleteErr == nil {
+			for _, object := range output.Deleted {
+				deletedObject := &S3DeletedObject{
+					Key:          aws.ToString(object.Key),
+					VersionId:    aws.ToString(object.VersionId),
+					DeleteMarker: aws.ToBool(object.DeleteMarker),
+				}
+				if deletedObject.VersionId == "" && deletedObject.DeleteMarker {
+					deletedObject.VersionId = aws.ToString(object.DeleteMarkerVersionId)
+				}
+				deleted = append(deleted, deletedObject)
+			}
+			for _, objectErr := range output.Errors {
+				failures = append(failures, &S3KeyError{
+					Key:       aws.ToString(objectErr.Key),
+					VersionId: aws.ToString(objectErr.VersionId),
+					Err:       &smithy.GenericAPIError{Code: aws.ToString(objectErr.Code), Message: aws.ToString(objectErr.Message)},
+				})
+			}
+		} else {
+			requestErr = deleteErr
+		}
+	}
+
+	if requestErr != nil {
+		for _, identifier := range chunk {
+			failures = append(failures, &S3KeyError{
+				Key:       aws.ToString(identifier.Key),
+				VersionId: aws.ToString(identifier.VersionId),
+				Err:       requestErr,
+			})
+		}
+	}
+
+	return
+}
@@ -0,0 +1,90 @@
+package awssdkhelper
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"testing"
+
+	"github.com/aws/smithy-go"
+	TestUtility "github.com/thcomp/GoLang_TestUtility"
+)
+
+func Test_S3Helper_DeleteItems(t *testing.T) {
+	tester := TestUtility.NewTestHelper(t)
+	fake := newFakeS3Server(t, "delete-bucket")
+	helper := fake.helper()
+
+	keys := []string{}
+	for index := 0; index < 2500; index++ {
+		key := fmt.Sprintf("batch/%04d.txt", index)
+		fake.putObject(key, []byte(key))
+		keys = append(keys, key)
+	}
+	fake.failDeletes["batch/1234.txt"] = true
+
+	result, err := helper.DeleteItemsWithContext(context.Background(), keys, &S3DeleteOptions{Concurrency: 2})
+	tester.Errorf(err != nil, "a failed key is not reported")
+	tester.Errorf(fake.deleteRequests == 3, "DeleteObjects requests: %d", fake.deleteRequests)
+	tester.Errorf(len(result.Deleted) == 2499 && result.Deleted[0].Key == "batch/0000.txt", "deleted: %d", len(result.Deleted))
+	tester.Fatalf(len(result.Failures) == 1 && result.Failures[0].Key == "batch/1234.txt", "failures: %v", result.Failures)
+	apiErr := smithy.APIError(nil)
+	tester.Errorf(errors.As(err, &apiErr) && apiErr.ErrorCode() == "AccessDenied", "per-key error: %v", err)
+	tester.Errorf(len(fake.objects) == 1 && fake.object("batch/1234.txt") != nil, "objects left: %d", len(fake.objects))
+}
+
+func Test_S3Helper_DeletePrefix(t *testing.T) {
+	tester := TestUtility.NewTestHelper(t)
+	fake := newFakeS3Server(t, "delete-bucket")
+	helper := fake.helper()
+	ctx := context.Background()
+
+	for _, key := range []string{"tmp/", "tmp/a.txt", "tmp/sub/b.txt", "tmpfile.txt"} {
+		fake.putObject(key, []byte(key))
+	}
+
+	_, err := helper.DeletePrefixWithContext(ctx, "", nil)
+	tester.Errorf(err != nil, "an empty prefix is accepted")
+
+	_, err = helper.DeletePrefixWithContext(ctx, "tmp/", &S3DeleteOptions{MaxKeys: 2})
+	tester.Errorf(errors.Is(err, ErrS3DeleteLimitExceeded) && len(fake.objects) == 4 && fake.deleteRequests == 0, "limit exceeded: %v", err)
+
+	result, err := helper.DeletePrefixWithContext(ctx, "tmp/", &S3DeleteOptions{DryRun: true})
+	tester.Errorf(err == nil && len(result.Deleted) == 3 && len(fake.objects) == 4 && fake.deleteRequests == 0, "dry run: %v, %v", result, err)
+
+	result, err = helper.DeletePrefixWithContext(ctx, "tmp/", &S3DeleteOptions{MaxKeys: 3})
+	tester.Fatalf(err == nil, "DeletePrefix: %v", err)
+	tester.Errorf(len(result.Deleted) == 3 && result.Deleted[0].Key == "tmp/" && result.Deleted[2].Key == "tmp/sub/b.txt", "deleted: %v", result.Deleted)
+	tester.Errorf(len(fake.objects) == 1 && fake.object("tmpfile.txt") != nil, "objects left: %v", fake.objects)
+}
+
+func Test_S3Helper_DeletePrefixVersioned(t *testing.T) {
+	tester := TestUtility.NewTestHelper(t)
+	fake := newFakeS3Server(t, "delete-bucket")
+	fake.versioned = true
+	helper := fake.helper()
+	ctx := context.Background()
+
+	for _, key := range []string{"logs/a.txt", "logs/a.txt", "logs/b.txt"} {
+		fake.putObject(key, []byte(key))
+	}
+
+	result, err := helper.DeletePrefixWithContext(ctx, "logs/", nil)
+	tester.Fatalf(err == nil, "DeletePrefix: %v", err)
+	tester.Errorf(len(result.Deleted) == 2 && result.Deleted[0].DeleteMarker && result.Deleted[0].VersionId != "", "deleted: %v", result.Deleted[0])
+	tester.Errorf(len(fake.objects) == 0 && len(fake.versions["delete-bucket"]["logs/a.txt"]) == 3, "versions: %v", fake.versions)
+
+	result, err = helper.DeletePrefixWithContext(ctx, "logs/", &S3DeleteOptions{AllVersions: true, DryRun: true})
+	tester.Errorf(err == nil && len(result.Deleted) == 5, "versions and delete markers to delete: %v, %v", result, err)
+
+	result, err = helper.DeletePrefixWithContext(ctx, "logs/", &S3DeleteOptions{AllVersions: true})
+	tester.Fatalf(err == nil, "DeletePrefix of all versions: %v", err)
+	markers := 0
+	for _, deleted := range result.Deleted {
+		if deleted.DeleteMarker {
+			markers++
+		}
+	}
+	tester.Errorf(len(result.Deleted) == 5 && markers == 2, "deleted versions: %d, markers: %d", len(result.Deleted), markers)
+	tester.Errorf(len(fake.versions["delete-bucket"]["logs/a.txt"]) == 0 && len(fake.versions["delete-bucket"]["logs/b.txt"]) == 0, "versions left: %v", fake.versions)
+}
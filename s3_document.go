@@ -0,0 +1,318 @@
+package awssdkhelper
+
+import (
+	"bytes"
+	"compress/gzip"
+	"container/list"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"strconv"
+	"sync"
+	"time"
+
+	"gopkg.in/yaml.v3"
+)
+
+// s3MetaSchemaVersion is the metadata name (x-amz-meta-*) of the schema version of documents.
+const s3MetaSchemaVersion = "schema-version"
+
+var ErrS3SchemaVersion = errors.New("s3 document schema version mismatch")
+
+// S3SchemaVersionError is returned when a document was stored with another schema version than expected.
+// Callers able to migrate older documents can read them again without SchemaVersion.
+type S3SchemaVersionError struct {
+	Key      string
+	Expected int
+	// Actual is 0 for documents stored without schema version.
+	Actual int
+}
+
+func (versionErr *S3SchemaVersionError) Error() string {
+	return fmt.Sprintf("%s: schema version %d, expected %d", versionErr.Key, versionErr.Actual, versionErr.Expected)
+}
+
+func (versionErr *S3SchemaVersionError) Is(target error) bool {
+	return target == ErrS3SchemaVersion
+}
+
+type S3DocumentOptions struct {
+	// Gzip compresses documents on put, with Content-Encoding gzip. Gzip and zstd documents are always decompressed on get.
+	Gzip bool
+	// SchemaVersion is stored with documents on put. On get, a document stored with another version
+	// (documents without version count as 0) fails with an *S3SchemaVersionError. 0 disables the check.
+	SchemaVersion int
+	// Cache keeps decoded documents by ETag. Gets then only send a conditional request, and do not
+	// download unchanged documents again.
+	Cache *S3DocumentCache
+	// PutOptions sets the metadata, tags, encryption and conditions of puts, e.g. IfMatch for compare-and-swap.
+	PutOptions *S3PutOptions
+}
+
+// GetJSON reads key and decodes it as JSON into a new T.
+func GetJSON[T any](ctx context.Context, s3Helper *S3Helper, key string, options *S3DocumentOptions) (value *T, err error) {
+	value = new(T)
+	if err = getS3Document(ctx, s3Helper, key, options, func(data []byte) error { return json.Unmarshal(data, value) }); err != nil {
+		value = nil
+	}
+
+	return
+}
+
+// PutJSON encodes value as JSON and writes it to key.
+func PutJSON[T any](ctx context.Context, s3Helper *S3Helper, key string, value T, options *S3DocumentOptions) (err error) {
+	if data, marshalErr := json.Marshal(value); marshalErr == nil {
+		err = putS3Document(ctx, s3Helper, key, data, "application/json", options)
+	} else {
+		err = marshalErr
+	}
+
+	return
+}
+
+// GetYAML reads key and decodes it as YAML into a new T.
+func GetYAML[T any](ctx context.Context, s3Helper *S3Helper, key string, options *S3DocumentOptions) (value *T, err error) {
+	value = new(T)
+	if err = getS3Document(ctx, s3Helper, key, options, func(data []byte) error { return yaml.Unmarshal(data, value) }); err != nil {
+		value = nil
+	}
+
+	return
+}
+
+// PutYAML encodes value as YAML and writes it to key.
+func PutYAML[T any](ctx context.Context, s3Helper *S3Helper, key string, value T, options *S3DocumentOptions) (err error) {
+	if data, marshalErr := yaml.Marshal(value); marshalErr == nil {
+		err = putS3Document(ctx, s3Helper, key, data, "application/yaml", options)
+	} else {
+		err = marshalErr
+	}
+
+	return
+}
+
+func getS3Document(ctx context.Context, s3Helper *S3Helper, key string, options *S3DocumentOptions, decode func(data []byte) error) (err error) {
+	normalized := S3DocumentOptions{}
+	if options != nil {
+		normalized = *options
+	}
+
+	cacheKey := s3Helper.bucket + "/" + key
+	cached, fresh, generation := normalized.Cache.get(cacheKey)
+	document := cached
+	if !fresh {
+		getOptions := &S3GetOptions{}
+		if cached != nil {
+			getOptions.IfNoneMatch = cached.etag
+		}
+
+		if item, getErr := s3Helper.GetItemWithOptions(ctx, key, getOptions); getErr == nil {
+			document, err = readS3Document(item)
+			item.Close()
+			if err != nil {
+				return fmt.Errorf("%s: %w", key, err)
+			}
+			normalized.Cache.put(cacheKey, document, generation)
+		} else if cached != nil && errors.Is(getErr, ErrS3NotModified) {
+			normalized.Cache.validated(cached)
+		} else {
+			if errors.Is(getErr, ErrObjectNotFound) {
+				normalized.Cache.remove(cacheKey)
+			}
+			return getErr
+		}
+	}
+
+	if normalized.SchemaVersion != 0 && document.schemaVersion != normalized.SchemaVersion {
+		return &S3SchemaVersionError{Key: key, Expected: normalized.SchemaVersion, Actual: document.schemaVersion}
+	}
+	if err = decode(document.data); err != nil {
+		err = fmt.Errorf("%s: %w", key, err)
+	}
+
+	return
+}
+
+// readS3Document reads the body of item, decompressing it when gzipped.
+func readS3Document(item *S3Item) (document *s3Document, err error) {
+	document = &s3Document{}
+	if document.data, err = io.ReadAll(item); err != nil {
+		return nil, err
+	}
+	if attributes, _ := item.Attributes(); attributes != nil {
+		document.etag = attributes.ETag
+		if value, exist := attributes.Metadata[s3MetaSchemaVersion]; exist {
+			if document.schemaVersion, err = strconv.Atoi(value); err != nil {
+				return nil, fmt.Errorf("invalid schema version %q", value)
+			}
+		}
+	}
+
+	// gzip and zstd are recognized by their magic number, as Content-Encoding is not always set by other writers
+	if compression := s3CompressionOfMagic(document.data); compression != S3CompressionNone {
+		if reader, decompressErr := newS3Decompressor(bytes.NewReader(document.data), compression); decompressErr == nil {
+			document.data, err = io.ReadAll(reader)
+			reader.Close()
+		} else {
+			err = decompressErr
+		}
+	}
+
+	return
+}
+
+func putS3Document(ctx context.Context, s3Helper *S3Helper, key string, data []byte, contentType string, options *S3DocumentOptions) (err error) {
+	normalized := S3DocumentOptions{}
+	if options != nil {
+		normalized = *options
+	}
+	putOptions := S3PutOptions{}
+	if normalized.PutOptions != nil {
+		putOptions = *normalized.PutOptions
+	}
+	if putOptions.ContentType == "" {
+		putOptions.ContentType = contentType
+	}
+	if normalized.SchemaVersion != 0 {
+		metadata := map[string]string{}
+		for name, value := range putOptions.Metadata {
+			metadata[name] = value
+		}
+		metadata[s3MetaSchemaVersion] = strconv.Itoa(normalized.SchemaVersion)
+		putOptions.Metadata = metadata
+	}
+	if normalized.Gzip {
+		buffer := &bytes.Buffer{}
+		writer := gzip.NewWriter(buffer)
+		if _, err = writer.Write(data); err == nil {
+			err = writer.Close()
+		}
+		if err != nil {
+			return
+		}
+		data = buffer.Bytes()
+		putOptions.ContentEncoding = "gzip"
+	}
+
+	err = s3Helper.PutDataWithOptions(ctx, key, data, &putOptions)
+	// the ETag of the new content is unknown, so the next get reloads it. Removed once the put is done,
+	// as gets running meanwhile would cache the previous content again.
+	normalized.Cache.remove(s3Helper.bucket + "/" + key)
+
+	return
+}
+
+type s3Document struct {
+	key           string
+	etag          string
+	schemaVersion int
+	// data is the decompressed content. It is decoded by every get, so callers never share a value.
+	data        []byte
+	validatedAt time.Time
+}
+
+// S3DocumentCache is an in-process cache of documents read by GetJSON and GetYAML, safe for concurrent use.
+// It lives as long as the process, e.g. across invocations of a warm Lambda function.
+type S3DocumentCache struct {
+	mutex      sync.Mutex
+	maxEntries int
+	maxAge     time.Duration
+	// entries holds *s3Document, most recently used first
+	entries *list.List
+	keys    map[string]*list.Element
+	// generation changes on every removal, so documents fetched before are not cached
+	generation uint64
+}
+
+// NewS3DocumentCache returns a cache keeping at most maxEntries documents, evicting the least recently used.
+// Within maxAge after a document was fetched or validated, gets return it without any request; afterwards
+// (and always when maxAge is 0) a conditional get checks the ETag first.
+func NewS3DocumentCache(maxEntries int, maxAge time.Duration) *S3DocumentCache {
+	return &S3DocumentCache{
+		maxEntries: maxEntries,
+		maxAge:     maxAge,
+		entries:    list.New(),
+		keys:       map[string]*list.Element{},
+	}
+}
+
+// get returns the cached document of key, whether it was validated within maxAge, and the generation
+// to pass to put.
+func (cache *S3DocumentCache) get(key string) (document *s3Document, fresh bool, generation uint64) {
+	if cache == nil {
+		return nil, false, 0
+	}
+	cache.mutex.Lock()
+	defer cache.mutex.Unlock()
+
+	if element, exist := cache.keys[key]; exist {
+		cache.entries.MoveToFront(element)
+		document = element.Value.(*s3Document)
+		fresh = cache.maxAge > 0 && time.Since(document.validatedAt) < cache.maxAge
+	}
+	generation = cache.generation
+
+	return
+}
+
+// put caches document, unless an entry was removed since the get which returned generation.
+func (cache *S3DocumentCache) put(key string, document *s3Document, generation uint64) {
+	if cache == nil || document.etag == "" {
+		return
+	}
+	cache.mutex.Lock()
+	defer cache.mutex.Unlock()
+
+	if generation != cache.generation {
+		return
+	}
+
+	document.key, document.validatedAt = key, time.Now()
+	if element, exist := cache.keys[key]; exist {
+		element.Value = document
+		cache.entries.MoveToFront(element)
+	} else {
+		cache.keys[key] = cache.entries.PushFront(document)
+	}
+	for cache.maxEntries > 0 && cache.entries.Len() > cache.maxEntries {
+		oldest := cache.entries.Back()
+		cache.entries.Remove(oldest)
+		delete(cache.keys, oldest.Value.(*s3Document).key)
+	}
+}
+
+func (cache *S3DocumentCache) validated(document *s3Document) {
+	if cache == nil {
+		return
+	}
+	cache.mutex.Lock()
+	defer cache.mutex.Unlock()
+
+	document.validatedAt = time.Now()
+}
+
+func (cache *S3DocumentCache) remove(key string) {
+	if cache == nil {
+		return
+	}
+	cache.mutex.Lock()
+	defer cache.mutex.Unlock()
+
+	cache.generation++
+	if element, exist := cache.keys[key]; exist {
+		cache.entries.Remove(element)
+		delete(cache.keys, key)
+	}
+}
+
+// Clear drops every cached document.
+func (cache *S3DocumentCache) Clear() {
+	cache.mutex.Lock()
+	defer cache.mutex.Unlock()
+
+	cache.generation++
+	cache.entries.Init()
+	cache.keys = map[string]*list.Element{}
+}
@@ -0,0 +1,142 @@
+package awssdkhelper
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	TestUtility "github.com/thcomp/GoLang_TestUtility"
+)
+
+type testS3Document struct {
+	Name  string   `json:"name" yaml:"name"`
+	Count int      `json:"count" yaml:"count"`
+	Tags  []string `json:"tags" yaml:"tags"`
+}
+
+func Test_S3Helper_JSONDocument(t *testing.T) {
+	tester := TestUtility.NewTestHelper(t)
+	fake := newFakeS3Server(t, "document-bucket")
+	helper := fake.helper()
+	ctx := context.Background()
+
+	document := testS3Document{Name: "config", Count: 3, Tags: []string{"a", "b"}}
+	err := PutJSON(ctx, helper, "config.json", document, nil)
+	tester.Fatalf(err == nil, "PutJSON: %v", err)
+	stored := fake.object("config.json")
+	tester.Errorf(stored.contentType == "application/json" && string(stored.data) == `{"name":"config","count":3,"tags":["a","b"]}`, "stored: %s, %s", stored.contentType, stored.data)
+
+	read, err := GetJSON[testS3Document](ctx, helper, "config.json", nil)
+	tester.Errorf(err == nil && read.Name == "config" && read.Count == 3 && len(read.Tags) == 2, "GetJSON: %+v, %v", read, err)
+
+	err = PutJSON(ctx, helper, "config.json.gz", &document, &S3DocumentOptions{Gzip: true})
+	tester.Fatalf(err == nil, "gzipped PutJSON: %v", err)
+	stored = fake.object("config.json.gz")
+	tester.Errorf(bytes.HasPrefix(stored.data, []byte{0x1f, 0x8b}) && stored.headers.Get("Content-Encoding") == "gzip", "stored gzip: %v", stored.headers)
+	read, err = GetJSON[testS3Document](ctx, helper, "config.json.gz", nil)
+	tester.Errorf(err == nil && read.Name == "config", "gzipped GetJSON: %+v, %v", read, err)
+
+	_, err = GetJSON[testS3Document](ctx, helper, "missing.json", nil)
+	tester.Errorf(errors.Is(err, ErrObjectNotFound), "missing document: %v", err)
+	fake.putObject("broken.json", []byte("{"))
+	_, err = GetJSON[testS3Document](ctx, helper, "broken.json", nil)
+	tester.Errorf(err != nil, "broken document is decoded")
+}
+
+func Test_S3Helper_YAMLDocument(t *testing.T) {
+	tester := TestUtility.NewTestHelper(t)
+	fake := newFakeS3Server(t, "document-bucket")
+	helper := fake.helper()
+	ctx := context.Background()
+
+	err := PutYAML(ctx, helper, "config.yaml", map[string]any{"name": "yaml", "count": 7}, &S3DocumentOptions{Gzip: true})
+	tester.Fatalf(err == nil, "PutYAML: %v", err)
+	tester.Errorf(fake.object("config.yaml").contentType == "application/yaml", "content type: %s", fake.object("config.yaml").contentType)
+
+	read, err := GetYAML[testS3Document](ctx, helper, "config.yaml", nil)
+	tester.Errorf(err == nil && read.Name == "yaml" && read.Count == 7, "GetYAML: %+v, %v", read, err)
+}
+
+func Test_S3Helper_DocumentSchemaVersion(t *testing.T) {
+	tester := TestUtility.NewTestHelper(t)
+	fake := newFakeS3Server(t, "document-bucket")
+	helper := fake.helper()
+	ctx := context.Background()
+
+	err := PutJSON(ctx, helper, "state.json", testS3Document{Name: "v2"}, &S3DocumentOptions{SchemaVersion: 2})
+	tester.Fatalf(err == nil, "PutJSON: %v", err)
+	tester.Errorf(fake.object("state.json").headers.Get("X-Amz-Meta-Schema-Version") == "2", "metadata: %v", fake.object("state.json").headers)
+
+	read, err := GetJSON[testS3Document](ctx, helper, "state.json", &S3DocumentOptions{SchemaVersion: 2})
+	tester.Errorf(err == nil && read.Name == "v2", "GetJSON of the same version: %v", err)
+
+	_, err = GetJSON[testS3Document](ctx, helper, "state.json", &S3DocumentOptions{SchemaVersion: 3})
+	versionErr := (*S3SchemaVersionError)(nil)
+	tester.Errorf(errors.Is(err, ErrS3SchemaVersion) && errors.As(err, &versionErr) && versionErr.Actual == 2 && versionErr.Expected == 3, "GetJSON of another version: %v", err)
+
+	fake.putObject("legacy.json", []byte(`{"name":"legacy"}`))
+	_, err = GetJSON[testS3Document](ctx, helper, "legacy.json", &S3DocumentOptions{SchemaVersion: 1})
+	tester.Errorf(errors.As(err, &versionErr) && versionErr.Actual == 0, "GetJSON without version: %v", err)
+	read, err = GetJSON[testS3Document](ctx, helper, "legacy.json", nil)
+	tester.Errorf(err == nil && read.Name == "legacy", "GetJSON without check: %v", err)
+}
+
+func Test_S3Helper_DocumentCache(t *testing.T) {
+	tester := TestUtility.NewTestHelper(t)
+	fake := newFakeS3Server(t, "document-bucket")
+	helper := fake.helper()
+	ctx := context.Background()
+	cache := NewS3DocumentCache(2, 0)
+	options := &S3DocumentOptions{Cache: cache}
+
+	fake.putObject("cached.json", []byte(`{"name":"first"}`))
+	read, err := GetJSON[testS3Document](ctx, helper, "cached.json", options)
+	tester.Fatalf(err == nil && read.Name == "first", "first GetJSON: %v", err)
+
+	// same ETag: the cached content is used, the changed body is not downloaded
+	fake.object("cached.json").data = []byte(`{"name":"same etag"}`)
+	read, err = GetJSON[testS3Document](ctx, helper, "cached.json", options)
+	tester.Errorf(err == nil && read.Name == "first", "cached GetJSON: %+v, %v", read, err)
+
+	// new ETag: the document is downloaded again
+	fake.putObject("cached.json", []byte(`{"name":"second"}`))
+	read, err = GetJSON[testS3Document](ctx, helper, "cached.json", options)
+	tester.Errorf(err == nil && read.Name == "second", "changed GetJSON: %+v, %v", read, err)
+
+	// a put through the cache drops its entry
+	err = PutJSON(ctx, helper, "cached.json", testS3Document{Name: "third"}, options)
+	tester.Fatalf(err == nil, "PutJSON: %v", err)
+	read, err = GetJSON[testS3Document](ctx, helper, "cached.json", options)
+	tester.Errorf(err == nil && read.Name == "third", "GetJSON after PutJSON: %+v, %v", read, err)
+
+	// a get which fetched the previous content while the put ran does not cache it
+	racing := NewS3DocumentCache(0, time.Hour)
+	_, _, generation := racing.get("document-bucket/cached.json")
+	stale := &s3Document{etag: `"stale"`, data: []byte(`{"name":"stale"}`)}
+	err = PutJSON(ctx, helper, "cached.json", testS3Document{Name: "third"}, &S3DocumentOptions{Cache: racing})
+	tester.Fatalf(err == nil, "PutJSON: %v", err)
+	racing.put("document-bucket/cached.json", stale, generation)
+	read, err = GetJSON[testS3Document](ctx, helper, "cached.json", &S3DocumentOptions{Cache: racing})
+	tester.Errorf(err == nil && read.Name == "third", "GetJSON after a concurrent PutJSON: %+v, %v", read, err)
+
+	for _, key := range []string{"a.json", "b.json"} {
+		fake.putObject(key, []byte(`{}`))
+		_, err = GetJSON[testS3Document](ctx, helper, key, options)
+		tester.Errorf(err == nil, "GetJSON of %s: %v", key, err)
+	}
+	tester.Errorf(len(cache.keys) == 2 && cache.keys["document-bucket/cached.json"] == nil, "least recently used entry is kept: %d", len(cache.keys))
+
+	// within maxAge no request is sent at all
+	fresh := NewS3DocumentCache(0, time.Hour)
+	options = &S3DocumentOptions{Cache: fresh}
+	read, err = GetJSON[testS3Document](ctx, helper, "cached.json", options)
+	tester.Fatalf(err == nil && read.Name == "third", "GetJSON: %v", err)
+	fake.putObject("cached.json", []byte(`{"name":"fourth"}`))
+	read, err = GetJSON[testS3Document](ctx, helper, "cached.json", options)
+	tester.Errorf(err == nil && read.Name == "third", "GetJSON within maxAge: %+v, %v", read, err)
+	fresh.Clear()
+	read, err = GetJSON[testS3Document](ctx, helper, "cached.json", options)
+	tester.Errorf(err == nil && read.Name == "fourth", "GetJSON after Clear: %+v, %v", read, err)
+}
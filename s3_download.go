@@ -0,0 +1,507 @@
+package awssdkhelper
+
+import (
+	"context"
+	"crypto/md5"
+	"crypto/sha1"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"hash"
+	"hash/crc32"
+	"hash/crc64"
+	"io"
+	"os"
+	"strconv"
+	"strings"
+	"sync"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/s3"
+	"github.com/aws/aws-sdk-go-v2/service/s3/types"
+	"github.com/aws/smithy-go"
+)
+
+const s3DefaultDownloadConcurrency = 4
+
+// crc64NVMEPolynomial is the reversed CRC-64/NVME polynomial used by the CRC64NVME checksum of S3.
+const crc64NVMEPolynomial = 0x9A6C9329AC4BC9B5
+
+var ErrS3ObjectChanged = errors.New("s3 object changed while reading")
+var ErrS3ChecksumMismatch = errors.New("s3 object checksum mismatch")
+
+// S3DownloadProgressFunc receives the number of bytes downloaded so far.
+type S3DownloadProgressFunc func(downloadedBytes, totalBytes int64)
+
+type S3DownloadOptions struct {
+	// PartSize is the size of each ranged GET. Defaults to 8 MiB.
+	PartSize int64
+	// Concurrency is the number of ranges fetched in parallel. Defaults to 4.
+	Concurrency int
+	// SkipVerify disables the ETag and checksum verification.
+	SkipVerify bool
+	// Progress is called after every fetched range. Calls are never concurrent.
+	Progress S3DownloadProgressFunc
+}
+
+func isS3InvalidRange(err error) bool {
+	apiErr := smithy.APIError(nil)
+
+	return errors.As(err, &apiErr) && apiErr.ErrorCode() == "InvalidRange"
+}
+
+func (item *S3Item) context() context.Context {
+	if item.ctx != nil {
+		return item.ctx
+	}
+
+	return context.Background()
+}
+
+// head loads the object attributes. partNumber 0 refreshes size, last modified, ETag and attributes of the item.
+func (item *S3Item) head(ctx context.Context, partNumber int32) (output *s3.HeadObjectOutput, err error) {
+	input := &s3.HeadObjectInput{
+		Bucket:       aws.String(item.helper.bucket),
+		Key:          aws.String(item.Path),
+		VersionId:    item.versionID,
+		ChecksumMode: types.ChecksumModeEnabled,
+	}
+	if partNumber > 0 {
+		input.PartNumber = aws.Int32(partNumber)
+	}
+	item.helper.encryption.applyToHeadObject(input)
+
+	callCtx, cancel := item.helper.callContext(ctx)
+	defer cancel()
+
+	if output, err = item.helper.client.HeadObject(callCtx, input); err == nil && partNumber == 0 {
+		item.size = output.ContentLength
+		item.lastModified = output.LastModified
+		item.etag = output.ETag
+		item.attributes = newS3ObjectAttributes(output)
+		if item.clientSide != nil {
+			item.clientSide.cipherSize = aws.ToInt64(output.ContentLength)
+			item.size = aws.Int64(item.clientSide.plaintextSize())
+		}
+		item.applyCompression()
+	}
+
+	return
+}
+
+func (item *S3Item) ReadAt(buffer []byte, offset int64) (size int, retErr error) {
+	return item.ReadAtWithContext(item.context(), buffer, offset)
+}
+
+// ReadAtWithContext reads len(buffer) bytes at offset with a ranged GET. It does not move the Read offset
+// and is safe for parallel calls. Once the item has an ETag, a changed object fails with ErrS3ObjectChanged.
+func (item *S3Item) ReadAtWithContext(ctx context.Context, buffer []byte, offset int64) (size int, retErr error) {
+	if offset < 0 {
+		return 0, fmt.Errorf("negative offset %d for item %s", offset, item.Path)
+	} else if len(buffer) == 0 {
+		return 0, nil
+	} else if err := item.resolveCompression(ctx); err != nil {
+		return 0, err
+	} else if item.clientSide != nil {
+		return item.readClientSideAt(ctx, buffer, offset)
+	} else if item.compression != "" {
+		return item.readDecompressedAt(ctx, buffer, offset)
+	}
+
+	input := &s3.GetObjectInput{
+		Bucket:    aws.String(item.helper.bucket),
+		Key:       aws.String(item.Path),
+		VersionId: item.versionID,
+		Range:     aws.String(fmt.Sprintf("bytes=%d-%d", offset, offset+int64(len(buffer))-1)),
+		IfMatch:   item.etag,
+	}
+	item.helper.encryption.applyToGetObject(input)
+
+	callCtx, cancel := item.helper.callContext(ctx)
+	defer cancel()
+
+	if output, err := item.helper.client.GetObject(callCtx, input); err == nil {
+		defer output.Body.Close()
+
+		size, retErr = io.ReadFull(output.Body, buffer)
+		if retErr == io.ErrUnexpectedEOF {
+			// the range was cut by the end of the object
+			retErr = io.EOF
+		}
+	} else if isS3InvalidRange(err) {
+		retErr = io.EOF
+	} else if isS3PreconditionFailed(err) {
+		retErr = fmt.Errorf("%s: %w: %w", item.Path, ErrS3ObjectChanged, err)
+	} else {
+		retErr = err
+	}
+
+	return
+}
+
+// Seek moves the offset of the next Read. The open body is dropped, and the next Read
+// issues a ranged GET from the new offset. io.SeekEnd loads the size with HeadObject when unknown.
+func (item *S3Item) Seek(offset int64, whence int) (ret int64, retErr error) {
+	switch whence {
+	case io.SeekStart:
+		ret = offset
+	case io.SeekCurrent:
+		ret = item.offset + offset
+	case io.SeekEnd:
+		if item.size == nil {
+			if _, err := item.head(item.context(), 0); err != nil {
+				return item.offset, err
+			} else if item.size == nil {
+				return item.offset, fmt.Errorf("size before compression is unknown for item %s", item.Path)
+			}
+		}
+		ret = aws.ToInt64(item.size) + offset
+	default:
+		return item.offset, fmt.Errorf("invalid whence %d", whence)
+	}
+
+	if ret < 0 {
+		return item.offset, fmt.Errorf("negative position %d for item %s", ret, item.Path)
+	}
+	if ret != item.offset {
+		if item.reader != nil {
+			item.reader.Close()
+			item.reader = nil
+		}
+		item.offset = ret
+	}
+
+	return
+}
+
+func (item *S3Item) DownloadTo(writer io.WriterAt, options *S3DownloadOptions) (err error) {
+	return item.DownloadToWithContext(item.context(), writer, options)
+}
+
+// DownloadToWithContext fetches the object into writer with concurrent ranged GETs pinned to the ETag
+// read first, so a change during the download fails with ErrS3ObjectChanged. Unless SkipVerify is set,
+// the MD5 ETag (including multipart ETags, fetched part by part) and full object checksums are verified,
+// and a mismatch fails with ErrS3ChecksumMismatch. Verifications needing the whole content read it back
+// from writer, so they are skipped when writer is not an io.ReaderAt.
+func (item *S3Item) DownloadToWithContext(ctx context.Context, writer io.WriterAt, options *S3DownloadOptions) (err error) {
+	if err = item.resolveCompression(ctx); err != nil {
+		return
+	} else if item.clientSide != nil {
+		return item.downloadClientSide(ctx, writer, options)
+	} else if item.compression != "" {
+		return item.downloadDecompressed(ctx, writer, options)
+	}
+
+	downloader := &s3Downloader{
+		item:   item,
+		writer: writer,
+	}
+	if options != nil {
+		downloader.options = *options
+	}
+	if downloader.options.PartSize <= 0 {
+		downloader.options.PartSize = s3DefaultPartSize
+	}
+	if downloader.options.Concurrency <= 0 {
+		downloader.options.Concurrency = s3DefaultDownloadConcurrency
+	}
+
+	return downloader.download(ctx)
+}
+
+// DownloadFileWithContext downloads key into filepath with DownloadTo. The file is removed on failure.
+func (s3Helper *S3Helper) DownloadFileWithContext(ctx context.Context, key string, filepath string, options *S3DownloadOptions) (err error) {
+	item := &S3Item{
+		Path:   key,
+		helper: s3Helper,
+		ctx:    ctx,
+	}
+
+	if file, createErr := os.Create(filepath); createErr == nil {
+		err = item.DownloadToWithContext(ctx, file, options)
+		if closeErr := file.Close(); err == nil {
+			err = closeErr
+		}
+		if err != nil {
+			os.Remove(filepath)
+		}
+	} else {
+		err = createErr
+	}
+
+	return
+}
+
+type s3DownloadRange struct {
+	index int
+	// partNumber fetches an uploaded part instead of the start-end range
+	partNumber int32
+	start      int64
+	end        int64
+}
+
+type s3Downloader struct {
+	item    *S3Item
+	writer  io.WriterAt
+	options S3DownloadOptions
+
+	head    *s3.HeadObjectOutput
+	size    int64
+	ranges  []*s3DownloadRange
+	digests [][]byte
+
+	progressMutex sync.Mutex
+	downloaded    int64
+}
+
+// parseS3ETag splits an MD5 based ETag into its hex digest and number of parts (0 for a single PUT).
+func parseS3ETag(etag string) (digest string, parts int, ok bool) {
+	digest = strings.Trim(etag, `"`)
+	if index := strings.Index(digest, "-"); index >= 0 {
+		if parts, _ = strconv.Atoi(digest[index+1:]); parts <= 0 {
+			return "", 0, false
+		}
+		digest = digest[:index]
+	}
+	if _, decodeErr := hex.DecodeString(digest); decodeErr != nil || len(digest) != md5.Size*2 {
+		return "", 0, false
+	}
+
+	return digest, parts, true
+}
+
+func (downloader *s3Downloader) verifiesETag() bool {
+	// ETags of SSE-KMS and SSE-C objects are not MD5 digests
+	return !downloader.options.SkipVerify &&
+		downloader.head.SSECustomerAlgorithm == nil &&
+		downloader.head.ServerSideEncryption != types.ServerSideEncryptionAwsKms &&
+		downloader.head.ServerSideEncryption != types.ServerSideEncryptionAwsKmsDsse
+}
+
+func (downloader *s3Downloader) reportProgress(size int64) {
+	downloader.progressMutex.Lock()
+	defer downloader.progressMutex.Unlock()
+
+	downloader.downloaded += size
+	if downloader.options.Progress != nil {
+		downloader.options.Progress(downloader.downloaded, downloader.size)
+	}
+}
+
+func (downloader *s3Downloader) download(ctx context.Context) (err error) {
+	if downloader.head, err = downloader.item.head(ctx, 0); err != nil {
+		return
+	}
+	downloader.size = aws.ToInt64(downloader.head.ContentLength)
+
+	_, parts, validETag := parseS3ETag(aws.ToString(downloader.head.ETag))
+	if parts > 0 && validETag && downloader.verifiesETag() {
+		// the digest of a multipart ETag is built from the digests of the uploaded parts
+		for partNumber := 1; partNumber <= parts; partNumber++ {
+			downloader.ranges = append(downloader.ranges, &s3DownloadRange{index: partNumber - 1, partNumber: int32(partNumber)})
+		}
+	} else {
+		for start := int64(0); start < downloader.size; start += downloader.options.PartSize {
+			downloader.ranges = append(downloader.ranges, &s3DownloadRange{
+				index: len(downloader.ranges),
+				start: start,
+				end:   min(start+downloader.options.PartSize, downloader.size) - 1,
+			})
+		}
+	}
+	downloader.digests = make([][]byte, len(downloader.ranges))
+
+	if err = downloader.fetchRanges(ctx); err == nil && !downloader.options.SkipVerify {
+		err = downloader.verify()
+	}
+
+	return
+}
+
+func (downloader *s3Downloader) fetchRanges(ctx context.Context) (err error) {
+	rangeCtx, cancel := context.WithCancel(ctx)
+	defer cancel()
+
+	semaphore := make(chan struct{}, downloader.options.Concurrency)
+	waitGroup := sync.WaitGroup{}
+	errMutex := sync.Mutex{}
+	setErr := func(rangeErr error) {
+		errMutex.Lock()
+		if err == nil {
+			err = rangeErr
+			cancel()
+		}
+		errMutex.Unlock()
+	}
+
+	for _, downloadRange := range downloader.ranges {
+		semaphore <- struct{}{}
+		if rangeCtx.Err() != nil {
+			<-semaphore
+			break
+		}
+
+		waitGroup.Add(1)
+		go func(downloadRange *s3DownloadRange) {
+			defer waitGroup.Done()
+			defer func() { <-semaphore }()
+
+			if rangeErr := downloader.fetchRange(rangeCtx, downloadRange); rangeErr != nil {
+				setErr(rangeErr)
+			}
+		}(downloadRange)
+	}
+	waitGroup.Wait()
+
+	return
+}
+
+func (downloader *s3Downloader) fetchRange(ctx context.Context, downloadRange *s3DownloadRange) (err error) {
+	input := &s3.GetObjectInput{
+		Bucket:    aws.String(downloader.item.helper.bucket),
+		Key:       aws.String(downloader.item.Path),
+		VersionId: downloader.item.versionID,
+		IfMatch:   downloader.head.ETag,
+	}
+	name := ""
+	if downloadRange.partNumber > 0 {
+		input.PartNumber = aws.Int32(downloadRange.partNumber)
+		name = fmt.Sprintf("part %d", downloadRange.partNumber)
+	} else {
+		input.Range = aws.String(fmt.Sprintf("bytes=%d-%d", downloadRange.start, downloadRange.end))
+		name = fmt.Sprintf("range %d-%d", downloadRange.start, downloadRange.end)
+	}
+	downloader.item.helper.encryption.applyToGetObject(input)
+
+	callCtx, cancel := downloader.item.helper.callContext(ctx)
+	defer cancel()
+
+	output, getErr := downloader.item.helper.client.GetObject(callCtx, input)
+	if getErr != nil {
+		if isS3PreconditionFailed(getErr) {
+			return fmt.Errorf("%s: %s: %w: %w", downloader.item.Path, name, ErrS3ObjectChanged, getErr)
+		}
+		return fmt.Errorf("%s: %s: %w", downloader.item.Path, name, getErr)
+	}
+	defer output.Body.Close()
+
+	start, expected := downloadRange.start, downloadRange.end-downloadRange.start+1
+	if downloadRange.partNumber > 0 {
+		// the offset of a part is only known from the response
+		if start, expected, err = parseS3ContentRange(aws.ToString(output.ContentRange), aws.ToInt64(output.ContentLength)); err != nil {
+			return fmt.Errorf("%s: %s: %w", downloader.item.Path, name, err)
+		}
+	}
+
+	digest := md5.New()
+	if copied, copyErr := io.Copy(io.MultiWriter(io.NewOffsetWriter(downloader.writer, start), digest), output.Body); copyErr != nil {
+		err = fmt.Errorf("%s: %s: %w", downloader.item.Path, name, copyErr)
+	} else if copied != expected {
+		err = fmt.Errorf("%s: %s: %w: %d of %d bytes", downloader.item.Path, name, io.ErrUnexpectedEOF, copied, expected)
+	} else {
+		downloader.digests[downloadRange.index] = digest.Sum(nil)
+		downloader.reportProgress(copied)
+	}
+
+	return
+}
+
+// parseS3ContentRange returns the start and length of "bytes start-end/total". An empty value means the whole body.
+func parseS3ContentRange(contentRange string, contentLength int64) (start int64, length int64, err error) {
+	if contentRange == "" {
+		return 0, contentLength, nil
+	}
+
+	end := int64(0)
+	if _, err = fmt.Sscanf(contentRange, "bytes %d-%d/", &start, &end); err == nil {
+		length = end - start + 1
+	} else {
+		err = fmt.Errorf("invalid Content-Range %q: %w", contentRange, err)
+	}
+
+	return
+}
+
+type s3ChecksumVerification struct {
+	algorithm string
+	expected  string
+	hash      hash.Hash
+}
+
+// fullObjectChecksums returns the checksums of the whole object. Composite checksums of multipart uploads ("...-N") are skipped.
+func (downloader *s3Downloader) fullObjectChecksums() (ret []*s3ChecksumVerification) {
+	head := downloader.head
+	if head.ChecksumType == types.ChecksumTypeComposite {
+		return
+	}
+
+	for _, checksum := range []*s3ChecksumVerification{
+		{algorithm: "CRC32", expected: aws.ToString(head.ChecksumCRC32), hash: crc32.NewIEEE()},
+		{algorithm: "CRC32C", expected: aws.ToString(head.ChecksumCRC32C), hash: crc32.New(crc32.MakeTable(crc32.Castagnoli))},
+		{algorithm: "CRC64NVME", expected: aws.ToString(head.ChecksumCRC64NVME), hash: crc64.New(crc64.MakeTable(crc64NVMEPolynomial))},
+		{algorithm: "SHA1", expected: aws.ToString(head.ChecksumSHA1), hash: sha1.New()},
+		{algorithm: "SHA256", expected: aws.ToString(head.ChecksumSHA256), hash: sha256.New()},
+	} {
+		if checksum.expected != "" && !strings.Contains(checksum.expected, "-") {
+			ret = append(ret, checksum)
+		}
+	}
+
+	return
+}
+
+func (downloader *s3Downloader) verify() (err error) {
+	etag := aws.ToString(downloader.head.ETag)
+	expectedDigest, parts, validETag := parseS3ETag(etag)
+	verifiesETag := validETag && downloader.verifiesETag()
+	checksums := downloader.fullObjectChecksums()
+
+	actualDigest := ""
+	readBack := []io.Writer{}
+	var wholeDigest hash.Hash
+	if verifiesETag {
+		if parts > 0 {
+			partDigests := md5.New()
+			for _, digest := range downloader.digests {
+				partDigests.Write(digest)
+			}
+			actualDigest = hex.EncodeToString(partDigests.Sum(nil))
+		} else if len(downloader.digests) == 1 {
+			actualDigest = hex.EncodeToString(downloader.digests[0])
+		} else {
+			wholeDigest = md5.New()
+			readBack = append(readBack, wholeDigest)
+		}
+	}
+	for _, checksum := range checksums {
+		readBack = append(readBack, checksum.hash)
+	}
+
+	if len(readBack) > 0 {
+		readerAt, ok := downloader.writer.(io.ReaderAt)
+		if !ok {
+			// the content cannot be read again, only the If-Match pinned ranges protect it
+			if wholeDigest != nil {
+				verifiesETag = false
+			}
+			checksums = nil
+		} else if _, readErr := io.Copy(io.MultiWriter(readBack...), io.NewSectionReader(readerAt, 0, downloader.size)); readErr != nil {
+			return fmt.Errorf("%s: read back for verification: %w", downloader.item.Path, readErr)
+		} else if wholeDigest != nil {
+			actualDigest = hex.EncodeToString(wholeDigest.Sum(nil))
+		}
+	}
+
+	if verifiesETag && actualDigest != expectedDigest {
+		return fmt.Errorf("%s: %w: ETag %s, downloaded MD5 %s", downloader.item.Path, ErrS3ChecksumMismatch, etag, actualDigest)
+	}
+	for _, checksum := range checksums {
+		if actual := base64.StdEncoding.EncodeToString(checksum.hash.Sum(nil)); actual != checksum.expected {
+			return fmt.Errorf("%s: %w: %s %s, downloaded %s", downloader.item.Path, ErrS3ChecksumMismatch, checksum.algorithm, checksum.expected, actual)
+		}
+	}
+
+	return
+}
@@ -0,0 +1,188 @@
+package awssdkhelper
+
+import (
+	"archive/zip"
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"encoding/base64"
+	"errors"
+	"io"
+	"os"
+	"path/filepath"
+	"sync"
+	"testing"
+
+	TestUtility "github.com/thcomp/GoLang_TestUtility"
+)
+
+// bytesWriterAt is an in-memory io.WriterAt and io.ReaderAt.
+type bytesWriterAt struct {
+	mutex sync.Mutex
+	data  []byte
+}
+
+func (writer *bytesWriterAt) WriteAt(buffer []byte, offset int64) (int, error) {
+	writer.mutex.Lock()
+	defer writer.mutex.Unlock()
+
+	if end := offset + int64(len(buffer)); end > int64(len(writer.data)) {
+		writer.data = append(writer.data, make([]byte, end-int64(len(writer.data)))...)
+	}
+
+	return copy(writer.data[offset:], buffer), nil
+}
+
+func (writer *bytesWriterAt) ReadAt(buffer []byte, offset int64) (int, error) {
+	writer.mutex.Lock()
+	defer writer.mutex.Unlock()
+
+	return bytes.NewReader(writer.data).ReadAt(buffer, offset)
+}
+
+// writeOnlyWriterAt hides ReadAt so that DownloadTo cannot read back.
+type writeOnlyWriterAt struct {
+	writer *bytesWriterAt
+}
+
+func (writer writeOnlyWriterAt) WriteAt(buffer []byte, offset int64) (int, error) {
+	return writer.writer.WriteAt(buffer, offset)
+}
+
+func Test_S3Item_ReadAtAndSeek(t *testing.T) {
+	tester := TestUtility.NewTestHelper(t)
+	fake := newFakeS3Server(t, "download-bucket")
+	helper := fake.helper()
+
+	data := testMultipartData(100)
+	fake.putObject("data.bin", data)
+
+	item, err := helper.GetItem("data.bin")
+	tester.Fatalf(err == nil, "GetItem: %v", err)
+	defer item.Close()
+
+	buffer := make([]byte, 10)
+	size, err := item.ReadAt(buffer, 20)
+	tester.Errorf(size == 10 && err == nil && bytes.Equal(buffer, data[20:30]), "ReadAt(20): %d, %v", size, err)
+	size, err = item.ReadAt(buffer, 95)
+	tester.Errorf(size == 5 && err == io.EOF && bytes.Equal(buffer[:5], data[95:]), "ReadAt(95): %d, %v", size, err)
+	size, err = item.ReadAt(buffer, 200)
+	tester.Errorf(size == 0 && err == io.EOF, "ReadAt(200): %d, %v", size, err)
+
+	position, err := item.Seek(50, io.SeekStart)
+	tester.Errorf(position == 50 && err == nil, "Seek(50): %d, %v", position, err)
+	size, err = io.ReadFull(item, buffer)
+	tester.Errorf(size == 10 && bytes.Equal(buffer, data[50:60]), "Read after Seek: %d, %v", size, err)
+
+	position, err = item.Seek(-10, io.SeekEnd)
+	tester.Errorf(position == 90 && err == nil, "Seek(-10, end): %d, %v", position, err)
+	rest, err := io.ReadAll(item)
+	tester.Errorf(err == nil && bytes.Equal(rest, data[90:]), "ReadAll after Seek: %d, %v", len(rest), err)
+	position, _ = item.Seek(0, io.SeekCurrent)
+	tester.Errorf(position == 100, "position after ReadAll: %d", position)
+
+	item.Seek(500, io.SeekStart)
+	size, err = item.Read(buffer)
+	tester.Errorf(size == 0 && err == io.EOF, "Read past the end: %d, %v", size, err)
+	_, err = item.Seek(-1, io.SeekStart)
+	tester.Errorf(err != nil, "negative Seek is accepted")
+
+	fake.putObject("data.bin", testMultipartData(101))
+	_, err = item.ReadAt(buffer, 0)
+	tester.Errorf(errors.Is(err, ErrS3ObjectChanged), "ReadAt after change: %v", err)
+}
+
+func Test_S3Item_ReadAtZip(t *testing.T) {
+	tester := TestUtility.NewTestHelper(t)
+	fake := newFakeS3Server(t, "download-bucket")
+	helper := fake.helper()
+
+	archive := bytes.Buffer{}
+	zipWriter := zip.NewWriter(&archive)
+	for _, name := range []string{"a.txt", "b.txt"} {
+		fileWriter, _ := zipWriter.Create(name)
+		fileWriter.Write([]byte("content of " + name))
+	}
+	zipWriter.Close()
+	fake.putObject("archive.zip", archive.Bytes())
+
+	item, err := helper.GetItem("archive.zip")
+	tester.Fatalf(err == nil, "GetItem: %v", err)
+	defer item.Close()
+	size, _ := item.Size()
+
+	zipReader, err := zip.NewReader(item, size)
+	tester.Fatalf(err == nil && len(zipReader.File) == 2, "zip.NewReader: %v", err)
+	fileReader, err := zipReader.Open("b.txt")
+	tester.Fatalf(err == nil, "Open b.txt: %v", err)
+	content, _ := io.ReadAll(fileReader)
+	tester.Errorf(string(content) == "content of b.txt", "b.txt: %s", content)
+}
+
+func Test_S3Item_DownloadTo(t *testing.T) {
+	tester := TestUtility.NewTestHelper(t)
+	fake := newFakeS3Server(t, "download-bucket")
+	helper := fake.helper()
+
+	data := testMultipartData(2500)
+	fake.putObject("data.bin", data)
+
+	downloaded := int64(0)
+	writer := &bytesWriterAt{}
+	item := &S3Item{Path: "data.bin", helper: helper}
+	err := item.DownloadTo(writer, &S3DownloadOptions{
+		PartSize: 1000,
+		Progress: func(downloadedBytes, totalBytes int64) {
+			downloaded = downloadedBytes
+			tester.Errorf(totalBytes == 2500, "total: %d", totalBytes)
+		},
+	})
+	tester.Errorf(err == nil && bytes.Equal(writer.data, data), "DownloadTo: %v", err)
+	tester.Errorf(downloaded == 2500, "progress: %d", downloaded)
+
+	sum := sha256.Sum256(data)
+	fake.setChecksum("data.bin", "SHA256", base64.StdEncoding.EncodeToString(sum[:]))
+	err = item.DownloadTo(&bytesWriterAt{}, &S3DownloadOptions{PartSize: 1000})
+	tester.Errorf(err == nil, "DownloadTo with SHA256: %v", err)
+
+	fake.setChecksum("data.bin", "SHA256", base64.StdEncoding.EncodeToString(make([]byte, sha256.Size)))
+	err = item.DownloadTo(&bytesWriterAt{}, &S3DownloadOptions{PartSize: 1000})
+	tester.Errorf(errors.Is(err, ErrS3ChecksumMismatch), "DownloadTo with a wrong SHA256: %v", err)
+	err = item.DownloadTo(&bytesWriterAt{}, &S3DownloadOptions{PartSize: 1000, SkipVerify: true})
+	tester.Errorf(err == nil, "DownloadTo with SkipVerify: %v", err)
+
+	// a wrong MD5 ETag is caught by reading back, or by the single range digest
+	fake.putObject("data.bin", data)
+	fake.object("data.bin").etag = `"00000000000000000000000000000000"`
+	err = item.DownloadTo(&bytesWriterAt{}, &S3DownloadOptions{PartSize: 1000})
+	tester.Errorf(errors.Is(err, ErrS3ChecksumMismatch), "DownloadTo with a wrong ETag: %v", err)
+	err = item.DownloadTo(writeOnlyWriterAt{&bytesWriterAt{}}, nil)
+	tester.Errorf(errors.Is(err, ErrS3ChecksumMismatch), "DownloadTo single range with a wrong ETag: %v", err)
+	err = item.DownloadTo(writeOnlyWriterAt{&bytesWriterAt{}}, &S3DownloadOptions{PartSize: 1000})
+	tester.Errorf(err == nil, "DownloadTo without read back: %v", err)
+
+	_, err = (&S3Item{Path: "missing.bin", helper: helper}).head(context.Background(), 0)
+	tester.Errorf(err != nil, "head of a missing object succeeds")
+}
+
+func Test_S3Helper_DownloadFileMultipart(t *testing.T) {
+	tester := TestUtility.NewTestHelper(t)
+	fake := newFakeS3Server(t, "download-bucket")
+	helper := fake.helper()
+
+	data := testMultipartData(int(2*S3MinPartSize + 100))
+	err := helper.UploadWithContext(context.Background(), "large.bin", bytes.NewReader(data), &S3UploadOptions{PartSize: S3MinPartSize})
+	tester.Fatalf(err == nil, "UploadWithContext: %v", err)
+
+	filePath := filepath.Join(t.TempDir(), "large.bin")
+	err = helper.DownloadFileWithContext(context.Background(), "large.bin", filePath, &S3DownloadOptions{Concurrency: 2})
+	tester.Fatalf(err == nil, "DownloadFileWithContext: %v", err)
+	downloaded, _ := os.ReadFile(filePath)
+	tester.Errorf(bytes.Equal(downloaded, data), "downloaded %d bytes", len(downloaded))
+
+	fake.object("large.bin").data[10] ^= 0xff
+	err = helper.DownloadFileWithContext(context.Background(), "large.bin", filePath, nil)
+	tester.Errorf(errors.Is(err, ErrS3ChecksumMismatch), "DownloadFileWithContext of a corrupted object: %v", err)
+	_, statErr := os.Stat(filePath)
+	tester.Errorf(os.IsNotExist(statErr), "file is kept after failure: %v", statErr)
+}
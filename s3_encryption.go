@@ -0,0 +1,153 @@
+package awssdkhelper
+
+import (
+	"crypto/md5"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/s3"
+	"github.com/aws/aws-sdk-go-v2/service/s3/types"
+)
+
+type S3EncryptionMode string
+
+const (
+	// S3EncryptionSSES3 encrypts with keys managed by S3 (AES256).
+	S3EncryptionSSES3 S3EncryptionMode = "SSE-S3"
+	// S3EncryptionSSEKMS encrypts with a KMS key.
+	S3EncryptionSSEKMS S3EncryptionMode = "SSE-KMS"
+	// S3EncryptionSSEC encrypts with a key supplied on every request. S3 does not keep the key.
+	S3EncryptionSSEC S3EncryptionMode = "SSE-C"
+)
+
+type S3Encryption struct {
+	Mode S3EncryptionMode
+	// KMSKeyID is the key ID, ARN or alias of SSE-KMS. Empty uses the AWS managed key aws/s3.
+	KMSKeyID string
+	// KMSEncryptionContext is additional authenticated data of SSE-KMS, also required by KMS key policies using it.
+	KMSEncryptionContext map[string]string
+	// BucketKeyEnabled reduces the KMS requests of SSE-KMS with an S3 Bucket Key.
+	BucketKeyEnabled bool
+	// CustomerKey is the 256-bit key of SSE-C. Reading the object needs the same key.
+	CustomerKey []byte
+}
+
+// SetEncryption sets the encryption of every object the helper writes, and the SSE-C key used to read objects.
+// nil falls back to the default encryption of the bucket.
+func (s3Helper *S3Helper) SetEncryption(encryption *S3Encryption) (err error) {
+	if err = encryption.validate(); err == nil {
+		s3Helper.encryption = encryption
+	}
+
+	return
+}
+
+// WithEncryption returns a copy of the helper using encryption instead of the default set by SetEncryption,
+// e.g. to read one object encrypted with another SSE-C key.
+func (s3Helper *S3Helper) WithEncryption(encryption *S3Encryption) (ret *S3Helper, err error) {
+	if err = encryption.validate(); err == nil {
+		copied := *s3Helper
+		copied.encryption = encryption
+		ret = &copied
+	}
+
+	return
+}
+
+func (encryption *S3Encryption) validate() error {
+	if encryption == nil {
+		return nil
+	}
+
+	switch encryption.Mode {
+	case S3EncryptionSSES3, S3EncryptionSSEKMS:
+	case S3EncryptionSSEC:
+		if len(encryption.CustomerKey) != 32 {
+			return fmt.Errorf("SSE-C customer key must be 32 bytes, not %d", len(encryption.CustomerKey))
+		}
+	default:
+		return fmt.Errorf("unknown encryption mode %q", encryption.Mode)
+	}
+
+	return nil
+}
+
+// encryptionFor returns the per-call encryption if any, otherwise the default of the helper.
+func (s3Helper *S3Helper) encryptionFor(override *S3Encryption) *S3Encryption {
+	if override != nil {
+		return override
+	}
+
+	return s3Helper.encryption
+}
+
+// customerKey returns the SSE-C algorithm, key and key MD5 headers, all nil unless the mode is SSE-C.
+func (encryption *S3Encryption) customerKey() (algorithm, key, keyMD5 *string) {
+	if encryption == nil || encryption.Mode != S3EncryptionSSEC {
+		return nil, nil, nil
+	}
+
+	sum := md5.Sum(encryption.CustomerKey)
+
+	return aws.String("AES256"), aws.String(base64.StdEncoding.EncodeToString(encryption.CustomerKey)), aws.String(base64.StdEncoding.EncodeToString(sum[:]))
+}
+
+// serverSide returns the x-amz-server-side-encryption headers of SSE-S3 and SSE-KMS.
+func (encryption *S3Encryption) serverSide() (algorithm types.ServerSideEncryption, kmsKeyID, kmsContext *string, bucketKey *bool) {
+	if encryption == nil {
+		return
+	}
+
+	switch encryption.Mode {
+	case S3EncryptionSSES3:
+		algorithm = types.ServerSideEncryptionAes256
+	case S3EncryptionSSEKMS:
+		algorithm = types.ServerSideEncryptionAwsKms
+		if encryption.KMSKeyID != "" {
+			kmsKeyID = aws.String(encryption.KMSKeyID)
+		}
+		if len(encryption.KMSEncryptionContext) > 0 {
+			if data, err := json.Marshal(encryption.KMSEncryptionContext); err == nil {
+				kmsContext = aws.String(base64.StdEncoding.EncodeToString(data))
+			}
+		}
+		if encryption.BucketKeyEnabled {
+			bucketKey = aws.Bool(true)
+		}
+	}
+
+	return
+}
+
+func (encryption *S3Encryption) applyToPutObject(input *s3.PutObjectInput) {
+	input.ServerSideEncryption, input.SSEKMSKeyId, input.SSEKMSEncryptionContext, input.BucketKeyEnabled = encryption.serverSide()
+	input.SSECustomerAlgorithm, input.SSECustomerKey, input.SSECustomerKeyMD5 = encryption.customerKey()
+}
+
+func (encryption *S3Encryption) applyToCreateMultipartUpload(input *s3.CreateMultipartUploadInput) {
+	input.ServerSideEncryption, input.SSEKMSKeyId, input.SSEKMSEncryptionContext, input.BucketKeyEnabled = encryption.serverSide()
+	input.SSECustomerAlgorithm, input.SSECustomerKey, input.SSECustomerKeyMD5 = encryption.customerKey()
+}
+
+func (encryption *S3Encryption) applyToCopyObject(input *s3.CopyObjectInput) {
+	input.ServerSideEncryption, input.SSEKMSKeyId, input.SSEKMSEncryptionContext, input.BucketKeyEnabled = encryption.serverSide()
+	input.SSECustomerAlgorithm, input.SSECustomerKey, input.SSECustomerKeyMD5 = encryption.customerKey()
+}
+
+func (encryption *S3Encryption) applyToGetObject(input *s3.GetObjectInput) {
+	input.SSECustomerAlgorithm, input.SSECustomerKey, input.SSECustomerKeyMD5 = encryption.customerKey()
+}
+
+func (encryption *S3Encryption) applyToHeadObject(input *s3.HeadObjectInput) {
+	input.SSECustomerAlgorithm, input.SSECustomerKey, input.SSECustomerKeyMD5 = encryption.customerKey()
+}
+
+func (encryption *S3Encryption) applyToUploadPart(input *s3.UploadPartInput) {
+	input.SSECustomerAlgorithm, input.SSECustomerKey, input.SSECustomerKeyMD5 = encryption.customerKey()
+}
+
+func (encryption *S3Encryption) applyToCompleteMultipartUpload(input *s3.CompleteMultipartUploadInput) {
+	input.SSECustomerAlgorithm, input.SSECustomerKey, input.SSECustomerKeyMD5 = encryption.customerKey()
+}
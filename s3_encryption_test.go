@@ -0,0 +1,98 @@
+package awssdkhelper
+
+import (
+	"bytes"
+	"context"
+	"crypto/md5"
+	"encoding/base64"
+	"encoding/json"
+	"io"
+	"testing"
+
+	TestUtility "github.com/thcomp/GoLang_TestUtility"
+)
+
+func Test_S3Helper_EncryptionKMS(t *testing.T) {
+	tester := TestUtility.NewTestHelper(t)
+	fake := newFakeS3Server(t, "encryption-bucket")
+	helper := fake.helper()
+	ctx := context.Background()
+
+	err := helper.SetEncryption(&S3Encryption{
+		Mode:                 S3EncryptionSSEKMS,
+		KMSKeyID:             "alias/compliance",
+		KMSEncryptionContext: map[string]string{"tenant": "a"},
+		BucketKeyEnabled:     true,
+	})
+	tester.Fatalf(err == nil, "SetEncryption: %v", err)
+
+	tester.Fatalf(helper.PutData("kms.txt", []byte("kms")) == nil, "PutData failed")
+	headers := fake.object("kms.txt").headers
+	encryptionContext := map[string]string{}
+	decoded, _ := base64.StdEncoding.DecodeString(headers.Get("X-Amz-Server-Side-Encryption-Context"))
+	json.Unmarshal(decoded, &encryptionContext)
+	tester.Errorf(headers.Get("X-Amz-Server-Side-Encryption") == "aws:kms" && headers.Get("X-Amz-Server-Side-Encryption-Aws-Kms-Key-Id") == "alias/compliance", "headers: %v", headers)
+	tester.Errorf(encryptionContext["tenant"] == "a" && headers.Get("X-Amz-Server-Side-Encryption-Bucket-Key-Enabled") == "true", "headers: %v", headers)
+
+	item, err := helper.HeadItemWithContext(ctx, "kms.txt")
+	tester.Fatalf(err == nil, "HeadItem: %v", err)
+	tester.Errorf(item.attributes.ServerSideEncryption == "aws:kms" && item.attributes.SSEKMSKeyId == "alias/compliance", "attributes: %+v", item.attributes)
+
+	err = helper.PutDataWithOptions(ctx, "sse-s3.txt", []byte("s3"), &S3PutOptions{Encryption: &S3Encryption{Mode: S3EncryptionSSES3}})
+	tester.Errorf(err == nil && fake.object("sse-s3.txt").headers.Get("X-Amz-Server-Side-Encryption") == "AES256", "per-call override: %v", err)
+
+	// a copy keeps the KMS key of the source
+	plain, _ := helper.WithEncryption(nil)
+	tester.Fatalf(plain.CopyItem("kms.txt", "kms-copy.txt", nil) == nil, "CopyItem failed")
+	tester.Errorf(fake.object("kms-copy.txt").headers.Get("X-Amz-Server-Side-Encryption-Aws-Kms-Key-Id") == "alias/compliance", "copy headers: %v", fake.object("kms-copy.txt").headers)
+
+	tester.Errorf(helper.SetEncryption(&S3Encryption{Mode: S3EncryptionSSEC, CustomerKey: make([]byte, 16)}) != nil, "a 128-bit SSE-C key is accepted")
+	tester.Errorf(helper.SetEncryption(&S3Encryption{Mode: "AES"}) != nil, "an unknown mode is accepted")
+}
+
+func Test_S3Helper_EncryptionCustomerKey(t *testing.T) {
+	tester := TestUtility.NewTestHelper(t)
+	fake := newFakeS3Server(t, "encryption-bucket")
+	helper := fake.helper()
+	helper.SetMultipartThreshold(S3MinPartSize)
+	ctx := context.Background()
+
+	customerKey := bytes.Repeat([]byte{7}, 32)
+	keyMD5 := md5.Sum(customerKey)
+	tester.Fatalf(helper.SetEncryption(&S3Encryption{Mode: S3EncryptionSSEC, CustomerKey: customerKey}) == nil, "SetEncryption failed")
+
+	data := testMultipartData(int(s3DefaultPartSize + 1))
+	tester.Fatalf(helper.PutData("ssec.bin", data) == nil, "multipart PutData failed")
+	tester.Fatalf(helper.PutData("small.txt", []byte("small")) == nil, "PutData failed")
+	object := fake.object("ssec.bin")
+	tester.Errorf(len(object.partSizes) == 2 && object.headers.Get("X-Amz-Server-Side-Encryption-Customer-Key-Md5") == base64.StdEncoding.EncodeToString(keyMD5[:]), "object headers: %v", object.headers)
+
+	item, err := helper.GetItemWithContext(ctx, "small.txt")
+	tester.Fatalf(err == nil, "GetItem: %v", err)
+	read, _ := io.ReadAll(item)
+	item.Close()
+	tester.Errorf(string(read) == "small", "read: %s", read)
+
+	item, err = helper.HeadItemWithContext(ctx, "ssec.bin")
+	tester.Fatalf(err == nil, "HeadItem: %v", err)
+	tester.Errorf(item.attributes.SSECustomerAlgorithm == "AES256", "attributes: %+v", item.attributes)
+	writer := &bytesWriterAt{}
+	err = item.DownloadToWithContext(ctx, writer, &S3DownloadOptions{PartSize: S3MinPartSize})
+	tester.Errorf(err == nil && bytes.Equal(writer.data, data), "DownloadTo: %v", err)
+
+	plain, _ := helper.WithEncryption(nil)
+	_, err = plain.HeadItemWithContext(ctx, "ssec.bin")
+	tester.Errorf(err != nil, "HeadItem without the customer key succeeded")
+
+	// re-encrypt the SSE-C object with SSE-S3
+	err = helper.CopyItemWithContext(ctx, "ssec.bin", "plain.bin", &S3CopyOptions{
+		Encryption:         &S3Encryption{Mode: S3EncryptionSSES3},
+		MultipartThreshold: S3MinPartSize,
+		PartSize:           S3MinPartSize,
+	})
+	tester.Fatalf(err == nil, "CopyItem: %v", err)
+	copied := fake.object("plain.bin")
+	tester.Errorf(bytes.Equal(copied.data, data) && copied.headers.Get("X-Amz-Server-Side-Encryption") == "AES256" && copied.headers.Get("X-Amz-Server-Side-Encryption-Customer-Key-Md5") == "", "copy headers: %v", copied.headers)
+	_, err = plain.HeadItemWithContext(ctx, "plain.bin")
+	tester.Errorf(err == nil, "HeadItem of the SSE-S3 copy: %v", err)
+}
@@ -0,0 +1,97 @@
+package awssdkhelper
+
+import (
+	"strings"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/s3"
+)
+
+// S3HelperOption configures the S3 client of NewS3Helper, e.g. to target S3-compatible stores
+// such as MinIO or LocalStack.
+type S3HelperOption func(*s3HelperConfig)
+
+type s3HelperConfig struct {
+	endpoint         string
+	pathStyle        bool
+	disableChecksums bool
+	disableTLS       bool
+	httpClient       aws.HTTPClient
+}
+
+// WithS3Endpoint sends every request to endpoint (e.g. "http://localhost:9000") instead of the AWS endpoint of the region.
+// An endpoint without scheme uses https, or http with WithS3DisableTLS.
+func WithS3Endpoint(endpoint string) S3HelperOption {
+	return func(config *s3HelperConfig) {
+		config.endpoint = endpoint
+	}
+}
+
+// WithS3PathStyle addresses buckets in the path (endpoint/bucket/key) instead of the host name
+// (bucket.endpoint/key), as most S3-compatible stores require.
+func WithS3PathStyle() S3HelperOption {
+	return func(config *s3HelperConfig) {
+		config.pathStyle = true
+	}
+}
+
+// WithS3DisableChecksums only calculates and validates checksums when S3 requires them, for stores
+// which do not support the default CRC checksums (and their aws-chunked uploads).
+func WithS3DisableChecksums() S3HelperOption {
+	return func(config *s3HelperConfig) {
+		config.disableChecksums = true
+	}
+}
+
+// WithS3DisableTLS uses http for the endpoint without scheme, and for the AWS endpoints.
+func WithS3DisableTLS() S3HelperOption {
+	return func(config *s3HelperConfig) {
+		config.disableTLS = true
+	}
+}
+
+// WithS3HTTPClient sends the requests with client, e.g. one trusting the certificate of a local stand-in.
+func WithS3HTTPClient(client aws.HTTPClient) S3HelperOption {
+	return func(config *s3HelperConfig) {
+		config.httpClient = client
+	}
+}
+
+func newS3HelperConfig(options []S3HelperOption) *s3HelperConfig {
+	config := &s3HelperConfig{}
+	for _, option := range options {
+		if option != nil {
+			option(config)
+		}
+	}
+
+	return config
+}
+
+// apply sets the configuration on the options of the S3 client.
+func (config *s3HelperConfig) apply(options *s3.Options) {
+	if config.endpoint != "" {
+		endpoint := config.endpoint
+		if !strings.Contains(endpoint, "://") {
+			if config.disableTLS {
+				endpoint = "http://" + endpoint
+			} else {
+				endpoint = "https://" + endpoint
+			}
+		}
+		options.BaseEndpoint = aws.String(strings.TrimSuffix(endpoint, "/"))
+	}
+	if config.pathStyle {
+		options.UsePathStyle = true
+	}
+	if config.disableChecksums {
+		options.RequestChecksumCalculation = aws.RequestChecksumCalculationWhenRequired
+		options.ResponseChecksumValidation = aws.ResponseChecksumValidationWhenRequired
+	}
+	if config.disableTLS {
+		options.EndpointOptions.DisableHTTPS = true
+	}
+	if config.httpClient != nil {
+		options.HTTPClient = config.httpClient
+	}
+}
@@ -0,0 +1,151 @@
+package awssdkhelper
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"os"
+	"strings"
+	"testing"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/s3"
+	"github.com/rs/xid"
+	TestUtility "github.com/thcomp/GoLang_TestUtility"
+)
+
+func Test_S3HelperOption_Apply(t *testing.T) {
+	tester := TestUtility.NewTestHelper(t)
+
+	options := s3.Options{}
+	newS3HelperConfig([]S3HelperOption{WithS3Endpoint("minio.local:9000/"), WithS3PathStyle()}).apply(&options)
+	tester.Errorf(aws.ToString(options.BaseEndpoint) == "https://minio.local:9000" && options.UsePathStyle, "endpoint: %s", aws.ToString(options.BaseEndpoint))
+
+	options = s3.Options{}
+	newS3HelperConfig([]S3HelperOption{WithS3Endpoint("minio.local:9000"), WithS3DisableTLS(), WithS3DisableChecksums()}).apply(&options)
+	tester.Errorf(aws.ToString(options.BaseEndpoint) == "http://minio.local:9000" && options.EndpointOptions.DisableHTTPS, "endpoint without TLS: %s", aws.ToString(options.BaseEndpoint))
+	tester.Errorf(options.RequestChecksumCalculation == aws.RequestChecksumCalculationWhenRequired && options.ResponseChecksumValidation == aws.ResponseChecksumValidationWhenRequired, "checksums are enabled")
+
+	options = s3.Options{}
+	newS3HelperConfig(nil).apply(&options)
+	tester.Errorf(options.BaseEndpoint == nil && !options.UsePathStyle && options.HTTPClient == nil, "default options changed: %+v", options)
+}
+
+// Test_S3Helper_Integration runs the integration suite against the fake S3 server, over TLS and plain http,
+// with helpers built by NewS3Helper. Set S3_TEST_ENDPOINT, S3_TEST_BUCKET, S3_TEST_ACCESS_KEY_ID and
+// S3_TEST_SECRET_ACCESS_KEY to also run it against an S3-compatible store such as MinIO or LocalStack.
+func Test_S3Helper_Integration(t *testing.T) {
+	t.Run("fake over TLS", func(t *testing.T) {
+		fake := newFakeS3Server(t, "integration-bucket")
+		helper := NewS3Helper("AKIDEXAMPLE", "SECRET", "us-east-1", fake.bucket, nil,
+			WithS3Endpoint(fake.server.URL),
+			WithS3PathStyle(),
+			WithS3DisableChecksums(),
+			WithS3HTTPClient(fake.server.Client()),
+		)
+		runS3IntegrationSuite(t, helper, fake.server.Client())
+	})
+
+	t.Run("fake over http", func(t *testing.T) {
+		fake := newFakeS3Server(t, "integration-bucket")
+		fake.server.Close()
+		fake.server = httptest.NewServer(fake)
+		t.Cleanup(fake.server.Close)
+
+		serverURL, _ := url.Parse(fake.server.URL)
+		helper := NewS3Helper("AKIDEXAMPLE", "SECRET", "us-east-1", fake.bucket, nil,
+			WithS3Endpoint(serverURL.Host),
+			WithS3DisableTLS(),
+			WithS3PathStyle(),
+			WithS3DisableChecksums(),
+		)
+		runS3IntegrationSuite(t, helper, http.DefaultClient)
+	})
+
+	t.Run("external store", func(t *testing.T) {
+		endpoint := os.Getenv("S3_TEST_ENDPOINT")
+		if endpoint == "" {
+			t.Skip("S3_TEST_ENDPOINT is not set")
+		}
+		region := os.Getenv("S3_TEST_REGION")
+		if region == "" {
+			region = "us-east-1"
+		}
+		helper := NewS3Helper(os.Getenv("S3_TEST_ACCESS_KEY_ID"), os.Getenv("S3_TEST_SECRET_ACCESS_KEY"), region, os.Getenv("S3_TEST_BUCKET"), nil,
+			WithS3Endpoint(endpoint),
+			WithS3PathStyle(),
+		)
+		runS3IntegrationSuite(t, helper, http.DefaultClient)
+	})
+}
+
+// runS3IntegrationSuite exercises the helper through its public API only, below a prefix deleted afterwards.
+func runS3IntegrationSuite(t *testing.T, helper *S3Helper, httpClient *http.Client) {
+	tester := TestUtility.NewTestHelper(t)
+	tester.Fatalf(helper != nil, "NewS3Helper failed")
+	ctx := context.Background()
+	prefix := "integration-" + xid.New().String() + "/"
+	t.Cleanup(func() {
+		helper.DeletePrefixWithContext(context.Background(), prefix, nil)
+	})
+
+	data := []byte("integration content")
+	err := helper.PutData(prefix+"dir/small.txt", data)
+	tester.Fatalf(err == nil, "PutData: %v", err)
+	item, err := helper.GetItem(prefix + "dir/small.txt")
+	tester.Fatalf(err == nil, "GetItem: %v", err)
+	read, err := io.ReadAll(item)
+	item.Close()
+	tester.Errorf(err == nil && bytes.Equal(read, data), "GetItem content: %q, %v", read, err)
+
+	head, err := helper.HeadItem(prefix + "dir/small.txt")
+	tester.Fatalf(err == nil, "HeadItem: %v", err)
+	size, _ := head.Size()
+	attributes, _ := head.Attributes()
+	tester.Errorf(size == int64(len(data)) && attributes != nil && strings.HasPrefix(attributes.ContentType, "text/plain"), "HeadItem: %d, %+v", size, attributes)
+
+	// multipart upload
+	helper.SetMultipartThreshold(S3MinPartSize)
+	large := testMultipartData(int(S3MinPartSize + 1))
+	err = helper.PutData(prefix+"large.bin", large)
+	tester.Fatalf(err == nil, "multipart PutData: %v", err)
+	head, err = helper.HeadItem(prefix + "large.bin")
+	tester.Fatalf(err == nil, "HeadItem: %v", err)
+	writer := &bytesWriterAt{}
+	err = head.DownloadTo(writer, &S3DownloadOptions{PartSize: S3MinPartSize})
+	tester.Errorf(err == nil && bytes.Equal(writer.data, large), "DownloadTo: %d bytes, %v", len(writer.data), err)
+
+	// conditional put
+	err = helper.PutDataWithOptions(ctx, prefix+"dir/small.txt", data, &S3PutOptions{IfNoneMatch: "*"})
+	tester.Errorf(errors.Is(err, ErrS3PreconditionFailed), "create-only put of an existing key: %v", err)
+
+	// copy and listing
+	err = helper.CopyItemWithContext(ctx, prefix+"dir/small.txt", prefix+"dir/copied.txt", nil)
+	tester.Fatalf(err == nil, "CopyItem: %v", err)
+	keys := []string{}
+	for walked, walkErr := range helper.Walk(ctx, prefix, nil) {
+		tester.Fatalf(walkErr == nil, "Walk: %v", walkErr)
+		keys = append(keys, strings.TrimPrefix(walked.Path, prefix))
+	}
+	tester.Errorf(strings.Join(keys, ",") == "dir/copied.txt,dir/small.txt,large.bin", "walked keys: %v", keys)
+
+	// presigned URLs use the endpoint
+	presigned, err := helper.PresignGetItem(ctx, prefix+"dir/copied.txt", nil)
+	tester.Fatalf(err == nil, "PresignGetItem: %v", err)
+	if response, getErr := httpClient.Get(presigned.URL); getErr == nil {
+		read, err = io.ReadAll(response.Body)
+		response.Body.Close()
+		tester.Errorf(response.StatusCode == http.StatusOK && bytes.Equal(read, data), "presigned GET: %d, %q, %v", response.StatusCode, read, err)
+	} else {
+		tester.Errorf(false, "presigned GET: %v", getErr)
+	}
+
+	err = helper.DeleteItem(prefix + "dir/copied.txt")
+	tester.Errorf(err == nil, "DeleteItem: %v", err)
+	_, err = helper.HeadItem(prefix + "dir/copied.txt")
+	tester.Errorf(errors.Is(err, ErrObjectNotFound), "HeadItem of a deleted key: %v", err)
+}
@@ -0,0 +1,998 @@
+package awssdkhelper
+
+import (
+	"crypto/md5"
+	"encoding/hex"
+	"encoding/xml"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/credentials"
+	"github.com/aws/aws-sdk-go-v2/service/s3"
+)
+
+// fakeS3Object is an object stored by fakeS3Server.
+type fakeS3Object struct {
+	data         []byte
+	etag         string
+	contentType  string
+	lastModified time.Time
+	// partSizes is set for objects completed by a multipart upload
+	partSizes []int64
+	// checksums holds x-amz-checksum-* headers returned when checksum mode is enabled
+	checksums map[string]string
+	// headers holds stored headers such as Cache-Control and x-amz-meta-*
+	headers http.Header
+	tags    url.Values
+	// versionID is set for objects stored while versioning is enabled
+	versionID    string
+	deleteMarker bool
+}
+
+type fakeS3Upload struct {
+	bucket      string
+	key         string
+	contentType string
+	headers     http.Header
+	tags        url.Values
+	parts       map[int]*fakeS3Object
+}
+
+// fakeS3StoredHeaders are the request headers kept with an object and returned by GET and HEAD.
+var fakeS3StoredHeaders = []string{
+	"Cache-Control",
+	"Content-Disposition",
+	"Content-Encoding",
+	"Content-Language",
+	"X-Amz-Storage-Class",
+	"X-Amz-Server-Side-Encryption",
+	"X-Amz-Server-Side-Encryption-Aws-Kms-Key-Id",
+	"X-Amz-Server-Side-Encryption-Context",
+	"X-Amz-Server-Side-Encryption-Bucket-Key-Enabled",
+	"X-Amz-Server-Side-Encryption-Customer-Algorithm",
+	"X-Amz-Server-Side-Encryption-Customer-Key-Md5",
+}
+
+func fakeS3HeadersOf(request http.Header) http.Header {
+	headers := http.Header{}
+	for name, values := range request {
+		if strings.HasPrefix(name, "X-Amz-Meta-") {
+			headers[name] = values
+		}
+	}
+	for _, name := range fakeS3StoredHeaders {
+		if value := request.Get(name); value != "" {
+			headers.Set(name, value)
+		}
+	}
+
+	return headers
+}
+
+// fakeS3CustomerKeyMatches reports whether the request carries the SSE-C key of the object, if it has one.
+func fakeS3CustomerKeyMatches(stored http.Header, request http.Header, prefix string) bool {
+	keyMD5 := stored.Get("X-Amz-Server-Side-Encryption-Customer-Key-Md5")
+	return keyMD5 == "" || keyMD5 == request.Get(prefix+"Server-Side-Encryption-Customer-Key-Md5")
+}
+
+func fakeS3TagsOf(request http.Header) url.Values {
+	tags, _ := url.ParseQuery(request.Get("X-Amz-Tagging"))
+	return tags
+}
+
+// fakeS3Server is a small in-process stand-in of the S3 REST API (path-style addressing).
+type fakeS3Server struct {
+	mutex  sync.Mutex
+	bucket string
+	// objects are the objects of bucket, buckets holds every bucket including it
+	objects map[string]*fakeS3Object
+	buckets map[string]map[string]*fakeS3Object
+	uploads map[string]*fakeS3Upload
+	server  *httptest.Server
+
+	// failParts makes UploadPart fail for the part numbers while the value is true
+	failParts map[int]bool
+	// failPuts makes PutObject fail for the keys while the value is true
+	failPuts map[string]bool
+	// failDeletes makes DeleteObjects report an error for the keys while the value is true
+	failDeletes map[string]bool
+	aborted     []string
+	uploadSeq   int
+	// listRequests counts ListObjectsV2 calls, deleteRequests DeleteObjects calls
+	listRequests   int
+	deleteRequests int
+
+	// versioned enables versioning on every bucket. versions holds the versions and delete markers
+	// of each bucket and key, oldest first.
+	versioned  bool
+	versions   map[string]map[string][]*fakeS3Object
+	versionSeq int
+	// versionPageSize caps the pages of ListObjectVersions when set
+	versionPageSize int
+	// beforeDelete runs with the server locked before each DeleteObject, e.g. to change the object meanwhile
+	beforeDelete func(bucket, key string)
+}
+
+func newFakeS3Server(t *testing.T, bucket string) *fakeS3Server {
+	fake := &fakeS3Server{
+		bucket:    bucket,
+		objects:   map[string]*fakeS3Object{},
+		uploads:   map[string]*fakeS3Upload{},
+		failParts: map[int]bool{},
+		failPuts:  map[string]bool{},
+
+		failDeletes: map[string]bool{},
+		versions:    map[string]map[string][]*fakeS3Object{},
+	}
+	fake.buckets = map[string]map[string]*fakeS3Object{bucket: fake.objects}
+	fake.server = httptest.NewTLSServer(fake)
+	t.Cleanup(fake.server.Close)
+
+	return fake
+}
+
+func (fake *fakeS3Server) client() *s3.Client {
+	return s3.New(s3.Options{
+		Region:                     "us-east-1",
+		Credentials:                credentials.NewStaticCredentialsProvider("AKIDEXAMPLE", "SECRET", ""),
+		BaseEndpoint:               aws.String(fake.server.URL),
+		UsePathStyle:               true,
+		HTTPClient:                 fake.server.Client(),
+		RequestChecksumCalculation: aws.RequestChecksumCalculationWhenRequired,
+		ResponseChecksumValidation: aws.ResponseChecksumValidationWhenRequired,
+	})
+}
+
+func (fake *fakeS3Server) helper() *S3Helper {
+	return &S3Helper{
+		bucket:        fake.bucket,
+		client:        fake.client(),
+		createdByFunc: true,
+	}
+}
+
+func (fake *fakeS3Server) addBucket(bucket string) {
+	fake.mutex.Lock()
+	defer fake.mutex.Unlock()
+
+	fake.buckets[bucket] = map[string]*fakeS3Object{}
+}
+
+func (fake *fakeS3Server) objectIn(bucket, key string) (ret *fakeS3Object) {
+	fake.mutex.Lock()
+	defer fake.mutex.Unlock()
+
+	return fake.buckets[bucket][key]
+}
+
+func (fake *fakeS3Server) putObject(key string, data []byte) {
+	fake.mutex.Lock()
+	defer fake.mutex.Unlock()
+
+	fake.store(fake.bucket, key, newFakeS3Object(data, ""))
+}
+
+// store makes object the current object of key, as a new version when versioning is enabled.
+func (fake *fakeS3Server) store(bucket, key string, object *fakeS3Object) {
+	if fake.versioned {
+		fake.versionSeq++
+		object.versionID = fmt.Sprintf("v%d", fake.versionSeq)
+		if fake.versions[bucket] == nil {
+			fake.versions[bucket] = map[string][]*fakeS3Object{}
+		}
+		fake.versions[bucket][key] = append(fake.versions[bucket][key], object)
+	}
+
+	if object.deleteMarker {
+		delete(fake.buckets[bucket], key)
+	} else {
+		fake.buckets[bucket][key] = object
+	}
+}
+
+// version returns a version of key. "null" is the object stored while versioning was disabled.
+func (fake *fakeS3Server) version(bucket, key, versionID string) *fakeS3Object {
+	for _, object := range fake.versions[bucket][key] {
+		if object.versionID == versionID {
+			return object
+		}
+	}
+	if current, exist := fake.buckets[bucket][key]; exist && versionID == "null" && current.versionID == "" {
+		return current
+	}
+
+	return nil
+}
+
+// remove deletes key like DeleteObject: a delete marker is added when versioning is enabled,
+// and a version is removed permanently when versionID is set.
+func (fake *fakeS3Server) remove(bucket, key, versionID string) (removed *fakeS3Object) {
+	if versionID == "" {
+		if fake.versioned {
+			removed = &fakeS3Object{deleteMarker: true, lastModified: time.Now().UTC().Truncate(time.Second)}
+			fake.store(bucket, key, removed)
+		} else {
+			removed = &fakeS3Object{}
+			delete(fake.buckets[bucket], key)
+		}
+		return
+	}
+
+	versions := fake.versions[bucket][key]
+	for index, object := range versions {
+		if object.versionID == versionID {
+			removed = object
+			versions = append(versions[:index:index], versions[index+1:]...)
+			fake.versions[bucket][key] = versions
+			if len(versions) == 0 || versions[len(versions)-1].deleteMarker {
+				delete(fake.buckets[bucket], key)
+			} else {
+				fake.buckets[bucket][key] = versions[len(versions)-1]
+			}
+			return
+		}
+	}
+	if current, exist := fake.buckets[bucket][key]; exist && versionID == "null" && current.versionID == "" {
+		removed = current
+		delete(fake.buckets[bucket], key)
+	} else {
+		// deleting a missing version succeeds
+		removed = &fakeS3Object{versionID: versionID}
+	}
+
+	return
+}
+
+func (fake *fakeS3Server) object(key string) (ret *fakeS3Object) {
+	fake.mutex.Lock()
+	defer fake.mutex.Unlock()
+
+	return fake.objects[key]
+}
+
+func (fake *fakeS3Server) setChecksum(key, algorithm, value string) {
+	fake.mutex.Lock()
+	defer fake.mutex.Unlock()
+
+	object := fake.objects[key]
+	if object.checksums == nil {
+		object.checksums = map[string]string{}
+	}
+	object.checksums["x-amz-checksum-"+strings.ToLower(algorithm)] = value
+}
+
+func newFakeS3Object(data []byte, contentType string) *fakeS3Object {
+	sum := md5.Sum(data)
+	return &fakeS3Object{
+		data:         data,
+		etag:         `"` + hex.EncodeToString(sum[:]) + `"`,
+		contentType:  contentType,
+		lastModified: time.Now().UTC().Truncate(time.Second),
+		headers:      http.Header{},
+		tags:         url.Values{},
+	}
+}
+
+func writeFakeS3Error(w http.ResponseWriter, r *http.Request, status int, code string) {
+	w.WriteHeader(status)
+	if r.Method != http.MethodHead {
+		fmt.Fprintf(w, `<?xml version="1.0" encoding="UTF-8"?><Error><Code>%s</Code><Message>%s</Message></Error>`, code, code)
+	}
+}
+
+func (fake *fakeS3Server) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	fake.mutex.Lock()
+	defer fake.mutex.Unlock()
+
+	bucketAndKey := strings.SplitN(strings.TrimPrefix(r.URL.Path, "/"), "/", 2)
+	bucket := bucketAndKey[0]
+	if _, exist := fake.buckets[bucket]; !exist {
+		writeFakeS3Error(w, r, http.StatusNotFound, "NoSuchBucket")
+		return
+	}
+
+	key := ""
+	if len(bucketAndKey) == 2 {
+		key = bucketAndKey[1]
+	}
+
+	if key == "" {
+		if r.Method == http.MethodGet && r.URL.Query().Get("list-type") == "2" {
+			fake.listObjectsV2(w, r, bucket)
+		} else if r.Method == http.MethodGet && r.URL.Query().Has("versions") {
+			fake.listObjectVersions(w, r, bucket)
+		} else if r.Method == http.MethodPost && r.URL.Query().Has("delete") {
+			fake.deleteObjectsHandler(w, r, bucket)
+		} else {
+			writeFakeS3Error(w, r, http.StatusNotImplemented, "NotImplemented")
+		}
+		return
+	}
+
+	query := r.URL.Query()
+	if query.Has("uploads") || query.Has("uploadId") {
+		fake.multipartHandler(w, r, bucket, key)
+		return
+	}
+	if query.Has("tagging") {
+		fake.taggingHandler(w, r, bucket, key)
+		return
+	}
+
+	switch r.Method {
+	case http.MethodPut:
+		if r.Header.Get("X-Amz-Copy-Source") != "" {
+			fake.copyObjectHandler(w, r, bucket, key)
+		} else {
+			fake.putObjectHandler(w, r, bucket, key)
+		}
+	case http.MethodGet, http.MethodHead:
+		fake.getObjectHandler(w, r, bucket, key)
+	case http.MethodDelete:
+		if fake.beforeDelete != nil {
+			fake.beforeDelete(bucket, key)
+		}
+		if ifMatch := r.Header.Get("If-Match"); ifMatch != "" {
+			if current, exist := fake.buckets[bucket][key]; !exist || current.deleteMarker {
+				writeFakeS3Error(w, r, http.StatusNotFound, "NoSuchKey")
+				return
+			} else if current.etag != ifMatch {
+				writeFakeS3Error(w, r, http.StatusPreconditionFailed, "PreconditionFailed")
+				return
+			}
+		}
+		removed := fake.remove(bucket, key, query.Get("versionId"))
+		if removed.versionID != "" {
+			w.Header().Set("X-Amz-Version-Id", removed.versionID)
+		}
+		if removed.deleteMarker {
+			w.Header().Set("X-Amz-Delete-Marker", "true")
+		}
+		w.WriteHeader(http.StatusNoContent)
+	default:
+		writeFakeS3Error(w, r, http.StatusNotImplemented, "NotImplemented")
+	}
+}
+
+func (fake *fakeS3Server) deleteObjectsHandler(w http.ResponseWriter, r *http.Request, bucket string) {
+	type fakeS3DeleteObject struct {
+		Key       string `xml:"Key"`
+		VersionId string `xml:"VersionId,omitempty"`
+	}
+	request := struct {
+		Quiet   bool                 `xml:"Quiet"`
+		Objects []fakeS3DeleteObject `xml:"Object"`
+	}{}
+	if err := xml.NewDecoder(r.Body).Decode(&request); err != nil || len(request.Objects) > 1000 {
+		writeFakeS3Error(w, r, http.StatusBadRequest, "MalformedXML")
+		return
+	}
+	fake.deleteRequests++
+
+	type fakeS3Deleted struct {
+		Key                   string `xml:"Key"`
+		VersionId             string `xml:"VersionId,omitempty"`
+		DeleteMarker          bool   `xml:"DeleteMarker,omitempty"`
+		DeleteMarkerVersionId string `xml:"DeleteMarkerVersionId,omitempty"`
+	}
+	type fakeS3DeleteError struct {
+		Key       string `xml:"Key"`
+		VersionId string `xml:"VersionId,omitempty"`
+		Code      string `xml:"Code"`
+		Message   string `xml:"Message"`
+	}
+	result := struct {
+		XMLName xml.Name            `xml:"DeleteResult"`
+		Deleted []fakeS3Deleted     `xml:"Deleted"`
+		Errors  []fakeS3DeleteError `xml:"Error"`
+	}{}
+	for _, object := range request.Objects {
+		if fake.failDeletes[object.Key] {
+			result.Errors = append(result.Errors, fakeS3DeleteError{Key: object.Key, VersionId: object.VersionId, Code: "AccessDenied", Message: "Access Denied"})
+			continue
+		}
+
+		removed := fake.remove(bucket, object.Key, object.VersionId)
+		deleted := fakeS3Deleted{Key: object.Key, VersionId: object.VersionId, DeleteMarker: removed.deleteMarker}
+		if removed.deleteMarker && object.VersionId == "" {
+			deleted.DeleteMarkerVersionId = removed.versionID
+		} else if removed.deleteMarker {
+			deleted.DeleteMarkerVersionId = object.VersionId
+		}
+		if !request.Quiet {
+			result.Deleted = append(result.Deleted, deleted)
+		}
+	}
+
+	w.Header().Set("Content-Type", "application/xml")
+	xml.NewEncoder(w).Encode(&result)
+}
+
+type fakeS3ListVersion struct {
+	Key          string `xml:"Key"`
+	VersionId    string `xml:"VersionId"`
+	IsLatest     bool   `xml:"IsLatest"`
+	LastModified string `xml:"LastModified"`
+	ETag         string `xml:"ETag,omitempty"`
+	Size         int64  `xml:"Size,omitempty"`
+}
+
+func (fake *fakeS3Server) listObjectVersions(w http.ResponseWriter, r *http.Request, bucket string) {
+	query := r.URL.Query()
+	prefix := query.Get("prefix")
+	keyMarker, versionIDMarker := query.Get("key-marker"), query.Get("version-id-marker")
+	maxKeys := 1000
+	if value, err := strconv.Atoi(query.Get("max-keys")); err == nil && value > 0 {
+		maxKeys = value
+	}
+	if fake.versionPageSize > 0 {
+		maxKeys = min(maxKeys, fake.versionPageSize)
+	}
+
+	keys := []string{}
+	seen := map[string]bool{}
+	for key := range fake.buckets[bucket] {
+		if strings.HasPrefix(key, prefix) && !seen[key] {
+			keys, seen[key] = append(keys, key), true
+		}
+	}
+	for key := range fake.versions[bucket] {
+		if strings.HasPrefix(key, prefix) && !seen[key] {
+			keys, seen[key] = append(keys, key), true
+		}
+	}
+	sort.Strings(keys)
+
+	// every version of a key, newest first; the object stored before versioning is the "null" version
+	entries := []*fakeS3Object{}
+	entryKeys := []string{}
+	for _, key := range keys {
+		versions := fake.versions[bucket][key]
+		if current, exist := fake.buckets[bucket][key]; exist && current.versionID == "" {
+			versions = append([]*fakeS3Object{{versionID: "null", etag: current.etag, data: current.data, lastModified: current.lastModified}}, versions...)
+		}
+		for index := len(versions) - 1; index >= 0; index-- {
+			entries = append(entries, versions[index])
+			entryKeys = append(entryKeys, key)
+		}
+	}
+
+	result := struct {
+		XMLName             xml.Name            `xml:"ListVersionsResult"`
+		Name                string              `xml:"Name"`
+		Prefix              string              `xml:"Prefix"`
+		MaxKeys             int                 `xml:"MaxKeys"`
+		IsTruncated         bool                `xml:"IsTruncated"`
+		NextKeyMarker       string              `xml:"NextKeyMarker,omitempty"`
+		NextVersionIdMarker string              `xml:"NextVersionIdMarker,omitempty"`
+		Versions            []fakeS3ListVersion `xml:"Version"`
+		DeleteMarkers       []fakeS3ListVersion `xml:"DeleteMarker"`
+	}{Name: bucket, Prefix: prefix, MaxKeys: maxKeys}
+
+	start := 0
+	if keyMarker != "" {
+		for start < len(entries) && entryKeys[start] < keyMarker {
+			start++
+		}
+		if versionIDMarker == "" {
+			for start < len(entries) && entryKeys[start] == keyMarker {
+				start++
+			}
+		} else {
+			for start < len(entries) && entryKeys[start] == keyMarker {
+				start++
+				if entries[start-1].versionID == versionIDMarker {
+					break
+				}
+			}
+		}
+	}
+
+	count := 0
+	for index := start; index < len(entries); index++ {
+		if count >= maxKeys {
+			result.IsTruncated = true
+			result.NextKeyMarker, result.NextVersionIdMarker = entryKeys[index-1], entries[index-1].versionID
+			break
+		}
+		count++
+
+		entry := entries[index]
+		version := fakeS3ListVersion{
+			Key:          entryKeys[index],
+			VersionId:    entry.versionID,
+			IsLatest:     index == 0 || entryKeys[index-1] != entryKeys[index],
+			LastModified: entry.lastModified.Format(time.RFC3339),
+		}
+		if entry.deleteMarker {
+			result.DeleteMarkers = append(result.DeleteMarkers, version)
+		} else {
+			version.ETag, version.Size = entry.etag, int64(len(entry.data))
+			result.Versions = append(result.Versions, version)
+		}
+	}
+
+	w.Header().Set("Content-Type", "application/xml")
+	xml.NewEncoder(w).Encode(&result)
+}
+
+// putConditionsHold checks the If-None-Match and If-Match headers of PutObject and CompleteMultipartUpload.
+func (fake *fakeS3Server) putConditionsHold(w http.ResponseWriter, r *http.Request, bucket, key string) bool {
+	current, exist := fake.buckets[bucket][key]
+	if r.Header.Get("If-None-Match") == "*" && exist {
+		writeFakeS3Error(w, r, http.StatusPreconditionFailed, "PreconditionFailed")
+		return false
+	}
+	if ifMatch := r.Header.Get("If-Match"); ifMatch != "" {
+		if !exist {
+			writeFakeS3Error(w, r, http.StatusNotFound, "NoSuchKey")
+			return false
+		} else if ifMatch != current.etag {
+			writeFakeS3Error(w, r, http.StatusPreconditionFailed, "PreconditionFailed")
+			return false
+		}
+	}
+
+	return true
+}
+
+func (fake *fakeS3Server) putObjectHandler(w http.ResponseWriter, r *http.Request, bucket, key string) {
+	if fake.failPuts[key] {
+		writeFakeS3Error(w, r, http.StatusForbidden, "AccessDenied")
+		return
+	}
+	if !fake.putConditionsHold(w, r, bucket, key) {
+		return
+	}
+
+	data, err := io.ReadAll(r.Body)
+	if err != nil {
+		writeFakeS3Error(w, r, http.StatusBadRequest, "IncompleteBody")
+		return
+	}
+
+	object := newFakeS3Object(data, r.Header.Get("Content-Type"))
+	object.headers = fakeS3HeadersOf(r.Header)
+	object.tags = fakeS3TagsOf(r.Header)
+	fake.store(bucket, key, object)
+	if object.versionID != "" {
+		w.Header().Set("X-Amz-Version-Id", object.versionID)
+	}
+	w.Header().Set("ETag", object.etag)
+	w.WriteHeader(http.StatusOK)
+}
+
+// copySource returns the object named by x-amz-copy-source ("bucket/key", URL-encoded).
+func (fake *fakeS3Server) copySource(w http.ResponseWriter, r *http.Request) (source *fakeS3Object) {
+	copySource, versionID := strings.TrimPrefix(r.Header.Get("X-Amz-Copy-Source"), "/"), ""
+	if index := strings.Index(copySource, "?versionId="); index >= 0 {
+		copySource, versionID = copySource[:index], copySource[index+len("?versionId="):]
+	}
+	copySource, _ = url.PathUnescape(copySource)
+	bucketAndKey := strings.SplitN(copySource, "/", 2)
+	if len(bucketAndKey) == 2 && versionID != "" {
+		if source = fake.version(bucketAndKey[0], bucketAndKey[1], versionID); source != nil && source.deleteMarker {
+			source = nil
+		}
+	} else if len(bucketAndKey) == 2 {
+		source = fake.buckets[bucketAndKey[0]][bucketAndKey[1]]
+	}
+
+	if source == nil {
+		writeFakeS3Error(w, r, http.StatusNotFound, "NoSuchKey")
+	} else if !fakeS3CustomerKeyMatches(source.headers, r.Header, "X-Amz-Copy-Source-") {
+		writeFakeS3Error(w, r, http.StatusBadRequest, "InvalidRequest")
+		source = nil
+	} else if ifMatch := r.Header.Get("X-Amz-Copy-Source-If-Match"); ifMatch != "" && ifMatch != source.etag {
+		writeFakeS3Error(w, r, http.StatusPreconditionFailed, "PreconditionFailed")
+		source = nil
+	}
+
+	return
+}
+
+func (fake *fakeS3Server) copyObjectHandler(w http.ResponseWriter, r *http.Request, bucket, key string) {
+	if fake.failPuts[key] {
+		writeFakeS3Error(w, r, http.StatusForbidden, "AccessDenied")
+		return
+	}
+	source := fake.copySource(w, r)
+	if source == nil {
+		return
+	}
+
+	object := newFakeS3Object(append([]byte{}, source.data...), source.contentType)
+	object.headers = source.headers.Clone()
+	if r.Header.Get("X-Amz-Metadata-Directive") == "REPLACE" {
+		object.contentType = r.Header.Get("Content-Type")
+		object.headers = fakeS3HeadersOf(r.Header)
+	}
+	object.tags = url.Values{}
+	for name, values := range source.tags {
+		object.tags[name] = values
+	}
+	if r.Header.Get("X-Amz-Tagging-Directive") == "REPLACE" {
+		object.tags = fakeS3TagsOf(r.Header)
+	}
+	fake.store(bucket, key, object)
+	if object.versionID != "" {
+		w.Header().Set("X-Amz-Version-Id", object.versionID)
+	}
+
+	fmt.Fprintf(w, `<CopyObjectResult><ETag>%s</ETag><LastModified>%s</LastModified></CopyObjectResult>`, strings.ReplaceAll(object.etag, `"`, "&quot;"), object.lastModified.Format(time.RFC3339))
+}
+
+func (fake *fakeS3Server) taggingHandler(w http.ResponseWriter, r *http.Request, bucket, key string) {
+	object, exist := fake.buckets[bucket][key]
+	if !exist {
+		writeFakeS3Error(w, r, http.StatusNotFound, "NoSuchKey")
+		return
+	}
+
+	type fakeS3Tag struct {
+		Key   string `xml:"Key"`
+		Value string `xml:"Value"`
+	}
+	tagging := struct {
+		XMLName xml.Name    `xml:"Tagging"`
+		Tags    []fakeS3Tag `xml:"TagSet>Tag"`
+	}{}
+
+	switch r.Method {
+	case http.MethodGet:
+		names := []string{}
+		for name := range object.tags {
+			names = append(names, name)
+		}
+		sort.Strings(names)
+		for _, name := range names {
+			tagging.Tags = append(tagging.Tags, fakeS3Tag{Key: name, Value: object.tags.Get(name)})
+		}
+		xml.NewEncoder(w).Encode(&tagging)
+	case http.MethodPut:
+		if err := xml.NewDecoder(r.Body).Decode(&tagging); err != nil {
+			writeFakeS3Error(w, r, http.StatusBadRequest, "MalformedXML")
+			return
+		}
+		object.tags = url.Values{}
+		for _, tag := range tagging.Tags {
+			object.tags.Set(tag.Key, tag.Value)
+		}
+	case http.MethodDelete:
+		object.tags = url.Values{}
+		w.WriteHeader(http.StatusNoContent)
+	default:
+		writeFakeS3Error(w, r, http.StatusNotImplemented, "NotImplemented")
+	}
+}
+
+func (fake *fakeS3Server) getObjectHandler(w http.ResponseWriter, r *http.Request, bucket, key string) {
+	object, exist := fake.buckets[bucket][key]
+	if versionID := r.URL.Query().Get("versionId"); versionID != "" {
+		object = fake.version(bucket, key, versionID)
+		exist = object != nil
+		if exist && object.deleteMarker {
+			w.Header().Set("X-Amz-Delete-Marker", "true")
+			w.Header().Set("X-Amz-Version-Id", versionID)
+			writeFakeS3Error(w, r, http.StatusMethodNotAllowed, "MethodNotAllowed")
+			return
+		}
+	}
+	if !exist {
+		writeFakeS3Error(w, r, http.StatusNotFound, "NoSuchKey")
+		return
+	}
+
+	if !fakeS3CustomerKeyMatches(object.headers, r.Header, "X-Amz-") {
+		writeFakeS3Error(w, r, http.StatusBadRequest, "InvalidRequest")
+		return
+	}
+	if ifMatch := r.Header.Get("If-Match"); ifMatch != "" && ifMatch != object.etag {
+		writeFakeS3Error(w, r, http.StatusPreconditionFailed, "PreconditionFailed")
+		return
+	}
+	if since, err := http.ParseTime(r.Header.Get("If-Unmodified-Since")); err == nil && object.lastModified.After(since) {
+		writeFakeS3Error(w, r, http.StatusPreconditionFailed, "PreconditionFailed")
+		return
+	}
+	ifNoneMatch := r.Header.Get("If-None-Match")
+	since, sinceErr := http.ParseTime(r.Header.Get("If-Modified-Since"))
+	if (ifNoneMatch != "" && ifNoneMatch == object.etag) || (ifNoneMatch == "" && sinceErr == nil && !object.lastModified.After(since)) {
+		w.Header().Set("ETag", object.etag)
+		w.WriteHeader(http.StatusNotModified)
+		return
+	}
+
+	size := int64(len(object.data))
+	start, end, partial := int64(0), size-1, false
+	if value := r.URL.Query().Get("partNumber"); value != "" {
+		partNumber, _ := strconv.Atoi(value)
+		partSizes := object.partSizes
+		if len(partSizes) == 0 {
+			partSizes = []int64{size}
+		} else {
+			w.Header().Set("x-amz-mp-parts-count", strconv.Itoa(len(partSizes)))
+		}
+		if partNumber < 1 || partNumber > len(partSizes) {
+			writeFakeS3Error(w, r, http.StatusRequestedRangeNotSatisfiable, "InvalidPartNumber")
+			return
+		}
+		start = 0
+		for _, partSize := range partSizes[:partNumber-1] {
+			start += partSize
+		}
+		end, partial = start+partSizes[partNumber-1]-1, len(object.partSizes) > 0
+	} else if value := r.Header.Get("Range"); strings.HasPrefix(value, "bytes=") {
+		bounds := strings.SplitN(strings.TrimPrefix(value, "bytes="), "-", 2)
+		start, _ = strconv.ParseInt(bounds[0], 10, 64)
+		if len(bounds) == 2 && bounds[1] != "" {
+			if value, err := strconv.ParseInt(bounds[1], 10, 64); err == nil && value < end {
+				end = value
+			}
+		}
+		if start >= size {
+			writeFakeS3Error(w, r, http.StatusRequestedRangeNotSatisfiable, "InvalidRange")
+			return
+		}
+		partial = true
+	}
+
+	w.Header().Set("ETag", object.etag)
+	w.Header().Set("Last-Modified", object.lastModified.Format(http.TimeFormat))
+	if object.versionID != "" {
+		w.Header().Set("X-Amz-Version-Id", object.versionID)
+	}
+	if object.contentType != "" {
+		w.Header().Set("Content-Type", object.contentType)
+	}
+	for name, values := range object.headers {
+		w.Header()[name] = values
+	}
+	if len(object.tags) > 0 {
+		w.Header().Set("X-Amz-Tagging-Count", strconv.Itoa(len(object.tags)))
+	}
+	if !partial && r.Header.Get("x-amz-checksum-mode") == "ENABLED" {
+		for name, value := range object.checksums {
+			w.Header().Set(name, value)
+		}
+		if len(object.checksums) > 0 {
+			w.Header().Set("x-amz-checksum-type", "FULL_OBJECT")
+		}
+	}
+	w.Header().Set("Content-Length", strconv.FormatInt(end-start+1, 10))
+	if partial {
+		w.Header().Set("Content-Range", fmt.Sprintf("bytes %d-%d/%d", start, end, size))
+		w.WriteHeader(http.StatusPartialContent)
+	} else {
+		w.WriteHeader(http.StatusOK)
+	}
+	if r.Method == http.MethodGet {
+		w.Write(object.data[start : end+1])
+	}
+}
+
+type fakeS3ListContent struct {
+	Key          string `xml:"Key"`
+	LastModified string `xml:"LastModified"`
+	ETag         string `xml:"ETag"`
+	Size         int64  `xml:"Size"`
+}
+
+type fakeS3CommonPrefix struct {
+	Prefix string `xml:"Prefix"`
+}
+
+type fakeS3ListBucketResult struct {
+	XMLName               xml.Name             `xml:"ListBucketResult"`
+	Name                  string               `xml:"Name"`
+	Prefix                string               `xml:"Prefix"`
+	KeyCount              int                  `xml:"KeyCount"`
+	MaxKeys               int                  `xml:"MaxKeys"`
+	IsTruncated           bool                 `xml:"IsTruncated"`
+	NextContinuationToken string               `xml:"NextContinuationToken,omitempty"`
+	Contents              []fakeS3ListContent  `xml:"Contents"`
+	CommonPrefixes        []fakeS3CommonPrefix `xml:"CommonPrefixes"`
+}
+
+func (fake *fakeS3Server) listObjectsV2(w http.ResponseWriter, r *http.Request, bucket string) {
+	objects := fake.buckets[bucket]
+	fake.listRequests++
+	query := r.URL.Query()
+	prefix := query.Get("prefix")
+	delimiter := query.Get("delimiter")
+	startAfter := query.Get("start-after")
+	if token := query.Get("continuation-token"); token != "" {
+		startAfter = token
+	}
+	maxKeys := 1000
+	if value, err := strconv.Atoi(query.Get("max-keys")); err == nil && value > 0 {
+		maxKeys = value
+	}
+
+	keys := []string{}
+	for key := range objects {
+		if strings.HasPrefix(key, prefix) {
+			keys = append(keys, key)
+		}
+	}
+	sort.Strings(keys)
+
+	result := fakeS3ListBucketResult{Name: bucket, Prefix: prefix, MaxKeys: maxKeys}
+	seenPrefixes := map[string]bool{}
+	for _, key := range keys {
+		entry, isPrefix := key, false
+		if delimiter != "" {
+			if index := strings.Index(key[len(prefix):], delimiter); index >= 0 {
+				// a placeholder key ending with the delimiter is a common prefix too
+				entry, isPrefix = key[:len(prefix)+index+len(delimiter)], true
+			}
+		}
+		if entry <= startAfter || seenPrefixes[entry] {
+			continue
+		}
+
+		if result.KeyCount >= maxKeys {
+			result.IsTruncated = true
+			break
+		}
+		result.NextContinuationToken = entry
+		result.KeyCount++
+
+		if isPrefix {
+			seenPrefixes[entry] = true
+			result.CommonPrefixes = append(result.CommonPrefixes, fakeS3CommonPrefix{Prefix: entry})
+		} else {
+			object := objects[key]
+			result.Contents = append(result.Contents, fakeS3ListContent{
+				Key:          key,
+				LastModified: object.lastModified.Format(time.RFC3339),
+				ETag:         object.etag,
+				Size:         int64(len(object.data)),
+			})
+		}
+	}
+	if !result.IsTruncated {
+		result.NextContinuationToken = ""
+	}
+
+	w.Header().Set("Content-Type", "application/xml")
+	xml.NewEncoder(w).Encode(&result)
+}
+
+type fakeS3Part struct {
+	PartNumber   int    `xml:"PartNumber"`
+	ETag         string `xml:"ETag"`
+	Size         int64  `xml:"Size,omitempty"`
+	LastModified string `xml:"LastModified,omitempty"`
+}
+
+func (fake *fakeS3Server) multipartHandler(w http.ResponseWriter, r *http.Request, bucket, key string) {
+	query := r.URL.Query()
+	uploadID := query.Get("uploadId")
+
+	if r.Method == http.MethodPost && query.Has("uploads") {
+		fake.uploadSeq++
+		uploadID = fmt.Sprintf("upload-%d", fake.uploadSeq)
+		fake.uploads[uploadID] = &fakeS3Upload{
+			bucket:      bucket,
+			key:         key,
+			contentType: r.Header.Get("Content-Type"),
+			headers:     fakeS3HeadersOf(r.Header),
+			tags:        fakeS3TagsOf(r.Header),
+			parts:       map[int]*fakeS3Object{},
+		}
+		fmt.Fprintf(w, `<InitiateMultipartUploadResult><Bucket>%s</Bucket><Key>%s</Key><UploadId>%s</UploadId></InitiateMultipartUploadResult>`, bucket, key, uploadID)
+		return
+	}
+
+	upload, exist := fake.uploads[uploadID]
+	if !exist || upload.bucket != bucket || upload.key != key {
+		writeFakeS3Error(w, r, http.StatusNotFound, "NoSuchUpload")
+		return
+	}
+
+	switch r.Method {
+	case http.MethodPut:
+		partNumber, _ := strconv.Atoi(query.Get("partNumber"))
+		if fake.failParts[partNumber] {
+			writeFakeS3Error(w, r, http.StatusForbidden, "AccessDenied")
+			return
+		}
+		if !fakeS3CustomerKeyMatches(upload.headers, r.Header, "X-Amz-") {
+			writeFakeS3Error(w, r, http.StatusBadRequest, "InvalidRequest")
+			return
+		}
+		if r.Header.Get("X-Amz-Copy-Source") != "" {
+			// UploadPartCopy
+			source := fake.copySource(w, r)
+			if source == nil {
+				return
+			}
+			start, end := int64(0), int64(len(source.data))-1
+			if value := r.Header.Get("X-Amz-Copy-Source-Range"); value != "" {
+				fmt.Sscanf(value, "bytes=%d-%d", &start, &end)
+			}
+			if start < 0 || end >= int64(len(source.data)) || start > end {
+				writeFakeS3Error(w, r, http.StatusBadRequest, "InvalidArgument")
+				return
+			}
+			part := newFakeS3Object(append([]byte{}, source.data[start:end+1]...), "")
+			upload.parts[partNumber] = part
+			fmt.Fprintf(w, `<CopyPartResult><ETag>%s</ETag><LastModified>%s</LastModified></CopyPartResult>`, strings.ReplaceAll(part.etag, `"`, "&quot;"), part.lastModified.Format(time.RFC3339))
+			return
+		}
+		data, _ := io.ReadAll(r.Body)
+		part := newFakeS3Object(data, "")
+		upload.parts[partNumber] = part
+		w.Header().Set("ETag", part.etag)
+	case http.MethodGet:
+		result := struct {
+			XMLName  xml.Name     `xml:"ListPartsResult"`
+			UploadId string       `xml:"UploadId"`
+			Parts    []fakeS3Part `xml:"Part"`
+		}{UploadId: uploadID}
+		partNumbers := []int{}
+		for partNumber := range upload.parts {
+			partNumbers = append(partNumbers, partNumber)
+		}
+		sort.Ints(partNumbers)
+		for _, partNumber := range partNumbers {
+			part := upload.parts[partNumber]
+			result.Parts = append(result.Parts, fakeS3Part{PartNumber: partNumber, ETag: part.etag, Size: int64(len(part.data)), LastModified: part.lastModified.Format(time.RFC3339)})
+		}
+		xml.NewEncoder(w).Encode(&result)
+	case http.MethodPost:
+		request := struct {
+			Parts []fakeS3Part `xml:"Part"`
+		}{}
+		if err := xml.NewDecoder(r.Body).Decode(&request); err != nil || len(request.Parts) == 0 {
+			writeFakeS3Error(w, r, http.StatusBadRequest, "MalformedXML")
+			return
+		}
+		if !fake.putConditionsHold(w, r, bucket, key) {
+			return
+		}
+		data := []byte{}
+		partSizes := []int64{}
+		partDigests := []byte{}
+		for index, requested := range request.Parts {
+			part, exist := upload.parts[requested.PartNumber]
+			if !exist || part.etag != requested.ETag || (index > 0 && requested.PartNumber <= request.Parts[index-1].PartNumber) {
+				writeFakeS3Error(w, r, http.StatusBadRequest, "InvalidPart")
+				return
+			}
+			data = append(data, part.data...)
+			partSizes = append(partSizes, int64(len(part.data)))
+			partDigest := md5.Sum(part.data)
+			partDigests = append(partDigests, partDigest[:]...)
+		}
+		object := newFakeS3Object(data, upload.contentType)
+		etag := md5.Sum(partDigests)
+		object.etag = fmt.Sprintf(`"%s-%d"`, hex.EncodeToString(etag[:]), len(request.Parts))
+		object.partSizes = partSizes
+		object.headers = upload.headers
+		object.tags = upload.tags
+		fake.store(bucket, key, object)
+		if object.versionID != "" {
+			w.Header().Set("X-Amz-Version-Id", object.versionID)
+		}
+		delete(fake.uploads, uploadID)
+		fmt.Fprintf(w, `<CompleteMultipartUploadResult><Bucket>%s</Bucket><Key>%s</Key><ETag>%s</ETag></CompleteMultipartUploadResult>`, bucket, key, object.etag)
+	case http.MethodDelete:
+		delete(fake.uploads, uploadID)
+		fake.aborted = append(fake.aborted, uploadID)
+		w.WriteHeader(http.StatusNoContent)
+	default:
+		writeFakeS3Error(w, r, http.StatusNotImplemented, "NotImplemented")
+	}
+}
@@ -0,0 +1,263 @@
+package awssdkhelper
+
+import (
+	"context"
+	"errors"
+	"io"
+	"io/fs"
+	"path"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/s3"
+)
+
+// S3FS exposes the objects under a prefix as a read-only fs.FS, so it can be passed to
+// http.FS, template.ParseFS or fs.WalkDir. Key separators "/" map to directories.
+type S3FS struct {
+	helper *S3Helper
+	prefix string
+	ctx    context.Context
+}
+
+var _ fs.ReadDirFS = (*S3FS)(nil)
+var _ fs.StatFS = (*S3FS)(nil)
+
+func NewS3FS(helper *S3Helper, prefix string) *S3FS {
+	if prefix != "" && !strings.HasSuffix(prefix, "/") {
+		prefix += "/"
+	}
+
+	return &S3FS{
+		helper: helper,
+		prefix: prefix,
+		ctx:    context.Background(),
+	}
+}
+
+// WithContext returns a copy whose S3 calls, including reads of opened files, use ctx.
+func (fsys *S3FS) WithContext(ctx context.Context) *S3FS {
+	return &S3FS{
+		helper: fsys.helper,
+		prefix: fsys.prefix,
+		ctx:    ctx,
+	}
+}
+
+func (fsys *S3FS) key(name string) string {
+	if name == "." {
+		return fsys.prefix
+	}
+
+	return fsys.prefix + name
+}
+
+func (fsys *S3FS) Open(name string) (fs.File, error) {
+	if info, err := fsys.stat("open", name); err == nil {
+		if info.IsDir() {
+			return &s3FSDir{fsys: fsys, name: name, info: info}, nil
+		}
+		return &s3FSFile{item: info.item, info: info}, nil
+	} else {
+		return nil, err
+	}
+}
+
+func (fsys *S3FS) Stat(name string) (fs.FileInfo, error) {
+	if info, err := fsys.stat("stat", name); err == nil {
+		return info, nil
+	} else {
+		return nil, err
+	}
+}
+
+// stat looks for an object named name first, then for keys below name + "/".
+func (fsys *S3FS) stat(op string, name string) (info *s3FileInfo, err error) {
+	if !fs.ValidPath(name) {
+		return nil, &fs.PathError{Op: op, Path: name, Err: fs.ErrInvalid}
+	}
+	if name == "." {
+		return &s3FileInfo{name: ".", isDir: true}, nil
+	}
+
+	item := &S3Item{
+		Path:   fsys.key(name),
+		helper: fsys.helper,
+		ctx:    fsys.ctx,
+	}
+	if _, headErr := item.head(fsys.ctx, 0); headErr == nil {
+		return &s3FileInfo{
+			name:    path.Base(name),
+			size:    aws.ToInt64(item.size),
+			modTime: aws.ToTime(item.lastModified),
+			item:    item,
+		}, nil
+	} else if !errors.Is(wrapS3NotFound(item.Path, headErr), ErrObjectNotFound) {
+		return nil, &fs.PathError{Op: op, Path: name, Err: headErr}
+	}
+
+	// any key below name + "/", including a "folder" placeholder object, makes name a directory
+	callCtx, cancel := fsys.helper.callContext(fsys.ctx)
+	defer cancel()
+	if output, listErr := fsys.helper.client.ListObjectsV2(callCtx, &s3.ListObjectsV2Input{
+		Bucket:  aws.String(fsys.helper.bucket),
+		Prefix:  aws.String(fsys.key(name) + "/"),
+		MaxKeys: aws.Int32(1),
+	}); listErr != nil {
+		return nil, &fs.PathError{Op: op, Path: name, Err: listErr}
+	} else if len(output.Contents) > 0 || len(output.CommonPrefixes) > 0 {
+		return &s3FileInfo{name: path.Base(name), isDir: true}, nil
+	}
+
+	return nil, &fs.PathError{Op: op, Path: name, Err: fs.ErrNotExist}
+}
+
+func (fsys *S3FS) ReadDir(name string) (entries []fs.DirEntry, err error) {
+	if !fs.ValidPath(name) {
+		return nil, &fs.PathError{Op: "readdir", Path: name, Err: fs.ErrInvalid}
+	}
+
+	dirPrefix := fsys.key(name)
+	if name != "." {
+		dirPrefix += "/"
+	}
+
+	for item, walkErr := range fsys.helper.Walk(fsys.ctx, dirPrefix, &S3WalkOptions{MaxDepth: 1, IncludeDirs: true}) {
+		if walkErr != nil {
+			return nil, &fs.PathError{Op: "readdir", Path: name, Err: walkErr}
+		}
+
+		info := &s3FileInfo{
+			name:  strings.TrimSuffix(strings.TrimPrefix(item.Path, dirPrefix), "/"),
+			isDir: item.IsDir,
+		}
+		if !item.IsDir {
+			if resolveErr := item.resolveCompression(fsys.ctx); resolveErr != nil {
+				return nil, &fs.PathError{Op: "readdir", Path: name, Err: resolveErr}
+			}
+			info.size = aws.ToInt64(item.size)
+			info.modTime = aws.ToTime(item.lastModified)
+		}
+		if info.name != "" {
+			entries = append(entries, fs.FileInfoToDirEntry(info))
+		}
+	}
+	sort.Slice(entries, func(i, j int) bool { return entries[i].Name() < entries[j].Name() })
+
+	if len(entries) == 0 && name != "." {
+		// an empty listing is indistinguishable from a missing directory, unless name is an object
+		if info, statErr := fsys.stat("readdir", name); statErr != nil {
+			return nil, statErr
+		} else if !info.IsDir() {
+			return nil, &fs.PathError{Op: "readdir", Path: name, Err: errors.New("not a directory")}
+		}
+	}
+
+	return
+}
+
+type s3FileInfo struct {
+	name    string
+	size    int64
+	modTime time.Time
+	isDir   bool
+	item    *S3Item
+}
+
+func (info *s3FileInfo) Name() string {
+	return info.name
+}
+
+func (info *s3FileInfo) Size() int64 {
+	return info.size
+}
+
+func (info *s3FileInfo) Mode() fs.FileMode {
+	if info.isDir {
+		return fs.ModeDir | 0o555
+	}
+
+	return 0o444
+}
+
+func (info *s3FileInfo) ModTime() time.Time {
+	return info.modTime
+}
+
+func (info *s3FileInfo) IsDir() bool {
+	return info.isDir
+}
+
+func (info *s3FileInfo) Sys() any {
+	return info.item
+}
+
+// s3FSFile reads an object lazily, with ranged GETs after Seek or for ReadAt.
+type s3FSFile struct {
+	item *S3Item
+	info *s3FileInfo
+}
+
+func (file *s3FSFile) Stat() (fs.FileInfo, error) {
+	return file.info, nil
+}
+
+func (file *s3FSFile) Read(buffer []byte) (int, error) {
+	return file.item.Read(buffer)
+}
+
+func (file *s3FSFile) ReadAt(buffer []byte, offset int64) (int, error) {
+	return file.item.ReadAt(buffer, offset)
+}
+
+func (file *s3FSFile) Seek(offset int64, whence int) (int64, error) {
+	return file.item.Seek(offset, whence)
+}
+
+func (file *s3FSFile) Close() error {
+	return file.item.Close()
+}
+
+type s3FSDir struct {
+	fsys    *S3FS
+	name    string
+	info    *s3FileInfo
+	entries []fs.DirEntry
+	loaded  bool
+}
+
+func (dir *s3FSDir) Stat() (fs.FileInfo, error) {
+	return dir.info, nil
+}
+
+func (dir *s3FSDir) Read([]byte) (int, error) {
+	return 0, &fs.PathError{Op: "read", Path: dir.name, Err: errors.New("is a directory")}
+}
+
+func (dir *s3FSDir) Close() error {
+	return nil
+}
+
+func (dir *s3FSDir) ReadDir(count int) (entries []fs.DirEntry, err error) {
+	if !dir.loaded {
+		if dir.entries, err = dir.fsys.ReadDir(dir.name); err != nil {
+			return nil, err
+		}
+		dir.loaded = true
+	}
+
+	if count <= 0 {
+		entries, dir.entries = dir.entries, nil
+		return
+	}
+	if len(dir.entries) == 0 {
+		return nil, io.EOF
+	}
+
+	count = min(count, len(dir.entries))
+	entries, dir.entries = dir.entries[:count], dir.entries[count:]
+
+	return
+}
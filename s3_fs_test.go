@@ -0,0 +1,73 @@
+package awssdkhelper
+
+import (
+	"bytes"
+	"errors"
+	"html/template"
+	"io"
+	"io/fs"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"testing/fstest"
+
+	TestUtility "github.com/thcomp/GoLang_TestUtility"
+)
+
+func Test_S3FS(t *testing.T) {
+	tester := TestUtility.NewTestHelper(t)
+	fake := newFakeS3Server(t, "fs-bucket")
+	for key, value := range map[string]string{
+		"site/index.html":              "<h1>index</h1>",
+		"site/css/style.css":           "body{}",
+		"site/templates/page.tmpl":     `{{define "page"}}Hello {{.}}{{end}}`,
+		"site/templates/sub/part.tmpl": `{{define "part"}}part{{end}}`,
+		"site/empty/":                  "",
+		"other.txt":                    "outside",
+	} {
+		fake.putObject(key, []byte(value))
+	}
+	fsys := NewS3FS(fake.helper(), "site")
+
+	err := fstest.TestFS(fsys, "index.html", "css/style.css", "templates/page.tmpl", "templates/sub/part.tmpl")
+	tester.Errorf(err == nil, "fstest.TestFS: %v", err)
+
+	data, err := fs.ReadFile(fsys, "css/style.css")
+	tester.Errorf(err == nil && string(data) == "body{}", "ReadFile: %s, %v", data, err)
+
+	info, err := fs.Stat(fsys, "templates")
+	tester.Errorf(err == nil && info.IsDir() && info.Name() == "templates", "Stat dir: %v, %v", info, err)
+	info, err = fs.Stat(fsys, "index.html")
+	tester.Errorf(err == nil && !info.IsDir() && info.Size() == 14 && !info.ModTime().IsZero(), "Stat file: %v, %v", info, err)
+	_, err = fs.Stat(fsys, "missing.html")
+	tester.Errorf(errors.Is(err, fs.ErrNotExist), "Stat missing: %v", err)
+	_, err = fsys.Open("../other.txt")
+	tester.Errorf(errors.Is(err, fs.ErrInvalid), "Open outside: %v", err)
+
+	entries, err := fs.ReadDir(fsys, ".")
+	names := []string{}
+	for _, entry := range entries {
+		names = append(names, entry.Name())
+	}
+	tester.Errorf(err == nil && len(names) == 4 && names[0] == "css" && names[1] == "empty" && names[2] == "index.html" && names[3] == "templates", "ReadDir: %v, %v", names, err)
+	entries, err = fs.ReadDir(fsys, "empty")
+	tester.Errorf(err == nil && len(entries) == 0, "ReadDir of an empty directory: %v, %v", entries, err)
+	_, err = fs.ReadDir(fsys, "index.html")
+	tester.Errorf(err != nil, "ReadDir of a file succeeds")
+
+	templates, err := template.ParseFS(fsys, "templates/*.tmpl", "templates/sub/*.tmpl")
+	tester.Fatalf(err == nil, "template.ParseFS: %v", err)
+	output := bytes.Buffer{}
+	templates.ExecuteTemplate(&output, "page", "S3")
+	tester.Errorf(output.String() == "Hello S3", "template output: %s", output.String())
+
+	server := httptest.NewServer(http.FileServer(http.FS(fsys)))
+	defer server.Close()
+	request, _ := http.NewRequest(http.MethodGet, server.URL+"/css/style.css", nil)
+	request.Header.Set("Range", "bytes=2-4")
+	response, err := http.DefaultClient.Do(request)
+	tester.Fatalf(err == nil, "GET from FileServer: %v", err)
+	body, _ := io.ReadAll(response.Body)
+	response.Body.Close()
+	tester.Errorf(response.StatusCode == http.StatusPartialContent && string(body) == "dy{", "FileServer range: %d %s", response.StatusCode, body)
+}
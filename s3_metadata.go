@@ -0,0 +1,390 @@
+package awssdkhelper
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"os"
+	"sort"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/s3"
+	"github.com/aws/aws-sdk-go-v2/service/s3/types"
+
+	ThcompUtility "github.com/thcomp/GoLang_Utility"
+)
+
+// S3ObjectAttributes are the attributes HeadObject returns besides size and last modified.
+type S3ObjectAttributes struct {
+	ETag               string
+	ContentType        string
+	ContentEncoding    string
+	ContentDisposition string
+	CacheControl       string
+	// StorageClass is "STANDARD" when S3 does not report one.
+	StorageClass string
+	// VersionId is empty when the bucket is not versioned.
+	VersionId string
+	// ServerSideEncryption is "AES256", "aws:kms" or "aws:kms:dsse". SSEKMSKeyId is the ARN of the KMS key.
+	ServerSideEncryption string
+	SSEKMSKeyId          string
+	// SSECustomerAlgorithm is "AES256" for objects encrypted with an SSE-C key.
+	SSECustomerAlgorithm string
+	// Metadata is the user metadata (x-amz-meta-*), with lower-case names.
+	Metadata map[string]string
+	// UncompressedSize is the size of gzip or zstd content (by Content-Encoding or key extension) once decompressed,
+	// stored by compressing puts, or -1 when unknown. It is the size for content which is not compressed.
+	UncompressedSize int64
+	// Checksums maps the algorithm ("CRC32", "CRC32C", "CRC64NVME", "SHA1" or "SHA256") to the base64 checksum
+	// stored with the object. Objects uploaded without checksum have none.
+	Checksums map[string]string
+}
+
+func newS3ObjectAttributes(output *s3.HeadObjectOutput) *S3ObjectAttributes {
+	attributes := &S3ObjectAttributes{
+		ETag:               aws.ToString(output.ETag),
+		ContentType:        aws.ToString(output.ContentType),
+		ContentEncoding:    aws.ToString(output.ContentEncoding),
+		ContentDisposition: aws.ToString(output.ContentDisposition),
+		CacheControl:       aws.ToString(output.CacheControl),
+		StorageClass:       string(output.StorageClass),
+		VersionId:          aws.ToString(output.VersionId),
+
+		ServerSideEncryption: string(output.ServerSideEncryption),
+		SSEKMSKeyId:          aws.ToString(output.SSEKMSKeyId),
+		SSECustomerAlgorithm: aws.ToString(output.SSECustomerAlgorithm),
+
+		Metadata:  map[string]string{},
+		Checksums: map[string]string{},
+	}
+	if attributes.StorageClass == "" {
+		attributes.StorageClass = string(types.StorageClassStandard)
+	}
+	for name, value := range output.Metadata {
+		attributes.Metadata[name] = value
+	}
+	for algorithm, checksum := range map[types.ChecksumAlgorithm]*string{
+		types.ChecksumAlgorithmCrc32:     output.ChecksumCRC32,
+		types.ChecksumAlgorithmCrc32c:    output.ChecksumCRC32C,
+		types.ChecksumAlgorithmCrc64nvme: output.ChecksumCRC64NVME,
+		types.ChecksumAlgorithmSha1:      output.ChecksumSHA1,
+		types.ChecksumAlgorithmSha256:    output.ChecksumSHA256,
+	} {
+		if checksum != nil {
+			attributes.Checksums[string(algorithm)] = *checksum
+		}
+	}
+
+	return attributes
+}
+
+// newS3ObjectAttributesOfGet returns the attributes GetObject returns with the body.
+func newS3ObjectAttributesOfGet(output *s3.GetObjectOutput) *S3ObjectAttributes {
+	return newS3ObjectAttributes(&s3.HeadObjectOutput{
+		ETag:                 output.ETag,
+		ContentType:          output.ContentType,
+		ContentEncoding:      output.ContentEncoding,
+		ContentDisposition:   output.ContentDisposition,
+		CacheControl:         output.CacheControl,
+		StorageClass:         output.StorageClass,
+		VersionId:            output.VersionId,
+		ServerSideEncryption: output.ServerSideEncryption,
+		SSEKMSKeyId:          output.SSEKMSKeyId,
+		SSECustomerAlgorithm: output.SSECustomerAlgorithm,
+		Metadata:             output.Metadata,
+		ChecksumCRC32:        output.ChecksumCRC32,
+		ChecksumCRC32C:       output.ChecksumCRC32C,
+		ChecksumCRC64NVME:    output.ChecksumCRC64NVME,
+		ChecksumSHA1:         output.ChecksumSHA1,
+		ChecksumSHA256:       output.ChecksumSHA256,
+	})
+}
+
+func (s3Helper *S3Helper) HeadItem(key string) (item *S3Item, err error) {
+	return s3Helper.HeadItemWithContext(context.Background(), key)
+}
+
+// HeadItemWithContext returns the item with its size, last modified and attributes loaded by HeadObject,
+// without opening the body. The body is only fetched once the item is read.
+func (s3Helper *S3Helper) HeadItemWithContext(ctx context.Context, key string) (item *S3Item, err error) {
+	item = &S3Item{
+		Path:   key,
+		helper: s3Helper,
+		ctx:    ctx,
+	}
+	if _, err = item.head(ctx, 0); err != nil {
+		return nil, wrapS3NotFound(key, err)
+	}
+
+	return
+}
+
+func (item *S3Item) Stat() (*S3ObjectAttributes, error) {
+	return item.StatWithContext(item.context())
+}
+
+// StatWithContext reloads size, last modified and the attributes of the item with HeadObject.
+func (item *S3Item) StatWithContext(ctx context.Context) (attributes *S3ObjectAttributes, err error) {
+	if _, err = item.head(ctx, 0); err == nil {
+		attributes = item.attributes
+	} else {
+		err = wrapS3NotFound(item.Path, err)
+	}
+
+	return
+}
+
+// Attributes returns the attributes loaded by GetItem, HeadItem or Stat.
+func (item *S3Item) Attributes() (*S3ObjectAttributes, error) {
+	if item.attributes != nil {
+		return item.attributes, nil
+	}
+
+	return nil, fmt.Errorf("attributes are not loaded for item %s: call Stat", item.Path)
+}
+
+func (item *S3Item) ETag() (string, error) {
+	if item.etag != nil {
+		return *item.etag, nil
+	}
+
+	return "", fmt.Errorf("etag is nil for item %s", item.Path)
+}
+
+type S3PutOptions struct {
+	// ContentType defaults to the type derived from the key's extension.
+	ContentType        string
+	ContentEncoding    string
+	ContentDisposition string
+	CacheControl       string
+	// Metadata is stored as x-amz-meta-* headers. S3 lower-cases the names.
+	Metadata map[string]string
+	Tags     map[string]string
+	// StorageClass such as "STANDARD_IA" or "GLACIER_IR". Defaults to the bucket default, usually "STANDARD".
+	StorageClass string
+	// Encryption overrides the encryption set by SetEncryption.
+	Encryption *S3Encryption
+	// Compression compresses the content, with Content-Encoding set, instead of the default set by SetCompression.
+	// S3CompressionNone writes the content as is.
+	Compression S3Compression
+	// IfNoneMatch "*" only creates the object, and IfMatch only replaces the object with this ETag (compare-and-swap).
+	// Otherwise the put fails with ErrS3PreconditionFailed, or ErrObjectNotFound for IfMatch on a missing object.
+	IfNoneMatch string
+	IfMatch     string
+}
+
+func (s3Helper *S3Helper) putEncryption(options *S3PutOptions) *S3Encryption {
+	if options != nil {
+		return s3Helper.encryptionFor(options.Encryption)
+	}
+
+	return s3Helper.encryption
+}
+
+func (options *S3PutOptions) applyToPutObject(input *s3.PutObjectInput) {
+	if options == nil {
+		return
+	}
+
+	if options.ContentType != "" {
+		input.ContentType = aws.String(options.ContentType)
+	}
+	if options.ContentEncoding != "" {
+		input.ContentEncoding = aws.String(options.ContentEncoding)
+	}
+	if options.ContentDisposition != "" {
+		input.ContentDisposition = aws.String(options.ContentDisposition)
+	}
+	if options.CacheControl != "" {
+		input.CacheControl = aws.String(options.CacheControl)
+	}
+	if len(options.Metadata) > 0 {
+		input.Metadata = options.Metadata
+	}
+	if len(options.Tags) > 0 {
+		input.Tagging = aws.String(encodeS3Tags(options.Tags))
+	}
+	if options.StorageClass != "" {
+		input.StorageClass = types.StorageClass(options.StorageClass)
+	}
+	if options.IfNoneMatch != "" {
+		input.IfNoneMatch = aws.String(options.IfNoneMatch)
+	}
+	if options.IfMatch != "" {
+		input.IfMatch = aws.String(options.IfMatch)
+	}
+}
+
+func (options *S3PutOptions) applyToCreateMultipartUpload(input *s3.CreateMultipartUploadInput) {
+	if options == nil {
+		return
+	}
+
+	if options.ContentType != "" {
+		input.ContentType = aws.String(options.ContentType)
+	}
+	if options.ContentEncoding != "" {
+		input.ContentEncoding = aws.String(options.ContentEncoding)
+	}
+	if options.ContentDisposition != "" {
+		input.ContentDisposition = aws.String(options.ContentDisposition)
+	}
+	if options.CacheControl != "" {
+		input.CacheControl = aws.String(options.CacheControl)
+	}
+	if len(options.Metadata) > 0 {
+		input.Metadata = options.Metadata
+	}
+	if len(options.Tags) > 0 {
+		input.Tagging = aws.String(encodeS3Tags(options.Tags))
+	}
+	if options.StorageClass != "" {
+		input.StorageClass = types.StorageClass(options.StorageClass)
+	}
+}
+
+// applyToCompleteMultipartUpload sets the conditions, which multipart uploads check on completion.
+func (options *S3PutOptions) applyToCompleteMultipartUpload(input *s3.CompleteMultipartUploadInput) {
+	if options == nil {
+		return
+	}
+
+	if options.IfNoneMatch != "" {
+		input.IfNoneMatch = aws.String(options.IfNoneMatch)
+	}
+	if options.IfMatch != "" {
+		input.IfMatch = aws.String(options.IfMatch)
+	}
+}
+
+// PutDataWithOptions uploads data with the metadata, tags and storage class of options.
+// Data from the multipart threshold on is sent with a multipart upload, like compressed data.
+func (s3Helper *S3Helper) PutDataWithOptions(ctx context.Context, itemKey string, data []byte, options *S3PutOptions) (err error) {
+	if int64(len(data)) >= s3Helper.getMultipartThreshold() || s3Helper.putCompression(itemKey, options) != "" {
+		return s3Helper.UploadWithContext(ctx, itemKey, bytes.NewReader(data), &S3UploadOptions{
+			Size:       int64(len(data)),
+			PutOptions: options,
+		})
+	}
+
+	callCtx, cancel := s3Helper.callContext(ctx)
+	defer cancel()
+
+	input := &s3.PutObjectInput{
+		Bucket:      aws.String(s3Helper.bucket),
+		Key:         aws.String(itemKey),
+		Body:        bytes.NewReader(data),
+		ContentType: aws.String(ThcompUtility.GetMIMETypeFromExtension(itemKey)),
+	}
+	options.applyToPutObject(input)
+	s3Helper.putEncryption(options).applyToPutObject(input)
+	_, err = s3Helper.client.PutObject(callCtx, input)
+
+	return wrapS3Condition(itemKey, err)
+}
+
+// PutFileWithOptions uploads the file with the metadata, tags and storage class of options.
+// The content type defaults to the one derived from the file extension.
+func (s3Helper *S3Helper) PutFileWithOptions(ctx context.Context, itemKey string, filepath string, options *S3PutOptions) (err error) {
+	if reader, readErr := os.Open(filepath); readErr == nil {
+		defer reader.Close()
+
+		tempOptions := S3PutOptions{}
+		if options != nil {
+			tempOptions = *options
+		}
+		if tempOptions.ContentType == "" {
+			tempOptions.ContentType = ThcompUtility.GetMIMETypeFromExtension(filepath)
+		}
+
+		if fileInfo, statErr := reader.Stat(); statErr == nil && (fileInfo.Size() >= s3Helper.getMultipartThreshold() || s3Helper.putCompression(itemKey, &tempOptions) != "") {
+			return s3Helper.UploadWithContext(ctx, itemKey, reader, &S3UploadOptions{
+				Size:       fileInfo.Size(),
+				PutOptions: &tempOptions,
+			})
+		}
+
+		callCtx, cancel := s3Helper.callContext(ctx)
+		defer cancel()
+
+		input := &s3.PutObjectInput{
+			Bucket: aws.String(s3Helper.bucket),
+			Key:    aws.String(itemKey),
+			Body:   reader,
+		}
+		tempOptions.applyToPutObject(input)
+		s3Helper.putEncryption(&tempOptions).applyToPutObject(input)
+		_, err = s3Helper.client.PutObject(callCtx, input)
+		err = wrapS3Condition(itemKey, err)
+	} else {
+		err = readErr
+	}
+
+	return
+}
+
+func (s3Helper *S3Helper) GetItemTags(key string) (map[string]string, error) {
+	return s3Helper.GetItemTagsWithContext(context.Background(), key)
+}
+
+func (s3Helper *S3Helper) GetItemTagsWithContext(ctx context.Context, key string) (map[string]string, error) {
+	return s3Helper.getTags(ctx, s3Helper.bucket, key, "")
+}
+
+func (s3Helper *S3Helper) PutItemTags(key string, tags map[string]string) error {
+	return s3Helper.PutItemTagsWithContext(context.Background(), key, tags)
+}
+
+// PutItemTagsWithContext replaces every tag of the object with tags. Empty tags remove them all.
+func (s3Helper *S3Helper) PutItemTagsWithContext(ctx context.Context, key string, tags map[string]string) (err error) {
+	callCtx, cancel := s3Helper.callContext(ctx)
+	defer cancel()
+
+	if len(tags) == 0 {
+		_, err = s3Helper.client.DeleteObjectTagging(callCtx, &s3.DeleteObjectTaggingInput{
+			Bucket: aws.String(s3Helper.bucket),
+			Key:    aws.String(key),
+		})
+		return wrapS3NotFound(key, err)
+	}
+
+	names := []string{}
+	for name := range tags {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	tagSet := []types.Tag{}
+	for _, name := range names {
+		tagSet = append(tagSet, types.Tag{Key: aws.String(name), Value: aws.String(tags[name])})
+	}
+
+	_, err = s3Helper.client.PutObjectTagging(callCtx, &s3.PutObjectTaggingInput{
+		Bucket:  aws.String(s3Helper.bucket),
+		Key:     aws.String(key),
+		Tagging: &types.Tagging{TagSet: tagSet},
+	})
+
+	return wrapS3NotFound(key, err)
+}
+
+func (s3Helper *S3Helper) UpdateItemTags(key string, set map[string]string, remove []string) error {
+	return s3Helper.UpdateItemTagsWithContext(context.Background(), key, set, remove)
+}
+
+// UpdateItemTagsWithContext sets and removes some tags, keeping the others. S3 only replaces the whole
+// tag set, so the tags are read then written back: a concurrent update between both calls is lost.
+func (s3Helper *S3Helper) UpdateItemTagsWithContext(ctx context.Context, key string, set map[string]string, remove []string) (err error) {
+	if tags, getErr := s3Helper.GetItemTagsWithContext(ctx, key); getErr == nil {
+		for name, value := range set {
+			tags[name] = value
+		}
+		for _, name := range remove {
+			delete(tags, name)
+		}
+		err = s3Helper.PutItemTagsWithContext(ctx, key, tags)
+	} else {
+		err = getErr
+	}
+
+	return
+}
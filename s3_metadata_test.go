@@ -0,0 +1,93 @@
+package awssdkhelper
+
+import (
+	"context"
+	"errors"
+	"os"
+	"path/filepath"
+	"testing"
+
+	TestUtility "github.com/thcomp/GoLang_TestUtility"
+)
+
+func Test_S3Helper_PutWithOptionsAndHeadItem(t *testing.T) {
+	tester := TestUtility.NewTestHelper(t)
+	fake := newFakeS3Server(t, "metadata-bucket")
+	helper := fake.helper()
+	ctx := context.Background()
+
+	err := helper.PutDataWithOptions(ctx, "reports/a.json", []byte(`{"a":1}`), &S3PutOptions{
+		CacheControl:    "max-age=300",
+		ContentEncoding: "identity",
+		Metadata:        map[string]string{"owner": "alice"},
+		Tags:            map[string]string{"project": "metadata"},
+		StorageClass:    "STANDARD_IA",
+	})
+	tester.Fatalf(err == nil, "PutDataWithOptions: %v", err)
+	fake.setChecksum("reports/a.json", "SHA256", "c2hhMjU2")
+
+	item, err := helper.HeadItemWithContext(ctx, "reports/a.json")
+	tester.Fatalf(err == nil, "HeadItem: %v", err)
+	tester.Errorf(item.reader == nil, "HeadItem opened the body")
+	size, _ := item.Size()
+	tester.Errorf(size == 7, "size: %d", size)
+
+	attributes, err := item.Attributes()
+	tester.Fatalf(err == nil, "Attributes: %v", err)
+	tester.Errorf(attributes.ContentType == "application/json" && attributes.CacheControl == "max-age=300" && attributes.ContentEncoding == "identity", "attributes: %+v", attributes)
+	tester.Errorf(attributes.StorageClass == "STANDARD_IA" && attributes.Metadata["owner"] == "alice", "attributes: %+v", attributes)
+	tester.Errorf(attributes.Checksums["SHA256"] == "c2hhMjU2" && attributes.ETag == fake.object("reports/a.json").etag, "attributes: %+v", attributes)
+	tester.Errorf(fake.object("reports/a.json").tags.Get("project") == "metadata", "tags: %v", fake.object("reports/a.json").tags)
+
+	data, _ := os.ReadFile("s3_metadata.go")
+	localPath := filepath.Join(t.TempDir(), "source.txt")
+	os.WriteFile(localPath, data, 0o644)
+	err = helper.PutFileWithOptions(ctx, "files/source", localPath, &S3PutOptions{Metadata: map[string]string{"origin": "local"}})
+	tester.Fatalf(err == nil, "PutFileWithOptions: %v", err)
+	fileItem := &S3Item{Path: "files/source", helper: helper}
+	attributes, err = fileItem.Stat()
+	tester.Errorf(err == nil && attributes.ContentType == "text/plain" && attributes.Metadata["origin"] == "local" && attributes.StorageClass == "STANDARD", "Stat: %+v, %v", attributes, err)
+
+	_, err = helper.HeadItemWithContext(ctx, "missing.json")
+	tester.Errorf(errors.Is(err, ErrObjectNotFound), "HeadItem of a missing key: %v", err)
+}
+
+func Test_S3Helper_PutWithOptionsMultipart(t *testing.T) {
+	tester := TestUtility.NewTestHelper(t)
+	fake := newFakeS3Server(t, "metadata-bucket")
+	helper := fake.helper()
+	helper.SetMultipartThreshold(S3MinPartSize)
+
+	err := helper.PutDataWithOptions(context.Background(), "large.bin", testMultipartData(int(s3DefaultPartSize+1)), &S3PutOptions{
+		ContentType:  "application/x-test",
+		Metadata:     map[string]string{"owner": "bob"},
+		Tags:         map[string]string{"size": "large"},
+		StorageClass: "GLACIER_IR",
+	})
+	tester.Fatalf(err == nil, "PutDataWithOptions: %v", err)
+	object := fake.object("large.bin")
+	tester.Fatalf(object != nil && len(object.partSizes) == 2, "multipart object is missing or not multipart")
+	tester.Errorf(object.contentType == "application/x-test" && object.headers.Get("X-Amz-Meta-Owner") == "bob" && object.headers.Get("X-Amz-Storage-Class") == "GLACIER_IR", "object: %s, %v", object.contentType, object.headers)
+	tester.Errorf(object.tags.Get("size") == "large", "tags: %v", object.tags)
+}
+
+func Test_S3Helper_ItemTags(t *testing.T) {
+	tester := TestUtility.NewTestHelper(t)
+	fake := newFakeS3Server(t, "metadata-bucket")
+	helper := fake.helper()
+
+	fake.putObject("tagged.txt", []byte("tagged"))
+	tester.Fatalf(helper.PutItemTags("tagged.txt", map[string]string{"a": "1", "b": "2"}) == nil, "PutItemTags failed")
+	tags, err := helper.GetItemTags("tagged.txt")
+	tester.Errorf(err == nil && len(tags) == 2 && tags["a"] == "1" && tags["b"] == "2", "GetItemTags: %v, %v", tags, err)
+
+	err = helper.UpdateItemTags("tagged.txt", map[string]string{"b": "3", "c": "4"}, []string{"a"})
+	tester.Fatalf(err == nil, "UpdateItemTags: %v", err)
+	tags, _ = helper.GetItemTags("tagged.txt")
+	tester.Errorf(len(tags) == 2 && tags["b"] == "3" && tags["c"] == "4", "updated tags: %v", tags)
+
+	tester.Errorf(helper.PutItemTags("tagged.txt", nil) == nil && len(fake.object("tagged.txt").tags) == 0, "tags not removed: %v", fake.object("tagged.txt").tags)
+
+	_, err = helper.GetItemTags("missing.txt")
+	tester.Errorf(errors.Is(err, ErrObjectNotFound), "GetItemTags of a missing key: %v", err)
+}
@@ -0,0 +1,452 @@
+package awssdkhelper
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"sort"
+	"sync"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/s3"
+	"github.com/aws/aws-sdk-go-v2/service/s3/types"
+
+	ThcompUtility "github.com/thcomp/GoLang_Utility"
+)
+
+const S3MinPartSize int64 = 5 * 1024 * 1024
+const S3MaxParts = 10000
+const s3DefaultPartSize int64 = 8 * 1024 * 1024
+const s3DefaultUploadConcurrency = 4
+const s3DefaultMultipartThreshold int64 = 64 * 1024 * 1024
+
+// S3UploadProgressFunc receives the number of bytes uploaded so far. totalBytes is -1 when the length is unknown.
+type S3UploadProgressFunc func(uploadedBytes, totalBytes int64)
+
+type S3UploadOptions struct {
+	// PartSize is the size of each part. Defaults to 8 MiB, and is raised to 5 MiB (the S3 minimum) if smaller.
+	PartSize int64
+	// Concurrency is the number of parts uploaded in parallel. Defaults to 4.
+	Concurrency int
+	// ContentType defaults to PutOptions.ContentType, then to the type derived from the key's extension.
+	ContentType string
+	// PutOptions sets the metadata, tags and storage class of the object.
+	PutOptions *S3PutOptions
+	// UploadID resumes an upload started earlier with the same PartSize. Parts already uploaded are skipped.
+	UploadID string
+	// OnUploadID is called once the multipart upload exists, so the ID can be persisted for resuming.
+	OnUploadID func(uploadID string)
+	// KeepPartsOnError leaves the upload open on failure instead of aborting it, so it can be resumed.
+	KeepPartsOnError bool
+	// Progress is called after every uploaded part. Calls are never concurrent.
+	Progress S3UploadProgressFunc
+	// Size is the total body length when known; -1 or 0 means unknown.
+	Size int64
+}
+
+// SetMultipartThreshold sets the size from which PutFile and PutData switch to multipart uploads.
+func (s3Helper *S3Helper) SetMultipartThreshold(threshold int64) {
+	s3Helper.multipartThreshold = threshold
+}
+
+func (s3Helper *S3Helper) getMultipartThreshold() int64 {
+	if s3Helper.multipartThreshold > 0 {
+		return s3Helper.multipartThreshold
+	}
+
+	return s3DefaultMultipartThreshold
+}
+
+type s3UploadedPart struct {
+	partNumber int32
+	etag       *string
+	size       int64
+}
+
+type s3MultipartUploader struct {
+	helper   *S3Helper
+	key      string
+	options  S3UploadOptions
+	uploadID string
+
+	mutex sync.Mutex
+	parts map[int32]*s3UploadedPart
+	// lastPart is the last part of the body, uploaded or found already stored. Parts of a resumed upload
+	// beyond it belong to a longer body, and are left out of the completed object.
+	lastPart int32
+	// encryption is PutOptions.Encryption, or the default of the helper
+	encryption *S3Encryption
+	// uncompressedRead counts the body read before compression, when its size is unknown. A body put
+	// with a single PutObject then stores it as the size before compression.
+	uncompressedRead *s3CountingReader
+
+	progressMutex sync.Mutex
+	uploaded      int64
+}
+
+// UploadWithContext uploads body, which may be of unknown length, with a multipart upload.
+// Bodies smaller than one part are sent with a single PutObject. Compressed bodies (see SetCompression)
+// are compressed while uploading, and Progress then counts compressed bytes.
+func (s3Helper *S3Helper) UploadWithContext(ctx context.Context, key string, body io.Reader, options *S3UploadOptions) (err error) {
+	uploader := &s3MultipartUploader{
+		helper: s3Helper,
+		key:    key,
+		parts:  map[int32]*s3UploadedPart{},
+	}
+	if options != nil {
+		uploader.options = *options
+	}
+
+	compression := s3Helper.putCompression(key, uploader.options.PutOptions)
+	if compression != "" {
+		size := int64(-1)
+		if uploader.options.Size > 0 {
+			size = uploader.options.Size
+		}
+		uploader.options.PutOptions = compressedPutOptions(uploader.options.PutOptions, compression, size)
+		if size < 0 {
+			uploader.uncompressedRead = &s3CountingReader{reader: body}
+			body = uploader.uncompressedRead
+		}
+
+		compressed := newS3CompressingReader(body, compression)
+		defer compressed.Close()
+		body = compressed
+	}
+	uploader.normalizeOptions()
+	if compression != "" {
+		// the compressed size is unknown, Size only sized the parts
+		uploader.options.Size = -1
+	}
+
+	return wrapS3Condition(key, uploader.upload(ctx, body))
+}
+
+func (s3Helper *S3Helper) UploadFileWithContext(ctx context.Context, key string, filepath string, options *S3UploadOptions) (err error) {
+	if file, openErr := os.Open(filepath); openErr == nil {
+		defer file.Close()
+
+		tempOptions := S3UploadOptions{}
+		if options != nil {
+			tempOptions = *options
+		}
+		if tempOptions.ContentType == "" && (tempOptions.PutOptions == nil || tempOptions.PutOptions.ContentType == "") {
+			tempOptions.ContentType = ThcompUtility.GetMIMETypeFromExtension(filepath)
+		}
+		if fileInfo, statErr := file.Stat(); statErr == nil {
+			tempOptions.Size = fileInfo.Size()
+		}
+
+		err = s3Helper.UploadWithContext(ctx, key, file, &tempOptions)
+	} else {
+		err = openErr
+	}
+
+	return
+}
+
+func (uploader *s3MultipartUploader) normalizeOptions() {
+	uploader.options.PartSize = s3UploadPartSize(uploader.options.Size, uploader.options.PartSize)
+	if uploader.options.Size <= 0 {
+		uploader.options.Size = -1
+	}
+	if uploader.options.Concurrency <= 0 {
+		uploader.options.Concurrency = s3DefaultUploadConcurrency
+	}
+	uploader.encryption = uploader.helper.putEncryption(uploader.options.PutOptions)
+	if uploader.options.ContentType == "" && uploader.options.PutOptions != nil {
+		uploader.options.ContentType = uploader.options.PutOptions.ContentType
+	}
+	if uploader.options.ContentType == "" {
+		uploader.options.ContentType = ThcompUtility.GetMIMETypeFromExtension(uploader.key)
+	}
+}
+
+// s3UploadPartSize is the part size uploading size bytes (negative when unknown) with partSize.
+func s3UploadPartSize(size int64, partSize int64) int64 {
+	if partSize <= 0 {
+		partSize = s3DefaultPartSize
+	}
+	if partSize < S3MinPartSize {
+		partSize = S3MinPartSize
+	}
+	if size > 0 {
+		// keep the number of parts under the S3 limit
+		for size/partSize >= S3MaxParts {
+			partSize *= 2
+		}
+	}
+
+	return partSize
+}
+
+// reportProgress serializes Progress calls, so callbacks never run concurrently.
+func (uploader *s3MultipartUploader) reportProgress(size int64) {
+	uploader.progressMutex.Lock()
+	defer uploader.progressMutex.Unlock()
+
+	uploader.uploaded += size
+	if uploader.options.Progress != nil {
+		uploader.options.Progress(uploader.uploaded, uploader.options.Size)
+	}
+}
+
+func (uploader *s3MultipartUploader) upload(ctx context.Context, body io.Reader) (err error) {
+	partSize := uploader.options.PartSize
+	firstPart := make([]byte, partSize)
+	firstSize, readErr := io.ReadFull(body, firstPart)
+	if readErr != nil && readErr != io.EOF && readErr != io.ErrUnexpectedEOF {
+		return readErr
+	}
+
+	if uploader.options.UploadID == "" && int64(firstSize) < partSize {
+		return uploader.putSingle(ctx, firstPart[:firstSize])
+	}
+
+	if uploader.options.UploadID == "" {
+		err = uploader.create(ctx)
+	} else {
+		uploader.uploadID = uploader.options.UploadID
+		err = uploader.listUploadedParts(ctx)
+	}
+	if err != nil {
+		return
+	}
+	if uploader.options.OnUploadID != nil {
+		uploader.options.OnUploadID(uploader.uploadID)
+	}
+
+	if err = uploader.uploadParts(ctx, body, firstPart[:firstSize]); err == nil {
+		err = uploader.complete(ctx)
+	}
+
+	if err != nil && !uploader.options.KeepPartsOnError {
+		abortCtx, cancel := uploader.helper.callContext(context.WithoutCancel(ctx))
+		if _, abortErr := uploader.helper.client.AbortMultipartUpload(abortCtx, &s3.AbortMultipartUploadInput{
+			Bucket:   aws.String(uploader.helper.bucket),
+			Key:      aws.String(uploader.key),
+			UploadId: aws.String(uploader.uploadID),
+		}); abortErr != nil {
+			err = errors.Join(err, fmt.Errorf("abort multipart upload %s: %w", uploader.uploadID, abortErr))
+		}
+		cancel()
+	}
+
+	return
+}
+
+func (uploader *s3MultipartUploader) putSingle(ctx context.Context, data []byte) (err error) {
+	callCtx, cancel := uploader.helper.callContext(ctx)
+	defer cancel()
+
+	input := &s3.PutObjectInput{
+		Bucket: aws.String(uploader.helper.bucket),
+		Key:    aws.String(uploader.key),
+		Body:   bytes.NewReader(data),
+	}
+	putOptions := uploader.options.PutOptions
+	if uploader.uncompressedRead != nil {
+		// the compressed body ended within the first part, so the whole body was read
+		putOptions = withS3UncompressedSize(putOptions, uploader.uncompressedRead.count.Load())
+	}
+	putOptions.applyToPutObject(input)
+	uploader.encryption.applyToPutObject(input)
+	input.ContentType = aws.String(uploader.options.ContentType)
+	if _, err = uploader.helper.client.PutObject(callCtx, input); err == nil {
+		uploader.reportProgress(int64(len(data)))
+	}
+
+	return
+}
+
+func (uploader *s3MultipartUploader) create(ctx context.Context) (err error) {
+	callCtx, cancel := uploader.helper.callContext(ctx)
+	defer cancel()
+
+	input := &s3.CreateMultipartUploadInput{
+		Bucket: aws.String(uploader.helper.bucket),
+		Key:    aws.String(uploader.key),
+	}
+	uploader.options.PutOptions.applyToCreateMultipartUpload(input)
+	uploader.encryption.applyToCreateMultipartUpload(input)
+	input.ContentType = aws.String(uploader.options.ContentType)
+	if output, createErr := uploader.helper.client.CreateMultipartUpload(callCtx, input); createErr == nil {
+		uploader.uploadID = aws.ToString(output.UploadId)
+	} else {
+		err = createErr
+	}
+
+	return
+}
+
+func (uploader *s3MultipartUploader) listUploadedParts(ctx context.Context) (err error) {
+	paginator := s3.NewListPartsPaginator(uploader.helper.client, &s3.ListPartsInput{
+		Bucket:   aws.String(uploader.helper.bucket),
+		Key:      aws.String(uploader.key),
+		UploadId: aws.String(uploader.uploadID),
+	})
+
+	for paginator.HasMorePages() {
+		callCtx, cancel := uploader.helper.callContext(ctx)
+		output, listErr := paginator.NextPage(callCtx)
+		cancel()
+		if listErr != nil {
+			return fmt.Errorf("resume multipart upload %s: %w", uploader.uploadID, listErr)
+		}
+
+		for _, part := range output.Parts {
+			partNumber := aws.ToInt32(part.PartNumber)
+			uploader.parts[partNumber] = &s3UploadedPart{
+				partNumber: partNumber,
+				etag:       part.ETag,
+				size:       aws.ToInt64(part.Size),
+			}
+		}
+	}
+
+	return
+}
+
+func (uploader *s3MultipartUploader) uploadParts(ctx context.Context, body io.Reader, firstPart []byte) (err error) {
+	partCtx, cancel := context.WithCancel(ctx)
+	defer cancel()
+
+	semaphore := make(chan struct{}, uploader.options.Concurrency)
+	waitGroup := sync.WaitGroup{}
+	errMutex := sync.Mutex{}
+	setErr := func(partErr error) {
+		errMutex.Lock()
+		if err == nil {
+			err = partErr
+			cancel()
+		}
+		errMutex.Unlock()
+	}
+	getErr := func() error {
+		errMutex.Lock()
+		defer errMutex.Unlock()
+		return err
+	}
+
+	partSize := uploader.options.PartSize
+	data := firstPart
+	for partNumber := int32(1); ; partNumber++ {
+		if partNumber > 1 {
+			data = make([]byte, partSize)
+			readSize, readErr := io.ReadFull(body, data)
+			data = data[:readSize]
+			if readErr != nil && readErr != io.EOF && readErr != io.ErrUnexpectedEOF {
+				setErr(readErr)
+				break
+			}
+		}
+		if len(data) == 0 && partNumber > 1 {
+			break
+		}
+		if partNumber > S3MaxParts {
+			setErr(fmt.Errorf("upload exceeds %d parts of %d bytes", S3MaxParts, partSize))
+			break
+		}
+
+		uploader.mutex.Lock()
+		uploaded, exist := uploader.parts[partNumber]
+		uploader.mutex.Unlock()
+
+		if exist {
+			// resumed: the part is already stored
+			if uploaded.size != int64(len(data)) {
+				setErr(fmt.Errorf("part %d of upload %s has %d bytes, but %d bytes were read: part size must not change on resume", partNumber, uploader.uploadID, uploaded.size, len(data)))
+				break
+			}
+			uploader.reportProgress(uploaded.size)
+		} else {
+			semaphore <- struct{}{}
+			if getErr() != nil {
+				<-semaphore
+				break
+			}
+
+			waitGroup.Add(1)
+			go func(partNumber int32, data []byte) {
+				defer waitGroup.Done()
+				defer func() { <-semaphore }()
+
+				if partErr := uploader.uploadPart(partCtx, partNumber, data); partErr != nil {
+					setErr(fmt.Errorf("upload part %d: %w", partNumber, partErr))
+				}
+			}(partNumber, data)
+		}
+
+		uploader.lastPart = partNumber
+
+		if int64(len(data)) < partSize || getErr() != nil {
+			break
+		}
+	}
+	waitGroup.Wait()
+
+	return
+}
+
+func (uploader *s3MultipartUploader) uploadPart(ctx context.Context, partNumber int32, data []byte) (err error) {
+	callCtx, cancel := uploader.helper.callContext(ctx)
+	defer cancel()
+
+	input := &s3.UploadPartInput{
+		Bucket:        aws.String(uploader.helper.bucket),
+		Key:           aws.String(uploader.key),
+		UploadId:      aws.String(uploader.uploadID),
+		PartNumber:    aws.Int32(partNumber),
+		Body:          bytes.NewReader(data),
+		ContentLength: aws.Int64(int64(len(data))),
+	}
+	uploader.encryption.applyToUploadPart(input)
+	if output, uploadErr := uploader.helper.client.UploadPart(callCtx, input); uploadErr == nil {
+		uploader.mutex.Lock()
+		uploader.parts[partNumber] = &s3UploadedPart{
+			partNumber: partNumber,
+			etag:       output.ETag,
+			size:       int64(len(data)),
+		}
+		uploader.mutex.Unlock()
+		uploader.reportProgress(int64(len(data)))
+	} else {
+		err = uploadErr
+	}
+
+	return
+}
+
+func (uploader *s3MultipartUploader) complete(ctx context.Context) (err error) {
+	completedParts := []types.CompletedPart{}
+	for _, part := range uploader.parts {
+		if part.partNumber > uploader.lastPart {
+			continue
+		}
+		completedParts = append(completedParts, types.CompletedPart{
+			ETag:       part.etag,
+			PartNumber: aws.Int32(part.partNumber),
+		})
+	}
+	sort.Slice(completedParts, func(i, j int) bool {
+		return aws.ToInt32(completedParts[i].PartNumber) < aws.ToInt32(completedParts[j].PartNumber)
+	})
+
+	callCtx, cancel := uploader.helper.callContext(ctx)
+	defer cancel()
+
+	input := &s3.CompleteMultipartUploadInput{
+		Bucket:          aws.String(uploader.helper.bucket),
+		Key:             aws.String(uploader.key),
+		UploadId:        aws.String(uploader.uploadID),
+		MultipartUpload: &types.CompletedMultipartUpload{Parts: completedParts},
+	}
+	uploader.options.PutOptions.applyToCompleteMultipartUpload(input)
+	uploader.encryption.applyToCompleteMultipartUpload(input)
+	_, err = uploader.helper.client.CompleteMultipartUpload(callCtx, input)
+
+	return
+}
@@ -0,0 +1,135 @@
+package awssdkhelper
+
+import (
+	"bytes"
+	"context"
+	"io"
+	"strings"
+	"sync"
+	"testing"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/s3"
+	TestUtility "github.com/thcomp/GoLang_TestUtility"
+)
+
+func testMultipartData(size int) []byte {
+	data := make([]byte, size)
+	for index := range data {
+		data[index] = byte(index % 251)
+	}
+
+	return data
+}
+
+func Test_S3Helper_UploadWithContext(t *testing.T) {
+	tester := TestUtility.NewTestHelper(t)
+	fake := newFakeS3Server(t, "upload-bucket")
+	helper := fake.helper()
+	data := testMultipartData(int(2*S3MinPartSize) + 1024)
+
+	progressMutex := sync.Mutex{}
+	lastUploaded, lastTotal := int64(0), int64(0)
+	err := helper.UploadWithContext(context.Background(), "large.bin", io.MultiReader(bytes.NewReader(data)), &S3UploadOptions{
+		PartSize:    S3MinPartSize,
+		Concurrency: 2,
+		Progress: func(uploadedBytes, totalBytes int64) {
+			progressMutex.Lock()
+			defer progressMutex.Unlock()
+			if uploadedBytes > lastUploaded {
+				lastUploaded = uploadedBytes
+			}
+			lastTotal = totalBytes
+		},
+	})
+	tester.Fatalf(err == nil, "UploadWithContext error: %v", err)
+
+	object := fake.object("large.bin")
+	tester.Fatalf(object != nil, "object is not stored")
+	tester.Errorf(bytes.Equal(object.data, data), "uploaded data differs: %d bytes", len(object.data))
+	tester.Errorf(strings.HasSuffix(object.etag, `-3"`), "object is not assembled from 3 parts: %s", object.etag)
+	tester.Errorf(lastUploaded == int64(len(data)) && lastTotal == -1, "progress: %d / %d", lastUploaded, lastTotal)
+
+	err = helper.UploadWithContext(context.Background(), "small.txt", strings.NewReader("small"), nil)
+	tester.Errorf(err == nil && fake.object("small.txt") != nil && fake.uploadSeq == 1, "small body must use a single PutObject: %v, %d", err, fake.uploadSeq)
+}
+
+func Test_S3Helper_UploadAbortAndResume(t *testing.T) {
+	tester := TestUtility.NewTestHelper(t)
+	fake := newFakeS3Server(t, "upload-bucket")
+	helper := fake.helper()
+	data := testMultipartData(int(2*S3MinPartSize) + 10)
+
+	fake.failParts[2] = true
+	err := helper.UploadWithContext(context.Background(), "aborted.bin", bytes.NewReader(data), &S3UploadOptions{PartSize: S3MinPartSize})
+	tester.Errorf(err != nil, "failed part must fail the upload")
+	tester.Errorf(len(fake.aborted) == 1 && len(fake.uploads) == 0, "upload is not aborted: %v", fake.aborted)
+
+	uploadID := ""
+	err = helper.UploadWithContext(context.Background(), "resumed.bin", bytes.NewReader(data), &S3UploadOptions{
+		PartSize:         S3MinPartSize,
+		Concurrency:      1,
+		KeepPartsOnError: true,
+		OnUploadID:       func(id string) { uploadID = id },
+	})
+	tester.Fatalf(err != nil && uploadID != "", "first attempt: %v, %s", err, uploadID)
+	tester.Errorf(len(fake.uploads) == 1 && len(fake.aborted) == 1, "upload is not kept for resume")
+
+	delete(fake.failParts, 2)
+	uploaded := int64(0)
+	err = helper.UploadWithContext(context.Background(), "resumed.bin", bytes.NewReader(data), &S3UploadOptions{
+		PartSize: S3MinPartSize,
+		UploadID: uploadID,
+		Progress: func(uploadedBytes, totalBytes int64) { uploaded = uploadedBytes },
+	})
+	tester.Fatalf(err == nil, "resume error: %v", err)
+	object := fake.object("resumed.bin")
+	tester.Errorf(object != nil && bytes.Equal(object.data, data), "resumed object differs")
+	tester.Errorf(uploaded == int64(len(data)), "resumed progress: %d", uploaded)
+
+	err = helper.UploadWithContext(context.Background(), "resumed.bin", bytes.NewReader(data), &S3UploadOptions{UploadID: "unknown"})
+	tester.Errorf(err != nil, "unknown upload id must fail")
+}
+
+func Test_S3Helper_ResumeShorterBody(t *testing.T) {
+	tester := TestUtility.NewTestHelper(t)
+	fake := newFakeS3Server(t, "upload-bucket")
+	helper := fake.helper()
+	ctx := context.Background()
+	data := testMultipartData(int(3 * S3MinPartSize))
+
+	// an earlier attempt stored the 3 parts of a longer body
+	created, err := fake.client().CreateMultipartUpload(ctx, &s3.CreateMultipartUploadInput{Bucket: aws.String(fake.bucket), Key: aws.String("shorter.bin")})
+	tester.Fatalf(err == nil, "CreateMultipartUpload: %v", err)
+	for partNumber := int32(1); partNumber <= 3; partNumber++ {
+		_, err = fake.client().UploadPart(ctx, &s3.UploadPartInput{
+			Bucket:     aws.String(fake.bucket),
+			Key:        aws.String("shorter.bin"),
+			UploadId:   created.UploadId,
+			PartNumber: aws.Int32(partNumber),
+			Body:       bytes.NewReader(data[int64(partNumber-1)*S3MinPartSize : int64(partNumber)*S3MinPartSize]),
+		})
+		tester.Fatalf(err == nil, "UploadPart %d: %v", partNumber, err)
+	}
+
+	err = helper.UploadWithContext(ctx, "shorter.bin", bytes.NewReader(data[:2*S3MinPartSize]), &S3UploadOptions{
+		PartSize: S3MinPartSize,
+		UploadID: aws.ToString(created.UploadId),
+	})
+	tester.Fatalf(err == nil, "resume error: %v", err)
+	object := fake.object("shorter.bin")
+	tester.Errorf(object != nil && bytes.Equal(object.data, data[:2*S3MinPartSize]), "stale trailing part is completed: %d bytes", len(object.data))
+}
+
+func Test_S3Helper_PutDataMultipartThreshold(t *testing.T) {
+	tester := TestUtility.NewTestHelper(t)
+	fake := newFakeS3Server(t, "upload-bucket")
+	helper := fake.helper()
+	helper.SetMultipartThreshold(S3MinPartSize)
+
+	data := testMultipartData(int(s3DefaultPartSize) + 1)
+	err := helper.PutData("threshold.bin", data)
+	tester.Fatalf(err == nil, "PutData error: %v", err)
+	object := fake.object("threshold.bin")
+	tester.Errorf(object != nil && bytes.Equal(object.data, data) && strings.HasSuffix(object.etag, `-2"`), "PutData above threshold is not multipart")
+}
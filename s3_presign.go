@@ -0,0 +1,321 @@
+package awssdkhelper
+
+import (
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/s3"
+	"github.com/aws/smithy-go/middleware"
+	smithyhttp "github.com/aws/smithy-go/transport/http"
+)
+
+const s3DefaultPresignExpires = 15 * time.Minute
+
+// S3MaxPresignExpires is the longest expiry accepted by Signature Version 4.
+const S3MaxPresignExpires = 7 * 24 * time.Hour
+
+type S3PresignOptions struct {
+	// Expires defaults to 15 minutes. At most S3MaxPresignExpires.
+	Expires time.Duration
+	// ContentType forces the Content-Type of the response for GET, and the Content-Type the uploader must send for PUT.
+	ContentType string
+	// ContentDisposition forces the Content-Disposition of the response for GET, and is stored with the object for PUT.
+	ContentDisposition string
+	// ChecksumSHA256 (base64) is the SHA-256 of the body the uploader must send for PUT.
+	ChecksumSHA256 string
+}
+
+type S3PresignedRequest struct {
+	URL    string
+	Method string
+	// Header holds the signed headers the client must send as is.
+	Header  http.Header
+	Expires time.Time
+}
+
+func normalizePresignExpires(expires time.Duration) (time.Duration, error) {
+	if expires <= 0 {
+		expires = s3DefaultPresignExpires
+	} else if expires > S3MaxPresignExpires {
+		return 0, fmt.Errorf("presign expiry %v exceeds %v", expires, S3MaxPresignExpires)
+	}
+
+	return expires, nil
+}
+
+// PresignGetItem returns a URL downloading key without credentials. It is signed locally without calling AWS.
+func (s3Helper *S3Helper) PresignGetItem(ctx context.Context, key string, options *S3PresignOptions) (ret *S3PresignedRequest, err error) {
+	if options == nil {
+		options = &S3PresignOptions{}
+	}
+
+	expires, expiresErr := normalizePresignExpires(options.Expires)
+	if expiresErr != nil {
+		return nil, expiresErr
+	}
+
+	input := &s3.GetObjectInput{
+		Bucket: aws.String(s3Helper.bucket),
+		Key:    aws.String(key),
+	}
+	if options.ContentType != "" {
+		input.ResponseContentType = aws.String(options.ContentType)
+	}
+	if options.ContentDisposition != "" {
+		input.ResponseContentDisposition = aws.String(options.ContentDisposition)
+	}
+
+	signedAt := time.Now()
+	if request, presignErr := s3.NewPresignClient(s3Helper.client).PresignGetObject(ctx, input, s3.WithPresignExpires(expires)); presignErr == nil {
+		ret = newS3PresignedRequest(request.URL, request.Method, request.SignedHeader, signedAt.Add(expires))
+	} else {
+		err = presignErr
+	}
+
+	return
+}
+
+// PresignPutItem returns a URL uploading key without credentials. The uploader must send the returned headers,
+// so a forced content type or checksum cannot be changed. It is signed locally without calling AWS.
+func (s3Helper *S3Helper) PresignPutItem(ctx context.Context, key string, options *S3PresignOptions) (ret *S3PresignedRequest, err error) {
+	if options == nil {
+		options = &S3PresignOptions{}
+	}
+
+	expires, expiresErr := normalizePresignExpires(options.Expires)
+	if expiresErr != nil {
+		return nil, expiresErr
+	}
+
+	input := &s3.PutObjectInput{
+		Bucket: aws.String(s3Helper.bucket),
+		Key:    aws.String(key),
+	}
+	presignOptions := []func(*s3.PresignOptions){s3.WithPresignExpires(expires)}
+	if options.ContentType != "" {
+		input.ContentType = aws.String(options.ContentType)
+		presignOptions = append(presignOptions, withPresignHeader("Content-Type", options.ContentType))
+	}
+	if options.ContentDisposition != "" {
+		input.ContentDisposition = aws.String(options.ContentDisposition)
+	}
+	if options.ChecksumSHA256 != "" {
+		input.ChecksumSHA256 = aws.String(options.ChecksumSHA256)
+	}
+
+	signedAt := time.Now()
+	if request, presignErr := s3.NewPresignClient(s3Helper.client).PresignPutObject(ctx, input, presignOptions...); presignErr == nil {
+		ret = newS3PresignedRequest(request.URL, request.Method, request.SignedHeader, signedAt.Add(expires))
+	} else {
+		err = presignErr
+	}
+
+	return
+}
+
+// withPresignHeader signs header even without a body. The SDK drops Content-Type from bodiless requests,
+// which would let the uploader choose any content type.
+func withPresignHeader(name, value string) func(*s3.PresignOptions) {
+	return s3.WithPresignClientFromClientOptions(func(options *s3.Options) {
+		options.APIOptions = append(options.APIOptions, func(stack *middleware.Stack) error {
+			return stack.Build.Add(middleware.BuildMiddlewareFunc("PresignHeader"+name, func(
+				ctx context.Context, input middleware.BuildInput, next middleware.BuildHandler,
+			) (middleware.BuildOutput, middleware.Metadata, error) {
+				if request, ok := input.Request.(*smithyhttp.Request); ok {
+					request.Header.Set(name, value)
+				}
+				return next.HandleBuild(ctx, input)
+			}), middleware.After)
+		})
+	})
+}
+
+func newS3PresignedRequest(url, method string, signedHeader http.Header, expires time.Time) *S3PresignedRequest {
+	header := http.Header{}
+	for name, values := range signedHeader {
+		// set by the HTTP client from the URL, and not settable in browsers
+		if !strings.EqualFold(name, "Host") {
+			header[name] = values
+		}
+	}
+
+	return &S3PresignedRequest{
+		URL:     url,
+		Method:  method,
+		Header:  header,
+		Expires: expires,
+	}
+}
+
+type S3PostPolicyOptions struct {
+	// Expires defaults to 15 minutes. At most S3MaxPresignExpires.
+	Expires time.Duration
+	// Key is the exact key, and may contain ${filename}. Without Key, the browser chooses a key under KeyPrefix.
+	Key string
+	// KeyPrefix restricts the key to start with the prefix. The key field defaults to KeyPrefix + "${filename}".
+	KeyPrefix string
+	// MinSize and MaxSize restrict the file size when MaxSize > 0.
+	MinSize int64
+	MaxSize int64
+	// ContentType requires the exact Content-Type field. ContentTypePrefix requires a prefix such as "image/".
+	ContentType       string
+	ContentTypePrefix string
+	// Fields are additional form fields with exact conditions, e.g. "success_action_status" or "x-amz-meta-owner".
+	Fields map[string]string
+}
+
+// S3PostPolicy is a browser upload form. Fields are sent as form fields before the "file" field.
+type S3PostPolicy struct {
+	URL     string
+	Fields  map[string]string
+	Expires time.Time
+}
+
+// PresignPostPolicy returns the URL and fields of an HTML form (multipart/form-data POST) uploading
+// directly to the bucket under the policy conditions. It is signed locally without calling AWS.
+func (s3Helper *S3Helper) PresignPostPolicy(ctx context.Context, options *S3PostPolicyOptions) (ret *S3PostPolicy, err error) {
+	if options == nil {
+		options = &S3PostPolicyOptions{}
+	}
+
+	expires, expiresErr := normalizePresignExpires(options.Expires)
+	if expiresErr != nil {
+		return nil, expiresErr
+	}
+	if options.Key != "" && options.KeyPrefix != "" && !strings.HasPrefix(options.Key, options.KeyPrefix) {
+		return nil, fmt.Errorf("key %s is not under prefix %s", options.Key, options.KeyPrefix)
+	}
+	if options.MaxSize > 0 && options.MinSize > options.MaxSize {
+		return nil, fmt.Errorf("min size %d exceeds max size %d", options.MinSize, options.MaxSize)
+	}
+
+	clientOptions := s3Helper.client.Options()
+	if clientOptions.Credentials == nil {
+		return nil, fmt.Errorf("no credentials to sign the POST policy")
+	}
+	credentials, credentialsErr := clientOptions.Credentials.Retrieve(ctx)
+	if credentialsErr != nil {
+		return nil, credentialsErr
+	}
+
+	url, urlErr := s3Helper.bucketURL(ctx)
+	if urlErr != nil {
+		return nil, urlErr
+	}
+
+	now := time.Now().UTC()
+	date := now.Format("20060102")
+	credentialScope := strings.Join([]string{date, clientOptions.Region, "s3", "aws4_request"}, "/")
+
+	fields := map[string]string{}
+	for name, value := range options.Fields {
+		fields[name] = value
+	}
+	fields["key"] = options.Key
+	if fields["key"] == "" {
+		fields["key"] = options.KeyPrefix + "${filename}"
+	}
+	if options.ContentType != "" {
+		fields["Content-Type"] = options.ContentType
+	}
+	fields["x-amz-algorithm"] = "AWS4-HMAC-SHA256"
+	fields["x-amz-credential"] = credentials.AccessKeyID + "/" + credentialScope
+	fields["x-amz-date"] = now.Format("20060102T150405Z")
+	if credentials.SessionToken != "" {
+		fields["x-amz-security-token"] = credentials.SessionToken
+	}
+
+	conditions := []interface{}{
+		map[string]string{"bucket": s3Helper.bucket},
+	}
+	if index := strings.Index(options.Key, "${filename}"); options.Key != "" && index < 0 {
+		conditions = append(conditions, map[string]string{"key": options.Key})
+	} else if index > len(options.KeyPrefix) {
+		// S3 replaces ${filename}, so only the part before it is fixed
+		conditions = append(conditions, []interface{}{"starts-with", "$key", options.Key[:index]})
+	} else {
+		conditions = append(conditions, []interface{}{"starts-with", "$key", options.KeyPrefix})
+	}
+	if options.MaxSize > 0 {
+		conditions = append(conditions, []interface{}{"content-length-range", options.MinSize, options.MaxSize})
+	}
+	if options.ContentType == "" && options.ContentTypePrefix != "" {
+		conditions = append(conditions, []interface{}{"starts-with", "$Content-Type", options.ContentTypePrefix})
+	}
+	names := []string{}
+	for name := range fields {
+		if name != "key" {
+			names = append(names, name)
+		}
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		conditions = append(conditions, map[string]string{name: fields[name]})
+	}
+
+	policy, marshalErr := json.Marshal(map[string]interface{}{
+		"expiration": now.Add(expires).Format("2006-01-02T15:04:05.000Z"),
+		"conditions": conditions,
+	})
+	if marshalErr != nil {
+		return nil, marshalErr
+	}
+	fields["policy"] = base64.StdEncoding.EncodeToString(policy)
+	fields["x-amz-signature"] = hex.EncodeToString(hmacSHA256(
+		s3SigningKey(credentials.SecretAccessKey, date, clientOptions.Region, "s3"),
+		fields["policy"],
+	))
+
+	ret = &S3PostPolicy{
+		URL:     url,
+		Fields:  fields,
+		Expires: now.Add(expires),
+	}
+
+	return
+}
+
+// bucketURL resolves the bucket endpoint (custom endpoint, path style, FIPS, ...) the same way the SDK does.
+func (s3Helper *S3Helper) bucketURL(ctx context.Context) (ret string, err error) {
+	const probeKey = "post-policy-probe"
+
+	if request, presignErr := s3.NewPresignClient(s3Helper.client).PresignPutObject(ctx, &s3.PutObjectInput{
+		Bucket: aws.String(s3Helper.bucket),
+		Key:    aws.String(probeKey),
+	}); presignErr == nil {
+		ret = request.URL
+		if index := strings.Index(ret, "?"); index >= 0 {
+			ret = ret[:index]
+		}
+		ret = strings.TrimSuffix(ret, "/"+probeKey)
+	} else {
+		err = presignErr
+	}
+
+	return
+}
+
+func hmacSHA256(key []byte, data string) []byte {
+	mac := hmac.New(sha256.New, key)
+	mac.Write([]byte(data))
+
+	return mac.Sum(nil)
+}
+
+func s3SigningKey(secretAccessKey, date, region, service string) []byte {
+	key := hmacSHA256([]byte("AWS4"+secretAccessKey), date)
+	key = hmacSHA256(key, region)
+	key = hmacSHA256(key, service)
+
+	return hmacSHA256(key, "aws4_request")
+}
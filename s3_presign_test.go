@@ -0,0 +1,139 @@
+package awssdkhelper
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/url"
+	"strings"
+	"testing"
+	"time"
+
+	TestUtility "github.com/thcomp/GoLang_TestUtility"
+)
+
+func Test_S3Helper_PresignGetAndPut(t *testing.T) {
+	tester := TestUtility.NewTestHelper(t)
+	fake := newFakeS3Server(t, "presign-bucket")
+	helper := fake.helper()
+	ctx := context.Background()
+
+	data := []byte("presigned content")
+	sum := sha256.Sum256(data)
+	checksum := base64.StdEncoding.EncodeToString(sum[:])
+
+	put, err := helper.PresignPutItem(ctx, "uploads/a.txt", &S3PresignOptions{
+		Expires:        time.Hour,
+		ContentType:    "text/plain",
+		ChecksumSHA256: checksum,
+	})
+	tester.Fatalf(err == nil, "PresignPutItem: %v", err)
+	tester.Errorf(put.Method == http.MethodPut && strings.Contains(put.URL, "X-Amz-Expires=3600"), "presigned PUT: %v", put)
+	tester.Errorf(put.Header.Get("Content-Type") == "text/plain" && put.Header.Get("Host") == "", "signed headers: %v", put.Header)
+	putURL, _ := url.Parse(put.URL)
+	tester.Errorf(putURL.Query().Get("X-Amz-Checksum-Sha256") == checksum && strings.Contains(putURL.Query().Get("X-Amz-SignedHeaders"), "content-type"), "presigned PUT URL: %s", put.URL)
+	tester.Errorf(time.Until(put.Expires) > 59*time.Minute, "expires: %v", put.Expires)
+
+	request, _ := http.NewRequest(put.Method, put.URL, bytes.NewReader(data))
+	request.Header = put.Header.Clone()
+	response, err := fake.server.Client().Do(request)
+	tester.Fatalf(err == nil && response.StatusCode == http.StatusOK, "PUT with presigned URL: %v, %v", response, err)
+	response.Body.Close()
+	object := fake.object("uploads/a.txt")
+	tester.Errorf(object != nil && bytes.Equal(object.data, data) && object.contentType == "text/plain", "uploaded object: %v", object)
+
+	get, err := helper.PresignGetItem(ctx, "uploads/a.txt", &S3PresignOptions{ContentDisposition: `attachment; filename="a.txt"`})
+	tester.Fatalf(err == nil, "PresignGetItem: %v", err)
+	parsed, _ := url.Parse(get.URL)
+	tester.Errorf(parsed.Query().Get("response-content-disposition") == `attachment; filename="a.txt"` && parsed.Query().Get("X-Amz-Expires") == "900", "presigned GET: %s", get.URL)
+
+	response, err = fake.server.Client().Get(get.URL)
+	tester.Fatalf(err == nil, "GET with presigned URL: %v", err)
+	body, _ := io.ReadAll(response.Body)
+	response.Body.Close()
+	tester.Errorf(bytes.Equal(body, data), "downloaded: %s", body)
+
+	_, err = helper.PresignGetItem(ctx, "a.txt", &S3PresignOptions{Expires: S3MaxPresignExpires + time.Second})
+	tester.Errorf(err != nil, "an expiry over 7 days is accepted")
+}
+
+func Test_S3Helper_PresignOffline(t *testing.T) {
+	tester := TestUtility.NewTestHelper(t)
+
+	helper := NewS3Helper("AKIDEXAMPLE", "SECRET", "ap-northeast-1", "offline-bucket", nil)
+	get, err := helper.PresignGetItem(context.Background(), "dir/file name.txt", nil)
+	tester.Fatalf(err == nil, "PresignGetItem: %v", err)
+	tester.Errorf(strings.HasPrefix(get.URL, "https://offline-bucket.s3.ap-northeast-1.amazonaws.com/dir/file%20name.txt?"), "URL: %s", get.URL)
+	tester.Errorf(strings.Contains(get.URL, "X-Amz-Credential=AKIDEXAMPLE%2F"), "URL: %s", get.URL)
+
+	policy, err := helper.PresignPostPolicy(context.Background(), &S3PostPolicyOptions{KeyPrefix: "uploads/"})
+	tester.Fatalf(err == nil, "PresignPostPolicy: %v", err)
+	tester.Errorf(policy.URL == "https://offline-bucket.s3.ap-northeast-1.amazonaws.com", "POST URL: %s", policy.URL)
+}
+
+func Test_S3Helper_PresignPostPolicy(t *testing.T) {
+	tester := TestUtility.NewTestHelper(t)
+	fake := newFakeS3Server(t, "presign-bucket")
+	helper := fake.helper()
+
+	policy, err := helper.PresignPostPolicy(context.Background(), &S3PostPolicyOptions{
+		Expires:           30 * time.Minute,
+		KeyPrefix:         "uploads/user-1/",
+		MinSize:           1,
+		MaxSize:           1024,
+		ContentTypePrefix: "image/",
+		Fields:            map[string]string{"success_action_status": "201"},
+	})
+	tester.Fatalf(err == nil, "PresignPostPolicy: %v", err)
+	tester.Errorf(policy.URL == fake.server.URL+"/presign-bucket", "URL: %s", policy.URL)
+	tester.Errorf(policy.Fields["key"] == "uploads/user-1/${filename}" && policy.Fields["success_action_status"] == "201", "fields: %v", policy.Fields)
+	tester.Errorf(strings.HasPrefix(policy.Fields["x-amz-credential"], "AKIDEXAMPLE/") && strings.HasSuffix(policy.Fields["x-amz-credential"], "/us-east-1/s3/aws4_request"), "credential: %s", policy.Fields["x-amz-credential"])
+
+	decoded, _ := base64.StdEncoding.DecodeString(policy.Fields["policy"])
+	document := struct {
+		Expiration string            `json:"expiration"`
+		Conditions []json.RawMessage `json:"conditions"`
+	}{}
+	tester.Fatalf(json.Unmarshal(decoded, &document) == nil, "policy: %s", decoded)
+	expiration, _ := time.Parse(time.RFC3339, document.Expiration)
+	tester.Errorf(time.Until(expiration) > 29*time.Minute && time.Until(expiration) <= 30*time.Minute, "expiration: %s", document.Expiration)
+
+	conditions := []string{}
+	for _, condition := range document.Conditions {
+		conditions = append(conditions, string(condition))
+	}
+	joined := strings.Join(conditions, "\n")
+	for _, expected := range []string{
+		`{"bucket":"presign-bucket"}`,
+		`["starts-with","$key","uploads/user-1/"]`,
+		`["content-length-range",1,1024]`,
+		`["starts-with","$Content-Type","image/"]`,
+		`{"success_action_status":"201"}`,
+		`{"x-amz-algorithm":"AWS4-HMAC-SHA256"}`,
+	} {
+		tester.Errorf(strings.Contains(joined, expected), "condition %s is missing in %s", expected, joined)
+	}
+
+	// recompute the Signature Version 4 signature of the policy
+	date := policy.Fields["x-amz-date"][:8]
+	key := []byte("AWS4SECRET")
+	for _, data := range []string{date, "us-east-1", "s3", "aws4_request", policy.Fields["policy"]} {
+		key = hmacSHA256(key, data)
+	}
+	tester.Errorf(policy.Fields["x-amz-signature"] == hex.EncodeToString(key), "signature: %s", policy.Fields["x-amz-signature"])
+
+	exact, err := helper.PresignPostPolicy(context.Background(), &S3PostPolicyOptions{Key: "uploads/fixed.png", ContentType: "image/png"})
+	tester.Fatalf(err == nil, "PresignPostPolicy with a key: %v", err)
+	decoded, _ = base64.StdEncoding.DecodeString(exact.Fields["policy"])
+	tester.Errorf(strings.Contains(string(decoded), `{"key":"uploads/fixed.png"}`) && strings.Contains(string(decoded), `{"Content-Type":"image/png"}`), "policy: %s", decoded)
+
+	_, err = helper.PresignPostPolicy(context.Background(), &S3PostPolicyOptions{Key: "other/a.png", KeyPrefix: "uploads/"})
+	tester.Errorf(err != nil, "a key outside the prefix is accepted")
+	_, err = helper.PresignPostPolicy(context.Background(), &S3PostPolicyOptions{MinSize: 10, MaxSize: 5})
+	tester.Errorf(err != nil, "an empty size range is accepted")
+}
@@ -0,0 +1,426 @@
+package awssdkhelper
+
+import (
+	"bufio"
+	"context"
+	"encoding/binary"
+	"encoding/csv"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"iter"
+	"sync"
+)
+
+// errS3UploadAborted fails the upload of an aborted S3UploadWriter.
+var errS3UploadAborted = errors.New("s3 upload aborted")
+
+const s3WriterBufferSize = 64 * 1024
+
+// s3DefaultMaxRecordSize bounds length-prefixed records, so a corrupt length does not allocate gigabytes.
+const s3DefaultMaxRecordSize = 64 * 1024 * 1024
+
+type S3ReaderOptions struct {
+	// Compression of the content. Defaults to the Content-Encoding when loaded (e.g. by GetItem),
+	// then to the key extension (.gz, .zst), then to the magic number of gzip or zstd.
+	// S3CompressionNone reads the content as is.
+	Compression S3Compression
+	// Comma is the CSV field separator. Defaults to ','.
+	Comma rune
+	// Comment starts CSV lines to skip, when not 0.
+	Comment rune
+	// SkipHeader drops the first CSV record.
+	SkipHeader bool
+	// LazyQuotes accepts quotes in unquoted CSV fields.
+	LazyQuotes bool
+	// MaxRecordSize limits the length of length-prefixed records. Defaults to 64 MiB.
+	MaxRecordSize int
+}
+
+type S3WriterOptions struct {
+	// Compression of the content. Defaults to the compression named by the key extension (.gz, .zst), otherwise
+	// to the one set by SetCompression. Content-Encoding is set unless the extension already names the compression.
+	Compression S3Compression
+	// Comma is the CSV field separator. Defaults to ','.
+	Comma rune
+	// UploadOptions sets the part size, concurrency, metadata and tags of the multipart upload.
+	UploadOptions *S3UploadOptions
+}
+
+// openS3Records returns the decompressed content of item from the current offset.
+func openS3Records(item *S3Item, options *S3ReaderOptions) (io.ReadCloser, error) {
+	reader := bufio.NewReaderSize(item, s3WriterBufferSize)
+	compression := S3Compression("")
+	if options != nil {
+		compression = options.Compression
+	}
+	if compression == "" {
+		compression = detectS3Compression(item, reader)
+	}
+
+	return newS3Decompressor(reader, compression)
+}
+
+// ReadCSVRecords iterates the CSV records of item, decoded while the body is streamed, so objects of any size
+// are read in constant memory. A failure is yielded once, and ends the iteration. The item is not closed.
+func ReadCSVRecords(item *S3Item, options *S3ReaderOptions) iter.Seq2[[]string, error] {
+	return func(yield func([]string, error) bool) {
+		reader, err := openS3Records(item, options)
+		if err != nil {
+			yield(nil, fmt.Errorf("%s: %w", item.Path, err))
+			return
+		}
+		defer reader.Close()
+
+		csvReader := csv.NewReader(reader)
+		if options != nil {
+			if options.Comma != 0 {
+				csvReader.Comma = options.Comma
+			}
+			csvReader.Comment = options.Comment
+			csvReader.LazyQuotes = options.LazyQuotes
+		}
+		for first := true; ; first = false {
+			record, readErr := csvReader.Read()
+			if readErr == io.EOF {
+				return
+			} else if readErr != nil {
+				yield(nil, fmt.Errorf("%s: %w", item.Path, readErr))
+				return
+			}
+
+			if first && options != nil && options.SkipHeader {
+				continue
+			}
+			if !yield(record, nil) {
+				return
+			}
+		}
+	}
+}
+
+// ReadJSONLRecords iterates the JSON Lines records of item, each line decoded into a T. Blank lines are skipped.
+// A failure is yielded once, with the line number, and ends the iteration. The item is not closed.
+func ReadJSONLRecords[T any](item *S3Item, options *S3ReaderOptions) iter.Seq2[T, error] {
+	return func(yield func(T, error) bool) {
+		var zero T
+
+		reader, err := openS3Records(item, options)
+		if err != nil {
+			yield(zero, fmt.Errorf("%s: %w", item.Path, err))
+			return
+		}
+		defer reader.Close()
+
+		lineReader := bufio.NewReaderSize(reader, s3WriterBufferSize)
+		for lineNumber := 1; ; lineNumber++ {
+			line, readErr := lineReader.ReadBytes('\n')
+			if readErr != nil && readErr != io.EOF {
+				yield(zero, fmt.Errorf("%s: line %d: %w", item.Path, lineNumber, readErr))
+				return
+			}
+
+			if len(trimJSONLine(line)) > 0 {
+				record := zero
+				if decodeErr := json.Unmarshal(line, &record); decodeErr != nil {
+					yield(zero, fmt.Errorf("%s: line %d: %w", item.Path, lineNumber, decodeErr))
+					return
+				}
+				if !yield(record, nil) {
+					return
+				}
+			}
+			if readErr == io.EOF {
+				return
+			}
+		}
+	}
+}
+
+// ReadLengthPrefixedRecords iterates binary records, each one prefixed by its length as an unsigned varint:
+// the length-delimited framing of protobuf (e.g. writeDelimitedTo), also used for Avro or Arrow IPC payloads.
+// A failure, including content ending inside a record, is yielded once and ends the iteration. The item is not closed.
+func ReadLengthPrefixedRecords(item *S3Item, options *S3ReaderOptions) iter.Seq2[[]byte, error] {
+	return func(yield func([]byte, error) bool) {
+		reader, err := openS3Records(item, options)
+		if err != nil {
+			yield(nil, fmt.Errorf("%s: %w", item.Path, err))
+			return
+		}
+		defer reader.Close()
+
+		maxRecordSize := uint64(s3DefaultMaxRecordSize)
+		if options != nil && options.MaxRecordSize > 0 {
+			maxRecordSize = uint64(options.MaxRecordSize)
+		}
+		recordReader := bufio.NewReaderSize(reader, s3WriterBufferSize)
+		for recordNumber := 1; ; recordNumber++ {
+			length, readErr := binary.ReadUvarint(recordReader)
+			if readErr == io.EOF {
+				return
+			} else if readErr != nil {
+				yield(nil, fmt.Errorf("%s: record %d: %w", item.Path, recordNumber, readErr))
+				return
+			} else if length > maxRecordSize {
+				yield(nil, fmt.Errorf("%s: record %d: length %d exceeds %d", item.Path, recordNumber, length, maxRecordSize))
+				return
+			}
+
+			record := make([]byte, length)
+			if _, readErr = io.ReadFull(recordReader, record); readErr != nil {
+				if readErr == io.EOF {
+					readErr = io.ErrUnexpectedEOF
+				}
+				yield(nil, fmt.Errorf("%s: record %d: %w", item.Path, recordNumber, readErr))
+				return
+			}
+			if !yield(record, nil) {
+				return
+			}
+		}
+	}
+}
+
+func trimJSONLine(line []byte) []byte {
+	for len(line) > 0 && (line[len(line)-1] == '\n' || line[len(line)-1] == '\r' || line[len(line)-1] == ' ' || line[len(line)-1] == '\t') {
+		line = line[:len(line)-1]
+	}
+
+	return line
+}
+
+// S3UploadWriter streams what is written into a multipart upload, compressed on the fly, so content larger
+// than memory can be produced. Parts are uploaded while writing; Close completes the upload, and Abort
+// (or any failure) aborts it, so nothing is stored.
+type S3UploadWriter struct {
+	pipe       *io.PipeWriter
+	buffer     *bufio.Writer
+	compressor io.WriteCloser
+
+	done      chan struct{}
+	uploadErr error
+	closeOnce sync.Once
+	closeErr  error
+}
+
+// NewUploadWriter starts the upload of key. Write errors report a failed upload, and Close must be called
+// to complete it.
+func (s3Helper *S3Helper) NewUploadWriter(ctx context.Context, key string, options *S3WriterOptions) (writer *S3UploadWriter, err error) {
+	normalized := S3WriterOptions{}
+	if options != nil {
+		normalized = *options
+	}
+	uploadOptions := S3UploadOptions{}
+	if normalized.UploadOptions != nil {
+		uploadOptions = *normalized.UploadOptions
+	}
+	uploadOptions.Size = 0
+
+	compression := normalized.Compression
+	if compression == "" {
+		compression = s3CompressionOfKey(key)
+	}
+	if compression != "" {
+		putOptions := S3PutOptions{}
+		if uploadOptions.PutOptions != nil {
+			putOptions = *uploadOptions.PutOptions
+		}
+		// the writer compresses the content itself
+		putOptions.Compression = S3CompressionNone
+		if compression != S3CompressionNone && s3CompressionOfKey(key) != compression {
+			putOptions.ContentEncoding = string(compression)
+		}
+		uploadOptions.PutOptions = &putOptions
+	}
+
+	pipeReader, pipeWriter := io.Pipe()
+	writer = &S3UploadWriter{
+		pipe:   pipeWriter,
+		buffer: bufio.NewWriterSize(pipeWriter, s3WriterBufferSize),
+		done:   make(chan struct{}),
+	}
+	if writer.compressor, err = newS3Compressor(writer.buffer, compression); err != nil {
+		return nil, err
+	}
+
+	go func() {
+		defer close(writer.done)
+
+		writer.uploadErr = s3Helper.UploadWithContext(ctx, key, pipeReader, &uploadOptions)
+		// unblocks and fails the writes once the upload failed
+		pipeReader.CloseWithError(writer.uploadErr)
+	}()
+
+	return
+}
+
+func (writer *S3UploadWriter) Write(data []byte) (int, error) {
+	return writer.compressor.Write(data)
+}
+
+// Close flushes the content and completes the upload, returning its failure.
+func (writer *S3UploadWriter) Close() error {
+	writer.closeOnce.Do(func() {
+		err := writer.compressor.Close()
+		if err == nil {
+			err = writer.buffer.Flush()
+		}
+		if err == nil {
+			writer.pipe.Close()
+		} else {
+			writer.pipe.CloseWithError(err)
+		}
+		<-writer.done
+
+		if writer.uploadErr != nil {
+			writer.closeErr = writer.uploadErr
+		} else {
+			writer.closeErr = err
+		}
+	})
+
+	return writer.closeErr
+}
+
+// Abort stops the upload and discards what was written. It does nothing after Close.
+func (writer *S3UploadWriter) Abort() {
+	writer.closeOnce.Do(func() {
+		writer.pipe.CloseWithError(errS3UploadAborted)
+		<-writer.done
+		writer.closeErr = errS3UploadAborted
+	})
+}
+
+// S3CSVWriter streams CSV records into a multipart upload.
+type S3CSVWriter struct {
+	upload *S3UploadWriter
+	writer *csv.Writer
+}
+
+// NewCSVRecordWriter starts the upload of CSV records to key. The content type defaults to text/csv.
+func NewCSVRecordWriter(ctx context.Context, s3Helper *S3Helper, key string, options *S3WriterOptions) (ret *S3CSVWriter, err error) {
+	if upload, uploadErr := s3Helper.NewUploadWriter(ctx, key, withS3RecordContentType(key, options, "text/csv")); uploadErr == nil {
+		ret = &S3CSVWriter{
+			upload: upload,
+			writer: csv.NewWriter(upload),
+		}
+		if options != nil && options.Comma != 0 {
+			ret.writer.Comma = options.Comma
+		}
+	} else {
+		err = uploadErr
+	}
+
+	return
+}
+
+func (writer *S3CSVWriter) Write(record []string) error {
+	return writer.writer.Write(record)
+}
+
+// Close writes the buffered records and completes the upload.
+func (writer *S3CSVWriter) Close() error {
+	writer.writer.Flush()
+	if err := writer.writer.Error(); err != nil {
+		writer.upload.Abort()
+		return errors.Join(err, writer.upload.Close())
+	}
+
+	return writer.upload.Close()
+}
+
+func (writer *S3CSVWriter) Abort() {
+	writer.upload.Abort()
+}
+
+// S3JSONLWriter streams records as JSON Lines into a multipart upload.
+type S3JSONLWriter[T any] struct {
+	upload  *S3UploadWriter
+	encoder *json.Encoder
+}
+
+// NewJSONLRecordWriter starts the upload of JSON Lines records to key. The content type defaults to application/x-ndjson.
+func NewJSONLRecordWriter[T any](ctx context.Context, s3Helper *S3Helper, key string, options *S3WriterOptions) (ret *S3JSONLWriter[T], err error) {
+	if upload, uploadErr := s3Helper.NewUploadWriter(ctx, key, withS3RecordContentType(key, options, "application/x-ndjson")); uploadErr == nil {
+		ret = &S3JSONLWriter[T]{
+			upload:  upload,
+			encoder: json.NewEncoder(upload),
+		}
+	} else {
+		err = uploadErr
+	}
+
+	return
+}
+
+func (writer *S3JSONLWriter[T]) Write(record T) error {
+	return writer.encoder.Encode(record)
+}
+
+// Close completes the upload.
+func (writer *S3JSONLWriter[T]) Close() error {
+	return writer.upload.Close()
+}
+
+func (writer *S3JSONLWriter[T]) Abort() {
+	writer.upload.Abort()
+}
+
+// S3LengthPrefixedWriter streams binary records, each one prefixed by its length, into a multipart upload.
+type S3LengthPrefixedWriter struct {
+	upload *S3UploadWriter
+	length []byte
+}
+
+// NewLengthPrefixedRecordWriter starts the upload of length-prefixed records to key, read back by
+// ReadLengthPrefixedRecords. The content type defaults to application/octet-stream.
+func NewLengthPrefixedRecordWriter(ctx context.Context, s3Helper *S3Helper, key string, options *S3WriterOptions) (ret *S3LengthPrefixedWriter, err error) {
+	if upload, uploadErr := s3Helper.NewUploadWriter(ctx, key, withS3RecordContentType(key, options, "application/octet-stream")); uploadErr == nil {
+		ret = &S3LengthPrefixedWriter{
+			upload: upload,
+			length: make([]byte, binary.MaxVarintLen64),
+		}
+	} else {
+		err = uploadErr
+	}
+
+	return
+}
+
+func (writer *S3LengthPrefixedWriter) Write(record []byte) (err error) {
+	if _, err = writer.upload.Write(writer.length[:binary.PutUvarint(writer.length, uint64(len(record)))]); err == nil {
+		_, err = writer.upload.Write(record)
+	}
+
+	return
+}
+
+// Close completes the upload.
+func (writer *S3LengthPrefixedWriter) Close() error {
+	return writer.upload.Close()
+}
+
+func (writer *S3LengthPrefixedWriter) Abort() {
+	writer.upload.Abort()
+}
+
+// withS3RecordContentType sets contentType on the upload unless the options set one, or the key names a
+// compressed file (e.g. .csv.gz), whose content type is the one of the compression.
+func withS3RecordContentType(key string, options *S3WriterOptions, contentType string) *S3WriterOptions {
+	normalized := S3WriterOptions{}
+	if options != nil {
+		normalized = *options
+	}
+	uploadOptions := S3UploadOptions{}
+	if normalized.UploadOptions != nil {
+		uploadOptions = *normalized.UploadOptions
+	}
+
+	if uploadOptions.ContentType == "" && (uploadOptions.PutOptions == nil || uploadOptions.PutOptions.ContentType == "") && s3CompressionOfKey(key) == "" {
+		uploadOptions.ContentType = contentType
+	}
+	normalized.UploadOptions = &uploadOptions
+
+	return &normalized
+}
@@ -0,0 +1,163 @@
+package awssdkhelper
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"math/rand/v2"
+	"strconv"
+	"testing"
+
+	TestUtility "github.com/thcomp/GoLang_TestUtility"
+)
+
+type testS3Record struct {
+	ID   int    `json:"id"`
+	Name string `json:"name"`
+}
+
+func Test_S3Helper_CSVRecords(t *testing.T) {
+	tester := TestUtility.NewTestHelper(t)
+	fake := newFakeS3Server(t, "records-bucket")
+	helper := fake.helper()
+	ctx := context.Background()
+
+	// random names, so the gzipped content still spans several parts
+	random := rand.New(rand.NewPCG(1, 2))
+	recordCount := 400000
+	writer, err := NewCSVRecordWriter(ctx, helper, "records.csv.gz", &S3WriterOptions{UploadOptions: &S3UploadOptions{PartSize: S3MinPartSize}})
+	tester.Fatalf(err == nil, "NewCSVRecordWriter: %v", err)
+	tester.Fatalf(writer.Write([]string{"id", "name"}) == nil, "Write header")
+	for index := 0; index < recordCount; index++ {
+		if err = writer.Write([]string{strconv.Itoa(index), fmt.Sprintf("%016x%016x", random.Uint64(), random.Uint64())}); err != nil {
+			tester.Fatalf(false, "Write: %v", err)
+		}
+	}
+	tester.Fatalf(writer.Close() == nil, "Close")
+
+	stored := fake.object("records.csv.gz")
+	tester.Fatalf(stored != nil && bytes.HasPrefix(stored.data, []byte{0x1f, 0x8b}), "stored content is not gzipped")
+	tester.Errorf(len(stored.partSizes) > 1 && stored.headers.Get("Content-Encoding") == "", "parts: %d, encoding: %s", len(stored.partSizes), stored.headers.Get("Content-Encoding"))
+
+	item, err := helper.GetItem("records.csv.gz")
+	tester.Fatalf(err == nil, "GetItem: %v", err)
+	defer item.Close()
+	count := 0
+	for record, readErr := range ReadCSVRecords(item, &S3ReaderOptions{SkipHeader: true}) {
+		if readErr != nil || record[0] != strconv.Itoa(count) {
+			tester.Fatalf(false, "record %d: %v, %v", count, record, readErr)
+		}
+		count++
+	}
+	tester.Errorf(count == recordCount, "records: %d", count)
+}
+
+func Test_S3Helper_JSONLRecords(t *testing.T) {
+	tester := TestUtility.NewTestHelper(t)
+	fake := newFakeS3Server(t, "records-bucket")
+	helper := fake.helper()
+	ctx := context.Background()
+
+	writer, err := NewJSONLRecordWriter[testS3Record](ctx, helper, "records.jsonl", &S3WriterOptions{Compression: S3CompressionZstd})
+	tester.Fatalf(err == nil, "NewJSONLRecordWriter: %v", err)
+	for index := 0; index < 1000; index++ {
+		tester.Fatalf(writer.Write(testS3Record{ID: index, Name: "record"}) == nil, "Write")
+	}
+	tester.Fatalf(writer.Close() == nil, "Close")
+
+	stored := fake.object("records.jsonl")
+	tester.Fatalf(stored != nil && bytes.HasPrefix(stored.data, s3ZstdMagic), "stored content is not zstd")
+	tester.Errorf(stored.headers.Get("Content-Encoding") == "zstd" && stored.contentType == "application/x-ndjson", "stored: %s, %s", stored.headers.Get("Content-Encoding"), stored.contentType)
+
+	// without Content-Encoding, zstd is recognized by its magic number
+	fake.putObject("copied.jsonl", stored.data)
+	for _, key := range []string{"records.jsonl", "copied.jsonl"} {
+		item, err := helper.GetItem(key)
+		tester.Fatalf(err == nil, "GetItem: %v", err)
+		count := 0
+		for record, readErr := range ReadJSONLRecords[testS3Record](item, nil) {
+			if readErr != nil || record.ID != count {
+				tester.Fatalf(false, "%s record %d: %+v, %v", key, count, record, readErr)
+			}
+			count++
+		}
+		item.Close()
+		tester.Errorf(count == 1000, "%s records: %d", key, count)
+	}
+
+	fake.putObject("broken.jsonl", []byte("{\"id\":1}\n\n{\"id\":\n"))
+	item, err := helper.GetItem("broken.jsonl")
+	tester.Fatalf(err == nil, "GetItem: %v", err)
+	ids := []int{}
+	for record, readErr := range ReadJSONLRecords[testS3Record](item, nil) {
+		if readErr != nil {
+			err = readErr
+			break
+		}
+		ids = append(ids, record.ID)
+	}
+	item.Close()
+	tester.Errorf(len(ids) == 1 && err != nil && bytes.Contains([]byte(err.Error()), []byte("line 3")), "broken records: %v, %v", ids, err)
+}
+
+func Test_S3Helper_LengthPrefixedRecords(t *testing.T) {
+	tester := TestUtility.NewTestHelper(t)
+	fake := newFakeS3Server(t, "records-bucket")
+	helper := fake.helper()
+	ctx := context.Background()
+
+	writer, err := NewLengthPrefixedRecordWriter(ctx, helper, "records.bin.gz", nil)
+	tester.Fatalf(err == nil, "NewLengthPrefixedRecordWriter: %v", err)
+	for index := 0; index < 1000; index++ {
+		// empty records and lengths above one varint byte
+		tester.Fatalf(writer.Write(bytes.Repeat([]byte{byte(index)}, index%300)) == nil, "Write")
+	}
+	tester.Fatalf(writer.Close() == nil, "Close")
+	stored := fake.object("records.bin.gz")
+	tester.Fatalf(stored != nil && bytes.HasPrefix(stored.data, []byte{0x1f, 0x8b}), "stored content is not gzipped")
+
+	item, err := helper.GetItem("records.bin.gz")
+	tester.Fatalf(err == nil, "GetItem: %v", err)
+	count := 0
+	for record, readErr := range ReadLengthPrefixedRecords(item, nil) {
+		if readErr != nil || !bytes.Equal(record, bytes.Repeat([]byte{byte(count)}, count%300)) {
+			tester.Fatalf(false, "record %d: %d bytes, %v", count, len(record), readErr)
+		}
+		count++
+	}
+	item.Close()
+	tester.Errorf(count == 1000, "records: %d", count)
+
+	// content ending inside a record, and lengths above MaxRecordSize
+	for key, options := range map[string]*S3ReaderOptions{"truncated.bin": nil, "large.bin": {MaxRecordSize: 3}} {
+		fake.putObject(key, []byte{2, 'a', 'b', 4, 'c'})
+		item, err = helper.GetItem(key)
+		tester.Fatalf(err == nil, "GetItem: %v", err)
+		records := 0
+		for _, readErr := range ReadLengthPrefixedRecords(item, options) {
+			if err = readErr; readErr == nil {
+				records++
+			}
+		}
+		item.Close()
+		tester.Errorf(records == 1 && err != nil && bytes.Contains([]byte(err.Error()), []byte("record 2")), "%s: %d records, %v", key, records, err)
+	}
+}
+
+func Test_S3Helper_RecordWriterAbort(t *testing.T) {
+	tester := TestUtility.NewTestHelper(t)
+	fake := newFakeS3Server(t, "records-bucket")
+	helper := fake.helper()
+	ctx := context.Background()
+
+	writer, err := NewCSVRecordWriter(ctx, helper, "aborted.csv", &S3WriterOptions{UploadOptions: &S3UploadOptions{PartSize: S3MinPartSize}})
+	tester.Fatalf(err == nil, "NewCSVRecordWriter: %v", err)
+	for index := 0; index < 500000; index++ {
+		tester.Fatalf(writer.Write([]string{strconv.Itoa(index), "aborted"}) == nil, "Write")
+	}
+	writer.Abort()
+
+	tester.Errorf(fake.object("aborted.csv") == nil && len(fake.uploads) == 0, "aborted upload is stored: %d uploads", len(fake.uploads))
+	tester.Errorf(errors.Is(writer.Close(), errS3UploadAborted), "Close after Abort")
+}
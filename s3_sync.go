@@ -0,0 +1,455 @@
+package awssdkhelper
+
+import (
+	"context"
+	"crypto/md5"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"os"
+	"path"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+)
+
+const s3DefaultSyncConcurrency = 4
+
+type S3SyncAction string
+
+const (
+	S3SyncUpload       S3SyncAction = "upload"
+	S3SyncDownload     S3SyncAction = "download"
+	S3SyncDeleteRemote S3SyncAction = "delete-remote"
+	S3SyncDeleteLocal  S3SyncAction = "delete-local"
+)
+
+type S3SyncOperation struct {
+	Action S3SyncAction
+	// RelativePath is the slash separated path below the local directory and the prefix.
+	RelativePath string
+	Key          string
+	LocalPath    string
+	Size         int64
+	// Reason is why the file is transferred or deleted: "missing", "size", "content" or "extra".
+	Reason string
+}
+
+type S3SyncOptions struct {
+	// DryRun only plans the operations.
+	DryRun bool
+	// Delete removes files on the destination side which do not exist on the source side.
+	Delete bool
+	// Include and Exclude filter relative paths with glob patterns. A pattern without "/" matches the base name.
+	// With Include, only matching paths are synced. Excluded paths are neither transferred nor deleted.
+	Include []string
+	Exclude []string
+	// Concurrency is the number of operations run in parallel. Defaults to 4.
+	Concurrency int
+	// OnOperation is called after every executed operation. Calls are never concurrent.
+	OnOperation func(operation *S3SyncOperation, err error)
+}
+
+type S3SyncFailure struct {
+	Operation *S3SyncOperation
+	Err       error
+}
+
+type S3SyncResult struct {
+	// Operations is the plan, sorted by relative path. Unless DryRun is set, each one was executed.
+	Operations []*S3SyncOperation
+	Failures   []*S3SyncFailure
+}
+
+// s3SyncEntry is a file on either side of a sync.
+type s3SyncEntry struct {
+	relativePath string
+	size         int64
+	modTime      time.Time
+	// etag is only set for remote entries
+	etag string
+}
+
+type s3Syncer struct {
+	helper   *S3Helper
+	localDir string
+	prefix   string
+	options  S3SyncOptions
+
+	local  map[string]*s3SyncEntry
+	remote map[string]*s3SyncEntry
+
+	resultMutex sync.Mutex
+	result      *S3SyncResult
+}
+
+// SyncToS3 mirrors localDir to prefix. Files are uploaded when missing remotely, when the size differs,
+// or when the local file was modified after the upload and its MD5 differs from the ETag.
+// Files are uploaded uncompressed, even when SetCompression is set.
+// Failed operations are listed in the result, and joined into the returned error.
+func (s3Helper *S3Helper) SyncToS3(ctx context.Context, localDir string, prefix string, options *S3SyncOptions) (*S3SyncResult, error) {
+	return s3Helper.newSyncer(localDir, prefix, options).sync(ctx, true)
+}
+
+// SyncFromS3 mirrors prefix to localDir. Objects are downloaded when missing locally, when the size differs,
+// or when the object was modified after the local file and the ETag differs from the local MD5.
+// Downloaded files get the LastModified of the object as their modification time.
+func (s3Helper *S3Helper) SyncFromS3(ctx context.Context, prefix string, localDir string, options *S3SyncOptions) (*S3SyncResult, error) {
+	return s3Helper.newSyncer(localDir, prefix, options).sync(ctx, false)
+}
+
+func (s3Helper *S3Helper) newSyncer(localDir string, prefix string, options *S3SyncOptions) *s3Syncer {
+	if prefix != "" && !strings.HasSuffix(prefix, "/") {
+		prefix += "/"
+	}
+
+	syncer := &s3Syncer{
+		helper:   s3Helper,
+		localDir: localDir,
+		prefix:   prefix,
+		local:    map[string]*s3SyncEntry{},
+		remote:   map[string]*s3SyncEntry{},
+		result:   &S3SyncResult{},
+	}
+	if options != nil {
+		syncer.options = *options
+	}
+	if syncer.options.Concurrency <= 0 {
+		syncer.options.Concurrency = s3DefaultSyncConcurrency
+	}
+
+	return syncer
+}
+
+func (syncer *s3Syncer) included(relativePath string) bool {
+	for _, pattern := range syncer.options.Exclude {
+		if matchS3Glob(pattern, relativePath) {
+			return false
+		}
+	}
+	if len(syncer.options.Include) == 0 {
+		return true
+	}
+	for _, pattern := range syncer.options.Include {
+		if matchS3Glob(pattern, relativePath) {
+			return true
+		}
+	}
+
+	return false
+}
+
+func (syncer *s3Syncer) sync(ctx context.Context, upload bool) (result *S3SyncResult, err error) {
+	result = syncer.result
+	for _, pattern := range append(append([]string{}, syncer.options.Include...), syncer.options.Exclude...) {
+		if _, matchErr := path.Match(pattern, ""); matchErr != nil {
+			return result, fmt.Errorf("pattern %q: %w", pattern, matchErr)
+		}
+	}
+
+	if err = syncer.listLocal(ctx, upload); err != nil {
+		return
+	}
+	if err = syncer.listRemote(ctx); err != nil {
+		return
+	}
+
+	source, destination := syncer.local, syncer.remote
+	if !upload {
+		source, destination = syncer.remote, syncer.local
+	}
+	for relativePath, sourceEntry := range source {
+		reason := ""
+		if destinationEntry, exist := destination[relativePath]; !exist {
+			reason = "missing"
+		} else if sourceEntry.size != destinationEntry.size {
+			reason = "size"
+		} else if sourceEntry.modTime.After(destinationEntry.modTime) {
+			// a newer source with the same size: compare the content through the ETag
+			localEntry, remoteEntry := sourceEntry, destinationEntry
+			if !upload {
+				localEntry, remoteEntry = destinationEntry, sourceEntry
+			}
+			if same, compareErr := syncer.sameContent(localEntry, remoteEntry); compareErr != nil {
+				return result, compareErr
+			} else if !same {
+				reason = "content"
+			}
+		}
+
+		if reason != "" {
+			action := S3SyncUpload
+			if !upload {
+				action = S3SyncDownload
+			}
+			result.Operations = append(result.Operations, syncer.newOperation(action, sourceEntry, reason))
+		}
+	}
+	if syncer.options.Delete {
+		for relativePath, destinationEntry := range destination {
+			if _, exist := source[relativePath]; !exist {
+				action := S3SyncDeleteRemote
+				if !upload {
+					action = S3SyncDeleteLocal
+				}
+				result.Operations = append(result.Operations, syncer.newOperation(action, destinationEntry, "extra"))
+			}
+		}
+	}
+	sort.Slice(result.Operations, func(i, j int) bool {
+		return result.Operations[i].RelativePath < result.Operations[j].RelativePath
+	})
+
+	if !syncer.options.DryRun {
+		// deletions run last, so that a failed transfer never leaves the destination with fewer files
+		transfers, deletions := []*S3SyncOperation{}, []*S3SyncOperation{}
+		for _, operation := range result.Operations {
+			if operation.Action == S3SyncDeleteRemote || operation.Action == S3SyncDeleteLocal {
+				deletions = append(deletions, operation)
+			} else {
+				transfers = append(transfers, operation)
+			}
+		}
+		syncer.run(ctx, transfers)
+		syncer.run(ctx, deletions)
+
+		errs := []error{}
+		for _, failure := range result.Failures {
+			errs = append(errs, fmt.Errorf("%s %s: %w", failure.Operation.Action, failure.Operation.RelativePath, failure.Err))
+		}
+		err = errors.Join(errs...)
+	}
+
+	return
+}
+
+func (syncer *s3Syncer) newOperation(action S3SyncAction, entry *s3SyncEntry, reason string) *S3SyncOperation {
+	return &S3SyncOperation{
+		Action:       action,
+		RelativePath: entry.relativePath,
+		Key:          syncer.prefix + entry.relativePath,
+		LocalPath:    filepath.Join(syncer.localDir, filepath.FromSlash(entry.relativePath)),
+		Size:         entry.size,
+		Reason:       reason,
+	}
+}
+
+func (syncer *s3Syncer) listLocal(ctx context.Context, upload bool) (err error) {
+	err = filepath.WalkDir(syncer.localDir, func(filePath string, entry fs.DirEntry, walkErr error) error {
+		if walkErr != nil {
+			if !upload && errors.Is(walkErr, fs.ErrNotExist) && filePath == syncer.localDir {
+				// downloading into a new directory
+				return filepath.SkipAll
+			}
+			return walkErr
+		}
+		if ctxErr := ctx.Err(); ctxErr != nil {
+			return ctxErr
+		}
+		if !entry.Type().IsRegular() {
+			return nil
+		}
+
+		relPath, relErr := filepath.Rel(syncer.localDir, filePath)
+		if relErr != nil {
+			return relErr
+		}
+		relativePath := filepath.ToSlash(relPath)
+		if syncer.included(relativePath) {
+			if fileInfo, infoErr := entry.Info(); infoErr == nil {
+				syncer.local[relativePath] = &s3SyncEntry{
+					relativePath: relativePath,
+					size:         fileInfo.Size(),
+					modTime:      fileInfo.ModTime(),
+				}
+			} else {
+				return infoErr
+			}
+		}
+
+		return nil
+	})
+
+	return
+}
+
+func (syncer *s3Syncer) listRemote(ctx context.Context) (err error) {
+	for item, walkErr := range syncer.helper.Walk(ctx, syncer.prefix, nil) {
+		if walkErr != nil {
+			return walkErr
+		}
+
+		relativePath := strings.TrimPrefix(item.Path, syncer.prefix)
+		if item.IsDir || !fs.ValidPath(relativePath) || !syncer.included(relativePath) {
+			// folder placeholders, and keys which cannot be local paths ("a//b", "../a")
+			continue
+		}
+		// local files hold the decompressed content
+		if err = item.resolveCompression(ctx); err != nil {
+			return
+		}
+		syncer.remote[relativePath] = &s3SyncEntry{
+			relativePath: relativePath,
+			size:         aws.ToInt64(item.size),
+			modTime:      aws.ToTime(item.lastModified),
+			etag:         aws.ToString(item.etag),
+		}
+	}
+
+	return
+}
+
+// sameContent compares the MD5 of the local file with the ETag, including multipart ETags uploaded
+// with common part sizes. ETags which cannot be compared count as different.
+func (syncer *s3Syncer) sameContent(local *s3SyncEntry, remote *s3SyncEntry) (same bool, err error) {
+	digest, parts, ok := parseS3ETag(remote.etag)
+	if !ok {
+		return false, nil
+	}
+
+	file, openErr := os.Open(filepath.Join(syncer.localDir, filepath.FromSlash(local.relativePath)))
+	if openErr != nil {
+		return false, openErr
+	}
+	defer file.Close()
+
+	partSizes := []int64{local.size}
+	if parts > 0 {
+		partSizes = []int64{}
+		for _, partSize := range []int64{s3DefaultPartSize, S3MinPartSize, 16 * 1024 * 1024, 64 * 1024 * 1024} {
+			// sized like the uploader does, which grows parts of large files
+			partSizes = append(partSizes, s3UploadPartSize(local.size, partSize))
+		}
+	}
+	for _, partSize := range partSizes {
+		if parts > 0 && (local.size+partSize-1)/partSize != int64(parts) {
+			continue
+		}
+		if _, err = file.Seek(0, io.SeekStart); err != nil {
+			return
+		}
+
+		if localDigest, digestErr := s3ContentDigest(file, partSize, parts > 0); digestErr != nil {
+			return false, digestErr
+		} else if localDigest == digest {
+			return true, nil
+		}
+	}
+
+	return false, nil
+}
+
+// s3ContentDigest computes the digest of an ETag: the MD5 of the content, or the MD5 of the part MD5s.
+func s3ContentDigest(reader io.Reader, partSize int64, multipart bool) (string, error) {
+	if !multipart {
+		hash := md5.New()
+		if _, err := io.Copy(hash, reader); err != nil {
+			return "", err
+		}
+		return hex.EncodeToString(hash.Sum(nil)), nil
+	}
+
+	partDigests := md5.New()
+	for {
+		hash := md5.New()
+		copied, err := io.CopyN(hash, reader, partSize)
+		if err != nil && err != io.EOF {
+			return "", err
+		}
+		if copied > 0 {
+			partDigests.Write(hash.Sum(nil))
+		}
+		if copied < partSize {
+			break
+		}
+	}
+
+	return hex.EncodeToString(partDigests.Sum(nil)), nil
+}
+
+func (syncer *s3Syncer) run(ctx context.Context, operations []*S3SyncOperation) {
+	semaphore := make(chan struct{}, syncer.options.Concurrency)
+	waitGroup := sync.WaitGroup{}
+
+	for _, operation := range operations {
+		semaphore <- struct{}{}
+		waitGroup.Add(1)
+		go func(operation *S3SyncOperation) {
+			defer waitGroup.Done()
+			defer func() { <-semaphore }()
+
+			err := ctx.Err()
+			if err == nil {
+				err = syncer.execute(ctx, operation)
+			}
+
+			syncer.resultMutex.Lock()
+			defer syncer.resultMutex.Unlock()
+			if err != nil {
+				syncer.result.Failures = append(syncer.result.Failures, &S3SyncFailure{Operation: operation, Err: err})
+			}
+			if syncer.options.OnOperation != nil {
+				syncer.options.OnOperation(operation, err)
+			}
+		}(operation)
+	}
+	waitGroup.Wait()
+}
+
+func (syncer *s3Syncer) execute(ctx context.Context, operation *S3SyncOperation) (err error) {
+	switch operation.Action {
+	case S3SyncUpload:
+		// stored uncompressed, so the size and the ETag compare with the local file
+		err = syncer.helper.PutFileWithOptions(ctx, operation.Key, operation.LocalPath, &S3PutOptions{Compression: S3CompressionNone})
+	case S3SyncDownload:
+		err = syncer.download(ctx, operation)
+	case S3SyncDeleteRemote:
+		err = syncer.helper.DeleteItemWithContext(ctx, operation.Key)
+	case S3SyncDeleteLocal:
+		err = os.Remove(operation.LocalPath)
+	}
+
+	return
+}
+
+// download writes into a temporary file renamed over the destination, so readers never see a partial file.
+func (syncer *s3Syncer) download(ctx context.Context, operation *S3SyncOperation) (err error) {
+	if err = os.MkdirAll(filepath.Dir(operation.LocalPath), 0o755); err != nil {
+		return
+	}
+
+	file, createErr := os.CreateTemp(filepath.Dir(operation.LocalPath), "."+filepath.Base(operation.LocalPath)+".*")
+	if createErr != nil {
+		return createErr
+	}
+	tempPath := file.Name()
+
+	item := &S3Item{
+		Path:   operation.Key,
+		helper: syncer.helper,
+		ctx:    ctx,
+	}
+	if err = item.DownloadToWithContext(ctx, file, nil); err == nil {
+		err = file.Chmod(0o644)
+	}
+	if closeErr := file.Close(); err == nil {
+		err = closeErr
+	}
+	if err == nil && item.lastModified != nil {
+		err = os.Chtimes(tempPath, *item.lastModified, *item.lastModified)
+	}
+	if err == nil {
+		err = os.Rename(tempPath, operation.LocalPath)
+	}
+	if err != nil {
+		os.Remove(tempPath)
+	}
+
+	return
+}
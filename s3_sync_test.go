@@ -0,0 +1,128 @@
+package awssdkhelper
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	TestUtility "github.com/thcomp/GoLang_TestUtility"
+)
+
+func writeTestSyncFile(t *testing.T, dir, relativePath, content string) {
+	filePath := filepath.Join(dir, filepath.FromSlash(relativePath))
+	os.MkdirAll(filepath.Dir(filePath), 0o755)
+	if err := os.WriteFile(filePath, []byte(content), 0o644); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func formatSyncOperations(result *S3SyncResult) string {
+	operations := []string{}
+	for _, operation := range result.Operations {
+		operations = append(operations, string(operation.Action)+":"+operation.RelativePath+":"+operation.Reason)
+	}
+
+	return strings.Join(operations, ",")
+}
+
+func Test_S3Helper_SyncToS3(t *testing.T) {
+	tester := TestUtility.NewTestHelper(t)
+	fake := newFakeS3Server(t, "sync-bucket")
+	helper := fake.helper()
+	ctx := context.Background()
+
+	localDir := t.TempDir()
+	writeTestSyncFile(t, localDir, "a.txt", "aaa")
+	writeTestSyncFile(t, localDir, "sub/b.txt", "bbb")
+	writeTestSyncFile(t, localDir, "debug.log", "log")
+	fake.putObject("artifacts/old.txt", []byte("old"))
+	fake.putObject("artifacts/keep.log", []byte("excluded"))
+	fake.putObject("artifacts/sub/b.txt", []byte("bb"))
+
+	options := &S3SyncOptions{Delete: true, Exclude: []string{"*.log"}, DryRun: true}
+	result, err := helper.SyncToS3(ctx, localDir, "artifacts", options)
+	tester.Fatalf(err == nil, "dry run: %v", err)
+	tester.Errorf(formatSyncOperations(result) == "upload:a.txt:missing,delete-remote:old.txt:extra,upload:sub/b.txt:size", "plan: %s", formatSyncOperations(result))
+	tester.Errorf(fake.object("artifacts/a.txt") == nil && fake.object("artifacts/old.txt") != nil, "dry run changed the bucket")
+
+	options.DryRun = false
+	executed := 0
+	options.OnOperation = func(operation *S3SyncOperation, err error) { executed++ }
+	result, err = helper.SyncToS3(ctx, localDir, "artifacts", options)
+	tester.Fatalf(err == nil && executed == 3, "sync: %d, %v", executed, err)
+	tester.Errorf(string(fake.object("artifacts/a.txt").data) == "aaa" && string(fake.object("artifacts/sub/b.txt").data) == "bbb", "uploaded objects differ")
+	tester.Errorf(fake.object("artifacts/old.txt") == nil && fake.object("artifacts/keep.log") != nil && fake.object("artifacts/debug.log") == nil, "extras and excluded files")
+
+	result, err = helper.SyncToS3(ctx, localDir, "artifacts", options)
+	tester.Errorf(err == nil && len(result.Operations) == 0, "second sync: %s, %v", formatSyncOperations(result), err)
+
+	// same size and newer: the ETag decides
+	future := time.Now().Add(time.Hour)
+	writeTestSyncFile(t, localDir, "a.txt", "AAA")
+	os.Chtimes(filepath.Join(localDir, "a.txt"), future, future)
+	os.Chtimes(filepath.Join(localDir, "sub", "b.txt"), future, future)
+	result, err = helper.SyncToS3(ctx, localDir, "artifacts", options)
+	tester.Errorf(err == nil && formatSyncOperations(result) == "upload:a.txt:content", "sync after touch: %s, %v", formatSyncOperations(result), err)
+
+	fake.failPuts["artifacts/c.txt"] = true
+	writeTestSyncFile(t, localDir, "c.txt", "ccc")
+	writeTestSyncFile(t, localDir, "d.txt", "ddd")
+	result, err = helper.SyncToS3(ctx, localDir, "artifacts", &S3SyncOptions{Include: []string{"c.txt", "d.txt"}, Concurrency: 1})
+	tester.Errorf(err != nil && strings.Contains(err.Error(), "upload c.txt"), "partial failure: %v", err)
+	tester.Errorf(len(result.Failures) == 1 && result.Failures[0].Operation.RelativePath == "c.txt" && fake.object("artifacts/d.txt") != nil, "failures: %v", result.Failures)
+
+	// a compressing helper uploads uncompressed, so a second sync with newer files finds nothing to do
+	helper.SetCompression(S3CompressionGzip)
+	result, err = helper.SyncToS3(ctx, localDir, "plain", nil)
+	tester.Fatalf(err == nil && len(result.Operations) == 5, "sync with compression: %s, %v", formatSyncOperations(result), err)
+	tester.Errorf(string(fake.object("plain/a.txt").data) == "AAA" && fake.object("plain/a.txt").headers.Get("Content-Encoding") == "", "synced object is compressed")
+	os.Chtimes(filepath.Join(localDir, "a.txt"), future.Add(time.Hour), future.Add(time.Hour))
+	result, err = helper.SyncToS3(ctx, localDir, "plain", nil)
+	tester.Errorf(err == nil && len(result.Operations) == 0, "second sync with compression: %s, %v", formatSyncOperations(result), err)
+	helper.SetCompression(S3CompressionNone)
+
+	_, err = helper.SyncToS3(ctx, localDir, "artifacts", &S3SyncOptions{Include: []string{"["}})
+	tester.Errorf(err != nil, "a bad pattern is accepted")
+	_, err = helper.SyncToS3(ctx, filepath.Join(localDir, "missing"), "artifacts", nil)
+	tester.Errorf(err != nil, "a missing local directory is accepted")
+}
+
+func Test_S3Helper_SyncFromS3(t *testing.T) {
+	tester := TestUtility.NewTestHelper(t)
+	fake := newFakeS3Server(t, "sync-bucket")
+	helper := fake.helper()
+	ctx := context.Background()
+
+	fake.putObject("config/app.json", []byte(`{"a":1}`))
+	fake.putObject("config/env/prod.json", []byte(`{"env":"prod"}`))
+	fake.putObject("config/env/", []byte{})
+	multipart := testMultipartData(int(S3MinPartSize + 10))
+	err := helper.UploadWithContext(ctx, "config/large.bin", strings.NewReader(string(multipart)), &S3UploadOptions{PartSize: S3MinPartSize})
+	tester.Fatalf(err == nil, "UploadWithContext: %v", err)
+
+	localDir := filepath.Join(t.TempDir(), "config")
+	result, err := helper.SyncFromS3(ctx, "config/", localDir, &S3SyncOptions{Concurrency: 2})
+	tester.Fatalf(err == nil, "SyncFromS3: %v", err)
+	tester.Errorf(formatSyncOperations(result) == "download:app.json:missing,download:env/prod.json:missing,download:large.bin:missing", "plan: %s", formatSyncOperations(result))
+
+	data, _ := os.ReadFile(filepath.Join(localDir, "env", "prod.json"))
+	tester.Errorf(string(data) == `{"env":"prod"}`, "downloaded: %s", data)
+	fileInfo, _ := os.Stat(filepath.Join(localDir, "app.json"))
+	tester.Errorf(fileInfo.ModTime().Equal(fake.object("config/app.json").lastModified), "mtime: %v", fileInfo.ModTime())
+
+	result, err = helper.SyncFromS3(ctx, "config/", localDir, nil)
+	tester.Errorf(err == nil && len(result.Operations) == 0, "second sync: %s, %v", formatSyncOperations(result), err)
+
+	// an object rewritten with the same content is not downloaded again, a multipart one neither
+	fake.putObject("config/app.json", []byte(`{"a":1}`))
+	fake.object("config/app.json").lastModified = time.Now().Add(time.Hour)
+	fake.object("config/large.bin").lastModified = time.Now().Add(time.Hour)
+	writeTestSyncFile(t, localDir, "extra.txt", "extra")
+	result, err = helper.SyncFromS3(ctx, "config/", localDir, &S3SyncOptions{Delete: true})
+	tester.Errorf(err == nil && formatSyncOperations(result) == "delete-local:extra.txt:extra", "sync after rewrite: %s, %v", formatSyncOperations(result), err)
+	_, statErr := os.Stat(filepath.Join(localDir, "extra.txt"))
+	tester.Errorf(os.IsNotExist(statErr), "extra file is kept: %v", statErr)
+}
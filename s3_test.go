@@ -1,37 +1,137 @@
 package awssdkhelper
 
 import (
+	"bytes"
+	"context"
 	"encoding/json"
+	"errors"
 	"io"
 	"os"
+	"path/filepath"
 	"testing"
+	"time"
+
+	TestUtility "github.com/thcomp/GoLang_TestUtility"
 )
 
 func Test_S3Helper_GetItem(t *testing.T) {
+	var helper *S3Helper
+	filepath := ""
 	if reader, openErr := os.Open("test_s3.json"); openErr == nil {
 		paramMap := map[string]string{}
 		json.NewDecoder(reader).Decode(&paramMap)
+		reader.Close()
 
 		accessKeyId, _ := paramMap["access_key_id"]
 		secretAccessKey, _ := paramMap["secret_access_key"]
 		bucket, _ := paramMap["bucket"]
 		region, _ := paramMap["region"]
-		filepath, _ := paramMap["ipv4_address_filepath"]
+		filepath, _ = paramMap["ipv4_address_filepath"]
+
+		helper = NewS3Helper(accessKeyId, secretAccessKey, region, bucket, nil)
+	} else if os.IsNotExist(openErr) {
+		// without an account, the same calls run against the fake server
+		fake := newFakeS3Server(t, "get-item-bucket")
+		var configErr error
+		helper, configErr = NewS3HelperWithConfig(context.Background(), fake.bucket,
+			WithAWSRegion("us-east-1"),
+			WithAWSStaticCredentials("AKIDEXAMPLE", "SECRET", ""),
+			WithS3Options(WithS3Endpoint(fake.server.URL), WithS3PathStyle(), WithS3HTTPClient(fake.server.Client())),
+		)
+		if configErr != nil {
+			t.Fatalf("NewS3HelperWithConfig error: %v", configErr)
+		}
+		filepath = "ipv4_address.txt"
+		fake.putObject(filepath, []byte("192.0.2.1"))
+	} else {
+		t.Fatalf("open error: %v", openErr)
+	}
 
-		helper := NewS3Helper(accessKeyId, secretAccessKey, region, bucket, nil)
-		if s3Item, getErr := helper.GetItem(filepath); getErr == nil {
-			defer s3Item.Close()
+	if s3Item, getErr := helper.GetItem(filepath); getErr == nil {
+		defer s3Item.Close()
 
-			if data, readErr := io.ReadAll(s3Item); readErr == nil {
-				t.Logf("data: %s\n", string(data))
-			} else {
-				t.Fatalf("ReadAll error: %v", readErr)
-			}
+		if data, readErr := io.ReadAll(s3Item); readErr == nil {
+			t.Logf("data: %s\n", string(data))
 		} else {
-			t.Fatalf("GetItem error: %v", getErr)
+			t.Fatalf("ReadAll error: %v", readErr)
 		}
 	} else {
-		t.Fatalf("open error: %v", openErr)
+		t.Fatalf("GetItem error: %v", getErr)
 	}
+}
+
+func Test_S3Helper_WithContext(t *testing.T) {
+	tester := TestUtility.NewTestHelper(t)
+	fake := newFakeS3Server(t, "context-bucket")
+	helper := fake.helper()
+	helper.SetTimeout(10 * time.Second)
+
+	data := bytes.Repeat([]byte("0123456789"), 100000)
+	err := helper.PutDataWithContext(context.Background(), "dir/large.bin", data)
+	tester.Fatalf(err == nil, "PutDataWithContext error: %v", err)
+
+	item, err := helper.GetItemWithContext(context.Background(), "dir/large.bin")
+	tester.Fatalf(err == nil, "GetItemWithContext error: %v", err)
+	readData, err := io.ReadAll(item)
+	item.Close()
+	tester.Errorf(err == nil && bytes.Equal(readData, data), "ReadAll: %d bytes, %v", len(readData), err)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	item, err = helper.GetItemWithContext(ctx, "dir/large.bin")
+	tester.Fatalf(err == nil, "GetItemWithContext error: %v", err)
+	buffer := make([]byte, 10)
+	_, err = item.Read(buffer)
+	tester.Errorf(err == nil, "first Read error: %v", err)
+	cancel()
+	_, err = item.Read(buffer)
+	tester.Errorf(errors.Is(err, context.Canceled), "Read after cancel: %v", err)
+	item.Close()
+
+	items, _, err := helper.ListItemsWithContext(context.Background(), "dir/", nil)
+	tester.Fatalf(err == nil && len(items) == 1, "ListItemsWithContext: %v, %v", items, err)
+	readData, err = io.ReadAll(items[0])
+	items[0].Close()
+	tester.Errorf(err == nil && len(readData) == len(data), "read listed item: %d bytes, %v", len(readData), err)
+
+	_, _, err = helper.ListItemsWithContext(ctx, "dir/", nil)
+	tester.Errorf(errors.Is(err, context.Canceled), "ListItemsWithContext with cancelled context: %v", err)
+
+	err = helper.PutFileWithContext(context.Background(), "missing.txt", filepath.Join(t.TempDir(), "missing.txt"))
+	tester.Errorf(err != nil, "PutFileWithContext with a missing file must fail")
+
+	err = helper.DeleteItemWithContext(context.Background(), "dir/large.bin")
+	tester.Errorf(err == nil && fake.object("dir/large.bin") == nil, "DeleteItemWithContext: %v", err)
+
+	helper.SetTimeout(time.Nanosecond)
+	_, err = helper.GetItemWithContext(context.Background(), "dir/large.bin")
+	tester.Errorf(errors.Is(err, context.DeadlineExceeded), "timeout is not applied: %v", err)
+}
+
+func Test_S3Item_Reader(t *testing.T) {
+	tester := TestUtility.NewTestHelper(t)
+	fake := newFakeS3Server(t, "reader-bucket")
+	helper := fake.helper()
+	fake.putObject("data.txt", []byte("0123456789"))
+
+	// the body opened by GetItem is returned as is, from where Read stopped
+	item, err := helper.GetItem("data.txt")
+	tester.Fatalf(err == nil, "GetItem: %v", err)
+	buffer := make([]byte, 4)
+	_, err = io.ReadFull(item, buffer)
+	tester.Fatalf(err == nil, "Read: %v", err)
+	reader, err := item.Reader()
+	tester.Fatalf(err == nil && reader != nil, "Reader of an opened item: %v, %v", reader, err)
+	readData, err := io.ReadAll(reader)
+	tester.Errorf(err == nil && string(readData) == "456789", "read from Reader: %q, %v", readData, err)
+	item.Close()
 
+	// a body opened by Reader is kept for the next calls
+	item = &S3Item{Path: "data.txt", helper: helper}
+	first, err := item.Reader()
+	tester.Fatalf(err == nil && first != nil, "first Reader: %v, %v", first, err)
+	second, err := item.Reader()
+	tester.Errorf(err == nil && second == first, "second Reader returned another body: %v", err)
+	readData, err = io.ReadAll(second)
+	item.Close()
+	tester.Errorf(err == nil && string(readData) == "0123456789", "read from Reader: %q, %v", readData, err)
 }
@@ -0,0 +1,217 @@
+package awssdkhelper
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/s3"
+	"github.com/aws/aws-sdk-go-v2/service/s3/types"
+)
+
+// S3ItemVersion is a version or a delete marker of a key in a versioned bucket.
+type S3ItemVersion struct {
+	Key string
+	// VersionId is "null" for an object stored before versioning was enabled.
+	VersionId string
+	// IsLatest is set on the current version. A key whose latest version is a delete marker reads as missing.
+	IsLatest     bool
+	DeleteMarker bool
+	// Size, ETag and StorageClass are empty for delete markers.
+	Size         int64
+	ETag         string
+	StorageClass string
+	LastModified time.Time
+}
+
+// S3VersionMarker is the position to continue a truncated ListItemVersions from.
+type S3VersionMarker struct {
+	KeyMarker       string
+	VersionIdMarker string
+}
+
+func (s3Helper *S3Helper) ListItemVersions(prefix string, marker *S3VersionMarker) (versions []*S3ItemVersion, nextMarker *S3VersionMarker, err error) {
+	return s3Helper.ListItemVersionsWithContext(context.Background(), prefix, marker)
+}
+
+// ListItemVersionsWithContext lists one page of the versions and delete markers of every key under prefix,
+// including keys in sub "folders". Versions are sorted by key, newest first. nextMarker is nil on the last page.
+func (s3Helper *S3Helper) ListItemVersionsWithContext(ctx context.Context, prefix string, marker *S3VersionMarker) (versions []*S3ItemVersion, nextMarker *S3VersionMarker, err error) {
+	input := &s3.ListObjectVersionsInput{
+		Bucket: aws.String(s3Helper.bucket),
+		Prefix: aws.String(prefix),
+	}
+	if marker != nil {
+		if marker.KeyMarker != "" {
+			input.KeyMarker = aws.String(marker.KeyMarker)
+		}
+		if marker.VersionIdMarker != "" {
+			input.VersionIdMarker = aws.String(marker.VersionIdMarker)
+		}
+	}
+
+	callCtx, cancel := s3Helper.callContext(ctx)
+	defer cancel()
+
+	if output, listErr := s3Helper.client.ListObjectVersions(callCtx, input); listErr == nil {
+		versions = newS3ItemVersions(output)
+		if aws.ToBool(output.IsTruncated) {
+			nextMarker = &S3VersionMarker{
+				KeyMarker:       aws.ToString(output.NextKeyMarker),
+				VersionIdMarker: aws.ToString(output.NextVersionIdMarker),
+			}
+		}
+	} else {
+		err = listErr
+	}
+
+	return
+}
+
+// newS3ItemVersions merges the versions and delete markers S3 returns in separate lists.
+func newS3ItemVersions(output *s3.ListObjectVersionsOutput) (versions []*S3ItemVersion) {
+	versions = []*S3ItemVersion{}
+	for _, version := range output.Versions {
+		versions = append(versions, &S3ItemVersion{
+			Key:          aws.ToString(version.Key),
+			VersionId:    aws.ToString(version.VersionId),
+			IsLatest:     aws.ToBool(version.IsLatest),
+			Size:         aws.ToInt64(version.Size),
+			ETag:         aws.ToString(version.ETag),
+			StorageClass: string(version.StorageClass),
+			LastModified: aws.ToTime(version.LastModified),
+		})
+	}
+	for _, marker := range output.DeleteMarkers {
+		versions = append(versions, &S3ItemVersion{
+			Key:          aws.ToString(marker.Key),
+			VersionId:    aws.ToString(marker.VersionId),
+			IsLatest:     aws.ToBool(marker.IsLatest),
+			DeleteMarker: true,
+			LastModified: aws.ToTime(marker.LastModified),
+		})
+	}
+
+	// S3 lists the versions of a key newest first, but the order between both lists is lost
+	sort.SliceStable(versions, func(i, j int) bool {
+		if versions[i].Key != versions[j].Key {
+			return versions[i].Key < versions[j].Key
+		} else if versions[i].IsLatest != versions[j].IsLatest {
+			return versions[i].IsLatest
+		}
+		return versions[i].LastModified.After(versions[j].LastModified)
+	})
+
+	return
+}
+
+func (s3Helper *S3Helper) GetItemVersions(key string) ([]*S3ItemVersion, error) {
+	return s3Helper.GetItemVersionsWithContext(context.Background(), key)
+}
+
+// GetItemVersionsWithContext returns every version and delete marker of key, newest first.
+func (s3Helper *S3Helper) GetItemVersionsWithContext(ctx context.Context, key string) (versions []*S3ItemVersion, err error) {
+	versions = []*S3ItemVersion{}
+	for marker := (&S3VersionMarker{}); marker != nil; {
+		page, nextMarker, listErr := s3Helper.ListItemVersionsWithContext(ctx, key, marker)
+		if listErr != nil {
+			return nil, listErr
+		}
+		for _, version := range page {
+			// the prefix also matches longer keys
+			if version.Key == key {
+				versions = append(versions, version)
+			}
+		}
+		marker = nextMarker
+	}
+
+	return
+}
+
+func (s3Helper *S3Helper) GetItemVersion(key, versionId string) (item *S3Item, err error) {
+	return s3Helper.GetItemVersionWithContext(context.Background(), key, versionId)
+}
+
+// GetItemVersionWithContext opens a version of key. Every read of the item, including Seek, ReadAt and
+// DownloadTo, stays on that version. A version that is a delete marker cannot be read.
+func (s3Helper *S3Helper) GetItemVersionWithContext(ctx context.Context, key, versionId string) (*S3Item, error) {
+	if versionId == "" {
+		return nil, fmt.Errorf("no version to get for %s", key)
+	}
+
+	return s3Helper.GetItemWithOptions(ctx, key, &S3GetOptions{VersionId: versionId})
+}
+
+func (s3Helper *S3Helper) RestoreItemVersion(key, versionId string) (restoredVersionId string, err error) {
+	return s3Helper.RestoreItemVersionWithContext(context.Background(), key, versionId)
+}
+
+// RestoreItemVersionWithContext copies a version of key over the current one, which becomes the newest version.
+// Older versions are kept, so a restore can itself be undone. An empty versionId restores the previous version:
+// the newest one that is neither current nor a delete marker, which also undeletes a key whose latest version
+// is a delete marker. The restored version is returned.
+func (s3Helper *S3Helper) RestoreItemVersionWithContext(ctx context.Context, key, versionId string) (restoredVersionId string, err error) {
+	if versionId == "" {
+		versions, listErr := s3Helper.GetItemVersionsWithContext(ctx, key)
+		if listErr != nil {
+			return "", listErr
+		}
+		for _, version := range versions {
+			if !version.IsLatest && !version.DeleteMarker {
+				versionId = version.VersionId
+				break
+			}
+		}
+		if versionId == "" {
+			return "", fmt.Errorf("%s has no previous version to restore: %w", key, ErrObjectNotFound)
+		}
+	}
+
+	if err = s3Helper.CopyItemWithContext(ctx, key, key, &S3CopyOptions{SourceVersionId: versionId}); err == nil {
+		restoredVersionId = versionId
+	}
+
+	return
+}
+
+func (s3Helper *S3Helper) DeleteItemVersion(key, versionId string) (err error) {
+	return s3Helper.DeleteItemVersionWithContext(context.Background(), key, versionId)
+}
+
+// DeleteItemVersionWithContext permanently removes a version or a delete marker of key, which cannot be undone.
+// Removing the current version makes the previous one current, and removing a delete marker undeletes the key.
+// Unlike DeleteItem, versionId is required, so that no delete marker is added by mistake.
+func (s3Helper *S3Helper) DeleteItemVersionWithContext(ctx context.Context, key, versionId string) (err error) {
+	if versionId == "" {
+		return fmt.Errorf("no version to delete for %s", key)
+	}
+
+	callCtx, cancel := s3Helper.callContext(ctx)
+	defer cancel()
+
+	_, err = s3Helper.client.DeleteObject(callCtx, &s3.DeleteObjectInput{
+		Bucket:    aws.String(s3Helper.bucket),
+		Key:       aws.String(key),
+		VersionId: aws.String(versionId),
+	})
+
+	return
+}
+
+func (s3Helper *S3Helper) DeleteItemVersions(versions []*S3ItemVersion) (*S3DeleteResult, error) {
+	return s3Helper.DeleteItemVersionsWithContext(context.Background(), versions, nil)
+}
+
+// DeleteItemVersionsWithContext permanently removes versions, e.g. a filtered page of ListItemVersions,
+// with DeleteObjects like DeleteItems.
+func (s3Helper *S3Helper) DeleteItemVersionsWithContext(ctx context.Context, versions []*S3ItemVersion, options *S3DeleteOptions) (*S3DeleteResult, error) {
+	identifiers := make([]types.ObjectIdentifier, 0, len(versions))
+	for _, version := range versions {
+		identifiers = append(identifiers, types.ObjectIdentifier{Key: aws.String(version.Key), VersionId: aws.String(version.VersionId)})
+	}
+
+	return s3Helper.deleteObjects(ctx, identifiers, options)
+}
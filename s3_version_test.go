@@ -0,0 +1,129 @@
+package awssdkhelper
+
+import (
+	"context"
+	"errors"
+	"io"
+	"testing"
+
+	TestUtility "github.com/thcomp/GoLang_TestUtility"
+)
+
+func Test_S3Helper_ListItemVersions(t *testing.T) {
+	tester := TestUtility.NewTestHelper(t)
+	fake := newFakeS3Server(t, "version-bucket")
+	fake.versioned = true
+	helper := fake.helper()
+
+	for _, content := range []string{"first", "second", "third"} {
+		fake.putObject("doc.txt", []byte(content))
+	}
+	fake.putObject("doc.txt.bak", []byte("backup"))
+	err := helper.DeleteItem("doc.txt.bak")
+	tester.Fatalf(err == nil, "DeleteItem: %v", err)
+
+	versions, nextMarker, err := helper.ListItemVersions("doc", nil)
+	tester.Fatalf(err == nil && nextMarker == nil, "ListItemVersions: %v, %v", nextMarker, err)
+	tester.Fatalf(len(versions) == 5, "versions: %d", len(versions))
+	tester.Errorf(versions[0].Key == "doc.txt" && versions[0].IsLatest && versions[0].VersionId == "v3" && versions[0].Size == 5, "latest version: %+v", versions[0])
+	tester.Errorf(versions[2].VersionId == "v1" && !versions[2].IsLatest, "oldest version: %+v", versions[2])
+	tester.Errorf(versions[3].Key == "doc.txt.bak" && versions[3].IsLatest && versions[3].DeleteMarker, "delete marker: %+v", versions[3])
+
+	versions, err = helper.GetItemVersions("doc.txt")
+	tester.Errorf(err == nil && len(versions) == 3, "versions of a key: %d, %v", len(versions), err)
+
+	// pages of 2 versions
+	fake.versionPageSize = 2
+	listed := 0
+	for marker := (&S3VersionMarker{}); marker != nil; {
+		page, nextMarker, err := helper.ListItemVersions("doc", marker)
+		tester.Fatalf(err == nil && len(page) <= 2, "page: %d, %v", len(page), err)
+		listed, marker = listed+len(page), nextMarker
+	}
+	tester.Errorf(listed == 5, "listed by pages: %d", listed)
+}
+
+func Test_S3Helper_GetItemVersion(t *testing.T) {
+	tester := TestUtility.NewTestHelper(t)
+	fake := newFakeS3Server(t, "version-bucket")
+	fake.versioned = true
+	helper := fake.helper()
+
+	fake.putObject("doc.txt", []byte("first content"))
+	fake.putObject("doc.txt", []byte("second"))
+
+	item, err := helper.GetItemVersion("doc.txt", "v1")
+	tester.Fatalf(err == nil, "GetItemVersion: %v", err)
+	data, err := io.ReadAll(item)
+	tester.Errorf(err == nil && string(data) == "first content", "version content: %q, %v", data, err)
+
+	_, err = item.Seek(6, io.SeekStart)
+	tester.Fatalf(err == nil, "Seek: %v", err)
+	data, err = io.ReadAll(item)
+	tester.Errorf(err == nil && string(data) == "content", "content after Seek: %q, %v", data, err)
+	buffer := make([]byte, 5)
+	_, err = item.ReadAt(buffer, 0)
+	tester.Errorf(err == nil && string(buffer) == "first", "ReadAt: %q, %v", buffer, err)
+	attributes, err := item.Stat()
+	tester.Errorf(err == nil && attributes.VersionId == "v1", "attributes: %v", err)
+	item.Close()
+
+	_, err = helper.GetItemVersion("doc.txt", "v9")
+	tester.Errorf(errors.Is(err, ErrObjectNotFound), "missing version: %v", err)
+}
+
+func Test_S3Helper_RestoreItemVersion(t *testing.T) {
+	tester := TestUtility.NewTestHelper(t)
+	fake := newFakeS3Server(t, "version-bucket")
+	fake.versioned = true
+	helper := fake.helper()
+	ctx := context.Background()
+
+	fake.putObject("doc.txt", []byte("first"))
+	fake.putObject("doc.txt", []byte("second"))
+	fake.putObject("doc.txt", []byte("third"))
+
+	restored, err := helper.RestoreItemVersionWithContext(ctx, "doc.txt", "v1")
+	tester.Fatalf(err == nil && restored == "v1", "RestoreItemVersion: %s, %v", restored, err)
+	tester.Errorf(string(fake.object("doc.txt").data) == "first" && len(fake.versions["version-bucket"]["doc.txt"]) == 4, "current after restore: %q", fake.object("doc.txt").data)
+
+	restored, err = helper.RestoreItemVersionWithContext(ctx, "doc.txt", "")
+	tester.Fatalf(err == nil && restored == "v3", "restore of the previous version: %s, %v", restored, err)
+	tester.Errorf(string(fake.object("doc.txt").data) == "third", "current after restoring the previous version: %q", fake.object("doc.txt").data)
+
+	// a deleted key is restored from its newest version
+	err = helper.DeleteItemWithContext(ctx, "doc.txt")
+	tester.Fatalf(err == nil && fake.object("doc.txt") == nil, "DeleteItem: %v", err)
+	restored, err = helper.RestoreItemVersionWithContext(ctx, "doc.txt", "")
+	tester.Errorf(err == nil && string(fake.object("doc.txt").data) == "third", "undelete: %s, %v", restored, err)
+
+	fake.putObject("new.txt", []byte("only"))
+	_, err = helper.RestoreItemVersionWithContext(ctx, "new.txt", "")
+	tester.Errorf(errors.Is(err, ErrObjectNotFound), "restore without previous version: %v", err)
+}
+
+func Test_S3Helper_DeleteItemVersion(t *testing.T) {
+	tester := TestUtility.NewTestHelper(t)
+	fake := newFakeS3Server(t, "version-bucket")
+	fake.versioned = true
+	helper := fake.helper()
+
+	fake.putObject("doc.txt", []byte("first"))
+	fake.putObject("doc.txt", []byte("second"))
+
+	err := helper.DeleteItemVersion("doc.txt", "v2")
+	tester.Fatalf(err == nil, "DeleteItemVersion: %v", err)
+	tester.Errorf(string(fake.object("doc.txt").data) == "first" && len(fake.versions["version-bucket"]["doc.txt"]) == 1, "current after deleting the latest version: %q", fake.object("doc.txt").data)
+
+	err = helper.DeleteItemVersion("doc.txt", "")
+	tester.Errorf(err != nil && fake.object("doc.txt") != nil, "delete without version: %v", err)
+
+	err = helper.DeleteItem("doc.txt")
+	tester.Fatalf(err == nil, "DeleteItem: %v", err)
+	versions, err := helper.GetItemVersions("doc.txt")
+	tester.Fatalf(err == nil && len(versions) == 2 && versions[0].DeleteMarker, "versions: %v", err)
+
+	result, err := helper.DeleteItemVersions(versions)
+	tester.Errorf(err == nil && len(result.Deleted) == 2, "DeleteItemVersions: %v", err)
+	tester.Errorf(fake.object("doc.txt") == nil && len(fake.versions["version-bucket"]["doc.txt"]) == 0, "versions left: %d", len(fake.versions["version-bucket"]["doc.txt"]))
+}
@@ -0,0 +1,168 @@
+package awssdkhelper
+
+import (
+	"context"
+	"iter"
+	"path"
+	"regexp"
+	"strings"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/s3"
+	"github.com/aws/aws-sdk-go-v2/service/s3/types"
+)
+
+type S3WalkOptions struct {
+	// MaxDepth limits the depth below the prefix: 1 yields only direct children. 0 means unlimited.
+	MaxDepth int
+	// IncludeDirs also yields the sub-prefixes ("directories") as items with IsDir set.
+	IncludeDirs bool
+	// Glob filters objects with path.Match. A pattern without "/" matches the base name,
+	// otherwise the key relative to the prefix, e.g. "*.json" or "2024/*/report-*.csv".
+	Glob string
+	// Regexp filters objects by their full key.
+	Regexp *regexp.Regexp
+	// ModifiedSince skips objects last modified before the time.
+	ModifiedSince time.Time
+	// PageSize is the number of keys requested per ListObjectsV2 call. Defaults to 1000.
+	PageSize int32
+}
+
+type s3Walker struct {
+	helper  *S3Helper
+	prefix  string
+	options S3WalkOptions
+}
+
+// Walk lists every object under prefix lazily, one ListObjectsV2 page at a time. Pages are only fetched while
+// the caller keeps iterating, so breaking out of the loop stops the listing. Without MaxDepth and IncludeDirs
+// keys are yielded in lexicographic order; otherwise the objects of a prefix come before its sub-prefixes.
+// An error is yielded once and ends the walk.
+//
+//	for item, err := range helper.Walk(ctx, "logs/", &S3WalkOptions{Glob: "*.gz"}) { ... }
+func (s3Helper *S3Helper) Walk(ctx context.Context, prefix string, options *S3WalkOptions) iter.Seq2[*S3Item, error] {
+	walker := &s3Walker{
+		helper: s3Helper,
+		prefix: prefix,
+	}
+	if options != nil {
+		walker.options = *options
+	}
+
+	return func(yield func(*S3Item, error) bool) {
+		if walker.options.Glob != "" {
+			if _, err := path.Match(walker.options.Glob, ""); err != nil {
+				yield(nil, err)
+				return
+			}
+		}
+
+		if walker.options.MaxDepth <= 0 && !walker.options.IncludeDirs {
+			walker.walkPrefix(ctx, prefix, "", 1, yield)
+		} else {
+			walker.walkPrefix(ctx, prefix, "/", 1, yield)
+		}
+	}
+}
+
+// walkPrefix returns false once the walk has to stop, because of an error or the caller.
+func (walker *s3Walker) walkPrefix(ctx context.Context, prefix string, delimiter string, depth int, yield func(*S3Item, error) bool) bool {
+	input := &s3.ListObjectsV2Input{
+		Bucket: aws.String(walker.helper.bucket),
+		Prefix: aws.String(prefix),
+	}
+	if delimiter != "" {
+		input.Delimiter = aws.String(delimiter)
+	}
+	if walker.options.PageSize > 0 {
+		input.MaxKeys = aws.Int32(walker.options.PageSize)
+	}
+
+	paginator := s3.NewListObjectsV2Paginator(walker.helper.client, input)
+	for paginator.HasMorePages() {
+		callCtx, cancel := walker.helper.callContext(ctx)
+		output, err := paginator.NextPage(callCtx)
+		cancel()
+		if err != nil {
+			yield(nil, err)
+			return false
+		}
+
+		for _, content := range output.Contents {
+			key := aws.ToString(content.Key)
+			if key == prefix || (delimiter == "" && strings.HasSuffix(key, "/")) || !walker.match(content) {
+				// the placeholder of the listed prefix itself is listed as a sub-prefix of its parent,
+				// and placeholders are no objects without IncludeDirs
+				continue
+			}
+			if !yield(walker.helper.newS3ItemFromObject(ctx, content), nil) {
+				return false
+			}
+		}
+
+		for _, commonPrefix := range output.CommonPrefixes {
+			subPrefix := aws.ToString(commonPrefix.Prefix)
+			if walker.options.IncludeDirs {
+				if !yield(&S3Item{IsDir: true, Path: subPrefix, helper: walker.helper, ctx: ctx}, nil) {
+					return false
+				}
+			}
+			if walker.options.MaxDepth <= 0 || depth < walker.options.MaxDepth {
+				if !walker.walkPrefix(ctx, subPrefix, delimiter, depth+1, yield) {
+					return false
+				}
+			}
+		}
+	}
+
+	return true
+}
+
+func (walker *s3Walker) match(content types.Object) bool {
+	key := aws.ToString(content.Key)
+
+	if walker.options.Glob != "" && !matchS3Glob(walker.options.Glob, strings.TrimPrefix(key[len(walker.prefix):], "/")) {
+		return false
+	}
+	if walker.options.Regexp != nil && !walker.options.Regexp.MatchString(key) {
+		return false
+	}
+	if !walker.options.ModifiedSince.IsZero() && (content.LastModified == nil || content.LastModified.Before(walker.options.ModifiedSince)) {
+		return false
+	}
+
+	return true
+}
+
+// matchS3Glob matches a pattern without "/" against the base name, otherwise against the whole relative key.
+func matchS3Glob(pattern string, relativeKey string) (matched bool) {
+	if !strings.Contains(pattern, "/") {
+		relativeKey = path.Base(relativeKey)
+	}
+	matched, _ = path.Match(pattern, relativeKey)
+
+	return
+}
+
+func (s3Helper *S3Helper) newS3ItemFromObject(ctx context.Context, content types.Object) *S3Item {
+	key := aws.ToString(content.Key)
+
+	item := &S3Item{
+		// "folder" placeholder objects created by the console end with "/"
+		IsDir:        strings.HasSuffix(key, "/"),
+		Path:         key,
+		size:         content.Size,
+		lastModified: content.LastModified,
+		etag:         content.ETag,
+		helper:       s3Helper,
+		ctx:          ctx,
+	}
+	if s3Helper.decompression && !item.IsDir {
+		// only the Content-Encoding tells whether the object is read decompressed, and the listed size is
+		// the stored one: both are loaded by a HEAD when first needed
+		item.size = nil
+	}
+
+	return item
+}
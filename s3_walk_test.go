@@ -0,0 +1,131 @@
+package awssdkhelper
+
+import (
+	"context"
+	"errors"
+	"regexp"
+	"strings"
+	"testing"
+	"time"
+
+	TestUtility "github.com/thcomp/GoLang_TestUtility"
+)
+
+func newTestWalkTree(t *testing.T) (*fakeS3Server, *S3Helper) {
+	fake := newFakeS3Server(t, "walk-bucket")
+	for _, key := range []string{
+		"root/a.txt",
+		"root/b.json",
+		"root/dir1/c.json",
+		"root/dir1/sub/d.json",
+		"root/dir1/sub/deep/e.txt",
+		"root/dir2/f.txt",
+		"other/g.txt",
+		// "folder" placeholders, listed as sub-prefixes too
+		"root/",
+		"root/dir1/",
+		"root/dir1/sub/",
+	} {
+		fake.putObject(key, []byte(key))
+	}
+
+	return fake, fake.helper()
+}
+
+func collectWalk(ctx context.Context, helper *S3Helper, prefix string, options *S3WalkOptions) (paths []string, err error) {
+	for item, walkErr := range helper.Walk(ctx, prefix, options) {
+		if walkErr != nil {
+			return paths, walkErr
+		}
+		if item.IsDir {
+			paths = append(paths, item.Path+"(dir)")
+		} else {
+			paths = append(paths, item.Path)
+		}
+	}
+
+	return
+}
+
+func Test_S3Helper_Walk(t *testing.T) {
+	tester := TestUtility.NewTestHelper(t)
+	fake, helper := newTestWalkTree(t)
+
+	paths, err := collectWalk(context.Background(), helper, "root/", &S3WalkOptions{PageSize: 2})
+	tester.Errorf(err == nil && strings.Join(paths, ",") == "root/a.txt,root/b.json,root/dir1/c.json,root/dir1/sub/d.json,root/dir1/sub/deep/e.txt,root/dir2/f.txt", "all: %v, %v", paths, err)
+
+	paths, err = collectWalk(context.Background(), helper, "root/", &S3WalkOptions{MaxDepth: 1, IncludeDirs: true, PageSize: 2})
+	tester.Errorf(err == nil && strings.Join(paths, ",") == "root/a.txt,root/b.json,root/dir1/(dir),root/dir2/(dir)", "depth 1: %v, %v", paths, err)
+
+	paths, err = collectWalk(context.Background(), helper, "root/", &S3WalkOptions{MaxDepth: 2})
+	tester.Errorf(err == nil && strings.Join(paths, ",") == "root/a.txt,root/b.json,root/dir1/c.json,root/dir2/f.txt", "depth 2: %v, %v", paths, err)
+
+	paths, err = collectWalk(context.Background(), helper, "root/", &S3WalkOptions{Glob: "*.json"})
+	tester.Errorf(err == nil && strings.Join(paths, ",") == "root/b.json,root/dir1/c.json,root/dir1/sub/d.json", "glob *.json: %v, %v", paths, err)
+
+	paths, err = collectWalk(context.Background(), helper, "root/", &S3WalkOptions{Glob: "dir1/*/*.json"})
+	tester.Errorf(err == nil && strings.Join(paths, ",") == "root/dir1/sub/d.json", "glob dir1/*/*.json: %v, %v", paths, err)
+
+	paths, err = collectWalk(context.Background(), helper, "", &S3WalkOptions{Regexp: regexp.MustCompile(`/[a-z]\.txt$`)})
+	tester.Errorf(err == nil && strings.Join(paths, ",") == "other/g.txt,root/a.txt,root/dir1/sub/deep/e.txt,root/dir2/f.txt", "regexp: %v, %v", paths, err)
+
+	_, err = collectWalk(context.Background(), helper, "root/", &S3WalkOptions{Glob: "["})
+	tester.Errorf(err != nil, "a bad glob is accepted")
+
+	old := time.Now().Add(-48 * time.Hour)
+	for _, key := range []string{"root/a.txt", "root/dir1/c.json"} {
+		fake.object(key).lastModified = old
+	}
+	paths, err = collectWalk(context.Background(), helper, "root/", &S3WalkOptions{ModifiedSince: time.Now().Add(-time.Hour)})
+	tester.Errorf(err == nil && len(paths) == 4 && !strings.Contains(strings.Join(paths, ","), "a.txt"), "modified since: %v, %v", paths, err)
+}
+
+func Test_S3Helper_WalkEarlyTermination(t *testing.T) {
+	tester := TestUtility.NewTestHelper(t)
+	fake, helper := newTestWalkTree(t)
+
+	fake.listRequests = 0
+	count := 0
+	for _, err := range helper.Walk(context.Background(), "", &S3WalkOptions{PageSize: 1}) {
+		tester.Fatalf(err == nil, "Walk: %v", err)
+		if count++; count == 2 {
+			break
+		}
+	}
+	// the placeholder "root/" is skipped, but takes a page of its own
+	tester.Errorf(fake.listRequests == 3, "pages fetched after break: %d", fake.listRequests)
+
+	missing := &S3Helper{bucket: "missing-bucket", client: fake.client()}
+	errCount := 0
+	for item, err := range missing.Walk(context.Background(), "", nil) {
+		tester.Errorf(item == nil && err != nil, "walk of a missing bucket: %v, %v", item, err)
+		errCount++
+	}
+	tester.Errorf(errCount == 1, "errors yielded: %d", errCount)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	_, err := collectWalk(ctx, helper, "", nil)
+	tester.Errorf(errors.Is(err, context.Canceled), "walk with a canceled context: %v", err)
+}
+
+func Test_S3Helper_ListItemsRecursive(t *testing.T) {
+	tester := TestUtility.NewTestHelper(t)
+	_, helper := newTestWalkTree(t)
+
+	items, next, err := helper.ListItems("root/*", nil)
+	tester.Fatalf(err == nil && next == nil, "ListItems: %v, %v", next, err)
+
+	paths := []string{}
+	for _, item := range items {
+		if item.IsDir {
+			paths = append(paths, item.Path+"(dir)")
+		} else {
+			paths = append(paths, item.Path)
+		}
+	}
+	tester.Errorf(strings.Join(paths, ",") == "root/a.txt,root/b.json,root/dir1/(dir),root/dir1/c.json,root/dir1/sub/(dir),root/dir1/sub/d.json,root/dir1/sub/deep/(dir),root/dir1/sub/deep/e.txt,root/dir2/(dir),root/dir2/f.txt", "ListItems: %v", paths)
+
+	walked, err := collectWalk(context.Background(), helper, "root/dir1/", &S3WalkOptions{IncludeDirs: true})
+	tester.Errorf(err == nil && strings.Join(walked, ",") == "root/dir1/c.json,root/dir1/sub/(dir),root/dir1/sub/d.json,root/dir1/sub/deep/(dir),root/dir1/sub/deep/e.txt", "Walk with placeholders: %v, %v", walked, err)
+}
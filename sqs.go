@@ -6,8 +6,6 @@ import (
 	"strings"
 
 	"github.com/aws/aws-sdk-go-v2/aws"
-	"github.com/aws/aws-sdk-go-v2/config"
-	"github.com/aws/aws-sdk-go-v2/credentials"
 	"github.com/aws/aws-sdk-go-v2/service/sqs"
 	"github.com/rs/xid"
 
@@ -22,41 +20,39 @@ type SQSHelper struct {
 	nextMessageDeduplicationId *string
 }
 
+// NewSQSHelperWithRole returns a helper with the default credential chain, or nil when the configuration cannot be loaded.
 func NewSQSHelperWithRole(queueURL, region string) (ret *SQSHelper) {
-	if sdkConfig, err := config.LoadDefaultConfig(
-		context.Background(),
-		config.WithRegion(region),
-	); err == nil {
-		ret = &SQSHelper{
-			queueURL: queueURL,
-			client:   sqs.NewFromConfig(sdkConfig),
-			fifo:     strings.HasSuffix(queueURL, ".fifo"),
-		}
-	}
+	ret, _ = NewSQSHelperWithConfig(context.Background(), queueURL, WithAWSRegion(region))
 
 	return ret
 }
 
+// NewSQSHelperWithIAM returns a helper with static keys, or nil when the configuration cannot be loaded.
 func NewSQSHelperWithIAM(queueURL, region, accessKeyId, secretAccessKey string) (ret *SQSHelper) {
-	if sdkConfig, err := config.LoadDefaultConfig(
+	ret, _ = NewSQSHelperWithConfig(
 		context.Background(),
-		config.WithRegion(region),
-		config.WithCredentialsProvider(
-			credentials.NewStaticCredentialsProvider(
-				accessKeyId,
-				secretAccessKey,
-				``,
-			),
-		),
-	); err == nil {
+		queueURL,
+		WithAWSRegion(region),
+		WithAWSStaticCredentials(accessKeyId, secretAccessKey, ``),
+	)
+
+	return ret
+}
+
+// NewSQSHelperWithConfig returns a helper of queueURL with the configuration of options,
+// e.g. WithAWSProfile or WithAWSAssumeRole, and the default credential chain otherwise.
+func NewSQSHelperWithConfig(ctx context.Context, queueURL string, options ...AWSConfigOption) (ret *SQSHelper, err error) {
+	if sdkConfig, loadErr := NewAWSConfig(ctx, options...); loadErr == nil {
 		ret = &SQSHelper{
 			queueURL: queueURL,
 			client:   sqs.NewFromConfig(sdkConfig),
 			fifo:     strings.HasSuffix(queueURL, ".fifo"),
 		}
+	} else {
+		err = loadErr
 	}
 
-	return ret
+	return
 }
 
 func (helper *SQSHelper) SetMessageGroupID(messageGroupID string) (ret bool) {